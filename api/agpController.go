@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the Ambulatory Glucose Profile of a patient
+// @Description Get the AGP of a patient computed from the cbg: the 5th, 25th, 50th, 75th & 95th percentiles by time of day slot
+// @Description (using the local time of each sample), the mean glucose, GMI, coefficient of variation and % of CGM active time.
+// @ID tide-whisperer-api-v1-getagp
+// @Produce json
+// @Success 200 {object} usecase.AgpResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to compute the AGP for"
+// @Param startDate query string false "ISO Date time (RFC3339) for the window lower limit, default to endDate - 14 days" format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for the window upper limit, default to now" format(date-time)
+// @Param slotMinutes query int false "Duration of the time of day slots in minutes, default to 15. Must divide a day."
+// @Param bgUnit query string false "The blood glucose unit of the result, can be mmol/L or mg/dL (default)."
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/agp/{userID} [get]
+func (a *API) getAgp(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	slotMinutes := 0
+	if value := query.Get("slotMinutes"); value != "" {
+		var err error
+		if slotMinutes, err = strconv.Atoi(value); err != nil || slotMinutes <= 0 {
+			return res.WriteError(&common.DetailedError{
+				Status:          errorInvalidParameters.Status,
+				Code:            errorInvalidParameters.Code,
+				Message:         errorInvalidParameters.Message,
+				InternalMessage: fmt.Sprintf("invalid slotMinutes %q", value),
+			})
+		}
+	}
+	agp, err := a.patientData.GetAgp(ctx, usecase.GetAgpArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+		StartDate:    query.Get("startDate"),
+		EndDate:      query.Get("endDate"),
+		SlotMinutes:  slotMinutes,
+		BgUnit:       query.Get("bgUnit"),
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, agp)
+}
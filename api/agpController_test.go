@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getAgp(t *testing.T) {
+	tests := []struct {
+		name               string
+		givenQuery         string
+		expectedStatusCode int
+		expectedSlot       int
+	}{
+		{"Default slots", "startDate=2023-04-01T00:00:00Z", http.StatusOK, 0},
+		{"30 minutes slots", "slotMinutes=30", http.StatusOK, 30},
+		{"Invalid slots", "slotMinutes=abc", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetAgp", mock.Anything, mock.Anything).Return(&usecase.AgpResult{UserID: "abcdef"}, nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/agp/abcdef?"+tt.givenQuery, nil)
+			res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+			err := api.getAgp(context.Background(), res)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedStatusCode == http.StatusOK {
+				mockPatientData.AssertCalled(t, "GetAgp", mock.Anything, mock.MatchedBy(func(args usecase.GetAgpArgs) bool {
+					return args.UserID == "abcdef" && args.SlotMinutes == tt.expectedSlot
+				}))
+			} else {
+				mockPatientData.AssertNotCalled(t, "GetAgp", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/mdblp/go-common/clients/auth"
+	"github.com/mdblp/shoreline/token"
 	tideV2Client "github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
 	"github.com/tidepool-org/go-common/clients/opa"
 	"github.com/tidepool-org/go-common/clients/status"
@@ -26,35 +27,53 @@ type (
 		databaseAdapter  usecase.DatabaseAdapter
 		authClient       auth.ClientInterface
 		perms            opa.Client
-		schemaVersion    common.SchemaVersion
 		logger           *log.Logger
 		tideV2Client     tideV2Client.ClientInterface
+		// streams one element per opened data stream, to limit their number
+		streams chan struct{}
+		// streamPath the path prefix of the data streams, see CompressHandler()
+		streamPath string
 	}
 )
 
 const (
 	// DataAPIPrefix logging prefix
 	DataAPIPrefix = "api/data "
+
+	jsonContentType   = "application/json"
+	ndjsonContentType = "application/x-ndjson"
+
+	// maxDataLimit maximum number of data per page
+	maxDataLimit = 10000
+
+	// syncTokenHeader response header of the token of the next incremental sync
+	syncTokenHeader = "X-Tidepool-Sync-Token"
+
+	// clinicianRole the role of the clinician tokens
+	clinicianRole = "hcp"
 )
 
 var (
-	errorStatusCheck      = common.DetailedError{Status: http.StatusInternalServerError, Code: "data_status_check", Message: "checking of the status endpoint showed an error"}
-	errorNoViewPermission = common.DetailedError{Status: http.StatusForbidden, Code: "data_cant_view", Message: "user is not authorized to view data"}
-	errorRunningQuery     = common.DetailedError{Status: http.StatusInternalServerError, Code: "data_store_error", Message: "internal server error"}
-	errorLoadingEvents    = common.DetailedError{Status: http.StatusInternalServerError, Code: "json_marshal_error", Message: "internal server error"}
-	errorNotfound         = common.DetailedError{Status: http.StatusNotFound, Code: "data_not_found", Message: "no data for specified user"}
+	errorStatusCheck       = common.DetailedError{Status: http.StatusInternalServerError, Code: "data_status_check", Message: "checking of the status endpoint showed an error"}
+	errorNoViewPermission  = common.DetailedError{Status: http.StatusForbidden, Code: "data_cant_view", Message: "user is not authorized to view data"}
+	errorRunningQuery      = common.DetailedError{Status: http.StatusInternalServerError, Code: "data_store_error", Message: "internal server error"}
+	errorLoadingEvents     = common.DetailedError{Status: http.StatusInternalServerError, Code: "json_marshal_error", Message: "internal server error"}
+	errorNotfound          = common.DetailedError{Status: http.StatusNotFound, Code: "data_not_found", Message: "no data for specified user"}
+	errorInvalidParameters = common.DetailedError{Status: http.StatusBadRequest, Code: "invalid_parameters", Message: "one or more parameters are invalid"}
+	errorServerOnly        = common.DetailedError{Status: http.StatusForbidden, Code: "data_server_only", Message: "parameter reserved to the server tokens"}
 )
 
-func InitAPI(exportController ExportController, patientDataUC PatientDataUseCase, dbAdapter usecase.DatabaseAdapter, auth auth.ClientInterface, permsClient opa.Client, schemaV common.SchemaVersion, logger *log.Logger, V2Client tideV2Client.ClientInterface) *API {
+func InitAPI(exportController ExportController, patientDataUC PatientDataUseCase, dbAdapter usecase.DatabaseAdapter, auth auth.ClientInterface, permsClient opa.Client, logger *log.Logger, V2Client tideV2Client.ClientInterface) *API {
+	exportController.authClient = auth
 	return &API{
 		exportController: exportController,
 		patientData:      patientDataUC,
 		databaseAdapter:  dbAdapter,
 		authClient:       auth,
 		perms:            permsClient,
-		schemaVersion:    schemaV,
 		logger:           logger,
 		tideV2Client:     V2Client,
+		streams:          make(chan struct{}, DefaultMaxStreams),
 	}
 }
 
@@ -73,6 +92,21 @@ func (a *API) setHandlers(prefix string, rtr *mux.Router) {
 	rtr.HandleFunc(prefix+"/range/{userID}", a.middleware(a.getRangeLegacy, true, "userID")).Methods(http.MethodGet)
 	rtr.HandleFunc(prefix+"/data/{userID}", a.middleware(a.getData, true, "userID")).Methods(http.MethodGet)
 	rtr.HandleFunc(prefix+"/dataV2/{userID}", a.middleware(a.getDataV2, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/summary/{userID}", a.middleware(a.getSummary, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/agp/{userID}", a.middleware(a.getAgp, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/tir/{userID}", a.middleware(a.getTimeInRange, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/insulin/{userID}", a.middleware(a.getInsulin, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/events/glycemic/{userID}", a.middleware(a.getGlycemicEvents, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/latest/{userID}", a.middleware(a.getLatestData, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/uploads/{userID}", a.middleware(a.getUploads, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/uploads/{userID}/{uploadID}/data", a.middleware(a.getDataInUpload, true, "userID", "uploadID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/devices/{userID}", a.middleware(a.getDevices, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/parameters/{userID}", a.middleware(a.getParametersHistory, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/parameters/{userID}/compare", a.middleware(a.compareParameters, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+"/basalsecurity/{userID}", a.middleware(a.getBasalSecurityProfiles, true, "userID")).Methods(http.MethodGet)
+	a.streamPath = prefix + "/stream/"
+	rtr.HandleFunc(a.streamPath+"{userID}", a.middleware(a.getStream, true, "userID")).Methods(http.MethodGet)
+	rtr.HandleFunc(prefix+batchDataRoute, a.middleware(a.postBatchData, false)).Methods(http.MethodPost)
 	rtr.HandleFunc(prefix+"/{.*}", a.middleware(a.getNotFound, false)).Methods(http.MethodGet)
 }
 
@@ -119,11 +153,74 @@ func (a *API) jsonError(res http.ResponseWriter, err common.DetailedError, start
 	res.Write(jsonErr)
 }
 
+// writeJSONResult marshal the result of a middleware handler
+func writeJSONResult(res *common.HttpResponseWriter, result interface{}) error {
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		return res.WriteError(&common.DetailedError{
+			Status:          http.StatusInternalServerError,
+			Code:            "json_marshall_error",
+			Message:         "internal server error",
+			InternalMessage: err.Error(),
+		})
+	}
+	return res.Write(jsonResult)
+}
+
 func (a *API) logError(err *common.DetailedError, startedAt time.Time) {
 	err.ID = uuid.New().String()
 	a.logger.Println(DataAPIPrefix, fmt.Sprintf("[%s][%s] failed after [%.3f]secs with error [%s][%s] ", err.ID, err.Code, time.Since(startedAt).Seconds(), err.Message, err.InternalMessage))
 }
 
+// getTokenData returns the token data of the request credentials, nil when they are not valid.
+// The request is already authorized by the middleware, only use it for the parameters reserved to some tokens.
+func getTokenData(ctx context.Context, authClient auth.ClientInterface, res *common.HttpResponseWriter) *token.TokenData {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, res.URL.String(), nil)
+	req.Header = res.Header
+	return authClient.Authenticate(req)
+}
+
+// getParameterLevels returns the device parameter levels of the parameterLevels parameter, nil when it is not set,
+// and whether the request is made with a server or clinician token, allowed to request the levels which are not configured
+func getParameterLevels(ctx context.Context, authClient auth.ClientInterface, res *common.HttpResponseWriter) ([]int, bool, *common.DetailedError) {
+	query := res.URL.Query()
+	if !query.Has("parameterLevels") {
+		return nil, false, nil
+	}
+	levels, err := usecase.ParseParameterLevels(query.Get("parameterLevels"))
+	if err != nil || len(levels) == 0 {
+		internalMessage := "empty parameterLevels"
+		if err != nil {
+			internalMessage = err.Error()
+		}
+		return nil, false, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: internalMessage,
+		}
+	}
+	return levels, isTrustedToken(ctx, authClient, res), nil
+}
+
+// isTrustedToken returns true when the request is made with a server or clinician token
+func isTrustedToken(ctx context.Context, authClient auth.ClientInterface, res *common.HttpResponseWriter) bool {
+	tokenData := getTokenData(ctx, authClient, res)
+	return tokenData != nil && (tokenData.IsServer || tokenData.Role == clinicianRole)
+}
+
+// getAllSchemaVersions returns true when a server token requests the data of all the schema versions
+// (allSchemaVersions=true), instead of the range configured in the use case
+func (a *API) getAllSchemaVersions(ctx context.Context, res *common.HttpResponseWriter) (bool, *common.DetailedError) {
+	if res.URL.Query().Get("allSchemaVersions") != "true" {
+		return false, nil
+	}
+	if tokenData := getTokenData(ctx, a.authClient, res); tokenData == nil || !tokenData.IsServer {
+		return false, &errorServerOnly
+	}
+	return true, nil
+}
+
 func (a *API) isAuthorized(req *http.Request, targetUserIDs []string) bool {
 	td := a.authClient.Authenticate(req)
 	if td == nil {
@@ -18,16 +18,11 @@ import (
 	"github.com/tidepool-org/go-common/clients/opa"
 	"github.com/tidepool-org/go-common/clients/status"
 	"github.com/tidepool-org/go-common/clients/version"
-	"github.com/tidepool-org/tide-whisperer/common"
 	"github.com/tidepool-org/tide-whisperer/infrastructure"
 	"github.com/tidepool-org/tide-whisperer/usecase"
 )
 
 var (
-	schemaVersions = common.SchemaVersion{
-		Maximum: 99,
-		Minimum: 1,
-	}
 	logger                = log.New(os.Stdout, "api-test", log.LstdFlags|log.Lshortfile)
 	dbAdapter             = infrastructure.NewMockDbAdapter()
 	patientDataRepository = infrastructure.NewMockPatientDataRepository()
@@ -35,7 +30,7 @@ var (
 	mockPerms             = opa.NewMock()
 	mockTideV2            = twV2Client.NewMock()
 	patientDataUC         = usecase.NewPatientDataUseCase(logger, mockTideV2, patientDataRepository, false)
-	api                   = InitAPI(ExportController{}, patientDataUC, dbAdapter, mockAuth, mockPerms, schemaVersions, logger, mockTideV2)
+	api                   = InitAPI(ExportController{}, patientDataUC, dbAdapter, mockAuth, mockPerms, logger, mockTideV2)
 	rtr                   = mux.NewRouter()
 )
 
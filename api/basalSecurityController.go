@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the basal security profiles history of a patient
+// @Description Get the basal security profiles applied during a window, in time order, the one in effect at the beginning of the window included.
+// @Description Each profile applies until its endTime, the time of the next one.
+// @ID tide-whisperer-api-v1-getbasalsecurityprofiles
+// @Produce json
+// @Success 200 {array} dto.Profile
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param startDate query string false "ISO Date time (RFC3339) for search lower limit. Default is the first profile." format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for search upper limit. Default is now." format(date-time)
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/basalsecurity/{userID} [get]
+func (a *API) getBasalSecurityProfiles(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	profiles, err := a.patientData.GetBasalSecurityProfiles(ctx, usecase.GetBasalSecurityProfilesArgs{
+		UserID:    res.VARS["userID"],
+		TraceID:   res.TraceID,
+		StartDate: query.Get("startDate"),
+		EndDate:   query.Get("endDate"),
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, profiles)
+}
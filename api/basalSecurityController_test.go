@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/api/dto"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getBasalSecurityProfiles(t *testing.T) {
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetBasalSecurityProfiles", mock.Anything, mock.MatchedBy(func(args usecase.GetBasalSecurityProfilesArgs) bool {
+		return args.UserID == "abcdef" && args.StartDate == "2023-01-01T00:00:00Z" && args.EndDate == ""
+	})).Return([]*dto.Profile{
+		{Type: "basalSecurity", Time: start, Guid: "p1", BasalSchedule: []dto.Schedule{{Rate: 1, Start: 0, End: 0}}, EndTime: &end},
+		{Type: "basalSecurity", Time: end, Guid: "p2"},
+	}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/basalsecurity/abcdef?startDate=2023-01-01T00:00:00Z", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getBasalSecurityProfiles(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `[
+		{"type":"basalSecurity","time":"2023-01-01T00:00:00Z","guid":"p1","basalSchedule":[{"rate":1,"start":0,"end":0}],"endTime":"2023-02-01T00:00:00Z"},
+		{"type":"basalSecurity","time":"2023-02-01T00:00:00Z","guid":"p2"}
+	]`, res.WriteBuffer.String())
+}
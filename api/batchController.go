@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tidepool-org/tide-whisperer/api/dto"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+const (
+	// maxBatchUsers maximum number of users in one batch request
+	maxBatchUsers = 50
+	// maxBatchWorkers number of users fetched concurrently
+	maxBatchWorkers = 4
+
+	batchDataRoute = "/batch/dataV2"
+)
+
+// @Summary Get the data of several patients
+// @Description Get the data of several patients, returning a JSON object keyed by user ID.
+// @Description The permissions are checked for each user, as for the dataV2 route: a user who can not be viewed
+// @Description or whose data can not be fetched has an error instead of the data, without failing the whole batch.
+// @Description The users are written as soon as their data are fetched, in no particular order.
+// @ID tide-whisperer-api-v1-postbatchdata
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]dto.BatchDataResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Param request body dto.BatchDataRequest true "The users (1 to 50), the window and the data types to return"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/batch/dataV2 [post]
+func (a *API) postBatchData(ctx context.Context, res *common.HttpResponseWriter) error {
+	var request dto.BatchDataRequest
+	err := json.Unmarshal(res.Body, &request)
+	if err == nil {
+		err = checkBatchUserIDs(request.UserIDs)
+	}
+	if err != nil {
+		return res.WriteError(&common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: err.Error(),
+		})
+	}
+	if a.authClient.Authenticate(a.getUserDataRequest(ctx, res, "")) == nil {
+		// A copy, WriteError sets its ID
+		errPermission := errorNoViewPermission
+		return res.WriteError(&errPermission)
+	}
+
+	bgUnit := request.BgUnit
+	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
+		bgUnit = ""
+	}
+	allSchemaVersions, errSchema := a.getAllSchemaVersions(ctx, res)
+	if errSchema != nil {
+		return res.WriteError(errSchema)
+	}
+	// Each user is written as soon as it is fetched: only the users being fetched are buffered
+	writer := &batchWriter{writer: res.StreamWriter("application/json")}
+	userIndexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxBatchWorkers && w < len(request.UserIDs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range userIndexes {
+				userID := request.UserIDs[i]
+				if !a.isAuthorized(a.getUserDataRequest(ctx, res, userID), []string{userID}) {
+					errPermission := errorNoViewPermission
+					writer.writeUser(userID, dto.BatchDataResult{Error: &errPermission})
+					continue
+				}
+				buffer := &bytes.Buffer{}
+				errData := a.patientData.GetData(ctx, usecase.GetDataArgs{
+					UserID:                userID,
+					TraceID:               res.TraceID,
+					StartDate:             request.StartDate,
+					EndDate:               request.EndDate,
+					WithPumpSettings:      request.WithPumpSettings,
+					WithParametersHistory: request.WithPumpSettings,
+					SessionToken:          getSessionToken(res),
+					BgUnit:                bgUnit,
+					Format:                usecase.FormatJSON,
+					Types:                 request.Types,
+					SubTypes:              request.SubTypes,
+					AllSchemaVersions:     allSchemaVersions,
+				}, buffer)
+				if errData != nil {
+					a.logger.Printf("{%s} %s: user %s failed with error [%s][%s]", res.TraceID, batchDataRoute, userID, errData.Code, errData.InternalMessage)
+					writer.writeUser(userID, dto.BatchDataResult{Error: errData})
+					continue
+				}
+				writer.writeUser(userID, dto.BatchDataResult{Data: buffer.Bytes()})
+			}
+		}()
+	}
+	for i := range request.UserIDs {
+		userIndexes <- i
+	}
+	close(userIndexes)
+	wg.Wait()
+	return writer.writeEnd()
+}
+
+// batchWriter write the JSON object of a batch one user at a time, in the order the workers end
+type batchWriter struct {
+	mutex     sync.Mutex
+	writer    io.Writer
+	userCount int
+	// err the first write error, nothing more is written after it
+	err error
+}
+
+// writeUser write the result of a user: its data are written as they are, without copy
+func (b *batchWriter) writeUser(userID string, result dto.BatchDataResult) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.err != nil {
+		return
+	}
+	separator := ","
+	if b.userCount == 0 {
+		separator = "{"
+	}
+	key, _ := json.Marshal(userID)
+	chunks := [][]byte{[]byte(separator), key, []byte(":")}
+	if result.Error == nil && len(result.Data) > 0 {
+		chunks = append(chunks, []byte(`{"data":`), result.Data, []byte("}"))
+	} else {
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			b.err = err
+			return
+		}
+		chunks = append(chunks, jsonResult)
+	}
+	for _, chunk := range chunks {
+		if _, b.err = b.writer.Write(chunk); b.err != nil {
+			return
+		}
+	}
+	b.userCount++
+}
+
+// writeEnd end the JSON object, returns the first write error
+func (b *batchWriter) writeEnd() error {
+	if b.err != nil {
+		return b.err
+	}
+	end := "}\n"
+	if b.userCount == 0 {
+		end = "{}\n"
+	}
+	_, err := io.WriteString(b.writer, end)
+	return err
+}
+
+// checkBatchUserIDs check the number of users and their IDs, as the middleware does for the userID parameter
+func checkBatchUserIDs(userIDs []string) error {
+	if len(userIDs) == 0 || len(userIDs) > maxBatchUsers {
+		return fmt.Errorf("expected 1 to %d userIds, got %d", maxBatchUsers, len(userIDs))
+	}
+	seen := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == "" || len(userID) > 64 {
+			return fmt.Errorf("invalid userId %q", userID)
+		}
+		if seen[userID] {
+			return fmt.Errorf("duplicated userId %q", userID)
+		}
+		seen[userID] = true
+	}
+	return nil
+}
+
+// getUserDataRequest returns the dataV2 request of a user with the batch request credentials,
+// so the permissions are checked by OPA as for the single user route
+func (a *API) getUserDataRequest(ctx context.Context, res *common.HttpResponseWriter, userID string) *http.Request {
+	path := strings.TrimSuffix(res.URL.Path, batchDataRoute) + "/dataV2/" + userID
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	req.Header = res.Header
+	return req
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_postBatchData(t *testing.T) {
+	mockAuth.ExpectedCalls = nil
+	mockAuth.On("Authenticate", mock.Anything).Return(&token.TokenData{UserId: "user1", IsServer: false})
+	authorized := mockPerms.GetMockedAuth(true, map[string]interface{}{}, "tidewhisperer-get")
+	mockPerms.SetMockOpaAuth("/v1/dataV2/user2", &authorized, nil)
+	mockPerms.SetMockOpaAuth("/v1/dataV2/user4", &authorized, nil)
+	forbidden := mockPerms.GetMockedAuth(false, map[string]interface{}{}, "tidewhisperer-get")
+	mockPerms.SetMockOpaAuth("/v1/dataV2/user3", &forbidden, nil)
+
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+		return args.UserID != "user4" && args.StartDate == "2023-04-01T00:00:00Z" && len(args.Types) == 1 && args.Types[0] == "cbg"
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte(`[{"id":"` + args.Get(1).(usecase.GetDataArgs).UserID + `"}]`))
+	}).Return(nil)
+	mockPatientData.On("GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+		return args.UserID == "user4"
+	}), mock.Anything).Return(&common.DetailedError{Status: http.StatusInternalServerError, Code: "data_store_error", Message: "internal server error"})
+	api := &API{patientData: &mockPatientData, authClient: mockAuth, perms: mockPerms, logger: logger}
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "should return the data or the error of each user",
+			body:               `{"userIds":["user1","user2","user3","user4"],"startDate":"2023-04-01T00:00:00Z","types":["cbg"]}`,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{
+				"user1":{"data":[{"id":"user1"}]},
+				"user2":{"data":[{"id":"user2"}]},
+				"user3":{"error":{"status":403,"id":"","code":"data_cant_view","message":"user is not authorized to view data"}},
+				"user4":{"error":{"status":500,"id":"","code":"data_store_error","message":"internal server error"}}
+			}`,
+		},
+		{
+			name:               "should refuse an empty batch",
+			body:               `{"userIds":[]}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "should refuse duplicated users",
+			body:               `{"userIds":["user1","user1"]}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "should refuse an invalid body",
+			body:               `["user1"]`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest("POST", "/v1/batch/dataV2", nil)
+			request.Header.Set("Authorization", "Bearer 123456")
+			recorder := httptest.NewRecorder()
+			res := &common.HttpResponseWriter{Writer: recorder, URL: request.URL, Header: request.Header, Body: []byte(tt.body), StatusCode: http.StatusOK}
+
+			err := api.postBatchData(context.Background(), res)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedBody != "" {
+				// The batch is streamed
+				assert.True(t, res.Streaming)
+				assert.JSONEq(t, tt.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPI_postBatchData_unauthenticated(t *testing.T) {
+	mockAuth.ExpectedCalls = nil
+	mockAuth.On("Authenticate", mock.Anything).Return(nil)
+	defer resetMocks()
+	api := &API{patientData: &MockPatientDataUseCase{}, authClient: mockAuth, perms: mockPerms, logger: logger}
+	request, _ := http.NewRequest("POST", "/v1/batch/dataV2", nil)
+	res := &common.HttpResponseWriter{Writer: httptest.NewRecorder(), URL: request.URL, Header: request.Header, Body: []byte(`{"userIds":["user1"]}`), StatusCode: http.StatusOK, TraceID: "trace1"}
+
+	err := api.postBatchData(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Equal(t, "trace1", res.Err.ID)
+	// The shared error is not modified by the request
+	assert.Empty(t, errorNoViewPermission.ID)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the devices used by a patient
+// @Description Get the timeline of the pumps, CGMs, BGMs and handsets used by a patient, ordered by their first data.
+// @Description The devices are found from the deviceId of the data, described by the upload datums and by the current pump settings.
+// @ID tide-whisperer-api-v1-getdevices
+// @Produce json
+// @Success 200 {object} usecase.DevicesResult
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/devices/{userID} [get]
+func (a *API) getDevices(ctx context.Context, res *common.HttpResponseWriter) error {
+	devices, err := a.patientData.GetDevices(ctx, usecase.GetDevicesArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, devices)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getDevices(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetDevices", mock.Anything, mock.MatchedBy(func(args usecase.GetDevicesArgs) bool {
+		return args.UserID == "abcdef"
+	})).Return(&usecase.DevicesResult{Devices: []usecase.DevicePeriod{
+		{DeviceID: "pump1", Kinds: []string{usecase.DeviceKindPump}, Model: "Kaleido", FirstDataTime: "2023-01-01T00:00:00Z", LastDataTime: "2023-02-01T00:00:00Z", NumData: 10, NumUploads: 1},
+	}}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/devices/abcdef", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getDevices(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"devices":[{"deviceId":"pump1","kinds":["pump"],"model":"Kaleido","firstDataTime":"2023-01-01T00:00:00Z","lastDataTime":"2023-02-01T00:00:00Z","numData":10,"numUploads":1,"current":false}]}`, res.WriteBuffer.String())
+}
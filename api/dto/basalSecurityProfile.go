@@ -15,5 +15,7 @@ type (
 		Timezone      string     `json:"timezone,omitempty"`
 		Guid          string     `json:"guid,omitempty"`
 		BasalSchedule []Schedule `json:"basalSchedule,omitempty"`
+		// EndTime the time the profile was replaced by the next one, not set for the last known profile
+		EndTime *time.Time `json:"endTime,omitempty"`
 	}
 )
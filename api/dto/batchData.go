@@ -0,0 +1,26 @@
+package dto
+
+import (
+	"encoding/json"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+type (
+	// BatchDataRequest body of the batch data route
+	BatchDataRequest struct {
+		UserIDs          []string `json:"userIds"`
+		StartDate        string   `json:"startDate,omitempty"`
+		EndDate          string   `json:"endDate,omitempty"`
+		Types            []string `json:"types,omitempty"`
+		SubTypes         []string `json:"subTypes,omitempty"`
+		WithPumpSettings bool     `json:"withPumpSettings,omitempty"`
+		BgUnit           string   `json:"bgUnit,omitempty"`
+	}
+
+	// BatchDataResult the data of one user, or the reason they can not be returned
+	BatchDataResult struct {
+		Data  json.RawMessage       `json:"data,omitempty" swaggertype:"array,object"`
+		Error *common.DetailedError `json:"error,omitempty"`
+	}
+)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 
+	"github.com/mdblp/go-common/clients/auth"
 	"github.com/tidepool-org/tide-whisperer/common"
 	"github.com/tidepool-org/tide-whisperer/usecase"
 )
@@ -11,6 +12,8 @@ import (
 type ExportController struct {
 	logger   *log.Logger
 	exporter ExporterUseCase
+	// authClient set by InitAPI, to check the parameters reserved to some tokens
+	authClient auth.ClientInterface
 }
 
 func NewExportController(logger *log.Logger, exporter ExporterUseCase) ExportController {
@@ -23,17 +26,22 @@ func NewExportController(logger *log.Logger, exporter ExporterUseCase) ExportCon
 // ExportData
 // @Summary Export patient data to S3 file.
 // @Description Export patient data to a file stored on S3.
-// This operation is asynchronous and always returning 200.
+// This operation is asynchronous and always returning 200 once the parameters are checked.
 // @ID tide-whisperer-export
 // @Produce json
 // @Success 200
+// @Failure 400 {object} common.DetailedError
 // @Failure 403 {object} common.DetailedError
 // @Failure 404 {object} common.DetailedError
 // @Param userID path string true "The ID of the user to search data for"
 // @Param startDate query string false "ISO Date time (RFC3339) for search lower limit" format(date-time)
 // @Param endDate query string false "ISO Date time (RFC3339) for search upper limit" format(date-time)
+// @Param tz query string false "IANA timezone (e.g. Europe/Paris) of the local startDate & endDate (2006-01-02 or 2006-01-02T15:04:05), and of the localTime of the data without timezone"
+// @Param localTime query string false "true to add the localTime field to the data: their wall clock time (2006-01-02T15:04:05) in their timezone" format(boolean)
 // @Param bgUnit query string false "The blood glucose unit used for exported data, can be mmol/L or mg/dL. By default, will be mmol/L."
-// @Param format query string false "the output format desired for the export. Can be json or csv. Default is set to csv."
+// @Param fields query string false "Comma separated list of the datum fields to export, the id, type & time are always exported. Default is all fields."
+// @Param parameterLevels query string false "Comma separated list of the levels of the device parameters to export, e.g. 1. Default is the configured levels (1,2), the other levels are reserved to the server & clinician tokens."
+// @Param format query string false "the output format desired for the export. Can be json, ndjson or csv. Default is set to csv."
 // @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
 // @Security Auth0
 // @Router /export/{userID} [get]
@@ -51,9 +59,17 @@ func (c ExportController) ExportData(ctx context.Context, res *common.HttpRespon
 	}
 
 	/*By default, we're formatting to CSV*/
-	formatToCsv := true
-	if format == "json" {
-		formatToCsv = false
+	if format != usecase.FormatJSON && format != usecase.FormatNDJSON {
+		format = usecase.FormatCSV
+	}
+
+	fields, errFields := getFieldsParam(query)
+	if errFields != nil {
+		return res.WriteError(errFields)
+	}
+	parameterLevels, trustedToken, errLevels := getParameterLevels(ctx, c.authClient, res)
+	if errLevels != nil {
+		return res.WriteError(errLevels)
 	}
 
 	sessionToken := getSessionToken(res)
@@ -66,7 +82,16 @@ func (c ExportController) ExportData(ctx context.Context, res *common.HttpRespon
 		WithParametersChanges: true,
 		SessionToken:          sessionToken,
 		BgUnit:                bgUnit,
-		FormatToCsv:           formatToCsv,
+		Format:                format,
+		Timezone:              query.Get("tz"),
+		WithLocalTime:         query.Get("localTime") == "true",
+		Fields:                fields,
+		ParameterLevels:       parameterLevels,
+		TrustedToken:          trustedToken,
+	}
+	// The export runs in the background: its arguments are checked before to return their errors
+	if errArgs := c.exporter.CheckExportArgs(exportArgs); errArgs != nil {
+		return res.WriteError(errArgs)
 	}
 	go c.exporter.Export(exportArgs)
 	return nil
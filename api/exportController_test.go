@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestExportController_ExportData(t *testing.T) {
+	logger := log.New(os.Stdout, "export-test ", log.LstdFlags)
+
+	t.Run("should launch the export in the background", func(t *testing.T) {
+		exported := make(chan usecase.ExportArgs, 1)
+		mockExporter := MockExporterUseCase{}
+		mockExporter.On("CheckExportArgs", mock.Anything).Return(nil)
+		mockExporter.On("Export", mock.Anything).Run(func(args mock.Arguments) {
+			exported <- args.Get(0).(usecase.ExportArgs)
+		}).Return()
+		controller := NewExportController(logger, &mockExporter)
+		request, _ := http.NewRequest("GET", "/export/abcdef?tz=Europe/Paris&format=json", nil)
+		res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+		err := controller.ExportData(context.Background(), res)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		select {
+		case args := <-exported:
+			assert.Equal(t, "abcdef", args.UserID)
+			assert.Equal(t, "Europe/Paris", args.Timezone)
+			assert.Equal(t, usecase.FormatJSON, args.Format)
+		case <-time.After(time.Second):
+			t.Error("the export was not launched")
+		}
+	})
+
+	t.Run("should return the errors of the arguments without launching the export", func(t *testing.T) {
+		mockExporter := MockExporterUseCase{}
+		mockExporter.On("CheckExportArgs", mock.Anything).Return(&common.DetailedError{Status: http.StatusBadRequest, Code: "data_invalid_parameters"})
+		controller := NewExportController(logger, &mockExporter)
+		request, _ := http.NewRequest("GET", "/export/abcdef?tz=Mars/Olympus", nil)
+		res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+		err := controller.ExportData(context.Background(), res)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		mockExporter.AssertNotCalled(t, "Export", mock.Anything)
+	})
+}
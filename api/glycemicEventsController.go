@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the hypoglycemia & hyperglycemia events of a patient
+// @Description Get the episodes detected from the cbg, using the consensus rules: an event starts after at least 15 minutes below (resp. above) the threshold
+// @Description and ends after at least 15 minutes back in range. The events are grouped by day and by night (midnight to 6AM, local time) or day-time.
+// @Description Default thresholds are the patient's hypo & hyper limits, 70 & 180 mg/dL when not available.
+// @ID tide-whisperer-api-v1-getglycemicevents
+// @Produce json
+// @Success 200 {object} usecase.GlycemicEventsResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to detect the events for"
+// @Param startDate query string false "ISO Date time (RFC3339) for the window lower limit, default to endDate - days" format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for the window upper limit, default to now" format(date-time)
+// @Param days query int false "Window duration in days when startDate is not set, default to 14"
+// @Param bgUnit query string false "The blood glucose unit of the result and the thresholds, can be mmol/L or mg/dL (default)."
+// @Param hypoThreshold query number false "Hypoglycemia threshold, in bgUnit"
+// @Param hyperThreshold query number false "Hyperglycemia threshold, in bgUnit"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/events/glycemic/{userID} [get]
+func (a *API) getGlycemicEvents(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	days, err := getDaysParam(query.Get("days"))
+	if err != nil {
+		return res.WriteError(err)
+	}
+	hypoThreshold, err := getFloatParam(query, "hypoThreshold")
+	if err != nil {
+		return res.WriteError(err)
+	}
+	hyperThreshold, err := getFloatParam(query, "hyperThreshold")
+	if err != nil {
+		return res.WriteError(err)
+	}
+	events, err := a.patientData.GetGlycemicEvents(ctx, usecase.GetGlycemicEventsArgs{
+		UserID:         res.VARS["userID"],
+		TraceID:        res.TraceID,
+		SessionToken:   getSessionToken(res),
+		StartDate:      query.Get("startDate"),
+		EndDate:        query.Get("endDate"),
+		Days:           days,
+		BgUnit:         query.Get("bgUnit"),
+		HypoThreshold:  hypoThreshold,
+		HyperThreshold: hyperThreshold,
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, events)
+}
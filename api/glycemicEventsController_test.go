@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getGlycemicEvents(t *testing.T) {
+	tests := []struct {
+		name               string
+		givenQuery         string
+		expectedStatusCode int
+		expectedHypo       float64
+		expectedHyper      float64
+	}{
+		{"Default thresholds", "", http.StatusOK, 0, 0},
+		{"Overridden thresholds", "hypoThreshold=3.9&hyperThreshold=10&bgUnit=mmol/L", http.StatusOK, 3.9, 10},
+		{"Invalid threshold", "hypoThreshold=abc", http.StatusBadRequest, 0, 0},
+		{"Invalid days", "days=-2", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetGlycemicEvents", mock.Anything, mock.Anything).Return(&usecase.GlycemicEventsResult{UserID: "abcdef"}, nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/events/glycemic/abcdef?"+tt.givenQuery, nil)
+			res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+			err := api.getGlycemicEvents(context.Background(), res)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedStatusCode == http.StatusOK {
+				mockPatientData.AssertCalled(t, "GetGlycemicEvents", mock.Anything, mock.MatchedBy(func(args usecase.GetGlycemicEventsArgs) bool {
+					return args.UserID == "abcdef" && args.HypoThreshold == tt.expectedHypo && args.HyperThreshold == tt.expectedHyper
+				}))
+			} else {
+				mockPatientData.AssertNotCalled(t, "GetGlycemicEvents", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
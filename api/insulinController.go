@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the total daily insulin of a patient
+// @Description Get the insulin delivered by day (local time of the data), split into basal and bolus, and the averages of the complete days.
+// @Description A day is incomplete when the basal deliveries do not cover it (missing pump data).
+// @ID tide-whisperer-api-v1-getinsulin
+// @Produce json
+// @Success 200 {object} usecase.InsulinResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to compute the insulin for"
+// @Param startDate query string false "ISO Date time (RFC3339) for the window lower limit, default to endDate - days" format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for the window upper limit, default to now" format(date-time)
+// @Param days query int false "Window duration in days when startDate is not set, default to 14"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/insulin/{userID} [get]
+func (a *API) getInsulin(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	days, err := getDaysParam(query.Get("days"))
+	if err != nil {
+		return res.WriteError(err)
+	}
+	insulin, err := a.patientData.GetInsulin(ctx, usecase.GetInsulinArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+		StartDate:    query.Get("startDate"),
+		EndDate:      query.Get("endDate"),
+		Days:         days,
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, insulin)
+}
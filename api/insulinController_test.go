@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getInsulin(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetInsulin", mock.Anything, mock.MatchedBy(func(args usecase.GetInsulinArgs) bool {
+		return args.UserID == "abcdef" && args.Days == 7
+	})).Return(&usecase.InsulinResult{
+		UserID:          "abcdef",
+		Days:            []usecase.InsulinDay{{Date: "2023-04-01", Basal: 12, Bolus: 20.5, Total: 32.5}},
+		NumCompleteDays: 1,
+		AverageBasal:    12,
+		AverageBolus:    20.5,
+		AverageTotal:    32.5,
+	}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/insulin/abcdef?days=7", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getInsulin(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"userId":"abcdef","startDate":"","endDate":"","days":[{"date":"2023-04-01","basal":12,"bolus":20.5,"total":32.5,"incomplete":false}],"numCompleteDays":1,"averageBasal":12,"averageBolus":20.5,"averageTotal":32.5}`, res.WriteBuffer.String())
+}
@@ -1,18 +1,35 @@
 package api
 
 import (
-	"bytes"
 	"context"
+	"io"
 
+	"github.com/tidepool-org/tide-whisperer/api/dto"
 	"github.com/tidepool-org/tide-whisperer/common"
 	"github.com/tidepool-org/tide-whisperer/usecase"
 )
 
 type PatientDataUseCase interface {
-	GetData(ctx context.Context, args usecase.GetDataArgs) (*bytes.Buffer, *common.DetailedError)
-	GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error)
+	GetData(ctx context.Context, args usecase.GetDataArgs, res io.Writer) *common.DetailedError
+	GetDataPage(ctx context.Context, args usecase.GetDataArgs, res io.Writer) (string, *common.DetailedError)
+	GetDataRangeLegacy(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*common.Date, error)
+	GetDataRangeValidator(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*usecase.DataValidator, *common.DetailedError)
+	GetSummary(ctx context.Context, args usecase.GetSummaryArgs) (*usecase.SummaryResultV1, *common.DetailedError)
+	GetAgp(ctx context.Context, args usecase.GetAgpArgs) (*usecase.AgpResult, *common.DetailedError)
+	GetTimeInRange(ctx context.Context, args usecase.GetTimeInRangeArgs) (*usecase.TimeInRangeResult, *common.DetailedError)
+	GetInsulin(ctx context.Context, args usecase.GetInsulinArgs) (*usecase.InsulinResult, *common.DetailedError)
+	GetGlycemicEvents(ctx context.Context, args usecase.GetGlycemicEventsArgs) (*usecase.GlycemicEventsResult, *common.DetailedError)
+	GetLatestData(ctx context.Context, args usecase.GetLatestDataArgs) (usecase.LatestData, *common.DetailedError)
+	GetUploads(ctx context.Context, args usecase.GetUploadsArgs) ([]usecase.Upload, *common.DetailedError)
+	GetDataInUpload(ctx context.Context, args usecase.GetDataInUploadArgs, res io.Writer) *common.DetailedError
+	StreamData(ctx context.Context, args usecase.StreamDataArgs, res io.Writer) *common.DetailedError
+	GetDevices(ctx context.Context, args usecase.GetDevicesArgs) (*usecase.DevicesResult, *common.DetailedError)
+	GetParametersHistory(ctx context.Context, args usecase.GetParametersArgs) (*usecase.ParametersHistoryResult, *common.DetailedError)
+	CompareParameters(ctx context.Context, args usecase.GetParametersArgs) (*usecase.ParametersCompareResult, *common.DetailedError)
+	GetBasalSecurityProfiles(ctx context.Context, args usecase.GetBasalSecurityProfilesArgs) ([]*dto.Profile, *common.DetailedError)
 }
 
 type ExporterUseCase interface {
+	CheckExportArgs(args usecase.ExportArgs) *common.DetailedError
 	Export(args usecase.ExportArgs)
 }
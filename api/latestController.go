@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the newest datum of each type for a patient
+// @Description Get the most recent datum of each requested type, returning a JSON object keyed by type. The types without data are not part of the result.
+// @ID tide-whisperer-api-v1-getlatestdata
+// @Produce json
+// @Success 200 {object} map[string]object
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param types query string false "Comma separated list of the data types to return. Default is cbg,smbg,bolus,basal,pumpSettings."
+// @Param bgUnit query string false "The blood glucose unit of the returned data, can be mmol/L or mg/dL. If nothing is specified, blood glucose data will be returned as it is in database."
+// @Param allSchemaVersions query string false "true to return the data of all the schema versions, not only the supported ones. Reserved to the server tokens." format(boolean)
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/latest/{userID} [get]
+func (a *API) getLatestData(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	bgUnit := query.Get("bgUnit")
+	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
+		bgUnit = ""
+	}
+	allSchemaVersions, errSchema := a.getAllSchemaVersions(ctx, res)
+	if errSchema != nil {
+		return res.WriteError(errSchema)
+	}
+	latest, err := a.patientData.GetLatestData(ctx, usecase.GetLatestDataArgs{
+		UserID:            res.VARS["userID"],
+		TraceID:           res.TraceID,
+		SessionToken:      getSessionToken(res),
+		Types:             getQueryList(query, "types"),
+		BgUnit:            bgUnit,
+		AllSchemaVersions: allSchemaVersions,
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, latest)
+}
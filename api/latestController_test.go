@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getLatestData(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetLatestData", mock.Anything, mock.MatchedBy(func(args usecase.GetLatestDataArgs) bool {
+		return args.UserID == "abcdef" && assert.ObjectsAreEqual([]string{"cbg", "bolus"}, args.Types) && args.BgUnit == usecase.MmolL &&
+			!args.AllSchemaVersions
+	})).Return(usecase.LatestData{
+		"cbg": {"id": "cbg_1_0", "type": "cbg", "units": usecase.MmolL, "value": 5.5},
+	}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/latest/abcdef?types=cbg,bolus&bgUnit=mmol/L", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getLatestData(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"cbg":{"id":"cbg_1_0","type":"cbg","units":"mmol/L","value":5.5}}`, res.WriteBuffer.String())
+}
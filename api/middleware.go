@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -20,6 +21,9 @@ type RequestLoggerFunc func(HandlerLoggerFunc) HandlerLoggerFunc
 
 var emptyUserIDs = []string{}
 
+// maxRequestBodySize the POST routes only accept small JSON documents
+const maxRequestBodySize = 1 << 20
+
 // middleware middleware to log received requests
 func (a *API) middleware(fn HandlerLoggerFunc, checkPermissions bool, params ...string) http.HandlerFunc {
 	// The mux handler func:
@@ -52,6 +56,7 @@ func (a *API) middleware(fn HandlerLoggerFunc, checkPermissions bool, params ...
 			TraceID:    traceID,
 			StatusCode: http.StatusOK, // Default status
 			Err:        nil,
+			Writer:     w,
 		}
 
 		userIDs := emptyUserIDs
@@ -79,6 +84,18 @@ func (a *API) middleware(fn HandlerLoggerFunc, checkPermissions bool, params ...
 			}
 		}
 
+		if r.Method == http.MethodPost && res.Err == nil {
+			var errBody error
+			if res.Body, errBody = io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize)); errBody != nil {
+				res.WriteError(&common.DetailedError{
+					Status:          http.StatusBadRequest,
+					Code:            "invalid_body",
+					Message:         "Invalid request body",
+					InternalMessage: errBody.Error(),
+				})
+			}
+		}
+
 		common.TimeIt(ctx, "checkPermissions")
 		if checkPermissions && !a.isAuthorized(r, userIDs) {
 			err = res.WriteError(&errorNoViewPermission)
@@ -95,13 +112,20 @@ func (a *API) middleware(fn HandlerLoggerFunc, checkPermissions bool, params ...
 			}
 		}
 
-		// We will send a JSON, so advertise it for all of our requests
 		common.TimeIt(ctx, "writeJSONResults")
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(res.StatusCode)
-		_, err = w.Write(res.WriteBuffer.Bytes())
-		if err != nil {
-			logErrors = append(logErrors, fmt.Sprintf("eww:\"%s\"", err))
+		if res.Streaming {
+			// The content is already sent, report a failure using the trailer
+			if res.Err != nil {
+				w.Header().Set(common.StreamErrorTrailer, res.Err.Code)
+			}
+		} else {
+			// We will send a JSON, so advertise it for all of our requests
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(res.StatusCode)
+			_, err = w.Write(res.WriteBuffer.Bytes())
+			if err != nil {
+				logErrors = append(logErrors, fmt.Sprintf("eww:\"%s\"", err))
+			}
 		}
 		common.TimeEnd(ctx, "writeJSONResults")
 
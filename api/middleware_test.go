@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -131,6 +132,29 @@ func TestApiV1MiddlewareNoError(t *testing.T) {
 	}
 }
 
+func TestApiV1MiddlewarePostBody(t *testing.T) {
+	value := `{"userIds":["abcdef"]}`
+	var handlerBody string
+	handlerFunc := func(ctx context.Context, res *common.HttpResponseWriter) error {
+		handlerBody = string(res.Body)
+		return nil
+	}
+
+	handlerLogFunc := api.middleware(handlerFunc, false)
+
+	request, _ := http.NewRequest("POST", "/v1/post-body", strings.NewReader(value))
+	response := httptest.NewRecorder()
+
+	handlerLogFunc(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected %d to equal %d", response.Code, http.StatusOK)
+	}
+	if handlerBody != value {
+		t.Fatalf("Expected `%s` to equal `%s`", handlerBody, value)
+	}
+}
+
 func TestApiV1MiddlewareErrorResponse(t *testing.T) {
 	value := &common.DetailedError{Status: http.StatusNotFound, Code: "data_not_found", Message: "no data for specified user"}
 	handlerFunc := func(ctx context.Context, res *common.HttpResponseWriter) error {
@@ -266,3 +290,73 @@ func TestApiV1MiddlewareNotAuthorizedWithUserID(t *testing.T) {
 		t.Fatalf("Expected `%s` to equal `%s`", bodyStr, errorText)
 	}
 }
+
+func TestApiV1MiddlewareStreamedResponse(t *testing.T) {
+	value := "[\"OK\"]"
+	handlerFunc := func(ctx context.Context, res *common.HttpResponseWriter) error {
+		_, err := res.StreamWriter("application/json").Write([]byte(value))
+		return err
+	}
+
+	handlerLogFunc := api.middleware(handlerFunc, false)
+
+	request, _ := http.NewRequest("GET", "/v1/stream", nil)
+	request.Header.Set("x-tidepool-trace-session", uuid.New().String())
+	response := httptest.NewRecorder()
+
+	handlerLogFunc(response, request)
+
+	result := response.Result()
+	if result.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d to equal %d", response.Code, http.StatusOK)
+	}
+
+	contentType := result.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		t.Fatalf("Expected `%s` to equal `application/json`", contentType)
+	}
+
+	body := make([]byte, 1024)
+	defer result.Body.Close()
+	n, _ := result.Body.Read(body)
+	bodyStr := string(body[:n])
+	if bodyStr != value {
+		t.Fatalf("Expected `%s` to equal `%s`", bodyStr, value)
+	}
+	if trailer := result.Trailer.Get(common.StreamErrorTrailer); trailer != "" {
+		t.Fatalf("Expected no stream error trailer, having `%s`", trailer)
+	}
+}
+
+func TestApiV1MiddlewareStreamedResponseError(t *testing.T) {
+	value := "[\n]\n"
+	detailedError := &common.DetailedError{Status: http.StatusInternalServerError, Code: "write_error", Message: "internal server error"}
+	handlerFunc := func(ctx context.Context, res *common.HttpResponseWriter) error {
+		res.StreamWriter("application/json").Write([]byte(value))
+		return res.WriteError(detailedError)
+	}
+
+	handlerLogFunc := api.middleware(handlerFunc, false)
+
+	request, _ := http.NewRequest("GET", "/v1/stream", nil)
+	request.Header.Set("x-tidepool-trace-session", uuid.New().String())
+	response := httptest.NewRecorder()
+
+	handlerLogFunc(response, request)
+
+	result := response.Result()
+	if result.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d to equal %d", response.Code, http.StatusOK)
+	}
+
+	body := make([]byte, 1024)
+	defer result.Body.Close()
+	n, _ := result.Body.Read(body)
+	bodyStr := string(body[:n])
+	if bodyStr != value {
+		t.Fatalf("Expected `%s` to equal `%s`", bodyStr, value)
+	}
+	if trailer := result.Trailer.Get(common.StreamErrorTrailer); trailer != detailedError.Code {
+		t.Fatalf("Expected `%s` to equal `%s`", trailer, detailedError.Code)
+	}
+}
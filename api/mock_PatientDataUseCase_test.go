@@ -3,11 +3,13 @@
 package api
 
 import (
-	bytes "bytes"
 	context "context"
+	io "io"
 
 	common "github.com/tidepool-org/tide-whisperer/common"
 
+	dto "github.com/tidepool-org/tide-whisperer/api/dto"
+
 	mock "github.com/stretchr/testify/mock"
 
 	usecase "github.com/tidepool-org/tide-whisperer/usecase"
@@ -26,21 +28,21 @@ func (_m *MockPatientDataUseCase) EXPECT() *MockPatientDataUseCase_Expecter {
 	return &MockPatientDataUseCase_Expecter{mock: &_m.Mock}
 }
 
-// GetData provides a mock function with given fields: ctx, args
-func (_m *MockPatientDataUseCase) GetData(ctx context.Context, args usecase.GetDataArgs) (*bytes.Buffer, *common.DetailedError) {
+// CompareParameters provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) CompareParameters(ctx context.Context, args usecase.GetParametersArgs) (*usecase.ParametersCompareResult, *common.DetailedError) {
 	ret := _m.Called(ctx, args)
 
-	var r0 *bytes.Buffer
-	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetDataArgs) *bytes.Buffer); ok {
+	var r0 *usecase.ParametersCompareResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetParametersArgs) *usecase.ParametersCompareResult); ok {
 		r0 = rf(ctx, args)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*bytes.Buffer)
+			r0 = ret.Get(0).(*usecase.ParametersCompareResult)
 		}
 	}
 
 	var r1 *common.DetailedError
-	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetDataArgs) *common.DetailedError); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetParametersArgs) *common.DetailedError); ok {
 		r1 = rf(ctx, args)
 	} else {
 		if ret.Get(1) != nil {
@@ -51,6 +53,144 @@ func (_m *MockPatientDataUseCase) GetData(ctx context.Context, args usecase.GetD
 	return r0, r1
 }
 
+// MockPatientDataUseCase_CompareParameters_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CompareParameters'
+type MockPatientDataUseCase_CompareParameters_Call struct {
+	*mock.Call
+}
+
+// CompareParameters is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetParametersArgs
+func (_e *MockPatientDataUseCase_Expecter) CompareParameters(ctx interface{}, args interface{}) *MockPatientDataUseCase_CompareParameters_Call {
+	return &MockPatientDataUseCase_CompareParameters_Call{Call: _e.mock.On("CompareParameters", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_CompareParameters_Call) Run(run func(ctx context.Context, args usecase.GetParametersArgs)) *MockPatientDataUseCase_CompareParameters_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetParametersArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_CompareParameters_Call) Return(_a0 *usecase.ParametersCompareResult, _a1 *common.DetailedError) *MockPatientDataUseCase_CompareParameters_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetAgp provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetAgp(ctx context.Context, args usecase.GetAgpArgs) (*usecase.AgpResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.AgpResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetAgpArgs) *usecase.AgpResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.AgpResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetAgpArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetAgp_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetAgp'
+type MockPatientDataUseCase_GetAgp_Call struct {
+	*mock.Call
+}
+
+// GetAgp is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetAgpArgs
+func (_e *MockPatientDataUseCase_Expecter) GetAgp(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetAgp_Call {
+	return &MockPatientDataUseCase_GetAgp_Call{Call: _e.mock.On("GetAgp", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetAgp_Call) Run(run func(ctx context.Context, args usecase.GetAgpArgs)) *MockPatientDataUseCase_GetAgp_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetAgpArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetAgp_Call) Return(_a0 *usecase.AgpResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetAgp_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetBasalSecurityProfiles provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetBasalSecurityProfiles(ctx context.Context, args usecase.GetBasalSecurityProfilesArgs) ([]*dto.Profile, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 []*dto.Profile
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetBasalSecurityProfilesArgs) []*dto.Profile); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*dto.Profile)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetBasalSecurityProfilesArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetBasalSecurityProfiles_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetBasalSecurityProfiles'
+type MockPatientDataUseCase_GetBasalSecurityProfiles_Call struct {
+	*mock.Call
+}
+
+// GetBasalSecurityProfiles is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetBasalSecurityProfilesArgs
+func (_e *MockPatientDataUseCase_Expecter) GetBasalSecurityProfiles(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetBasalSecurityProfiles_Call {
+	return &MockPatientDataUseCase_GetBasalSecurityProfiles_Call{Call: _e.mock.On("GetBasalSecurityProfiles", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetBasalSecurityProfiles_Call) Run(run func(ctx context.Context, args usecase.GetBasalSecurityProfilesArgs)) *MockPatientDataUseCase_GetBasalSecurityProfiles_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetBasalSecurityProfilesArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetBasalSecurityProfiles_Call) Return(_a0 []*dto.Profile, _a1 *common.DetailedError) *MockPatientDataUseCase_GetBasalSecurityProfiles_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetData provides a mock function with given fields: ctx, args, res
+func (_m *MockPatientDataUseCase) GetData(ctx context.Context, args usecase.GetDataArgs, res io.Writer) *common.DetailedError {
+	ret := _m.Called(ctx, args, res)
+
+	var r0 *common.DetailedError
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetDataArgs, io.Writer) *common.DetailedError); ok {
+		r0 = rf(ctx, args, res)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*common.DetailedError)
+		}
+	}
+
+	return r0
+}
+
 // MockPatientDataUseCase_GetData_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetData'
 type MockPatientDataUseCase_GetData_Call struct {
 	*mock.Call
@@ -59,29 +199,119 @@ type MockPatientDataUseCase_GetData_Call struct {
 // GetData is a helper method to define mock.On call
 //  - ctx context.Context
 //  - args usecase.GetDataArgs
-func (_e *MockPatientDataUseCase_Expecter) GetData(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetData_Call {
-	return &MockPatientDataUseCase_GetData_Call{Call: _e.mock.On("GetData", ctx, args)}
+//  - res io.Writer
+func (_e *MockPatientDataUseCase_Expecter) GetData(ctx interface{}, args interface{}, res interface{}) *MockPatientDataUseCase_GetData_Call {
+	return &MockPatientDataUseCase_GetData_Call{Call: _e.mock.On("GetData", ctx, args, res)}
+}
+
+func (_c *MockPatientDataUseCase_GetData_Call) Run(run func(ctx context.Context, args usecase.GetDataArgs, res io.Writer)) *MockPatientDataUseCase_GetData_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetDataArgs), args[2].(io.Writer))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetData_Call) Return(_a0 *common.DetailedError) *MockPatientDataUseCase_GetData_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// GetDataInUpload provides a mock function with given fields: ctx, args, res
+func (_m *MockPatientDataUseCase) GetDataInUpload(ctx context.Context, args usecase.GetDataInUploadArgs, res io.Writer) *common.DetailedError {
+	ret := _m.Called(ctx, args, res)
+
+	var r0 *common.DetailedError
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetDataInUploadArgs, io.Writer) *common.DetailedError); ok {
+		r0 = rf(ctx, args, res)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*common.DetailedError)
+		}
+	}
+
+	return r0
+}
+
+// MockPatientDataUseCase_GetDataInUpload_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDataInUpload'
+type MockPatientDataUseCase_GetDataInUpload_Call struct {
+	*mock.Call
+}
+
+// GetDataInUpload is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetDataInUploadArgs
+//  - res io.Writer
+func (_e *MockPatientDataUseCase_Expecter) GetDataInUpload(ctx interface{}, args interface{}, res interface{}) *MockPatientDataUseCase_GetDataInUpload_Call {
+	return &MockPatientDataUseCase_GetDataInUpload_Call{Call: _e.mock.On("GetDataInUpload", ctx, args, res)}
+}
+
+func (_c *MockPatientDataUseCase_GetDataInUpload_Call) Run(run func(ctx context.Context, args usecase.GetDataInUploadArgs, res io.Writer)) *MockPatientDataUseCase_GetDataInUpload_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetDataInUploadArgs), args[2].(io.Writer))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetDataInUpload_Call) Return(_a0 *common.DetailedError) *MockPatientDataUseCase_GetDataInUpload_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// GetDataPage provides a mock function with given fields: ctx, args, res
+func (_m *MockPatientDataUseCase) GetDataPage(ctx context.Context, args usecase.GetDataArgs, res io.Writer) (string, *common.DetailedError) {
+	ret := _m.Called(ctx, args, res)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetDataArgs, io.Writer) string); ok {
+		r0 = rf(ctx, args, res)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetDataArgs, io.Writer) *common.DetailedError); ok {
+		r1 = rf(ctx, args, res)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetDataPage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDataPage'
+type MockPatientDataUseCase_GetDataPage_Call struct {
+	*mock.Call
+}
+
+// GetDataPage is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetDataArgs
+//  - res io.Writer
+func (_e *MockPatientDataUseCase_Expecter) GetDataPage(ctx interface{}, args interface{}, res interface{}) *MockPatientDataUseCase_GetDataPage_Call {
+	return &MockPatientDataUseCase_GetDataPage_Call{Call: _e.mock.On("GetDataPage", ctx, args, res)}
 }
 
-func (_c *MockPatientDataUseCase_GetData_Call) Run(run func(ctx context.Context, args usecase.GetDataArgs)) *MockPatientDataUseCase_GetData_Call {
+func (_c *MockPatientDataUseCase_GetDataPage_Call) Run(run func(ctx context.Context, args usecase.GetDataArgs, res io.Writer)) *MockPatientDataUseCase_GetDataPage_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(usecase.GetDataArgs))
+		run(args[0].(context.Context), args[1].(usecase.GetDataArgs), args[2].(io.Writer))
 	})
 	return _c
 }
 
-func (_c *MockPatientDataUseCase_GetData_Call) Return(_a0 *bytes.Buffer, _a1 *common.DetailedError) *MockPatientDataUseCase_GetData_Call {
+func (_c *MockPatientDataUseCase_GetDataPage_Call) Return(_a0 string, _a1 *common.DetailedError) *MockPatientDataUseCase_GetDataPage_Call {
 	_c.Call.Return(_a0, _a1)
 	return _c
 }
 
-// GetDataRangeLegacy provides a mock function with given fields: ctx, traceID, userID
-func (_m *MockPatientDataUseCase) GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error) {
-	ret := _m.Called(ctx, traceID, userID)
+// GetDataRangeLegacy provides a mock function with given fields: ctx, traceID, userID, allSchemaVersions
+func (_m *MockPatientDataUseCase) GetDataRangeLegacy(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*common.Date, error) {
+	ret := _m.Called(ctx, traceID, userID, allSchemaVersions)
 
 	var r0 *common.Date
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *common.Date); ok {
-		r0 = rf(ctx, traceID, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) *common.Date); ok {
+		r0 = rf(ctx, traceID, userID, allSchemaVersions)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*common.Date)
@@ -89,8 +319,8 @@ func (_m *MockPatientDataUseCase) GetDataRangeLegacy(ctx context.Context, traceI
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, traceID, userID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bool) error); ok {
+		r1 = rf(ctx, traceID, userID, allSchemaVersions)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -107,13 +337,14 @@ type MockPatientDataUseCase_GetDataRangeLegacy_Call struct {
 //  - ctx context.Context
 //  - traceID string
 //  - userID string
-func (_e *MockPatientDataUseCase_Expecter) GetDataRangeLegacy(ctx interface{}, traceID interface{}, userID interface{}) *MockPatientDataUseCase_GetDataRangeLegacy_Call {
-	return &MockPatientDataUseCase_GetDataRangeLegacy_Call{Call: _e.mock.On("GetDataRangeLegacy", ctx, traceID, userID)}
+//  - allSchemaVersions bool
+func (_e *MockPatientDataUseCase_Expecter) GetDataRangeLegacy(ctx interface{}, traceID interface{}, userID interface{}, allSchemaVersions interface{}) *MockPatientDataUseCase_GetDataRangeLegacy_Call {
+	return &MockPatientDataUseCase_GetDataRangeLegacy_Call{Call: _e.mock.On("GetDataRangeLegacy", ctx, traceID, userID, allSchemaVersions)}
 }
 
-func (_c *MockPatientDataUseCase_GetDataRangeLegacy_Call) Run(run func(ctx context.Context, traceID string, userID string)) *MockPatientDataUseCase_GetDataRangeLegacy_Call {
+func (_c *MockPatientDataUseCase_GetDataRangeLegacy_Call) Run(run func(ctx context.Context, traceID string, userID string, allSchemaVersions bool)) *MockPatientDataUseCase_GetDataRangeLegacy_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string))
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool))
 	})
 	return _c
 }
@@ -123,6 +354,488 @@ func (_c *MockPatientDataUseCase_GetDataRangeLegacy_Call) Return(_a0 *common.Dat
 	return _c
 }
 
+// GetDataRangeValidator provides a mock function with given fields: ctx, traceID, userID, allSchemaVersions
+func (_m *MockPatientDataUseCase) GetDataRangeValidator(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*usecase.DataValidator, *common.DetailedError) {
+	ret := _m.Called(ctx, traceID, userID, allSchemaVersions)
+
+	var r0 *usecase.DataValidator
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) *usecase.DataValidator); ok {
+		r0 = rf(ctx, traceID, userID, allSchemaVersions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.DataValidator)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bool) *common.DetailedError); ok {
+		r1 = rf(ctx, traceID, userID, allSchemaVersions)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetDataRangeValidator_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDataRangeValidator'
+type MockPatientDataUseCase_GetDataRangeValidator_Call struct {
+	*mock.Call
+}
+
+// GetDataRangeValidator is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+//  - allSchemaVersions bool
+func (_e *MockPatientDataUseCase_Expecter) GetDataRangeValidator(ctx interface{}, traceID interface{}, userID interface{}, allSchemaVersions interface{}) *MockPatientDataUseCase_GetDataRangeValidator_Call {
+	return &MockPatientDataUseCase_GetDataRangeValidator_Call{Call: _e.mock.On("GetDataRangeValidator", ctx, traceID, userID, allSchemaVersions)}
+}
+
+func (_c *MockPatientDataUseCase_GetDataRangeValidator_Call) Run(run func(ctx context.Context, traceID string, userID string, allSchemaVersions bool)) *MockPatientDataUseCase_GetDataRangeValidator_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetDataRangeValidator_Call) Return(_a0 *usecase.DataValidator, _a1 *common.DetailedError) *MockPatientDataUseCase_GetDataRangeValidator_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetDevices provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetDevices(ctx context.Context, args usecase.GetDevicesArgs) (*usecase.DevicesResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.DevicesResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetDevicesArgs) *usecase.DevicesResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.DevicesResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetDevicesArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetDevices_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDevices'
+type MockPatientDataUseCase_GetDevices_Call struct {
+	*mock.Call
+}
+
+// GetDevices is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetDevicesArgs
+func (_e *MockPatientDataUseCase_Expecter) GetDevices(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetDevices_Call {
+	return &MockPatientDataUseCase_GetDevices_Call{Call: _e.mock.On("GetDevices", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetDevices_Call) Run(run func(ctx context.Context, args usecase.GetDevicesArgs)) *MockPatientDataUseCase_GetDevices_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetDevicesArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetDevices_Call) Return(_a0 *usecase.DevicesResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetDevices_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetGlycemicEvents provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetGlycemicEvents(ctx context.Context, args usecase.GetGlycemicEventsArgs) (*usecase.GlycemicEventsResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.GlycemicEventsResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetGlycemicEventsArgs) *usecase.GlycemicEventsResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.GlycemicEventsResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetGlycemicEventsArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetGlycemicEvents_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetGlycemicEvents'
+type MockPatientDataUseCase_GetGlycemicEvents_Call struct {
+	*mock.Call
+}
+
+// GetGlycemicEvents is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetGlycemicEventsArgs
+func (_e *MockPatientDataUseCase_Expecter) GetGlycemicEvents(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetGlycemicEvents_Call {
+	return &MockPatientDataUseCase_GetGlycemicEvents_Call{Call: _e.mock.On("GetGlycemicEvents", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetGlycemicEvents_Call) Run(run func(ctx context.Context, args usecase.GetGlycemicEventsArgs)) *MockPatientDataUseCase_GetGlycemicEvents_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetGlycemicEventsArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetGlycemicEvents_Call) Return(_a0 *usecase.GlycemicEventsResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetGlycemicEvents_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetInsulin provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetInsulin(ctx context.Context, args usecase.GetInsulinArgs) (*usecase.InsulinResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.InsulinResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetInsulinArgs) *usecase.InsulinResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.InsulinResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetInsulinArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetInsulin_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetInsulin'
+type MockPatientDataUseCase_GetInsulin_Call struct {
+	*mock.Call
+}
+
+// GetInsulin is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetInsulinArgs
+func (_e *MockPatientDataUseCase_Expecter) GetInsulin(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetInsulin_Call {
+	return &MockPatientDataUseCase_GetInsulin_Call{Call: _e.mock.On("GetInsulin", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetInsulin_Call) Run(run func(ctx context.Context, args usecase.GetInsulinArgs)) *MockPatientDataUseCase_GetInsulin_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetInsulinArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetInsulin_Call) Return(_a0 *usecase.InsulinResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetInsulin_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetLatestData provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetLatestData(ctx context.Context, args usecase.GetLatestDataArgs) (usecase.LatestData, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 usecase.LatestData
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetLatestDataArgs) usecase.LatestData); ok {
+		r0 = rf(ctx, args)
+	} else {
+		r0 = ret.Get(0).(usecase.LatestData)
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetLatestDataArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetLatestData_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLatestData'
+type MockPatientDataUseCase_GetLatestData_Call struct {
+	*mock.Call
+}
+
+// GetLatestData is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetLatestDataArgs
+func (_e *MockPatientDataUseCase_Expecter) GetLatestData(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetLatestData_Call {
+	return &MockPatientDataUseCase_GetLatestData_Call{Call: _e.mock.On("GetLatestData", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetLatestData_Call) Run(run func(ctx context.Context, args usecase.GetLatestDataArgs)) *MockPatientDataUseCase_GetLatestData_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetLatestDataArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetLatestData_Call) Return(_a0 usecase.LatestData, _a1 *common.DetailedError) *MockPatientDataUseCase_GetLatestData_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetParametersHistory provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetParametersHistory(ctx context.Context, args usecase.GetParametersArgs) (*usecase.ParametersHistoryResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.ParametersHistoryResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetParametersArgs) *usecase.ParametersHistoryResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.ParametersHistoryResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetParametersArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetParametersHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetParametersHistory'
+type MockPatientDataUseCase_GetParametersHistory_Call struct {
+	*mock.Call
+}
+
+// GetParametersHistory is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetParametersArgs
+func (_e *MockPatientDataUseCase_Expecter) GetParametersHistory(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetParametersHistory_Call {
+	return &MockPatientDataUseCase_GetParametersHistory_Call{Call: _e.mock.On("GetParametersHistory", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetParametersHistory_Call) Run(run func(ctx context.Context, args usecase.GetParametersArgs)) *MockPatientDataUseCase_GetParametersHistory_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetParametersArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetParametersHistory_Call) Return(_a0 *usecase.ParametersHistoryResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetParametersHistory_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetSummary provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetSummary(ctx context.Context, args usecase.GetSummaryArgs) (*usecase.SummaryResultV1, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.SummaryResultV1
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetSummaryArgs) *usecase.SummaryResultV1); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.SummaryResultV1)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetSummaryArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetSummary_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetSummary'
+type MockPatientDataUseCase_GetSummary_Call struct {
+	*mock.Call
+}
+
+// GetSummary is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetSummaryArgs
+func (_e *MockPatientDataUseCase_Expecter) GetSummary(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetSummary_Call {
+	return &MockPatientDataUseCase_GetSummary_Call{Call: _e.mock.On("GetSummary", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetSummary_Call) Run(run func(ctx context.Context, args usecase.GetSummaryArgs)) *MockPatientDataUseCase_GetSummary_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetSummaryArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetSummary_Call) Return(_a0 *usecase.SummaryResultV1, _a1 *common.DetailedError) *MockPatientDataUseCase_GetSummary_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetTimeInRange provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetTimeInRange(ctx context.Context, args usecase.GetTimeInRangeArgs) (*usecase.TimeInRangeResult, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 *usecase.TimeInRangeResult
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetTimeInRangeArgs) *usecase.TimeInRangeResult); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*usecase.TimeInRangeResult)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetTimeInRangeArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetTimeInRange_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetTimeInRange'
+type MockPatientDataUseCase_GetTimeInRange_Call struct {
+	*mock.Call
+}
+
+// GetTimeInRange is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetTimeInRangeArgs
+func (_e *MockPatientDataUseCase_Expecter) GetTimeInRange(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetTimeInRange_Call {
+	return &MockPatientDataUseCase_GetTimeInRange_Call{Call: _e.mock.On("GetTimeInRange", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetTimeInRange_Call) Run(run func(ctx context.Context, args usecase.GetTimeInRangeArgs)) *MockPatientDataUseCase_GetTimeInRange_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetTimeInRangeArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetTimeInRange_Call) Return(_a0 *usecase.TimeInRangeResult, _a1 *common.DetailedError) *MockPatientDataUseCase_GetTimeInRange_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetUploads provides a mock function with given fields: ctx, args
+func (_m *MockPatientDataUseCase) GetUploads(ctx context.Context, args usecase.GetUploadsArgs) ([]usecase.Upload, *common.DetailedError) {
+	ret := _m.Called(ctx, args)
+
+	var r0 []usecase.Upload
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.GetUploadsArgs) []usecase.Upload); ok {
+		r0 = rf(ctx, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]usecase.Upload)
+		}
+	}
+
+	var r1 *common.DetailedError
+	if rf, ok := ret.Get(1).(func(context.Context, usecase.GetUploadsArgs) *common.DetailedError); ok {
+		r1 = rf(ctx, args)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*common.DetailedError)
+		}
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataUseCase_GetUploads_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUploads'
+type MockPatientDataUseCase_GetUploads_Call struct {
+	*mock.Call
+}
+
+// GetUploads is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.GetUploadsArgs
+func (_e *MockPatientDataUseCase_Expecter) GetUploads(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetUploads_Call {
+	return &MockPatientDataUseCase_GetUploads_Call{Call: _e.mock.On("GetUploads", ctx, args)}
+}
+
+func (_c *MockPatientDataUseCase_GetUploads_Call) Run(run func(ctx context.Context, args usecase.GetUploadsArgs)) *MockPatientDataUseCase_GetUploads_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.GetUploadsArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_GetUploads_Call) Return(_a0 []usecase.Upload, _a1 *common.DetailedError) *MockPatientDataUseCase_GetUploads_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// StreamData provides a mock function with given fields: ctx, args, res
+func (_m *MockPatientDataUseCase) StreamData(ctx context.Context, args usecase.StreamDataArgs, res io.Writer) *common.DetailedError {
+	ret := _m.Called(ctx, args, res)
+
+	var r0 *common.DetailedError
+	if rf, ok := ret.Get(0).(func(context.Context, usecase.StreamDataArgs, io.Writer) *common.DetailedError); ok {
+		r0 = rf(ctx, args, res)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*common.DetailedError)
+		}
+	}
+
+	return r0
+}
+
+// MockPatientDataUseCase_StreamData_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'StreamData'
+type MockPatientDataUseCase_StreamData_Call struct {
+	*mock.Call
+}
+
+// StreamData is a helper method to define mock.On call
+//  - ctx context.Context
+//  - args usecase.StreamDataArgs
+//  - res io.Writer
+func (_e *MockPatientDataUseCase_Expecter) StreamData(ctx interface{}, args interface{}, res interface{}) *MockPatientDataUseCase_StreamData_Call {
+	return &MockPatientDataUseCase_StreamData_Call{Call: _e.mock.On("StreamData", ctx, args, res)}
+}
+
+func (_c *MockPatientDataUseCase_StreamData_Call) Run(run func(ctx context.Context, args usecase.StreamDataArgs, res io.Writer)) *MockPatientDataUseCase_StreamData_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(usecase.StreamDataArgs), args[2].(io.Writer))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_StreamData_Call) Return(_a0 *common.DetailedError) *MockPatientDataUseCase_StreamData_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
 type NewMockPatientDataUseCaseT interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the pump settings parameters history of a patient
+// @Description Get the changes of the pump settings parameters, in effective date order.
+// @ID tide-whisperer-api-v1-getparametershistory
+// @Produce json
+// @Success 200 {object} usecase.ParametersHistoryResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param names query string false "Comma separated list of the parameter names to return. Default is all."
+// @Param levels query string false "Comma separated list of the parameter levels to return. Default is the configured levels, the other levels are reserved to the server & clinician tokens."
+// @Param startDate query string false "ISO Date time (RFC3339) for the beginning of the changes window. Default is no bound."
+// @Param endDate query string false "ISO Date time (RFC3339) for the end of the changes window. Default is no bound."
+// @Param bgUnit query string false "The blood glucose unit of the returned parameters, can be mmol/L or mg/dL. If nothing is specified, the parameters are returned as they are in the settings."
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/parameters/{userID} [get]
+func (a *API) getParametersHistory(ctx context.Context, res *common.HttpResponseWriter) error {
+	args, errParams := a.getParametersArgs(ctx, res)
+	if errParams != nil {
+		return res.WriteError(errParams)
+	}
+	query := res.URL.Query()
+	args.StartDate = query.Get("startDate")
+	args.EndDate = query.Get("endDate")
+	history, err := a.patientData.GetParametersHistory(ctx, args)
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, history)
+}
+
+// @Summary Compare the pump settings parameters of a patient at two dates
+// @Description Get the effective value of every pump settings parameter at two dates, and which ones changed.
+// @ID tide-whisperer-api-v1-compareparameters
+// @Produce json
+// @Success 200 {object} usecase.ParametersCompareResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param from query string true "ISO Date time (RFC3339) of the first date to compare"
+// @Param to query string true "ISO Date time (RFC3339) of the second date to compare"
+// @Param names query string false "Comma separated list of the parameter names to return. Default is all."
+// @Param levels query string false "Comma separated list of the parameter levels to return. Default is the configured levels, the other levels are reserved to the server & clinician tokens."
+// @Param bgUnit query string false "The blood glucose unit of the returned parameters, can be mmol/L or mg/dL. If nothing is specified, the parameters are returned as they are in the settings."
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/parameters/{userID}/compare [get]
+func (a *API) compareParameters(ctx context.Context, res *common.HttpResponseWriter) error {
+	args, errParams := a.getParametersArgs(ctx, res)
+	if errParams != nil {
+		return res.WriteError(errParams)
+	}
+	query := res.URL.Query()
+	args.From = query.Get("from")
+	args.To = query.Get("to")
+	comparison, err := a.patientData.CompareParameters(ctx, args)
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, comparison)
+}
+
+// getParametersArgs returns the arguments shared by the parameters routes.
+// When levels are requested, the token tells if the levels which are not configured are allowed.
+func (a *API) getParametersArgs(ctx context.Context, res *common.HttpResponseWriter) (usecase.GetParametersArgs, *common.DetailedError) {
+	query := res.URL.Query()
+	bgUnit := query.Get("bgUnit")
+	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
+		bgUnit = ""
+	}
+	levels, err := getIntList(query, "levels")
+	trustedToken := err == nil && len(levels) > 0 && isTrustedToken(ctx, a.authClient, res)
+	return usecase.GetParametersArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+		Names:        getQueryList(query, "names"),
+		Levels:       levels,
+		TrustedToken: trustedToken,
+		BgUnit:       bgUnit,
+	}, err
+}
+
+// getIntList returns the comma separated integers of a query parameter
+func getIntList(query url.Values, name string) ([]int, *common.DetailedError) {
+	values := getQueryList(query, name)
+	numbers := make([]int, len(values))
+	for i, value := range values {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &common.DetailedError{
+				Status:          errorInvalidParameters.Status,
+				Code:            errorInvalidParameters.Code,
+				Message:         errorInvalidParameters.Message,
+				InternalMessage: fmt.Sprintf("invalid %s %q", name, value),
+			}
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getParametersHistory(t *testing.T) {
+	tests := []struct {
+		name                 string
+		givenQuery           string
+		givenToken           *token.TokenData
+		expectedTrustedToken bool
+		expectedStatusCode   int
+	}{
+		{"Filters", "names=PATIENT_GLY_HYPO_LIMIT&levels=1,2&startDate=2023-01-01T00:00:00Z&bgUnit=mmol/L", &token.TokenData{UserId: "abcdef", Role: "patient"}, false, http.StatusOK},
+		{"Clinician token", "names=PATIENT_GLY_HYPO_LIMIT&levels=1,2&startDate=2023-01-01T00:00:00Z&bgUnit=mmol/L", &token.TokenData{UserId: "clinician", Role: "hcp"}, true, http.StatusOK},
+		{"Invalid level", "levels=one", nil, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth.ExpectedCalls = nil
+			mockAuth.On("Authenticate", mock.Anything).Return(tt.givenToken)
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetParametersHistory", mock.Anything, mock.MatchedBy(func(args usecase.GetParametersArgs) bool {
+				return args.UserID == "abcdef" && assert.ObjectsAreEqual([]string{"PATIENT_GLY_HYPO_LIMIT"}, args.Names) &&
+					assert.ObjectsAreEqual([]int{1, 2}, args.Levels) && args.StartDate == "2023-01-01T00:00:00Z" && args.BgUnit == usecase.MmolL &&
+					args.TrustedToken == tt.expectedTrustedToken
+			})).Return(&usecase.ParametersHistoryResult{}, nil)
+			api := &API{patientData: &mockPatientData, authClient: mockAuth}
+			request, _ := http.NewRequest("GET", "/v1/parameters/abcdef?"+tt.givenQuery, nil)
+			res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+			err := api.getParametersHistory(context.Background(), res)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedStatusCode != http.StatusOK {
+				mockPatientData.AssertNotCalled(t, "GetParametersHistory", mock.Anything, mock.Anything)
+			} else {
+				mockPatientData.AssertExpectations(t)
+			}
+		})
+	}
+	resetMocks()
+}
+
+func TestAPI_compareParameters(t *testing.T) {
+	from := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC)
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("CompareParameters", mock.Anything, mock.MatchedBy(func(args usecase.GetParametersArgs) bool {
+		return args.UserID == "abcdef" && args.From == "2023-01-01T00:00:00Z" && args.To == "2023-02-01T00:00:00Z"
+	})).Return(&usecase.ParametersCompareResult{From: from, To: to, Parameters: []usecase.ParameterComparison{
+		{Name: "WEIGHT", Level: 1, From: &usecase.ParameterValue{Value: "70", Unit: "kg"}, To: &usecase.ParameterValue{Value: "72", Unit: "kg"}, Changed: true},
+	}}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/parameters/abcdef/compare?from=2023-01-01T00:00:00Z&to=2023-02-01T00:00:00Z", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.compareParameters(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"from":"2023-01-01T00:00:00Z","to":"2023-02-01T00:00:00Z","parameters":[
+		{"name":"WEIGHT","level":1,"from":{"value":"70","unit":"kg"},"to":{"value":"72","unit":"kg"},"changed":true}
+	]}`, res.WriteBuffer.String())
+}
@@ -1,30 +1,61 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tidepool-org/tide-whisperer/common"
 	"github.com/tidepool-org/tide-whisperer/usecase"
 )
 
+// fieldNameRegexp the accepted datum field names
+var fieldNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
 // @Summary Get the data for a specific patient using new bucket api
-// @Description Get the data for a specific patient, returning a JSON array of objects
+// @Description Get the data for a specific patient, returning a JSON array of objects.
+// @Description The response is streamed: an error occurring after the first byte is reported in the X-Tidepool-Stream-Error trailer.
 // @ID tide-whisperer-api-v1V2-getdata
 // @Produce json
+// @Produce application/x-ndjson
 // @Success 200 {array} string "Array of objects"
 // @Failure 400 {object} common.DetailedError
 // @Failure 403 {object} common.DetailedError
 // @Failure 404 {object} common.DetailedError
 // @Failure 500 {object} common.DetailedError
 // @Param userID path string true "The ID of the user to search data for"
-// @Param startDate query string false "ISO Date time (RFC3339) for search lower limit" format(date-time)
-// @Param endDate query string false "ISO Date time (RFC3339) for search upper limit" format(date-time)
+// @Param startDate query string false "ISO Date time (RFC3339) for search lower limit, or a local date (2006-01-02) or date time (2006-01-02T15:04:05) with tz"
+// @Param endDate query string false "ISO Date time (RFC3339) for search upper limit, or a local date (whole day included) or date time with tz"
+// @Param tz query string false "IANA timezone (e.g. Europe/Paris) of the local startDate & endDate, and of the localTime of the data without timezone"
+// @Param localTime query string false "true to add the localTime field to the data: their wall clock time (2006-01-02T15:04:05) in their timezone" format(boolean)
 // @Param withPumpSettings query string false "true to include the pump settings in the results" format(boolean)
 // @Param bgUnit query string false "The blood glucose unit used for exported data, can be mmol/L or mg/dL. If nothing is specified, blood glucose data will be returned as it is in database."
+// @Param format query string false "ndjson to return one JSON datum per line (application/x-ndjson), same as the Accept header. Default is a JSON array."
+// @Param types query string false "Comma separated list of the data types to return, e.g. cbg,smbg,bolus. Default is all types."
+// @Param subTypes query string false "Comma separated list of the data sub types to return, data without sub type are not filtered. Default is all sub types."
+// @Param fields query string false "Comma separated list of the datum fields to return, the id, type & time are always returned. Default is all fields."
+// @Param modifiedSince query string false "ISO Date time (RFC3339): only return the data created or modified since, with a tombstone ({id, type, time, modifiedTime, deleted: true}) for the deleted ones. The pump settings are not returned. Can not be used with limit."
+// @Param syncToken query string false "Token of a previous incremental sync, from the X-Tidepool-Sync-Token header, instead of modifiedSince"
+// @Param rawSources query string false "Comma separated list of the sources (carelink, dexcom, medtronic or all) to return as they are: by default, where the data of several sources overlap, only the ones of the preferred source are returned"
+// @Param allSchemaVersions query string false "true to return the data of all the schema versions, not only the supported ones. Reserved to the server tokens." format(boolean)
+// @Param parameterLevels query string false "Comma separated list of the levels of the device parameters to return, e.g. 1. Default is the configured levels (1,2), the other levels are reserved to the server & clinician tokens."
+// @Param limit query int false "Maximum number of data to return (1 to 10000). The data are then returned in time order, the next page URL is given by the Link header (rel=next). The pump settings are only part of the first page, the upload data are not returned (see /v1/uploads)."
+// @Param cursor query string false "Opaque position of the page to return, from the next Link header. Requires limit."
 // @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Param If-None-Match header string false "ETag of a previous response, 304 is returned when the data did not change"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response, 304 is returned when the data did not change. Ignored with If-None-Match."
+// @Header 200 {string} Link "Next page URL, when more data are available with limit"
+// @Header 200 {string} X-Tidepool-Sync-Token "Token of the next incremental sync, with modifiedSince or syncToken"
+// @Header 200 {string} ETag "Validator of the response"
+// @Header 200 {string} Last-Modified "Newest modification of the data, not set when tide-v2 data (cbg & basal buckets, pump settings) are returned"
+// @Success 304 "The data did not change"
 // @Security Auth0
 // @Router /v1/dataV2/{userID} [get]
 func (a *API) getDataV2(ctx context.Context, res *common.HttpResponseWriter) error {
@@ -40,6 +71,37 @@ func (a *API) getDataV2(ctx context.Context, res *common.HttpResponseWriter) err
 	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
 		bgUnit = ""
 	}
+	format, contentType := getDataFormat(res)
+	types := getQueryList(query, "types")
+	subTypes := getQueryList(query, "subTypes")
+	limit, cursor, errPage := getPageParams(query)
+	if errPage != nil {
+		return res.WriteError(errPage)
+	}
+	fields, errFields := getFieldsParam(query)
+	if errFields != nil {
+		return res.WriteError(errFields)
+	}
+	allSchemaVersions, errSchema := a.getAllSchemaVersions(ctx, res)
+	if errSchema != nil {
+		return res.WriteError(errSchema)
+	}
+	parameterLevels, trustedToken, errLevels := getParameterLevels(ctx, a.authClient, res)
+	if errLevels != nil {
+		return res.WriteError(errLevels)
+	}
+	modifiedSince := query.Get("modifiedSince")
+	if syncToken := query.Get("syncToken"); syncToken != "" {
+		var errToken error
+		if modifiedSince, errToken = usecase.DecodeSyncToken(syncToken); errToken != nil {
+			return res.WriteError(&common.DetailedError{
+				Status:          errorInvalidParameters.Status,
+				Code:            errorInvalidParameters.Code,
+				Message:         errorInvalidParameters.Message,
+				InternalMessage: errToken.Error(),
+			})
+		}
+	}
 	getDataArgs := usecase.GetDataArgs{
 		UserID:                     userID,
 		TraceID:                    res.TraceID,
@@ -50,15 +112,126 @@ func (a *API) getDataV2(ctx context.Context, res *common.HttpResponseWriter) err
 		SessionToken:               sessionToken,
 		BgUnit:                     bgUnit,
 		FilteringParametersHistory: false,
+		Format:                     format,
+		Types:                      types,
+		SubTypes:                   subTypes,
+		Limit:                      limit,
+		Cursor:                     cursor,
+		Timezone:                   query.Get("tz"),
+		WithLocalTime:              query.Get("localTime") == "true",
+		Fields:                     fields,
+		ModifiedSince:              modifiedSince,
+		RawSources:                 getQueryList(query, "rawSources"),
+		AllSchemaVersions:          allSchemaVersions,
+		ParameterLevels:            parameterLevels,
+		TrustedToken:               trustedToken,
+		Validate: func(validator usecase.DataValidator) bool {
+			return checkValidator(res, validator, format)
+		},
 	}
-	buff, err := a.patientData.GetData(ctx, getDataArgs)
-	if err != nil {
+	if modifiedSince != "" {
+		// The checkpoint of the next sync is taken before reading the data
+		res.Writer.Header().Set(syncTokenHeader, usecase.NewSyncToken(time.Now()))
+	}
+	if limit > 0 {
+		return a.writeDataPage(ctx, res, getDataArgs, contentType)
+	}
+	// Stream the result to the client to avoid buffering the whole payload
+	if err := a.patientData.GetData(ctx, getDataArgs, res.StreamWriter(contentType)); err != nil {
 		return res.WriteError(err)
 	}
-	res.WriteBuffer = *buff
 	return nil
 }
 
+// writeDataPage write one page of data with the Link header to the next one.
+// The page size is bounded so it is buffered: the next cursor is only known once the page is built.
+func (a *API) writeDataPage(ctx context.Context, res *common.HttpResponseWriter, getDataArgs usecase.GetDataArgs, contentType string) error {
+	buffer := &bytes.Buffer{}
+	nextCursor, err := a.patientData.GetDataPage(ctx, getDataArgs, buffer)
+	if err != nil {
+		return res.WriteError(err)
+	}
+	if res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if nextCursor != "" {
+		res.Writer.Header().Set("Link", getNextLink(res.URL, nextCursor))
+	}
+	_, errWrite := res.StreamWriter(contentType).Write(buffer.Bytes())
+	return errWrite
+}
+
+// getPageParams returns the limit & cursor query parameters, limit is 0 when the pagination is not requested
+func getPageParams(query url.Values) (int, string, *common.DetailedError) {
+	limitValue := query.Get("limit")
+	cursor := query.Get("cursor")
+	if limitValue == "" {
+		if cursor != "" {
+			return 0, "", &common.DetailedError{
+				Status:          errorInvalidParameters.Status,
+				Code:            errorInvalidParameters.Code,
+				Message:         errorInvalidParameters.Message,
+				InternalMessage: "cursor requires a limit",
+			}
+		}
+		return 0, "", nil
+	}
+	limit, err := strconv.Atoi(limitValue)
+	if err != nil || limit <= 0 || limit > maxDataLimit {
+		return 0, "", &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: fmt.Sprintf("invalid limit %q", limitValue),
+		}
+	}
+	return limit, cursor, nil
+}
+
+// getNextLink returns the Link header value to the next page: the same request with the next cursor
+func getNextLink(requestURL *url.URL, nextCursor string) string {
+	query := requestURL.Query()
+	query.Set("cursor", nextCursor)
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", requestURL.Path, query.Encode())
+}
+
+// getDataFormat returns the output format and its content type, using the format query parameter
+// or the Accept header: newline delimited JSON can be requested, JSON array is the default.
+func getDataFormat(res *common.HttpResponseWriter) (string, string) {
+	if res.URL.Query().Get("format") == usecase.FormatNDJSON || strings.Contains(res.Header.Get("Accept"), ndjsonContentType) {
+		return usecase.FormatNDJSON, ndjsonContentType
+	}
+	return usecase.FormatJSON, jsonContentType
+}
+
+// getQueryList returns the comma separated values of a query parameter, empty values are ignored
+func getQueryList(query url.Values, name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(query.Get(name), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getFieldsParam returns the datum fields of the fields query parameter, only top level field names are accepted
+func getFieldsParam(query url.Values) ([]string, *common.DetailedError) {
+	fields := getQueryList(query, "fields")
+	for _, field := range fields {
+		if !fieldNameRegexp.MatchString(field) {
+			return nil, &common.DetailedError{
+				Status:          errorInvalidParameters.Status,
+				Code:            errorInvalidParameters.Code,
+				Message:         errorInvalidParameters.Message,
+				InternalMessage: fmt.Sprintf("invalid field %q", field),
+			}
+		}
+	}
+	return fields, nil
+}
+
 // get session token (for history the header is found in the response and not in the request because of the v1 middelware)
 // to be change of course, but for now keep it
 func getSessionToken(res *common.HttpResponseWriter) string {
@@ -110,14 +283,32 @@ func (a *API) getData(ctx context.Context, res *common.HttpResponseWriter) error
 // @Failure 404 {object} common.DetailedError
 // @Failure 500 {object} common.DetailedError
 // @Param userID path string true "The ID of the user to search data for"
+// @Param allSchemaVersions query string false "true to use the data of all the schema versions, not only the supported ones. Reserved to the server tokens." format(boolean)
 // @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Param If-None-Match header string false "ETag of a previous response, 304 is returned when the data did not change"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response, 304 is returned when the data did not change. Ignored with If-None-Match."
+// @Header 200 {string} ETag "Validator of the response"
+// @Header 200 {string} Last-Modified "Newest modification of the data"
+// @Success 304 "The data did not change"
 // @Security Auth0
 // @Router /v1/range/{userID} [get]
 // Deprecated: not removed for backward compatibility but should not be used
 func (a *API) getRangeLegacy(ctx context.Context, res *common.HttpResponseWriter) error {
 	userID := res.VARS["userID"]
+	allSchemaVersions, errSchema := a.getAllSchemaVersions(ctx, res)
+	if errSchema != nil {
+		return res.WriteError(errSchema)
+	}
+
+	validator, errValidator := a.patientData.GetDataRangeValidator(ctx, res.TraceID, userID, allSchemaVersions)
+	if errValidator != nil {
+		return res.WriteError(errValidator)
+	}
+	if !checkValidator(res, *validator, usecase.FormatJSON) {
+		return nil
+	}
 
-	dates, err := a.patientData.GetDataRangeLegacy(ctx, res.TraceID, userID)
+	dates, err := a.patientData.GetDataRangeLegacy(ctx, res.TraceID, userID, allSchemaVersions)
 	if err != nil {
 		logError := &common.DetailedError{
 			Status:          errorRunningQuery.Status,
@@ -1,9 +1,9 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/mdblp/shoreline/token"
 	"github.com/mdblp/tide-whisperer-v2/v2/schema"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -198,7 +199,7 @@ func TestAPI_GetDataV2(t *testing.T) {
 	urlParams := map[string]string{}
 
 	patientDataUseCase := usecase.NewPatientDataUseCase(logger, mockTideV2, patientDataRepository, true)
-	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, schemaVersions, logger, mockTideV2)
+	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, logger, mockTideV2)
 	expectedBody := "[" + strings.Join(
 		[]string{
 			expectedDataV1,
@@ -213,7 +214,7 @@ func TestAPI_GetDataV2(t *testing.T) {
 
 	// testing with cbg only, required to set basal to false
 	patientDataUseCase = usecase.NewPatientDataUseCase(logger, mockTideV2, patientDataRepository, false)
-	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, schemaVersions, logger, mockTideV2)
+	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, logger, mockTideV2)
 	expectedBody = "[" + strings.Join(
 		[]string{
 			expectedDataV1,
@@ -227,7 +228,7 @@ func TestAPI_GetDataV2(t *testing.T) {
 	}
 
 	patientDataUseCase = usecase.NewPatientDataUseCase(logger, mockTideV2, patientDataRepository, true)
-	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, schemaVersions, logger, mockTideV2)
+	api = InitAPI(ExportController{}, patientDataUseCase, dbAdapter, mockAuth, mockPerms, logger, mockTideV2)
 	expectedBasalBucket := `{"deliveryType":"automated","duration":1000,"id":"basal_bucket1_0","rate":1,"time":"2021-01-01T00:05:00Z","timezone":"Paris","type":"basal"}`
 	expectedBody = "[" + strings.Join(
 		[]string{
@@ -293,7 +294,7 @@ func TestAPI_getDataV2_bgUnit(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockPatientData := MockPatientDataUseCase{}
-			mockPatientData.On("GetData", mock.Anything, mock.Anything).Return(new(bytes.Buffer), nil)
+			mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			api := &API{patientData: &mockPatientData}
 			/*Build the request with bgUnit query param*/
 			request, _ := http.NewRequest("GET", "/v1/dataV2/testBgUnit?bgUnit="+tt.givenBgUnitQueryParam, nil)
@@ -305,7 +306,305 @@ func TestAPI_getDataV2_bgUnit(t *testing.T) {
 			assert.NoError(t, err)
 			mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
 				return args.BgUnit == tt.expectedBgUnitInUseCase
-			}))
+			}), mock.Anything)
+		})
+	}
+}
+
+func TestAPI_getDataV2_format(t *testing.T) {
+	tests := []struct {
+		name                    string
+		givenFormatQueryParam   string
+		givenAcceptHeader       string
+		expectedFormatInUseCase string
+	}{
+		{"Default format", "", "", usecase.FormatJSON},
+		{"ndjson query param", "ndjson", "", usecase.FormatNDJSON},
+		{"ndjson accept header", "", "application/x-ndjson", usecase.FormatNDJSON},
+		{"json accept header", "", "application/json", usecase.FormatJSON},
+		{"Invalid format", "xml", "", usecase.FormatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testFormat?format="+tt.givenFormatQueryParam, nil)
+			request.Header.Set("Accept", tt.givenAcceptHeader)
+			httpResponseWriter := common.HttpResponseWriter{}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+			err := api.getDataV2(context.Background(), &httpResponseWriter)
+			assert.NoError(t, err)
+			mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return args.Format == tt.expectedFormatInUseCase
+			}), mock.Anything)
+		})
+	}
+}
+
+func TestAPI_getDataV2_types(t *testing.T) {
+	tests := []struct {
+		name             string
+		givenQuery       string
+		expectedTypes    []string
+		expectedSubTypes []string
+	}{
+		{"No filter", "", []string{}, []string{}},
+		{"Types only", "types=cbg,smbg", []string{"cbg", "smbg"}, []string{}},
+		{"Types and subTypes", "types=deviceEvent&subTypes=deviceParameter", []string{"deviceEvent"}, []string{"deviceParameter"}},
+		{"Empty values are ignored", "types=cbg,,%20smbg%20,", []string{"cbg", "smbg"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testTypes?"+tt.givenQuery, nil)
+			httpResponseWriter := common.HttpResponseWriter{}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+			err := api.getDataV2(context.Background(), &httpResponseWriter)
+			assert.NoError(t, err)
+			mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return assert.ObjectsAreEqual(tt.expectedTypes, args.Types) && assert.ObjectsAreEqual(tt.expectedSubTypes, args.SubTypes)
+			}), mock.Anything)
+		})
+	}
+}
+
+func TestAPI_getDataV2_page(t *testing.T) {
+	tests := []struct {
+		name               string
+		givenQuery         string
+		givenNextCursor    string
+		expectedStatusCode int
+		expectedLink       string
+	}{
+		{"First page", "limit=2", "next123", http.StatusOK, `</v1/dataV2/testPage?cursor=next123&limit=2>; rel="next"`},
+		{"Last page", "limit=2&cursor=abc", "", http.StatusOK, ""},
+		{"Invalid limit", "limit=abc", "", http.StatusBadRequest, ""},
+		{"Limit too high", "limit=10001", "", http.StatusBadRequest, ""},
+		{"Cursor without limit", "cursor=abc", "", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetDataPage", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				args.Get(2).(io.Writer).Write([]byte("[\n]\n"))
+			}).Return(tt.givenNextCursor, nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testPage?"+tt.givenQuery, nil)
+			recorder := httptest.NewRecorder()
+			httpResponseWriter := common.HttpResponseWriter{
+				URL:        request.URL,
+				Header:     request.Header,
+				StatusCode: http.StatusOK,
+				Writer:     recorder,
+			}
+			err := api.getDataV2(context.Background(), &httpResponseWriter)
+			assert.NoError(t, err)
+			if tt.expectedStatusCode != http.StatusOK {
+				assert.Equal(t, tt.expectedStatusCode, httpResponseWriter.StatusCode)
+				mockPatientData.AssertNotCalled(t, "GetDataPage", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.Equal(t, tt.expectedStatusCode, recorder.Code)
+			assert.Equal(t, tt.expectedLink, recorder.Header().Get("Link"))
+			assert.Equal(t, "[\n]\n", recorder.Body.String())
+			mockPatientData.AssertNotCalled(t, "GetData", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAPI_getDataV2_timezone(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/dataV2/testTimezone?startDate=2023-03-03&endDate=2023-03-04&tz=Europe%2FParis&localTime=true", nil)
+	httpResponseWriter := common.HttpResponseWriter{}
+	httpResponseWriter.URL = request.URL
+	httpResponseWriter.Header = request.Header
+	err := api.getDataV2(context.Background(), &httpResponseWriter)
+	assert.NoError(t, err)
+	mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+		return args.StartDate == "2023-03-03" && args.EndDate == "2023-03-04" && args.Timezone == "Europe/Paris" && args.WithLocalTime
+	}), mock.Anything)
+}
+
+func TestAPI_getDataV2_rawSources(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+		return assert.ObjectsAreEqual([]string{"dexcom", "carelink"}, args.RawSources)
+	}), mock.Anything).Return(nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/dataV2/testSources?rawSources=dexcom,carelink", nil)
+	httpResponseWriter := common.HttpResponseWriter{StatusCode: http.StatusOK}
+	httpResponseWriter.URL = request.URL
+	httpResponseWriter.Header = request.Header
+
+	err := api.getDataV2(context.Background(), &httpResponseWriter)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, httpResponseWriter.StatusCode)
+	mockPatientData.AssertExpectations(t)
+}
+
+func TestAPI_getDataV2_schemaVersion(t *testing.T) {
+	tests := []struct {
+		name                string
+		givenQuery          string
+		givenToken          *token.TokenData
+		expectedAllVersions bool
+		expectedStatus      int
+	}{
+		{"Configured range", "", nil, false, http.StatusOK},
+		{"All versions for a server token", "allSchemaVersions=true", &token.TokenData{UserId: "server", IsServer: true}, true, http.StatusOK},
+		{"All versions for a patient token", "allSchemaVersions=true", &token.TokenData{UserId: "testSchema", IsServer: false}, false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth.ExpectedCalls = nil
+			mockAuth.On("Authenticate", mock.Anything).Return(tt.givenToken)
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return args.AllSchemaVersions == tt.expectedAllVersions
+			}), mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData, authClient: mockAuth}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testSchema?"+tt.givenQuery, nil)
+			httpResponseWriter := common.HttpResponseWriter{StatusCode: http.StatusOK}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+
+			err := api.getDataV2(context.Background(), &httpResponseWriter)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, httpResponseWriter.StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				mockPatientData.AssertExpectations(t)
+			} else {
+				mockPatientData.AssertNotCalled(t, "GetData", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+	resetMocks()
+}
+
+func TestAPI_getDataV2_parameterLevels(t *testing.T) {
+	tests := []struct {
+		name                 string
+		givenQuery           string
+		givenToken           *token.TokenData
+		expectedLevels       []int
+		expectedTrustedToken bool
+		expectedStatus       int
+	}{
+		{"Configured levels", "", nil, nil, false, http.StatusOK},
+		{"Patient token", "parameterLevels=1", &token.TokenData{UserId: "testLevels", Role: "patient"}, []int{1}, false, http.StatusOK},
+		{"Clinician token", "parameterLevels=1,2,3", &token.TokenData{UserId: "clinician", Role: "hcp"}, []int{1, 2, 3}, true, http.StatusOK},
+		{"Server token", "parameterLevels=3", &token.TokenData{UserId: "server", IsServer: true}, []int{3}, true, http.StatusOK},
+		{"Invalid level", "parameterLevels=high", &token.TokenData{UserId: "server", IsServer: true}, nil, false, http.StatusBadRequest},
+		{"Empty levels", "parameterLevels=", &token.TokenData{UserId: "server", IsServer: true}, nil, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth.ExpectedCalls = nil
+			mockAuth.On("Authenticate", mock.Anything).Return(tt.givenToken)
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return assert.ObjectsAreEqual(tt.expectedLevels, args.ParameterLevels) && args.TrustedToken == tt.expectedTrustedToken
+			}), mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData, authClient: mockAuth}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testLevels?"+tt.givenQuery, nil)
+			httpResponseWriter := common.HttpResponseWriter{StatusCode: http.StatusOK}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+
+			err := api.getDataV2(context.Background(), &httpResponseWriter)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, httpResponseWriter.StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				mockPatientData.AssertExpectations(t)
+			} else {
+				mockPatientData.AssertNotCalled(t, "GetData", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+	resetMocks()
+}
+
+func TestAPI_getDataV2_fields(t *testing.T) {
+	tests := []struct {
+		name           string
+		givenQuery     string
+		expectedFields []string
+		expectedStatus int
+	}{
+		{"No fields", "", []string{}, http.StatusOK},
+		{"Fields", "fields=value,units", []string{"value", "units"}, http.StatusOK},
+		{"Nested field", "fields=payload.history", nil, http.StatusBadRequest},
+		{"Operator", "fields=$where", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testFields?"+tt.givenQuery, nil)
+			httpResponseWriter := common.HttpResponseWriter{StatusCode: http.StatusOK}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+			_ = api.getDataV2(context.Background(), &httpResponseWriter)
+			assert.Equal(t, tt.expectedStatus, httpResponseWriter.StatusCode)
+			if tt.expectedStatus != http.StatusOK {
+				mockPatientData.AssertNotCalled(t, "GetData", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return assert.ObjectsAreEqual(tt.expectedFields, args.Fields)
+			}), mock.Anything)
+		})
+	}
+}
+
+func TestAPI_getDataV2_sync(t *testing.T) {
+	tests := []struct {
+		name                  string
+		givenQuery            string
+		expectedModifiedSince string
+		expectedStatus        int
+	}{
+		{"No sync", "", "", http.StatusOK},
+		{"Modified since", "modifiedSince=2023-04-01T10:00:00Z", "2023-04-01T10:00:00Z", http.StatusOK},
+		{"Sync token", "syncToken=" + usecase.NewSyncToken(time.Date(2023, time.April, 1, 10, 1, 0, 0, time.UTC)), "2023-04-01T10:00:00.000Z", http.StatusOK},
+		{"Invalid sync token", "syncToken=invalid", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/dataV2/testSync?"+tt.givenQuery, nil)
+			recorder := httptest.NewRecorder()
+			httpResponseWriter := common.HttpResponseWriter{StatusCode: http.StatusOK, Writer: recorder}
+			httpResponseWriter.URL = request.URL
+			httpResponseWriter.Header = request.Header
+			_ = api.getDataV2(context.Background(), &httpResponseWriter)
+			assert.Equal(t, tt.expectedStatus, httpResponseWriter.StatusCode)
+			if tt.expectedStatus != http.StatusOK {
+				mockPatientData.AssertNotCalled(t, "GetData", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			mockPatientData.AssertCalled(t, "GetData", mock.Anything, mock.MatchedBy(func(args usecase.GetDataArgs) bool {
+				return args.ModifiedSince == tt.expectedModifiedSince
+			}), mock.Anything)
+			if tt.expectedModifiedSince == "" {
+				assert.Empty(t, recorder.Header().Get(syncTokenHeader))
+			} else {
+				_, err := usecase.DecodeSyncToken(recorder.Header().Get(syncTokenHeader))
+				assert.NoError(t, err)
+			}
 		})
 	}
 }
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+
+	// DefaultMaxStreams default maximum number of concurrent data streams
+	DefaultMaxStreams = 100
+)
+
+var errorTooManyStreams = common.DetailedError{Status: http.StatusServiceUnavailable, Code: "data_too_many_streams", Message: "too many data streams, retry later"}
+
+// flushWriter send each write straight to the client
+type flushWriter struct {
+	writer     io.Writer
+	controller *http.ResponseController
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err = w.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// flushForwarder a response writer forwarding Flush to the writer of the request before a middleware
+type flushForwarder struct {
+	http.ResponseWriter
+	flushed http.ResponseWriter
+}
+
+func (f *flushForwarder) FlushError() error {
+	return http.NewResponseController(f.flushed).Flush()
+}
+
+func (f *flushForwarder) Flush() {
+	_ = f.FlushError()
+}
+
+func (f *flushForwarder) Unwrap() http.ResponseWriter {
+	return f.ResponseWriter
+}
+
+// FlushMiddleware wrap a middleware whose response writer hides Flush (e.g. the prometheus instrumentation),
+// so the data streams still reach the client as they are written
+func FlushMiddleware(middleware mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middleware(http.HandlerFunc(func(wrapped http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(&flushForwarder{ResponseWriter: wrapped, flushed: w}, r)
+			})).ServeHTTP(w, r)
+		})
+	}
+}
+
+// CompressHandler compress the responses (gzip/deflate) when the client accepts it,
+// except the data streams: their events must not wait in the compressor buffers
+func (a *API) CompressHandler(handler http.Handler) http.Handler {
+	compressHandler := handlers.CompressHandler(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.streamPath != "" && strings.HasPrefix(r.URL.Path, a.streamPath) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		compressHandler.ServeHTTP(w, r)
+	})
+}
+
+// SetMaxStreams set the maximum number of concurrent data streams, the streams already opened are not counted
+func (a *API) SetMaxStreams(maxStreams int) {
+	a.streams = make(chan struct{}, maxStreams)
+}
+
+// @Summary Stream the new data of a patient
+// @Description Server-Sent Events stream of the data of a patient, as they are uploaded. Each event data is a datum, using the /v1/data format, and its id can be sent back in the Last-Event-ID header to resume the stream after it. A comment is sent as heartbeat when no datum is uploaded for 15 seconds.
+// @ID tide-whisperer-api-v1-streamdata
+// @Produce text/event-stream
+// @Success 200 {string} string "Server-Sent Events"
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Failure 503 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to stream data for"
+// @Param bgUnit query string false "The blood glucose unit of the returned data, can be mmol/L or mg/dL. If nothing is specified, blood glucose data will be returned as it is in database."
+// @Param Last-Event-ID header string false "The id of the last event received, to resume the stream after it"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/stream/{userID} [get]
+func (a *API) getStream(ctx context.Context, res *common.HttpResponseWriter) error {
+	select {
+	case a.streams <- struct{}{}:
+		defer func() { <-a.streams }()
+	default:
+		return res.WriteError(&errorTooManyStreams)
+	}
+
+	bgUnit := res.URL.Query().Get("bgUnit")
+	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
+		bgUnit = ""
+	}
+	args := usecase.StreamDataArgs{
+		UserID:      res.VARS["userID"],
+		TraceID:     res.TraceID,
+		LastEventID: res.Header.Get("Last-Event-ID"),
+		BgUnit:      bgUnit,
+	}
+
+	header := res.Writer.Header()
+	header.Set("Cache-Control", "no-cache")
+	// Disable the buffering of the reverse proxies
+	header.Set("X-Accel-Buffering", "no")
+	writer := &flushWriter{writer: res.StreamWriter(eventStreamContentType), controller: http.NewResponseController(res.Writer)}
+	if err := a.patientData.StreamData(ctx, args, writer); err != nil {
+		return res.WriteError(err)
+	}
+	return nil
+}
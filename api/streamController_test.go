@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mdblp/shoreline/token"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+	muxprom "gitlab.com/msvechla/mux-prometheus/pkg/middleware"
+)
+
+func TestAPI_getStream(t *testing.T) {
+	t.Run("should stream the events", func(t *testing.T) {
+		mockPatientData := MockPatientDataUseCase{}
+		mockPatientData.On("StreamData", mock.Anything, mock.MatchedBy(func(args usecase.StreamDataArgs) bool {
+			return args.UserID == "abcdef" && args.LastEventID == "token1" && args.BgUnit == usecase.MgdL
+		}), mock.Anything).Run(func(args mock.Arguments) {
+			io.WriteString(args.Get(2).(io.Writer), "id: token2\ndata: {}\n\n")
+		}).Return(nil)
+		api := &API{patientData: &mockPatientData, streams: make(chan struct{}, 1)}
+		request, _ := http.NewRequest("GET", "/v1/stream/abcdef?bgUnit=mg/dL", nil)
+		request.Header.Set("Last-Event-ID", "token1")
+		recorder := httptest.NewRecorder()
+		res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK, Writer: recorder}
+
+		err := api.getStream(context.Background(), res)
+
+		assert.NoError(t, err)
+		assert.True(t, recorder.Flushed)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, eventStreamContentType, recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+		assert.Equal(t, "id: token2\ndata: {}\n\n", recorder.Body.String())
+		assert.Len(t, api.streams, 0)
+	})
+
+	t.Run("should return an error when too many streams are opened", func(t *testing.T) {
+		mockPatientData := MockPatientDataUseCase{}
+		api := &API{patientData: &mockPatientData, streams: make(chan struct{}, 1)}
+		api.streams <- struct{}{}
+		request, _ := http.NewRequest("GET", "/v1/stream/abcdef", nil)
+		res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK, Writer: httptest.NewRecorder()}
+
+		err := api.getStream(context.Background(), res)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		mockPatientData.AssertNotCalled(t, "StreamData", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return the stream errors", func(t *testing.T) {
+		mockPatientData := MockPatientDataUseCase{}
+		mockPatientData.On("StreamData", mock.Anything, mock.Anything, mock.Anything).Return(&common.DetailedError{Status: errorInvalidParameters.Status, Code: errorInvalidParameters.Code})
+		api := &API{patientData: &mockPatientData, streams: make(chan struct{}, 1)}
+		request, _ := http.NewRequest("GET", "/v1/stream/abcdef", nil)
+		request.Header.Set("Last-Event-ID", "invalid")
+		res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK, Writer: httptest.NewRecorder()}
+
+		err := api.getStream(context.Background(), res)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Len(t, api.streams, 0)
+	})
+}
+
+func TestAPI_getStream_router(t *testing.T) {
+	resetMocks()
+	mockAuth.On("Authenticate", mock.Anything).Return(&token.TokenData{UserId: "abcdef", IsServer: false})
+	authorized := mockPerms.GetMockedAuth(true, map[string]interface{}{}, "tidewhisperer-get")
+	mockPerms.SetMockOpaAuth("/v1/stream/abcdef", &authorized, nil)
+	// The stream stays opened until the test ends
+	done := make(chan struct{})
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("StreamData", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		io.WriteString(args.Get(2).(io.Writer), "id: token2\ndata: {}\n\n")
+		<-done
+	}).Return(nil)
+	streamAPI := &API{patientData: &mockPatientData, authClient: mockAuth, perms: mockPerms, logger: logger, streams: make(chan struct{}, 1)}
+	// The production stack: instrumentation & compression
+	router := mux.NewRouter()
+	instrumentation := muxprom.NewCustomInstrumentation(true, "test", "stream", prometheus.DefBuckets, nil, prometheus.NewRegistry())
+	router.Use(FlushMiddleware(instrumentation.Middleware))
+	streamAPI.SetHandlers("", router)
+	server := httptest.NewServer(streamAPI.CompressHandler(router))
+	defer server.Close()
+	defer close(done)
+
+	type streamResult struct {
+		response *http.Response
+		event    string
+		err      error
+	}
+	results := make(chan streamResult, 1)
+	go func() {
+		request, _ := http.NewRequest("GET", server.URL+"/v1/stream/abcdef", nil)
+		request.Header.Set("Authorization", "Bearer 123456")
+		request.Header.Set("Accept-Encoding", "gzip")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			results <- streamResult{err: err}
+			return
+		}
+		reader := bufio.NewReader(response.Body)
+		event := ""
+		for err == nil && (event == "" || event[len(event)-2:] != "\n\n") {
+			var line string
+			line, err = reader.ReadString('\n')
+			event += line
+		}
+		results <- streamResult{response: response, event: event, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		assert.NoError(t, result.err)
+		if result.response != nil {
+			defer result.response.Body.Close()
+			assert.Equal(t, http.StatusOK, result.response.StatusCode)
+			assert.Equal(t, eventStreamContentType, result.response.Header.Get("Content-Type"))
+			assert.Empty(t, result.response.Header.Get("Content-Encoding"))
+		}
+		assert.Equal(t, "id: token2\ndata: {}\n\n", result.event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not received while the stream is opened")
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the glucose summary of a patient
+// @Description Get the time in range (TIR) and time below range (TBR) of a patient, computed from the cbg (or the smbg when there is no cbg).
+// @Description The hypo & hyper limits are the ones of the patient's current pump settings.
+// @ID tide-whisperer-api-v1-getsummary
+// @Produce json
+// @Success 200 {object} usecase.SummaryResultV1
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to compute the summary for"
+// @Param startDate query string false "ISO Date time (RFC3339) for the window lower limit, default to endDate - days" format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for the window upper limit, default to the last data of the patient" format(date-time)
+// @Param days query int false "Window duration in days when startDate is not set, default to 14"
+// @Param bgUnit query string false "The blood glucose unit of the result, can be mmol/L or mg/dL (default)."
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/summary/{userID} [get]
+func (a *API) getSummary(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	days, err := getDaysParam(query.Get("days"))
+	if err != nil {
+		return res.WriteError(err)
+	}
+	summary, err := a.patientData.GetSummary(ctx, usecase.GetSummaryArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+		StartDate:    query.Get("startDate"),
+		EndDate:      query.Get("endDate"),
+		Days:         days,
+		BgUnit:       query.Get("bgUnit"),
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, summary)
+}
+
+// getDaysParam parse the days query parameter, 0 when not set
+func getDaysParam(value string) (int, *common.DetailedError) {
+	if value == "" {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		return 0, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: fmt.Sprintf("invalid days %q", value),
+		}
+	}
+	return days, nil
+}
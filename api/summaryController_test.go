@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getSummary(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetSummary", mock.Anything, mock.MatchedBy(func(args usecase.GetSummaryArgs) bool {
+		return args.UserID == "abcdef" && args.Days == 7 && args.BgUnit == usecase.MmolL
+	})).Return(&usecase.SummaryResultV1{
+		UserID:                "abcdef",
+		ComputeDays:           7,
+		PercentTimeInRange:    70,
+		PercentTimeBelowRange: 4,
+		NumBgValues:           2016,
+		GlyHypoLimit:          3.9,
+		GlyHyperLimit:         10,
+		GlyUnit:               usecase.MmolL,
+	}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/summary/abcdef?days=7&bgUnit=mmol/L", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getSummary(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"userId":"abcdef","rangeStart":"","rangeEnd":"","computeDays":7,"percentTimeInRange":70,"percentTimeBelowRange":4,"numBgValues":2016,"glyHypoLimit":3.9,"glyHyperLimit":10,"glyUnit":"mmol/L"}`, res.WriteBuffer.String())
+}
+
+func TestAPI_getSummary_invalidDays(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/summary/abcdef?days=-1", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getSummary(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	mockPatientData.AssertNotCalled(t, "GetSummary", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the time in range bands of a patient
+// @Description Get the % of cbg in the five consensus bands: very low, low, target, high & very high; by day and for the whole window.
+// @Description Default thresholds are 54, 70, 180 & 250 mg/dL, low & high being the patient's hypo & hyper limits when available.
+// @ID tide-whisperer-api-v1-gettimeinrange
+// @Produce json
+// @Success 200 {object} usecase.TimeInRangeResult
+// @Failure 400 {object} common.DetailedError
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to compute the time in range for"
+// @Param startDate query string false "ISO Date time (RFC3339) for the window lower limit, default to endDate - days" format(date-time)
+// @Param endDate query string false "ISO Date time (RFC3339) for the window upper limit, default to now" format(date-time)
+// @Param days query int false "Window duration in days when startDate is not set, default to 14"
+// @Param bgUnit query string false "The blood glucose unit of the result and the thresholds, can be mmol/L or mg/dL (default)."
+// @Param veryLow query number false "Very low threshold, in bgUnit"
+// @Param low query number false "Low threshold, in bgUnit"
+// @Param high query number false "High threshold, in bgUnit"
+// @Param veryHigh query number false "Very high threshold, in bgUnit"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/tir/{userID} [get]
+func (a *API) getTimeInRange(ctx context.Context, res *common.HttpResponseWriter) error {
+	query := res.URL.Query()
+	days, err := getDaysParam(query.Get("days"))
+	if err != nil {
+		return res.WriteError(err)
+	}
+	var thresholds usecase.TimeInRangeThresholds
+	for name, threshold := range map[string]*float64{
+		"veryLow":  &thresholds.VeryLow,
+		"low":      &thresholds.Low,
+		"high":     &thresholds.High,
+		"veryHigh": &thresholds.VeryHigh,
+	} {
+		if *threshold, err = getFloatParam(query, name); err != nil {
+			return res.WriteError(err)
+		}
+	}
+	tir, err := a.patientData.GetTimeInRange(ctx, usecase.GetTimeInRangeArgs{
+		UserID:       res.VARS["userID"],
+		TraceID:      res.TraceID,
+		SessionToken: getSessionToken(res),
+		StartDate:    query.Get("startDate"),
+		EndDate:      query.Get("endDate"),
+		Days:         days,
+		BgUnit:       query.Get("bgUnit"),
+		Thresholds:   thresholds,
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, tir)
+}
+
+// getFloatParam parse a positive number query parameter, 0 when not set
+func getFloatParam(query url.Values, name string) (float64, *common.DetailedError) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: fmt.Sprintf("invalid %s %q", name, value),
+		}
+	}
+	return number, nil
+}
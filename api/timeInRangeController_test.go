@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getTimeInRange(t *testing.T) {
+	tests := []struct {
+		name               string
+		givenQuery         string
+		expectedStatusCode int
+		expectedThresholds usecase.TimeInRangeThresholds
+	}{
+		{"Default thresholds", "", http.StatusOK, usecase.TimeInRangeThresholds{}},
+		{"Overridden thresholds", "veryLow=3&low=3.9&high=10&veryHigh=13.9&bgUnit=mmol/L", http.StatusOK, usecase.TimeInRangeThresholds{VeryLow: 3, Low: 3.9, High: 10, VeryHigh: 13.9}},
+		{"Invalid threshold", "low=abc", http.StatusBadRequest, usecase.TimeInRangeThresholds{}},
+		{"Negative threshold", "high=-1", http.StatusBadRequest, usecase.TimeInRangeThresholds{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPatientData := MockPatientDataUseCase{}
+			mockPatientData.On("GetTimeInRange", mock.Anything, mock.Anything).Return(&usecase.TimeInRangeResult{UserID: "abcdef"}, nil)
+			api := &API{patientData: &mockPatientData}
+			request, _ := http.NewRequest("GET", "/v1/tir/abcdef?"+tt.givenQuery, nil)
+			res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+			err := api.getTimeInRange(context.Background(), res)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedStatusCode == http.StatusOK {
+				mockPatientData.AssertCalled(t, "GetTimeInRange", mock.Anything, mock.MatchedBy(func(args usecase.GetTimeInRangeArgs) bool {
+					return args.UserID == "abcdef" && args.Thresholds == tt.expectedThresholds
+				}))
+			} else {
+				mockPatientData.AssertNotCalled(t, "GetTimeInRange", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// @Summary Get the uploads of a patient
+// @Description Get the uploads (data sets) of a patient, the newest first, with their device, the time range of their data and the number of data by type.
+// @Description The data whose upload datum is missing are reported as uploads with only their uploadId, after the others.
+// @ID tide-whisperer-api-v1-getuploads
+// @Produce json
+// @Success 200 {array} usecase.Upload
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/uploads/{userID} [get]
+func (a *API) getUploads(ctx context.Context, res *common.HttpResponseWriter) error {
+	uploads, err := a.patientData.GetUploads(ctx, usecase.GetUploadsArgs{
+		UserID:  res.VARS["userID"],
+		TraceID: res.TraceID,
+	})
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return writeJSONResult(res, uploads)
+}
+
+// @Summary Get the data of one upload of a patient
+// @Description Get the data of one upload (data set), the upload datum included, in time order.
+// @ID tide-whisperer-api-v1-getdatainupload
+// @Produce json
+// @Produce x-ndjson
+// @Success 200 {array} object
+// @Failure 403 {object} common.DetailedError
+// @Failure 500 {object} common.DetailedError
+// @Param userID path string true "The ID of the user to search data for"
+// @Param uploadID path string true "The ID of the upload"
+// @Param bgUnit query string false "The blood glucose unit of the returned data, can be mmol/L or mg/dL. If nothing is specified, blood glucose data will be returned as it is in database."
+// @Param format query string false "Output format, json (default) or ndjson. The Accept header application/x-ndjson is also supported."
+// @Param allSchemaVersions query string false "true to return the data of all the schema versions, not only the supported ones. Reserved to the server tokens." format(boolean)
+// @Param x-tidepool-trace-session header string false "Trace session uuid" format(uuid)
+// @Security Auth0
+// @Router /v1/uploads/{userID}/{uploadID}/data [get]
+func (a *API) getDataInUpload(ctx context.Context, res *common.HttpResponseWriter) error {
+	bgUnit := res.URL.Query().Get("bgUnit")
+	if bgUnit != usecase.MgdL && bgUnit != usecase.MmolL {
+		bgUnit = ""
+	}
+	allSchemaVersions, errSchema := a.getAllSchemaVersions(ctx, res)
+	if errSchema != nil {
+		return res.WriteError(errSchema)
+	}
+	format, contentType := getDataFormat(res)
+	err := a.patientData.GetDataInUpload(ctx, usecase.GetDataInUploadArgs{
+		UserID:            res.VARS["userID"],
+		TraceID:           res.TraceID,
+		UploadID:          res.VARS["uploadID"],
+		AllSchemaVersions: allSchemaVersions,
+		BgUnit:            bgUnit,
+		Format:            format,
+	}, res.StreamWriter(contentType))
+	if err != nil {
+		return res.WriteError(err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestAPI_getUploads(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetUploads", mock.Anything, mock.MatchedBy(func(args usecase.GetUploadsArgs) bool {
+		return args.UserID == "abcdef"
+	})).Return([]usecase.Upload{
+		{UploadID: "up1", DeviceModel: "Dexcom G6", DeviceSerialNumber: "1234", NumData: 2, DataCounts: map[string]int{"cbg": 2}},
+	}, nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/uploads/abcdef", nil)
+	res := &common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "abcdef"}, StatusCode: http.StatusOK}
+
+	err := api.getUploads(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `[{"uploadId":"up1","deviceModel":"Dexcom G6","deviceSerialNumber":"1234","numData":2,"dataCounts":{"cbg":2}}]`, res.WriteBuffer.String())
+}
+
+func TestAPI_getDataInUpload(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetDataInUpload", mock.Anything, mock.MatchedBy(func(args usecase.GetDataInUploadArgs) bool {
+		return args.UserID == "abcdef" && args.UploadID == "up1" && args.BgUnit == usecase.MmolL &&
+			args.Format == usecase.FormatNDJSON && !args.AllSchemaVersions
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte("{\"type\":\"upload\"}\n"))
+	}).Return(nil)
+	api := &API{patientData: &mockPatientData}
+	request, _ := http.NewRequest("GET", "/v1/uploads/abcdef/up1/data?bgUnit=mmol/L&format=ndjson", nil)
+	recorder := httptest.NewRecorder()
+	res := &common.HttpResponseWriter{
+		URL:        request.URL,
+		Header:     request.Header,
+		VARS:       map[string]string{"userID": "abcdef", "uploadID": "up1"},
+		StatusCode: http.StatusOK,
+		Writer:     recorder,
+	}
+
+	err := api.getDataInUpload(context.Background(), res)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, ndjsonContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"type\":\"upload\"}\n", recorder.Body.String())
+}
+
+func TestAPI_getDataInUpload_schemaVersion(t *testing.T) {
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetDataInUpload", mock.Anything, mock.MatchedBy(func(args usecase.GetDataInUploadArgs) bool {
+		return args.AllSchemaVersions
+	}), mock.Anything).Return(nil)
+	mockAuth.ExpectedCalls = nil
+	mockAuth.On("Authenticate", mock.Anything).Return(&token.TokenData{UserId: "server", IsServer: true})
+	defer resetMocks()
+	api := &API{patientData: &mockPatientData, authClient: mockAuth}
+	request, _ := http.NewRequest("GET", "/v1/uploads/abcdef/up1/data?allSchemaVersions=true", nil)
+	res := &common.HttpResponseWriter{
+		URL:        request.URL,
+		Header:     request.Header,
+		VARS:       map[string]string{"userID": "abcdef", "uploadID": "up1"},
+		StatusCode: http.StatusOK,
+		Writer:     httptest.NewRecorder(),
+	}
+
+	err := api.getDataInUpload(context.Background(), res)
+
+	assert.NoError(t, err)
+	mockPatientData.AssertExpectations(t)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+// getETag returns the quoted entity tag of a response: the validator of its data
+// and the request parameters changing its content
+func getETag(validator usecase.DataValidator, res *common.HttpResponseWriter, format string) string {
+	digest := sha256.New()
+	digest.Write([]byte(validator.ETag))
+	digest.Write([]byte{'\n'})
+	if res.URL != nil {
+		// Encode() sort the parameters
+		digest.Write([]byte(res.URL.Query().Encode()))
+	}
+	digest.Write([]byte{'\n'})
+	digest.Write([]byte(format))
+	return `"` + hex.EncodeToString(digest.Sum(nil)[:16]) + `"`
+}
+
+// checkValidator set the ETag & Last-Modified headers of the response, and answer 304 Not Modified
+// when the request preconditions match.
+// Returns true when the response content must be written.
+func checkValidator(res *common.HttpResponseWriter, validator usecase.DataValidator, format string) bool {
+	etag := getETag(validator, res, format)
+	header := res.Writer.Header()
+	header.Set("ETag", etag)
+	if !validator.LastModified.IsZero() {
+		header.Set("Last-Modified", validator.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if isNotModified(res.Header, etag, validator.LastModified) {
+		res.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// isNotModified evaluate the If-None-Match & If-Modified-Since request headers,
+// If-Modified-Since is ignored when If-None-Match is given (RFC 7232)
+func isNotModified(requestHeader http.Header, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := requestHeader.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	ifModifiedSince, err := http.ParseTime(requestHeader.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// The HTTP dates have a second precision
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/usecase"
+)
+
+func TestIsNotModified(t *testing.T) {
+	lastModified := time.Date(2023, time.April, 1, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected bool
+	}{
+		{"No precondition", map[string]string{}, false},
+		{"Matching ETag", map[string]string{"If-None-Match": `"other", "abc"`}, true},
+		{"Weak matching ETag", map[string]string{"If-None-Match": `W/"abc"`}, true},
+		{"Any ETag", map[string]string{"If-None-Match": `*`}, true},
+		{"Other ETag", map[string]string{"If-None-Match": `"other"`}, false},
+		{"ETag has precedence", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Sat, 01 Apr 2023 13:00:00 GMT"}, false},
+		{"Not modified since", map[string]string{"If-Modified-Since": "Sat, 01 Apr 2023 12:00:00 GMT"}, true},
+		{"Modified since", map[string]string{"If-Modified-Since": "Sat, 01 Apr 2023 11:59:59 GMT"}, false},
+		{"Invalid date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.header {
+				header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, isNotModified(header, `"abc"`, lastModified))
+		})
+	}
+}
+
+func TestAPI_getRangeLegacy_notModified(t *testing.T) {
+	validator := &usecase.DataValidator{ETag: "state", LastModified: time.Date(2023, time.April, 1, 12, 0, 0, 0, time.UTC)}
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetDataRangeValidator", mock.Anything, mock.Anything, "user1", false).Return(validator, nil)
+	mockPatientData.On("GetDataRangeLegacy", mock.Anything, mock.Anything, "user1", mock.Anything).Return(&common.Date{Start: "2023-01-01T00:00:00.000Z", End: "2023-04-01T00:00:00.000Z"}, nil)
+	api := &API{patientData: &mockPatientData}
+
+	request, _ := http.NewRequest("GET", "/v1/range/user1", nil)
+	res := common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "user1"}, StatusCode: http.StatusOK, Writer: httptest.NewRecorder()}
+	assert.NoError(t, api.getRangeLegacy(context.Background(), &res))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	etag := res.Writer.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "Sat, 01 Apr 2023 12:00:00 GMT", res.Writer.Header().Get("Last-Modified"))
+	assert.Equal(t, `["2023-01-01T00:00:00.000Z","2023-04-01T00:00:00.000Z"]`, res.WriteBuffer.String())
+
+	request.Header.Set("If-None-Match", etag)
+	res = common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "user1"}, StatusCode: http.StatusOK, Writer: httptest.NewRecorder()}
+	assert.NoError(t, api.getRangeLegacy(context.Background(), &res))
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, 0, res.WriteBuffer.Len())
+	mockPatientData.AssertNumberOfCalls(t, "GetDataRangeLegacy", 1)
+}
+
+func TestAPI_getDataV2_notModified(t *testing.T) {
+	validator := usecase.DataValidator{ETag: "state"}
+	mockPatientData := MockPatientDataUseCase{}
+	mockPatientData.On("GetData", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		if args.Get(1).(usecase.GetDataArgs).Validate(validator) {
+			_, _ = args.Get(2).(io.Writer).Write([]byte("[]"))
+		}
+	}).Return(nil)
+	api := &API{patientData: &mockPatientData}
+
+	request, _ := http.NewRequest("GET", "/v1/dataV2/user1?types=cbg", nil)
+	recorder := httptest.NewRecorder()
+	res := common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "user1"}, StatusCode: http.StatusOK, Writer: recorder}
+	assert.NoError(t, api.getDataV2(context.Background(), &res))
+	etag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "[]", recorder.Body.String())
+
+	t.Run("should depend on the query", func(t *testing.T) {
+		otherRequest, _ := http.NewRequest("GET", "/v1/dataV2/user1?types=smbg", nil)
+		otherRes := common.HttpResponseWriter{URL: otherRequest.URL, Header: otherRequest.Header, StatusCode: http.StatusOK}
+		assert.NotEqual(t, etag, getETag(validator, &otherRes, usecase.FormatJSON))
+	})
+
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	res = common.HttpResponseWriter{URL: request.URL, Header: request.Header, VARS: map[string]string{"userID": "user1"}, StatusCode: http.StatusOK, Writer: recorder}
+	assert.NoError(t, api.getDataV2(context.Background(), &res))
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.False(t, res.Streaming)
+	assert.Empty(t, recorder.Body.String())
+}
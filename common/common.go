@@ -27,6 +27,22 @@ type Params struct {
 	MedtronicUploadIds []string
 	UploadID           string
 	LevelFilter        []int
+	// CbgUploadIds the cloud syncs preferred by the source precedence: their cbg are read from the database
+	// even when the cbg type is excluded (read from the tide-v2 buckets)
+	CbgUploadIds []string
+	// Limit the maximum number of data to return, 0 for no limit.
+	// When set, the data are sorted by time and id
+	Limit int
+	// After only return the data after this position
+	After *Cursor
+	// Fields when not empty, only return these fields of the data, with their id, type & time
+	Fields []string
+	// ModifiedSince when set, only return the data created or modified after this time (ISO-8601 datetime).
+	// The inactive data are returned too, with their _active & modifiedTime fields
+	ModifiedSince string
+	// SourcePrecedence apply the Carelink, Dexcom & Medtronic source filters to the live data queries,
+	// they are always applied by the legacy query
+	SourcePrecedence bool
 }
 
 // Date struct
@@ -34,3 +50,9 @@ type Date struct {
 	Start string
 	End   string
 }
+
+// Cursor position of a datum in the (time, id) ordered data
+type Cursor struct {
+	Time string `json:"time"`
+	ID   string `json:"id"`
+}
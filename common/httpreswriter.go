@@ -3,10 +3,14 @@ package common
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
 )
 
+// StreamErrorTrailer HTTP trailer set when a streamed response failed after its first byte
+const StreamErrorTrailer = "X-Tidepool-Stream-Error"
+
 /*TODO : remove from common once it will not be used by api and usecase*/
 type (
 	// HttpResponseWriter used for middleware api functions.
@@ -26,9 +30,43 @@ type (
 		StatusCode  int
 		Err         *DetailedError
 		Size        int
+		// Body the request body, only read by the middleware for the POST routes
+		Body []byte
+		// Writer the client response writer, only used by streamed responses
+		Writer http.ResponseWriter
+		// Streaming true once the first byte has been sent to the client
+		Streaming bool
+	}
+
+	// streamWriter send the content straight to the client (chunked encoding)
+	streamWriter struct {
+		res         *HttpResponseWriter
+		contentType string
 	}
 )
 
+// StreamWriter returns a writer sending its content directly to the client.
+//
+// Nothing is sent before the first write, so WriteError() still produce a valid
+// JSON error until then. After that, errors are reported using the StreamErrorTrailer.
+func (res *HttpResponseWriter) StreamWriter(contentType string) io.Writer {
+	return &streamWriter{res: res, contentType: contentType}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	res := s.res
+	if !res.Streaming {
+		res.Streaming = true
+		header := res.Writer.Header()
+		header.Set("Content-Type", s.contentType)
+		header.Set("Trailer", StreamErrorTrailer)
+		res.Writer.WriteHeader(res.StatusCode)
+	}
+	size, err := res.Writer.Write(p)
+	res.Size += size
+	return size, err
+}
+
 func (res *HttpResponseWriter) Grow(n int) {
 	if n > 0 { // Avoid Grow panic()
 		res.WriteBuffer.Grow(n)
@@ -69,6 +107,11 @@ func (res *HttpResponseWriter) WriteError(err *DetailedError) error {
 	res.Err = err
 	res.Err.ID = res.TraceID
 
+	if res.Streaming {
+		// Too late to change the response, the middleware will report it
+		return nil
+	}
+
 	// Discard the previous content write, so we ends up with
 	// a valid json returned to the client
 	res.WriteBuffer.Reset()
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidResumeToken the resume token of a data stream is not valid
+var ErrInvalidResumeToken = errors.New("invalid resume token")
+
+// DataStream a stream of the data of a user, as they are written to the database
+type DataStream interface {
+	// TryNext wait a bit for the next datum, returns false when there is none yet or on error, see Err()
+	TryNext(ctx context.Context) bool
+	// Decode the current datum
+	Decode(val interface{}) error
+	// ResumeToken the opaque position of the current datum in the stream
+	ResumeToken() string
+	// Err the last error of the stream, nil when it is still usable
+	Err() error
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dataChangeStream a change stream of the deviceData collection, returning the full documents of its events
+type dataChangeStream struct {
+	*mongo.ChangeStream
+}
+
+// dataChangeEvent the part of a change event kept by the WatchData pipeline
+type dataChangeEvent struct {
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+// WatchData returns the stream of the datums activated for a user: inserted active, or activated at the end of their upload.
+// Only the datums in the schemaVersion range are returned, when it is not nil.
+//
+// The stream starts after the resumeToken position when it is set, now otherwise.
+// The server waits maxAwaitTime at most for new events on each TryNext().
+// A replica set is required.
+func (p *PatientDataMongoRepository) WatchData(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion, resumeToken string, maxAwaitTime time.Duration) (common.DataStream, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(maxAwaitTime).
+		SetComment(traceID)
+	if resumeToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(resumeToken)
+		if err != nil || bson.Raw(token).Validate() != nil {
+			return nil, common.ErrInvalidResumeToken
+		}
+		opts.SetResumeAfter(bson.Raw(token))
+	}
+
+	// The event _id is the resume token, it must be kept
+	projection := bson.M{"updateDescription": 0}
+	for field := range unwantedFields {
+		projection["fullDocument."+field] = 0
+	}
+	match := bson.M{
+		"fullDocument._userId": userID,
+		"fullDocument._active": true,
+		"$or": []bson.M{
+			{"operationType": "insert"},
+			{"operationType": "update", "updateDescription.updatedFields._active": true},
+		},
+	}
+	if schemaVersion != nil {
+		match["fullDocument._schemaVersion"] = bson.M{"$gte": schemaVersion.Minimum, "$lte": schemaVersion.Maximum}
+	}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$project": projection},
+	}
+	stream, err := dataCollection(p).Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dataChangeStream{ChangeStream: stream}, nil
+}
+
+// Decode the full document of the current event
+func (s *dataChangeStream) Decode(val interface{}) error {
+	var event dataChangeEvent
+	if err := s.ChangeStream.Decode(&event); err != nil {
+		return err
+	}
+	if event.FullDocument == nil {
+		return errors.New("change event without document")
+	}
+	return bson.Unmarshal(event.FullDocument, val)
+}
+
+// ResumeToken the base64 encoded resume token of the current event
+func (s *dataChangeStream) ResumeToken() string {
+	return base64.RawURLEncoding.EncodeToString(s.ChangeStream.ResumeToken())
+}
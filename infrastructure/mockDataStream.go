@@ -0,0 +1,60 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// mockDataStreamWait the time waited by TryNext once the data are all sent
+const mockDataStreamWait = 10 * time.Millisecond
+
+// MockDataStream a common.DataStream of JSON data, use for unit tests
+type MockDataStream struct {
+	numIter int
+	data    []string
+	// Error returned by Err once the data are all sent
+	Error  error
+	Closed bool
+}
+
+func NewMockDataStream(data []string) *MockDataStream {
+	return &MockDataStream{
+		numIter: -1,
+		data:    data,
+	}
+}
+
+// TryNext returns the next datum, or waits a bit like a change stream without events
+func (s *MockDataStream) TryNext(ctx context.Context) bool {
+	if s.numIter+1 < len(s.data) {
+		s.numIter++
+		return true
+	}
+	if s.Error == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(mockDataStreamWait):
+		}
+	}
+	return false
+}
+func (s *MockDataStream) Decode(val interface{}) error {
+	return json.Unmarshal([]byte(s.data[s.numIter]), &val)
+}
+
+// ResumeToken the 1-based index of the current datum
+func (s *MockDataStream) ResumeToken() string {
+	return strconv.Itoa(s.numIter + 1)
+}
+func (s *MockDataStream) Err() error {
+	if s.numIter+1 < len(s.data) {
+		return nil
+	}
+	return s.Error
+}
+func (s *MockDataStream) Close(ctx context.Context) error {
+	s.Closed = true
+	return nil
+}
@@ -24,10 +24,19 @@ func NewMockDbAdapterIterator(data []string) *MockDbAdapterIterator {
 	}
 }
 
+// NewFailingMockDbAdapterIterator returns an iterator which fails with err after the data, like a cursor
+// which looses its connection in the middle of the data
+func NewFailingMockDbAdapterIterator(data []string, err error) *MockDbAdapterIterator {
+	iter := NewMockDbAdapterIterator(data)
+	iter.err = err
+	return iter
+}
+
 type MockDbAdapterIterator struct {
 	numIter int
 	maxIter int
 	data    []string
+	err     error
 }
 
 func (i *MockDbAdapterIterator) Next(ctx context.Context) bool {
@@ -40,6 +49,12 @@ func (i *MockDbAdapterIterator) Close(ctx context.Context) error {
 func (i *MockDbAdapterIterator) Decode(val interface{}) error {
 	return json.Unmarshal([]byte(i.data[i.numIter]), &val)
 }
+func (i *MockDbAdapterIterator) Err() error {
+	if i.numIter < i.maxIter {
+		return nil
+	}
+	return i.err
+}
 
 // MockDbAdapter use for unit tests
 type MockDbAdapter struct {
@@ -2,7 +2,9 @@ package infrastructure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	goComMgo "github.com/tidepool-org/go-common/clients/mongo"
 	"github.com/tidepool-org/tide-whisperer/common"
@@ -31,7 +33,7 @@ func NewMockPatientDataRepository() *MockPatientDataRepository {
 }
 
 // GetDataRangeLegacy mock func, return nil,nil
-func (c *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error) {
+func (c *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion) (*common.Date, error) {
 	if c.DataRangeV1 != nil && len(c.DataRangeV1) == 2 {
 		return &common.Date{
 			Start: c.DataRangeV1[0],
@@ -42,7 +44,7 @@ func (c *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, trac
 }
 
 // GetDataInDeviceData GetDataV1 v1 api mock call to fetch diabetes data
-func (c *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, traceID string, userID string, dates *common.Date, excludedType []string) (goComMgo.StorageIterator, error) {
+func (c *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, traceID string, params *common.Params, excludedType []string) (goComMgo.StorageIterator, error) {
 	if c.DataV1 != nil {
 		return &MockDbAdapterIterator{
 			numIter: -1,
@@ -50,7 +52,7 @@ func (c *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, tra
 			data:    c.DataV1,
 		}, nil
 	}
-	return nil, fmt.Errorf("{%s} - [%s] - No data", traceID, userID)
+	return nil, fmt.Errorf("{%s} - [%s] - No data", traceID, params.UserID)
 }
 
 func (c *MockPatientDataRepository) GetLatestBasalSecurityProfile(ctx context.Context, traceID string, userID string) (*schema.DbProfile, error) {
@@ -60,8 +62,67 @@ func (c *MockPatientDataRepository) GetLatestBasalSecurityProfile(ctx context.Co
 	return nil, nil
 }
 
+// GetBasalSecurityProfiles mock func, return the BasalSecurityProfile
+func (c *MockPatientDataRepository) GetBasalSecurityProfiles(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time) ([]schema.DbProfile, error) {
+	if c.BasalSecurityProfile != nil {
+		return []schema.DbProfile{*c.BasalSecurityProfile}, nil
+	}
+	return nil, nil
+}
+
+// GetLatestDatum mock func, return the first DataV1 datum of the requested type
+func (c *MockPatientDataRepository) GetLatestDatum(ctx context.Context, traceID string, userID string, datumType string, schemaVersion *common.SchemaVersion) (map[string]interface{}, error) {
+	for _, jsonDatum := range c.DataV1 {
+		var datum map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonDatum), &datum); err == nil && datum["type"] == datumType {
+			return datum, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetUploads mock func, return nil
+func (c *MockPatientDataRepository) GetUploads(ctx context.Context, traceID string, userID string) ([]schema.DbUpload, error) {
+	return nil, nil
+}
+
+// GetUploadsDataCount mock func, return nil
+func (c *MockPatientDataRepository) GetUploadsDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbUploadTypeCount, error) {
+	return nil, nil
+}
+
+// GetDevicesDataCount mock func, return nil
+func (c *MockPatientDataRepository) GetDevicesDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbDeviceTypeCount, error) {
+	return nil, nil
+}
+
+// GetUploadsDataRange mock func, return an empty range
+func (c *MockPatientDataRepository) GetUploadsDataRange(ctx context.Context, traceID string, userID string, uploadIDs []string) (*common.Date, error) {
+	return &common.Date{}, nil
+}
+
+// CountSchemaVersionFiltered mock func, return 0
+func (c *MockPatientDataRepository) CountSchemaVersionFiltered(ctx context.Context, traceID string, params *common.Params) (int64, error) {
+	return 0, nil
+}
+
+// GetDataState mock func, return an empty state
+func (c *MockPatientDataRepository) GetDataState(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (*schema.DbDataState, error) {
+	return &schema.DbDataState{}, nil
+}
+
+// WatchData mock func, return a stream of the DataV1
+func (c *MockPatientDataRepository) WatchData(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion, resumeToken string, maxAwaitTime time.Duration) (common.DataStream, error) {
+	return NewMockDataStream(c.DataV1), nil
+}
+
+// GetDataInUpload mock func, return the DataV1
+func (c *MockPatientDataRepository) GetDataInUpload(ctx context.Context, traceID string, params *common.Params) (goComMgo.StorageIterator, error) {
+	return c.GetDataInDeviceData(ctx, traceID, params, nil)
+}
+
 // GetUploadData GetUploadDataV1 Fetch upload data from theirs upload ids, using the $in query parameter
-func (c *MockPatientDataRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string) (goComMgo.StorageIterator, error) {
+func (c *MockPatientDataRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string, schemaVersion *common.SchemaVersion) (goComMgo.StorageIterator, error) {
 	if c.DataIDV1 != nil {
 		return &MockDbAdapterIterator{
 			numIter: -1,
@@ -39,6 +39,45 @@ var unwantedFields = bson.M{
 	"source":             0,
 }
 
+// requestableFields the unwanted fields which are returned when they are part of params.Fields,
+// e.g. to compute the local time of the data without timezone
+var requestableFields = map[string]bool{"timezoneOffset": true}
+
+// syncFields the fields of the data returned with params.ModifiedSince, to tell the deleted data
+var syncFields = []string{"_active", "modifiedTime"}
+
+// dataProjection returns the projection of the data: the requested fields with the id, type & time
+// when params.Fields is not empty, all but the unwantedFields otherwise. The unwanted fields are never returned,
+// but the syncFields with params.ModifiedSince and the requestableFields.
+func dataProjection(params *common.Params) bson.M {
+	var projection bson.M
+	if len(params.Fields) == 0 {
+		projection = unwantedFields
+		if params.ModifiedSince != "" {
+			projection = make(bson.M, len(unwantedFields))
+			for field, value := range unwantedFields {
+				projection[field] = value
+			}
+			for _, field := range syncFields {
+				delete(projection, field)
+			}
+		}
+		return projection
+	}
+	projection = bson.M{"_id": 0, "id": 1, "type": 1, "time": 1}
+	for _, field := range params.Fields {
+		if _, unwanted := unwantedFields[field]; !unwanted || requestableFields[field] {
+			projection[field] = 1
+		}
+	}
+	if params.ModifiedSince != "" {
+		for _, field := range syncFields {
+			projection[field] = 1
+		}
+	}
+	return projection
+}
+
 var wantedRangeFields = bson.M{
 	"_id":  0,
 	"time": 1,
@@ -89,12 +128,12 @@ func dataCollection(p *PatientDataMongoRepository) *mongo.Collection {
 // on parameters
 func generateMongoQuery(p *common.Params) bson.M {
 
-	finalQuery := bson.M{}
 	skipParamsQuery := false
 	groupDataQuery := bson.M{
-		"_userId":        p.UserID,
-		"_active":        true,
-		"_schemaVersion": bson.M{"$gte": p.SchemaVersion.Minimum, "$lte": p.SchemaVersion.Maximum}}
+		"_userId": p.UserID,
+		"_active": true,
+	}
+	addSchemaVersionFilter(groupDataQuery, p.SchemaVersion)
 
 	//if optional parameters are present, then add them to the query
 	if len(p.Types) > 0 && p.Types[0] != "" {
@@ -132,69 +171,49 @@ func generateMongoQuery(p *common.Params) bson.M {
 	// data source-based filtering
 	if p.UploadID != "" {
 		groupDataQuery["uploadId"] = p.UploadID
-		finalQuery = groupDataQuery
-	} else {
-		andQuery := []bson.M{}
-		if !p.Dexcom && p.DexcomDataSource != nil {
-			dexcomQuery := []bson.M{
-				{"type": bson.M{"$ne": "cbg"}},
-				{"uploadId": bson.M{"$in": p.DexcomDataSource["dataSetIds"]}},
-			}
-			if earliestDataTime, ok := p.DexcomDataSource["earliestDataTime"].(time.Time); ok {
-				dexcomQuery = append(dexcomQuery, bson.M{"time": bson.M{"$lt": earliestDataTime.Format(time.RFC3339)}})
-			}
-			if latestDataTime, ok := p.DexcomDataSource["latestDataTime"].(time.Time); ok {
-				dexcomQuery = append(dexcomQuery, bson.M{"time": bson.M{"$gt": latestDataTime.Format(time.RFC3339)}})
-			}
-			andQuery = append(andQuery, bson.M{"$or": dexcomQuery})
-		}
+		return groupDataQuery
+	}
+	addAndFilter(groupDataQuery, sourceFilters(p)...)
+	if !skipParamsQuery {
+		addLevelFilter(groupDataQuery, p.LevelFilter)
+	}
+	return groupDataQuery
+}
 
-		if !p.Medtronic && len(p.MedtronicUploadIds) > 0 {
-			medtronicQuery := []bson.M{
-				{"time": bson.M{"$lt": p.MedtronicDate}},
-				{"type": bson.M{"$nin": []string{"basal", "bolus", "cbg"}}},
-				{"uploadId": bson.M{"$nin": p.MedtronicUploadIds}},
-			}
-			andQuery = append(andQuery, bson.M{"$or": medtronicQuery})
+// sourceFilters returns the filters excluding the data of the less preferred sources, where they overlap:
+// the cbg of the other sources during the Dexcom data source time range, unless p.Dexcom is set,
+// and the basal, bolus & cbg of the Medtronic direct uploads after p.MedtronicDate, unless p.Medtronic is set
+func sourceFilters(p *common.Params) []bson.M {
+	filters := []bson.M{}
+	if !p.Dexcom && p.DexcomDataSource != nil {
+		dexcomQuery := []bson.M{
+			{"type": bson.M{"$ne": "cbg"}},
+			{"uploadId": bson.M{"$in": p.DexcomDataSource["dataSetIds"]}},
 		}
-
-		if len(andQuery) > 0 {
-			groupDataQuery["$and"] = andQuery
-			finalQuery = groupDataQuery
-		} else if skipParamsQuery || len(p.LevelFilter) == 0 {
-			finalQuery = groupDataQuery
-		} else {
-			paramQuery := []bson.M{}
-			// create the level filter as string
-			levelFilterAsString := []string{}
-			for value := range p.LevelFilter {
-				levelFilterAsString = append(levelFilterAsString, strconv.Itoa(value))
-			}
-			paramQuery = append(paramQuery, groupDataQuery)
-
-			deviceParametersQuery := bson.M{}
-			deviceParametersQuery["type"] = "deviceEvent"
-			deviceParametersQuery["subType"] = "deviceParameter"
-			deviceParametersQuery["level"] = bson.M{"$in": levelFilterAsString}
-			otherDataQuery := bson.M{}
-			otherDataQuery["subType"] = bson.M{"$ne": "deviceParameter"}
-
-			orQuery := []bson.M{}
-			orQuery = append(orQuery, deviceParametersQuery)
-			orQuery = append(orQuery, otherDataQuery)
-
-			paramQuery = append(paramQuery, bson.M{"$or": orQuery})
-			finalQuery = bson.M{"$and": paramQuery}
+		if earliestDataTime, ok := p.DexcomDataSource["earliestDataTime"].(time.Time); ok {
+			dexcomQuery = append(dexcomQuery, bson.M{"time": bson.M{"$lt": earliestDataTime.Format(time.RFC3339)}})
+		}
+		if latestDataTime, ok := p.DexcomDataSource["latestDataTime"].(time.Time); ok {
+			dexcomQuery = append(dexcomQuery, bson.M{"time": bson.M{"$gt": latestDataTime.Format(time.RFC3339)}})
 		}
+		filters = append(filters, bson.M{"$or": dexcomQuery})
 	}
 
-	return finalQuery
+	if !p.Medtronic && len(p.MedtronicUploadIds) > 0 {
+		medtronicQuery := []bson.M{
+			{"time": bson.M{"$lt": p.MedtronicDate}},
+			{"type": bson.M{"$nin": []string{"basal", "bolus", "cbg"}}},
+			{"uploadId": bson.M{"$nin": p.MedtronicUploadIds}},
+		}
+		filters = append(filters, bson.M{"$or": medtronicQuery})
+	}
+	return filters
 }
 
-// GetDataRangeLegacy returns the time data range
+// GetDataRangeLegacy returns the time data range of the active data, in the schemaVersion range when it is not nil
 //
 // If no data for the requested user, return nil or empty string dates
-func (p *PatientDataMongoRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error) {
+func (p *PatientDataMongoRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion) (*common.Date, error) {
 
 	dateRange := &common.Date{
 		Start: "",
@@ -205,8 +224,10 @@ func (p *PatientDataMongoRepository) GetDataRangeLegacy(ctx context.Context, tra
 	query := bson.M{
 		"_userId": userID,
 		// Use only diabetes data, excluding upload & pumpSettings
-		"type": bson.M{"$not": bson.M{"$in": []string{"upload", "pumpSettings"}}},
+		"type":    bson.M{"$not": bson.M{"$in": []string{"upload", "pumpSettings"}}},
+		"_active": true,
 	}
+	addSchemaVersionFilter(query, schemaVersion)
 
 	opts := options.FindOne()
 	opts.SetProjection(wantedRangeFields)
@@ -236,7 +257,10 @@ func (p *PatientDataMongoRepository) GetDataRangeLegacy(ctx context.Context, tra
 
 // GetDataInDeviceData GetDataV1 v1 api call to fetch diabetes data, excludes "upload" and "pumpSettings"
 // and potentially other types
-func (p *PatientDataMongoRepository) GetDataInDeviceData(ctx context.Context, traceID string, userID string, dates *common.Date, excludeTypes []string) (goComMgo.StorageIterator, error) {
+//
+// The query uses the UserID, Date, Types, SubTypes, Fields, ModifiedSince & SchemaVersion of params.
+// Only the active data are returned, unless ModifiedSince is set.
+func (p *PatientDataMongoRepository) GetDataInDeviceData(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (goComMgo.StorageIterator, error) {
 	if !InArray("upload", excludeTypes) {
 		excludeTypes = append(excludeTypes, "upload")
 	}
@@ -244,8 +268,18 @@ func (p *PatientDataMongoRepository) GetDataInDeviceData(ctx context.Context, tr
 		excludeTypes = append(excludeTypes, "pumpSettings")
 	}
 
-	query := buildFilter(userID, excludeTypes)
+	excludeTypes, cbgFilter := cloudSyncCbgFilter(params, excludeTypes)
+	query := buildFilter(params, excludeTypes)
+	if cbgFilter != nil {
+		addAndFilter(query, cbgFilter)
+	}
+	if params.ModifiedSince == "" {
+		// The inactive data are the tombstones of the incremental sync
+		query["_active"] = true
+	}
+	addSchemaVersionFilter(query, params.SchemaVersion)
 
+	dates := params.Date
 	if dates.Start != "" && dates.End != "" {
 		query["time"] = bson.M{"$gte": dates.Start, "$lt": dates.End}
 	} else if dates.Start != "" {
@@ -254,9 +288,19 @@ func (p *PatientDataMongoRepository) GetDataInDeviceData(ctx context.Context, tr
 		query["time"] = bson.M{"$lt": dates.End}
 	}
 
+	addCursorFilter(query, params.After)
+	addModifiedSinceFilter(query, params.ModifiedSince)
+	addSourceFilter(query, params)
+	addLevelFilter(query, params.LevelFilter)
+
 	opts := options.Find()
-	opts.SetProjection(unwantedFields)
+	opts.SetProjection(dataProjection(params))
 	opts.SetComment(traceID)
+	if params.Limit > 0 {
+		// Paginated read, the cursor is based on the (time, id) order
+		opts.SetSort(bson.D{{Key: "time", Value: 1}, {Key: "id", Value: 1}})
+		opts.SetLimit(int64(params.Limit))
+	}
 
 	return dataCollection(p).Find(ctx, query, opts)
 }
@@ -288,32 +332,454 @@ func (p *PatientDataMongoRepository) GetLatestBasalSecurityProfile(ctx context.C
 	return &result, nil
 }
 
-// GetUploadDataV1 Fetch upload data from theirs upload ids, using the $in query parameter
-func (p *PatientDataMongoRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string) (goComMgo.StorageIterator, error) {
+// GetBasalSecurityProfiles returns the basal security profiles applied during a window, in time order:
+// the profiles created during the window, and the one in effect at its beginning.
+// A zero startTime or endTime leaves the window unbounded on this side.
+func (p *PatientDataMongoRepository) GetBasalSecurityProfiles(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time) ([]schema.DbProfile, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	profiles := make([]schema.DbProfile, 0)
+	if !startTime.IsZero() {
+		query := bson.M{
+			"_userId": userID,
+			"type":    "basalSecurity",
+			"time":    bson.M{"$lte": startTime},
+		}
+		opts := options.FindOne()
+		opts.SetSort(bson.M{"time": -1})
+		opts.SetComment(traceID)
+		var previous schema.DbProfile
+		err := dataCollection(p).FindOne(ctx, query, opts).Decode(&previous)
+		if err == nil {
+			profiles = append(profiles, previous)
+		} else if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	timeFilter := bson.M{}
+	if !startTime.IsZero() {
+		timeFilter["$gt"] = startTime
+	}
+	if !endTime.IsZero() {
+		timeFilter["$lte"] = endTime
+	}
+	query := bson.M{
+		"_userId": userID,
+		"type":    "basalSecurity",
+	}
+	if len(timeFilter) > 0 {
+		query["time"] = timeFilter
+	}
+	opts := options.Find()
+	opts.SetSort(bson.M{"time": 1})
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var inWindow []schema.DbProfile
+	if err = cursor.All(ctx, &inWindow); err != nil {
+		return nil, err
+	}
+	return append(profiles, inWindow...), nil
+}
+
+// GetLatestDatum returns the newest active datum of a type, in the schemaVersion range when it is not nil,
+// nil if the user has none
+func (p *PatientDataMongoRepository) GetLatestDatum(ctx context.Context, traceID string, userID string, datumType string, schemaVersion *common.SchemaVersion) (map[string]interface{}, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	query := bson.M{
+		"_userId": userID,
+		"type":    datumType,
+		"_active": true,
+	}
+	addSchemaVersionFilter(query, schemaVersion)
+	opts := options.FindOne()
+	opts.SetProjection(unwantedFields)
+	opts.SetSort(bson.D{{Key: "time", Value: -1}})
+	opts.SetHint(idxUserIDTypeTime)
+	opts.SetComment(traceID)
+	var datum map[string]interface{}
+	err := dataCollection(p).FindOne(ctx, query, opts).Decode(&datum)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return datum, nil
+}
+
+// GetUploadDataV1 Fetch upload data from theirs upload ids, using the $in query parameter.
+// Only the active ones are returned, in the schemaVersion range when it is not nil
+func (p *PatientDataMongoRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string, schemaVersion *common.SchemaVersion) (goComMgo.StorageIterator, error) {
 	query := bson.M{
 		"uploadId": bson.M{"$in": uploadIds},
 		"type":     "upload",
+		"_active":  true,
+	}
+	addSchemaVersionFilter(query, schemaVersion)
+
+	opts := options.Find()
+	opts.SetProjection(unwantedFields)
+	opts.SetComment(traceID)
+	return dataCollection(p).Find(ctx, query, opts)
+}
+
+// GetUploads returns the active upload datums of a user, the newest first
+func (p *PatientDataMongoRepository) GetUploads(ctx context.Context, traceID string, userID string) ([]schema.DbUpload, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	query := bson.M{
+		"_userId": userID,
+		"type":    "upload",
+		"_active": true,
+	}
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "time", Value: -1}})
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	uploads := make([]schema.DbUpload, 0)
+	if err = cursor.All(ctx, &uploads); err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// GetUploadsDataCount returns the number of active data by upload & type of a user, the upload datums excluded
+func (p *PatientDataMongoRepository) GetUploadsDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbUploadTypeCount, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"_userId": userID, "type": bson.M{"$ne": "upload"}, "_active": true}},
+		{"$group": bson.M{
+			"_id":   bson.M{"uploadId": "$uploadId", "type": "$type"},
+			"count": bson.M{"$sum": 1},
+			"start": bson.M{"$min": "$time"},
+			"end":   bson.M{"$max": "$time"},
+		}},
+		{"$project": bson.M{
+			"_id":      0,
+			"uploadId": "$_id.uploadId",
+			"type":     "$_id.type",
+			"count":    1,
+			"start":    1,
+			"end":      1,
+		}},
+	}
+	opts := options.Aggregate()
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]schema.DbUploadTypeCount, 0)
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetUploadsDataRange returns the time range of the active data of some uploads of a user, the upload datums excluded
+//
+// The dates are empty when these uploads have no data
+func (p *PatientDataMongoRepository) GetUploadsDataRange(ctx context.Context, traceID string, userID string, uploadIDs []string) (*common.Date, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"_userId": userID, "uploadId": bson.M{"$in": uploadIDs}, "type": bson.M{"$ne": "upload"}, "_active": true}},
+		{"$group": bson.M{
+			"_id":   nil,
+			"start": bson.M{"$min": "$time"},
+			"end":   bson.M{"$max": "$time"},
+		}},
+	}
+	opts := options.Aggregate()
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]common.Date, 0, 1)
+	if err = cursor.All(ctx, &ranges); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return &common.Date{}, nil
+	}
+	return &ranges[0], nil
+}
+
+// CountSchemaVersionFiltered returns the number of active data of a user in the params Date window
+// which are not in the params SchemaVersion range, so are not returned by GetDataInDeviceData
+func (p *PatientDataMongoRepository) CountSchemaVersionFiltered(ctx context.Context, traceID string, params *common.Params) (int64, error) {
+	if params.UserID == "" {
+		return 0, errors.New("invalid user id")
+	}
+	if params.SchemaVersion == nil {
+		return 0, nil
 	}
 
+	query := bson.M{
+		"_userId": params.UserID,
+		"_active": true,
+		// $not matches the data without _schemaVersion too
+		"_schemaVersion": bson.M{"$not": bson.M{"$gte": params.SchemaVersion.Minimum, "$lte": params.SchemaVersion.Maximum}},
+	}
+	dates := params.Date
+	if dates.Start != "" && dates.End != "" {
+		query["time"] = bson.M{"$gte": dates.Start, "$lt": dates.End}
+	} else if dates.Start != "" {
+		query["time"] = bson.M{"$gte": dates.Start}
+	} else if dates.End != "" {
+		query["time"] = bson.M{"$lt": dates.End}
+	}
+	opts := options.Count()
+	opts.SetComment(traceID)
+	return dataCollection(p).CountDocuments(ctx, query, opts)
+}
+
+// GetDataState returns the number of data of a user in the params Date window, and their newest modification time.
+// The data of excludeTypes and, when params.SchemaVersion is set, out of its range are not part of the state.
+//
+// The inactive data are counted, so a deletion changes the state. With a Date window, the uploads of the user are
+// counted whatever their time, unless excluded: a new upload changes the state, even when it backfills the window
+// (the tide-v2 buckets & the pump settings are fed by the uploads).
+func (p *PatientDataMongoRepository) GetDataState(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (*schema.DbDataState, error) {
+	if params.UserID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	match := bson.M{"_userId": params.UserID}
+	window := bson.M{}
+	dates := params.Date
+	if dates.Start != "" && dates.End != "" {
+		window["time"] = bson.M{"$gte": dates.Start, "$lt": dates.End}
+	} else if dates.Start != "" {
+		window["time"] = bson.M{"$gte": dates.Start}
+	} else if dates.End != "" {
+		window["time"] = bson.M{"$lt": dates.End}
+	}
+	addSchemaVersionFilter(window, params.SchemaVersion)
+	if len(excludeTypes) > 0 {
+		window["type"] = bson.M{"$nin": excludeTypes}
+	}
+	if _, ok := window["time"]; ok && !InArray("upload", excludeTypes) {
+		match["$or"] = []bson.M{window, {"type": "upload"}}
+	} else {
+		for key, value := range window {
+			match[key] = value
+		}
+	}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":          nil,
+			"count":        bson.M{"$sum": 1},
+			"lastModified": bson.M{"$max": bson.M{"$ifNull": []interface{}{"$modifiedTime", "$createdTime"}}},
+		}},
+	}
+	opts := options.Aggregate()
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]schema.DbDataState, 0, 1)
+	if err = cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return &schema.DbDataState{}, nil
+	}
+	return &states[0], nil
+}
+
+// GetDevicesDataCount returns the number of active data by device & type of a user, the upload datums excluded
+//
+// The deviceId is not part of the returned data (see unwantedFields), it is only used here to know which device produced them
+func (p *PatientDataMongoRepository) GetDevicesDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbDeviceTypeCount, error) {
+	if userID == "" {
+		return nil, errors.New("invalid user id")
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"_userId": userID, "type": bson.M{"$ne": "upload"}, "_active": true}},
+		{"$group": bson.M{
+			"_id":   bson.M{"deviceId": "$deviceId", "type": "$type"},
+			"count": bson.M{"$sum": 1},
+			"start": bson.M{"$min": "$time"},
+			"end":   bson.M{"$max": "$time"},
+		}},
+		{"$project": bson.M{
+			"_id":      0,
+			"deviceId": "$_id.deviceId",
+			"type":     "$_id.type",
+			"count":    1,
+			"start":    1,
+			"end":      1,
+		}},
+	}
+	opts := options.Aggregate()
+	opts.SetComment(traceID)
+	cursor, err := dataCollection(p).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]schema.DbDeviceTypeCount, 0)
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetDataInUpload returns the data of one upload, the upload datum included, in time order
+//
+// The query uses the UserID, UploadID & SchemaVersion of params
+func (p *PatientDataMongoRepository) GetDataInUpload(ctx context.Context, traceID string, params *common.Params) (goComMgo.StorageIterator, error) {
+	if params.UploadID == "" {
+		return nil, errors.New("invalid upload id")
+	}
+	query := generateMongoQuery(params)
+
 	opts := options.Find()
 	opts.SetProjection(unwantedFields)
+	opts.SetSort(bson.D{{Key: "time", Value: 1}})
 	opts.SetComment(traceID)
 	return dataCollection(p).Find(ctx, query, opts)
 }
 
-func buildFilter(userID string, excludeTypes []string) bson.M {
+// addCursorFilter restrict the query to the data after the cursor position, in the (time, id) order
+func addCursorFilter(query bson.M, after *common.Cursor) {
+	if after == nil {
+		return
+	}
+	query["$or"] = []bson.M{
+		{"time": bson.M{"$gt": after.Time}},
+		{"time": after.Time, "id": bson.M{"$gt": after.ID}},
+	}
+}
+
+// addModifiedSinceFilter restrict the query to the data created or modified after a time,
+// the data never modified have no modifiedTime
+func addModifiedSinceFilter(query bson.M, modifiedSince string) {
+	if modifiedSince == "" {
+		return
+	}
+	// $and, the cursor filter is a $or too
+	addAndFilter(query, bson.M{"$or": []bson.M{
+		{"modifiedTime": bson.M{"$gt": modifiedSince}},
+		{"modifiedTime": bson.M{"$exists": false}, "createdTime": bson.M{"$gt": modifiedSince}},
+	}})
+}
+
+// addSchemaVersionFilter restrict the query to the data in the schemaVersion range, when it is not nil
+func addSchemaVersionFilter(query bson.M, schemaVersion *common.SchemaVersion) {
+	if schemaVersion == nil {
+		return
+	}
+	query["_schemaVersion"] = bson.M{"$gte": schemaVersion.Minimum, "$lte": schemaVersion.Maximum}
+}
+
+// addSourceFilter apply the source precedence of the params to the query, when params.SourcePrecedence is set:
+// the Carelink data are excluded unless params.Carelink is set, see sourceFilters() for the other sources
+func addSourceFilter(query bson.M, params *common.Params) {
+	if !params.SourcePrecedence {
+		return
+	}
+	if !params.Carelink {
+		query["source"] = bson.M{"$ne": "carelink"}
+	}
+	addAndFilter(query, sourceFilters(params)...)
+}
+
+// cloudSyncCbgFilter when the cbg are excluded (read from the tide-v2 buckets) and the source precedence
+// prefers some cloud syncs (params.CbgUploadIds), returns the excluded types without cbg and the filter
+// restricting the cbg to these cloud syncs
+func cloudSyncCbgFilter(params *common.Params, excludeTypes []string) ([]string, bson.M) {
+	if !params.SourcePrecedence || len(params.CbgUploadIds) == 0 || !InArray("cbg", excludeTypes) {
+		return excludeTypes, nil
+	}
+	types := make([]string, 0, len(excludeTypes))
+	for _, excludeType := range excludeTypes {
+		if excludeType != "cbg" {
+			types = append(types, excludeType)
+		}
+	}
+	return types, bson.M{"$or": []bson.M{
+		{"type": bson.M{"$ne": "cbg"}},
+		{"uploadId": bson.M{"$in": params.CbgUploadIds}},
+	}}
+}
+
+// addLevelFilter restrict the device parameters of the query to these levels, when there are some.
+// The levels are stored as strings, or numbers by some uploaders. The device parameters without level
+// are kept, like usecase isParameterLevelKept() does.
+func addLevelFilter(query bson.M, levels []int) {
+	if len(levels) == 0 {
+		return
+	}
+	levelsAsString := make([]string, 0, len(levels))
+	for _, level := range levels {
+		levelsAsString = append(levelsAsString, strconv.Itoa(level))
+	}
+	addAndFilter(query, bson.M{"$or": []bson.M{
+		{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$in": levelsAsString}},
+		{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$in": levels}},
+		{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$exists": false}},
+		{"subType": bson.M{"$ne": "deviceParameter"}},
+	}})
+}
+
+// addAndFilter add filters to the $and of the query
+func addAndFilter(query bson.M, filters ...bson.M) {
+	if len(filters) == 0 {
+		return
+	}
+	andQuery, _ := query["$and"].([]bson.M)
+	query["$and"] = append(andQuery, filters...)
+}
+
+func buildFilter(params *common.Params, excludeTypes []string) bson.M {
+	typeFilter := bson.M{"$nin": excludeTypes}
+	if len(params.Types) > 0 {
+		typeFilter["$in"] = params.Types
+	}
+	filter := bson.M{
+		"_userId": params.UserID,
+		"type":    typeFilter,
+	}
+
+	subTypeFilter := bson.M{}
 	if InArray("deviceParameter", excludeTypes) {
 		// parameters type is defined by two dimensions a type deviceEvent and a subtype deviceParameter
-		excludedSubType := []string{"deviceParameter"}
-		return bson.M{
-			"_userId": userID,
-			"type":    bson.M{"$nin": excludeTypes},
-			"subType": bson.M{"$nin": excludedSubType},
-		}
-	} else {
-		return bson.M{
-			"_userId": userID,
-			"type":    bson.M{"$nin": excludeTypes},
+		subTypeFilter["$nin"] = []string{"deviceParameter"}
+	}
+	if len(params.SubTypes) > 0 {
+		// Data without subType are not filtered: nil matches a missing field
+		subTypes := make([]interface{}, 0, len(params.SubTypes)+1)
+		for _, subType := range params.SubTypes {
+			subTypes = append(subTypes, subType)
 		}
+		subTypeFilter["$in"] = append(subTypes, nil)
+	}
+	if len(subTypeFilter) > 0 {
+		filter["subType"] = subTypeFilter
 	}
+	return filter
 }
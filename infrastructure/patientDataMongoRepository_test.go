@@ -3,16 +3,20 @@ package infrastructure
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/schema"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	goComMgo "github.com/tidepool-org/go-common/clients/mongo"
 )
@@ -292,6 +296,29 @@ func TestStore_generateMongoQuery_uploadId(t *testing.T) {
 	}
 }
 
+func TestStore_generateMongoQuery_allSchemaVersions(t *testing.T) {
+
+	qParams := &common.Params{
+		UserID:   "abc123",
+		UploadID: "xyz123",
+	}
+	query := generateMongoQuery(qParams)
+
+	expectedQuery := bson.M{
+		"_userId":  "abc123",
+		"_active":  true,
+		"uploadId": "xyz123",
+		"source": bson.M{
+			"$ne": "carelink",
+		},
+	}
+
+	eq := reflect.DeepEqual(query, expectedQuery)
+	if !eq {
+		t.Error(getErrString(query, expectedQuery))
+	}
+}
+
 func TestStore_generateMongoQuery_noDates(t *testing.T) {
 
 	query := typeAndSubtypeQuery()
@@ -325,25 +352,32 @@ func TestStore_generateMongoQuery_blip(t *testing.T) {
 	query := blipQuery()
 
 	expectedQuery := bson.M{
+		"_userId":        "abc123",
+		"_active":        true,
+		"_schemaVersion": bson.M{"$gte": 0, "$lte": 2},
+		"source":         bson.M{"$ne": "carelink"},
+		"time": bson.M{
+			"$gte": "2015-10-07T15:00:00.000Z",
+			"$lte": "2015-11-07T15:00:00.000Z"},
 		"$and": []bson.M{
-			{
-				"_userId":        "abc123",
-				"_active":        true,
-				"_schemaVersion": bson.M{"$gte": 0, "$lte": 2},
-				"source":         bson.M{"$ne": "carelink"},
-				"time": bson.M{
-					"$gte": "2015-10-07T15:00:00.000Z",
-					"$lte": "2015-11-07T15:00:00.000Z"},
-			},
-			bson.M{"$or": []bson.M{
-				bson.M{
-					"level":   bson.M{"$in": []string{"0", "1"}},
+			{"$or": []bson.M{
+				{
+					"level":   bson.M{"$in": []string{"1", "2"}},
 					"subType": "deviceParameter",
 					"type":    "deviceEvent",
 				},
-				bson.M{"subType": bson.M{"$ne": "deviceParameter"}},
-			},
-			},
+				{
+					"level":   bson.M{"$in": []int{1, 2}},
+					"subType": "deviceParameter",
+					"type":    "deviceEvent",
+				},
+				{
+					"level":   bson.M{"$exists": false},
+					"subType": "deviceParameter",
+					"type":    "deviceEvent",
+				},
+				{"subType": bson.M{"$ne": "deviceParameter"}},
+			}},
 		},
 	}
 
@@ -358,26 +392,33 @@ func TestStore_generateMongoQuery_withDETypes(t *testing.T) {
 	query := typesWithDeviceEventQuery()
 
 	expectedQuery := bson.M{
+		"_userId":        "abc123",
+		"_active":        true,
+		"_schemaVersion": bson.M{"$gte": 0, "$lte": 2},
+		"source":         bson.M{"$ne": "carelink"},
+		"time": bson.M{
+			"$gte": "2015-10-07T15:00:00.000Z",
+			"$lte": "2015-11-07T15:00:00.000Z"},
+		"type": bson.M{"$in": []string{"deviceEvent", "food"}},
 		"$and": []bson.M{
-			{
-				"_userId":        "abc123",
-				"_active":        true,
-				"_schemaVersion": bson.M{"$gte": 0, "$lte": 2},
-				"source":         bson.M{"$ne": "carelink"},
-				"time": bson.M{
-					"$gte": "2015-10-07T15:00:00.000Z",
-					"$lte": "2015-11-07T15:00:00.000Z"},
-				"type": bson.M{"$in": []string{"deviceEvent", "food"}},
-			},
-			bson.M{"$or": []bson.M{
-				bson.M{
-					"level":   bson.M{"$in": []string{"0", "1"}},
+			{"$or": []bson.M{
+				{
+					"level":   bson.M{"$in": []string{"1", "2"}},
 					"subType": "deviceParameter",
 					"type":    "deviceEvent",
 				},
-				bson.M{"subType": bson.M{"$ne": "deviceParameter"}},
-			},
-			},
+				{
+					"level":   bson.M{"$in": []int{1, 2}},
+					"subType": "deviceParameter",
+					"type":    "deviceEvent",
+				},
+				{
+					"level":   bson.M{"$exists": false},
+					"subType": "deviceParameter",
+					"type":    "deviceEvent",
+				},
+				{"subType": bson.M{"$ne": "deviceParameter"}},
+			}},
 		},
 	}
 
@@ -432,6 +473,233 @@ func TestStore_generateMongoQuery_withDETypesAndSubType(t *testing.T) {
 	}
 }
 
+func TestStore_buildFilter(t *testing.T) {
+	params := &common.Params{UserID: "abc123"}
+	filter := buildFilter(params, []string{"cbg"})
+	expectedFilter := bson.M{
+		"_userId": "abc123",
+		"type":    bson.M{"$nin": []string{"cbg"}},
+	}
+	if !reflect.DeepEqual(filter, expectedFilter) {
+		t.Error(getErrString(filter, expectedFilter))
+	}
+}
+
+func TestStore_buildFilter_withTypesAndSubTypes(t *testing.T) {
+	params := &common.Params{
+		UserID:   "abc123",
+		Types:    []string{"deviceEvent", "smbg"},
+		SubTypes: []string{"reservoirChange"},
+	}
+	filter := buildFilter(params, []string{"cbg", "deviceParameter"})
+	expectedFilter := bson.M{
+		"_userId": "abc123",
+		"type":    bson.M{"$nin": []string{"cbg", "deviceParameter"}, "$in": []string{"deviceEvent", "smbg"}},
+		"subType": bson.M{"$nin": []string{"deviceParameter"}, "$in": []interface{}{"reservoirChange", nil}},
+	}
+	if !reflect.DeepEqual(filter, expectedFilter) {
+		t.Error(getErrString(filter, expectedFilter))
+	}
+}
+
+func TestStore_addCursorFilter(t *testing.T) {
+	query := bson.M{"_userId": "abc123"}
+	addCursorFilter(query, nil)
+	if len(query) != 1 {
+		t.Errorf("expected no cursor filter, having %v", query)
+	}
+
+	addCursorFilter(query, &common.Cursor{Time: "2023-04-01T12:32:00.000Z", ID: "abcdef"})
+	expectedQuery := bson.M{
+		"_userId": "abc123",
+		"$or": []bson.M{
+			{"time": bson.M{"$gt": "2023-04-01T12:32:00.000Z"}},
+			{"time": "2023-04-01T12:32:00.000Z", "id": bson.M{"$gt": "abcdef"}},
+		},
+	}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Error(getErrString(query, expectedQuery))
+	}
+}
+
+func TestStore_dataProjection(t *testing.T) {
+	if projection := dataProjection(&common.Params{}); !reflect.DeepEqual(projection, unwantedFields) {
+		t.Error(getErrString(projection, unwantedFields))
+	}
+	projection := dataProjection(&common.Params{Fields: []string{"value", "units", "_userId", "deviceId", "timezoneOffset"}})
+	expectedProjection := bson.M{
+		"_id":            0,
+		"id":             1,
+		"type":           1,
+		"time":           1,
+		"value":          1,
+		"units":          1,
+		"timezoneOffset": 1,
+	}
+	if !reflect.DeepEqual(projection, expectedProjection) {
+		t.Error(getErrString(projection, expectedProjection))
+	}
+
+	projection = dataProjection(&common.Params{Fields: []string{"value"}, ModifiedSince: "2023-01-01T00:00:00.000Z"})
+	expectedProjection = bson.M{
+		"_id":          0,
+		"id":           1,
+		"type":         1,
+		"time":         1,
+		"value":        1,
+		"_active":      1,
+		"modifiedTime": 1,
+	}
+	if !reflect.DeepEqual(projection, expectedProjection) {
+		t.Error(getErrString(projection, expectedProjection))
+	}
+
+	projection = dataProjection(&common.Params{ModifiedSince: "2023-01-01T00:00:00.000Z"})
+	if _, found := projection["_active"]; found || projection["_userId"] != 0 || len(projection) != len(unwantedFields)-2 {
+		t.Errorf("expected the unwanted fields but the sync ones, having %v", projection)
+	}
+	if _, found := unwantedFields["_active"]; !found {
+		t.Error("unwantedFields must not be modified")
+	}
+}
+
+func TestStore_addModifiedSinceFilter(t *testing.T) {
+	query := bson.M{"_userId": "abc123"}
+	addModifiedSinceFilter(query, "")
+	if len(query) != 1 {
+		t.Errorf("expected no modifiedSince filter, having %v", query)
+	}
+
+	addModifiedSinceFilter(query, "2023-04-01T12:32:00.000Z")
+	expectedQuery := bson.M{
+		"_userId": "abc123",
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"modifiedTime": bson.M{"$gt": "2023-04-01T12:32:00.000Z"}},
+				{"modifiedTime": bson.M{"$exists": false}, "createdTime": bson.M{"$gt": "2023-04-01T12:32:00.000Z"}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Error(getErrString(query, expectedQuery))
+	}
+}
+
+func TestStore_addSchemaVersionFilter(t *testing.T) {
+	query := bson.M{"_userId": "abc123"}
+	addSchemaVersionFilter(query, nil)
+	if len(query) != 1 {
+		t.Errorf("expected no schema version filter, having %v", query)
+	}
+
+	addSchemaVersionFilter(query, &common.SchemaVersion{Minimum: 1, Maximum: 99})
+	expectedQuery := bson.M{
+		"_userId":        "abc123",
+		"_schemaVersion": bson.M{"$gte": 1, "$lte": 99},
+	}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Error(getErrString(query, expectedQuery))
+	}
+}
+
+func TestStore_addLevelFilter(t *testing.T) {
+	query := bson.M{"_userId": "abc123"}
+	addLevelFilter(query, nil)
+	if len(query) != 1 {
+		t.Errorf("expected no level filter, having %v", query)
+	}
+
+	addLevelFilter(query, []int{1, 3})
+	expectedQuery := bson.M{
+		"_userId": "abc123",
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$in": []string{"1", "3"}}},
+				{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$in": []int{1, 3}}},
+				{"type": "deviceEvent", "subType": "deviceParameter", "level": bson.M{"$exists": false}},
+				{"subType": bson.M{"$ne": "deviceParameter"}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Error(getErrString(query, expectedQuery))
+	}
+}
+
+func TestStore_addSourceFilter(t *testing.T) {
+	query := bson.M{"_userId": "abc123"}
+	addSourceFilter(query, allParams())
+	if len(query) != 1 {
+		t.Errorf("expected no source filter, having %v", query)
+	}
+
+	params := allParams()
+	params.SourcePrecedence = true
+	params.Carelink = false
+	addModifiedSinceFilter(query, "2023-04-01T12:32:00.000Z")
+	addSourceFilter(query, params)
+	expectedQuery := bson.M{
+		"_userId": "abc123",
+		"source":  bson.M{"$ne": "carelink"},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"modifiedTime": bson.M{"$gt": "2023-04-01T12:32:00.000Z"}},
+				{"modifiedTime": bson.M{"$exists": false}, "createdTime": bson.M{"$gt": "2023-04-01T12:32:00.000Z"}},
+			}},
+			{"$or": []bson.M{
+				{"type": bson.M{"$ne": "cbg"}},
+				{"uploadId": bson.M{"$in": []string{"123", "456"}}},
+				{"time": bson.M{"$lt": "2015-10-07T15:00:00Z"}},
+				{"time": bson.M{"$gt": "2016-12-13T02:00:00Z"}},
+			}},
+			{"$or": []bson.M{
+				{"time": bson.M{"$lt": "2017-01-01T00:00:00Z"}},
+				{"type": bson.M{"$nin": []string{"basal", "bolus", "cbg"}}},
+				{"uploadId": bson.M{"$nin": []string{"555666777", "888999000"}}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Error(getErrString(query, expectedQuery))
+	}
+
+	query = bson.M{"_userId": "abc123"}
+	params.Carelink = true
+	params.Dexcom = true
+	params.Medtronic = true
+	addSourceFilter(query, params)
+	if len(query) != 1 {
+		t.Errorf("expected no source filter for the raw sources, having %v", query)
+	}
+}
+
+func TestStore_cloudSyncCbgFilter(t *testing.T) {
+	params := allParams()
+	excludeTypes, filter := cloudSyncCbgFilter(params, []string{"cbg", "upload"})
+	if !reflect.DeepEqual(excludeTypes, []string{"cbg", "upload"}) || filter != nil {
+		t.Errorf("expected no cloud sync cbg filter without source precedence, having %v %v", excludeTypes, filter)
+	}
+
+	params.SourcePrecedence = true
+	params.CbgUploadIds = []string{"123"}
+	excludeTypes, filter = cloudSyncCbgFilter(params, []string{"cbg", "upload"})
+	expectedFilter := bson.M{"$or": []bson.M{
+		{"type": bson.M{"$ne": "cbg"}},
+		{"uploadId": bson.M{"$in": []string{"123"}}},
+	}}
+	if !reflect.DeepEqual(excludeTypes, []string{"upload"}) {
+		t.Errorf("expected the cbg not to be excluded, having %v", excludeTypes)
+	}
+	if !reflect.DeepEqual(filter, expectedFilter) {
+		t.Error(getErrString(filter, expectedFilter))
+	}
+
+	excludeTypes, filter = cloudSyncCbgFilter(params, []string{"upload"})
+	if !reflect.DeepEqual(excludeTypes, []string{"upload"}) || filter != nil {
+		t.Errorf("expected no cloud sync cbg filter when the cbg are not excluded, having %v %v", excludeTypes, filter)
+	}
+}
+
 func TestStore_Ping(t *testing.T) {
 
 	store := before(t)
@@ -448,32 +716,40 @@ func TestStore_GetDataRangeV1(t *testing.T) {
 	endDate := "2021-01-01T00:00:00.000Z"
 	store := before(t,
 		bson.M{
-			"id":      uuid.New().String(),
-			"_userId": userID,
-			"time":    "2020-01-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"id":             uuid.New().String(),
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"time":           "2020-01-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"id":      uuid.New().String(),
-			"_userId": userID,
-			"time":    "2020-06-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"id":             uuid.New().String(),
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"time":           "2020-06-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"id":      uuid.New().String(),
-			"_userId": userID,
-			"time":    "2021-01-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"id":             uuid.New().String(),
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"time":           "2021-01-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
+		bson.M{"id": "inactive", "_userId": userID, "_active": false, "_schemaVersion": 1, "time": "2019-01-01T00:00:00.000Z", "type": "cbg"},
+		bson.M{"id": "old", "_userId": userID, "_active": true, "_schemaVersion": 0, "time": "2022-01-01T00:00:00.000Z", "type": "cbg"},
 	)
 	traceID := uuid.New().String()
-	res, err := store.GetDataRangeLegacy(context.Background(), traceID, userID)
+	res, err := store.GetDataRangeLegacy(context.Background(), traceID, userID, &common.SchemaVersion{Minimum: 1, Maximum: 99})
 	if err != nil {
 		t.Errorf("Unexpected error during GetDataRangeLegacy: %s", err)
 	}
@@ -496,41 +772,51 @@ func TestStore_GetDataV1(t *testing.T) {
 	}
 	store := before(t,
 		bson.M{
-			"_userId": userID,
-			"id":      "1",
-			"time":    "2020-01-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "1",
+			"time":           "2020-01-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"_userId": userID,
-			"id":      "2",
-			"time":    "2020-06-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "2",
+			"time":           "2020-06-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"_userId": "a00000",
-			"id":      "a",
-			"time":    "2020-11-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"_userId":        "a00000",
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "a",
+			"time":           "2020-11-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"_userId": userID,
-			"id":      "3",
-			"time":    "2021-01-01T00:00:00.000Z",
-			"type":    "cbg",
-			"units":   "mmol/L",
-			"value":   12,
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "3",
+			"time":           "2021-01-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
+		bson.M{"_userId": userID, "_active": false, "_schemaVersion": 1, "id": "inactive", "time": "2020-07-01T00:00:00.000Z", "type": "cbg"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 0, "id": "old", "time": "2020-07-01T00:00:00.000Z", "type": "cbg"},
 	)
 	ctx := context.Background()
 	traceID := uuid.New().String()
-	iter, err = store.GetDataInDeviceData(ctx, traceID, userID, ddr, []string{})
+	iter, err = store.GetDataInDeviceData(ctx, traceID, &common.Params{UserID: userID, Date: *ddr, SchemaVersion: &common.SchemaVersion{Minimum: 1, Maximum: 99}}, []string{})
 	if err != nil {
 		t.Fatalf("Unexpected error during GetDataRangeLegacy: %s", err)
 	}
@@ -553,6 +839,52 @@ func TestStore_GetDataV1(t *testing.T) {
 	}
 }
 
+func TestStore_GetDataInDeviceData_levels(t *testing.T) {
+	userID := "abcdef"
+	parameter := func(id string, level interface{}) bson.M {
+		datum := bson.M{
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             id,
+			"time":           "2020-06-01T00:00:00.000Z",
+			"type":           "deviceEvent",
+			"subType":        "deviceParameter",
+		}
+		if level != nil {
+			datum["level"] = level
+		}
+		return datum
+	}
+	store := before(t,
+		parameter("string1", "1"),
+		parameter("number1", 1),
+		parameter("noLevel", nil),
+		parameter("string3", "3"),
+		parameter("number3", 3),
+	)
+	ctx := context.Background()
+	iter, err := store.GetDataInDeviceData(ctx, uuid.New().String(), &common.Params{UserID: userID, LevelFilter: []int{1, 2}}, []string{})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataInDeviceData: %s", err)
+	}
+	defer iter.Close(ctx)
+	data, err := iteratorToAllData(ctx, iter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	ids := make([]string, 0, len(data))
+	for _, datum := range data {
+		ids = append(ids, datum["id"].(string))
+	}
+	sort.Strings(ids)
+	expectedIDs := []string{"noLevel", "number1", "string1"}
+	if !reflect.DeepEqual(ids, expectedIDs) {
+		t.Errorf("Expected the data %v having %v", expectedIDs, ids)
+	}
+}
+
 func TestStore_GetUploadDataV1(t *testing.T) {
 	var err error
 	var iter goComMgo.StorageIterator
@@ -561,42 +893,52 @@ func TestStore_GetUploadDataV1(t *testing.T) {
 
 	store := before(t,
 		bson.M{
-			"_userId":  userID,
-			"id":       "1",
-			"uploadId": "1",
-			"time":     "2020-01-01T00:00:00.000Z",
-			"type":     "upload",
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "1",
+			"uploadId":       "1",
+			"time":           "2020-01-01T00:00:00.000Z",
+			"type":           "upload",
 		},
 		bson.M{
-			"_userId":  userID,
-			"id":       "2",
-			"uploadId": "1",
-			"time":     "2020-06-01T00:00:00.000Z",
-			"type":     "cbg",
-			"units":    "mmol/L",
-			"value":    12,
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "2",
+			"uploadId":       "1",
+			"time":           "2020-06-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
 		bson.M{
-			"_userId":  userID,
-			"id":       "3",
-			"uploadId": "3",
-			"time":     "2020-11-01T00:00:00.000Z",
-			"type":     "upload",
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "3",
+			"uploadId":       "3",
+			"time":           "2020-11-01T00:00:00.000Z",
+			"type":           "upload",
 		},
 		bson.M{
-			"_userId":  userID,
-			"id":       "4",
-			"uploadId": "3",
-			"time":     "2021-01-01T00:00:00.000Z",
-			"type":     "cbg",
-			"units":    "mmol/L",
-			"value":    12,
+			"_userId":        userID,
+			"_active":        true,
+			"_schemaVersion": 1,
+			"id":             "4",
+			"uploadId":       "3",
+			"time":           "2021-01-01T00:00:00.000Z",
+			"type":           "cbg",
+			"units":          "mmol/L",
+			"value":          12,
 		},
+		bson.M{"_userId": userID, "_active": false, "_schemaVersion": 1, "id": "5", "uploadId": "5", "time": "2021-01-01T00:00:00.000Z", "type": "upload"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 0, "id": "6", "uploadId": "6", "time": "2021-01-01T00:00:00.000Z", "type": "upload"},
 	)
 	ctx := context.Background()
 	traceID := uuid.New().String()
-	ids := []string{"1", "2", "3", "4"}
-	iter, err = store.GetUploadData(ctx, traceID, ids)
+	ids := []string{"1", "2", "3", "4", "5", "6"}
+	iter, err = store.GetUploadData(ctx, traceID, ids, &common.SchemaVersion{Minimum: 1, Maximum: 99})
 	if err != nil {
 		t.Fatalf("Unexpected error during GetDataRangeLegacy: %s", err)
 	}
@@ -630,6 +972,31 @@ func TestStore_GetUploadDataV1(t *testing.T) {
 	}
 }
 
+func TestStore_CountSchemaVersionFiltered(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 1, "id": "1", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 0, "id": "2", "type": "cbg", "time": "2020-01-01T11:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "3", "type": "cbg", "time": "2020-01-01T12:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "_schemaVersion": 0, "id": "4", "type": "cbg", "time": "2020-01-01T13:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 0, "id": "5", "type": "cbg", "time": "2020-03-01T10:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	count, err := store.CountSchemaVersionFiltered(ctx, traceID, &common.Params{
+		UserID:        userID,
+		Date:          common.Date{Start: "2020-01-01T00:00:00.000Z", End: "2020-02-01T00:00:00.000Z"},
+		SchemaVersion: &common.SchemaVersion{Minimum: 1, Maximum: 99},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error during CountSchemaVersionFiltered: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 filtered data, having %d", count)
+	}
+}
+
 func TestStore_GetLatestBasalSecurityProfile(t *testing.T) {
 
 	userID := "abcdef"
@@ -738,3 +1105,414 @@ func TestStore_GetLatestBasalSecurityProfile(t *testing.T) {
 func ptr(t time.Time) *time.Time {
 	return &t
 }
+
+func TestStore_GetLatestDatum(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{
+			"_userId":  userID,
+			"id":       "1",
+			"uploadId": "1",
+			"time":     "2020-01-01T00:00:00.000Z",
+			"type":     "bolus",
+			"normal":   2,
+			"_active":  true,
+		},
+		bson.M{
+			"_userId":  userID,
+			"id":       "2",
+			"uploadId": "1",
+			"time":     "2020-06-01T00:00:00.000Z",
+			"type":     "bolus",
+			"normal":   3,
+			"_active":  true,
+		},
+		bson.M{
+			"_userId":  userID,
+			"id":       "2b",
+			"uploadId": "1",
+			"time":     "2020-07-01T00:00:00.000Z",
+			"type":     "bolus",
+			"normal":   4,
+			"_active":  false,
+		},
+		bson.M{
+			"_userId":        userID,
+			"id":             "2c",
+			"uploadId":       "1",
+			"time":           "2020-08-01T00:00:00.000Z",
+			"type":           "bolus",
+			"normal":         5,
+			"_active":        true,
+			"_schemaVersion": 3,
+		},
+		bson.M{
+			"_userId":  userID,
+			"id":       "3",
+			"uploadId": "1",
+			"time":     "2020-11-01T00:00:00.000Z",
+			"type":     "smbg",
+			"units":    "mmol/L",
+			"value":    12,
+			"_active":  true,
+		},
+		bson.M{
+			"_userId":  "a00000",
+			"id":       "a",
+			"uploadId": "a",
+			"time":     "2021-01-01T00:00:00.000Z",
+			"type":     "bolus",
+			"normal":   1,
+			"_active":  true,
+		},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	// The newer inactive datum 2b is ignored, as the datum 2c out of the schema version range
+	datum, err := store.GetLatestDatum(ctx, traceID, userID, "bolus", &common.SchemaVersion{Minimum: 0, Maximum: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetLatestDatum: %s", err)
+	}
+	if datum == nil || datum["id"] != "2" {
+		t.Fatalf("Expected the datum 2, having %v", datum)
+	}
+	if _, found := datum["_userId"]; found {
+		t.Fatalf("Unexpected _userId in %v", datum)
+	}
+
+	datum, err = store.GetLatestDatum(ctx, traceID, userID, "bolus", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetLatestDatum: %s", err)
+	}
+	if datum == nil || datum["id"] != "2c" {
+		t.Fatalf("Expected the datum 2c, having %v", datum)
+	}
+
+	datum, err = store.GetLatestDatum(ctx, traceID, userID, "cbg", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetLatestDatum: %s", err)
+	}
+	if datum != nil {
+		t.Fatalf("Expected no datum, having %v", datum)
+	}
+}
+
+func TestStore_GetUploads(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "id": "1", "uploadId": "1", "type": "upload", "time": "2020-01-01T00:00:00.000Z", "deviceModel": "Kaleido", "deviceSerialNumber": "123"},
+		bson.M{"_userId": userID, "_active": true, "id": "2", "uploadId": "2", "type": "upload", "time": "2020-06-01T00:00:00.000Z", "deviceModel": "Dexcom G6"},
+		bson.M{"_userId": userID, "_active": false, "id": "3", "uploadId": "3", "type": "upload", "time": "2020-11-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "4", "uploadId": "2", "type": "cbg", "time": "2020-05-01T00:00:00.000Z"},
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "uploadId": "a", "type": "upload", "time": "2021-01-01T00:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	uploads, err := store.GetUploads(ctx, traceID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetUploads: %s", err)
+	}
+	if len(uploads) != 2 {
+		t.Fatalf("Expected 2 uploads, having %v", uploads)
+	}
+	if uploads[0].UploadID != "2" || uploads[0].DeviceModel != "Dexcom G6" {
+		t.Fatalf("Expected the upload 2 first, having %v", uploads[0])
+	}
+	if uploads[1].UploadID != "1" || uploads[1].DeviceSerialNumber != "123" {
+		t.Fatalf("Expected the upload 1 last, having %v", uploads[1])
+	}
+}
+
+func TestStore_GetUploadsDataCount(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "id": "1", "uploadId": "1", "type": "upload", "time": "2020-01-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "2", "uploadId": "1", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "3", "uploadId": "1", "type": "cbg", "time": "2020-01-01T08:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "id": "4", "uploadId": "1", "type": "cbg", "time": "2020-01-01T12:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "5", "uploadId": "1", "type": "bolus", "time": "2020-01-01T09:00:00.000Z"},
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "uploadId": "1", "type": "cbg", "time": "2021-01-01T00:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	counts, err := store.GetUploadsDataCount(ctx, traceID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetUploadsDataCount: %s", err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 counts, having %v", counts)
+	}
+	for _, count := range counts {
+		switch count.Type {
+		case "cbg":
+			if count.UploadID != "1" || count.Count != 2 || count.Start != "2020-01-01T08:00:00.000Z" || count.End != "2020-01-01T10:00:00.000Z" {
+				t.Fatalf("Unexpected cbg count %v", count)
+			}
+		case "bolus":
+			if count.UploadID != "1" || count.Count != 1 {
+				t.Fatalf("Unexpected bolus count %v", count)
+			}
+		default:
+			t.Fatalf("Unexpected count %v", count)
+		}
+	}
+}
+
+func TestStore_GetUploadsDataRange(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "id": "1", "uploadId": "1", "type": "upload", "time": "2019-01-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "2", "uploadId": "1", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "3", "uploadId": "2", "type": "cbg", "time": "2020-01-01T08:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "id": "4", "uploadId": "1", "type": "cbg", "time": "2020-01-01T12:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "5", "uploadId": "3", "type": "cbg", "time": "2020-01-01T06:00:00.000Z"},
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "uploadId": "1", "type": "cbg", "time": "2021-01-01T00:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	dataRange, err := store.GetUploadsDataRange(ctx, traceID, userID, []string{"1", "2"})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetUploadsDataRange: %s", err)
+	}
+	if dataRange.Start != "2020-01-01T08:00:00.000Z" || dataRange.End != "2020-01-01T10:00:00.000Z" {
+		t.Fatalf("Unexpected range %v", dataRange)
+	}
+
+	dataRange, err = store.GetUploadsDataRange(ctx, traceID, userID, []string{"unknown"})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetUploadsDataRange: %s", err)
+	}
+	if dataRange.Start != "" || dataRange.End != "" {
+		t.Fatalf("Expected an empty range, having %v", dataRange)
+	}
+}
+
+func TestStore_GetDataInUpload(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 1, "id": "1", "uploadId": "1", "type": "upload", "time": "2020-01-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 1, "id": "2", "uploadId": "1", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "_schemaVersion": 1, "id": "3", "uploadId": "2", "type": "cbg", "time": "2020-01-01T08:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "_schemaVersion": 1, "id": "4", "uploadId": "1", "type": "cbg", "time": "2020-01-01T12:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+	params := &common.Params{
+		UserID:        userID,
+		UploadID:      "1",
+		SchemaVersion: &common.SchemaVersion{Minimum: 0, Maximum: 2},
+		Carelink:      true,
+	}
+
+	iter, err := store.GetDataInUpload(ctx, traceID, params)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataInUpload: %s", err)
+	}
+	defer iter.Close(ctx)
+	ids := make([]string, 0, 2)
+	for iter.Next(ctx) {
+		var datum map[string]interface{}
+		if err := iter.Decode(&datum); err != nil {
+			t.Fatalf("Unexpected decode error: %s", err)
+		}
+		ids = append(ids, datum["id"].(string))
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Fatalf("Expected the data 1 & 2, having %v", ids)
+	}
+}
+
+func TestStore_GetDataState(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "id": "1", "type": "basal", "time": "2020-01-01T10:00:00.000Z", "createdTime": "2020-01-02T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "id": "2", "type": "basal", "time": "2020-01-02T10:00:00.000Z", "createdTime": "2020-01-03T00:00:00.000Z", "modifiedTime": "2020-02-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "3", "type": "cbg", "time": "2020-03-01T10:00:00.000Z", "createdTime": "2020-03-02T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "4", "type": "basal", "time": "2020-01-03T10:00:00.000Z", "createdTime": "2020-01-04T00:00:00.000Z", "_schemaVersion": 2},
+		bson.M{"_userId": userID, "_active": true, "id": "5", "type": "upload", "time": "2020-03-05T10:00:00.000Z", "createdTime": "2020-03-05T10:00:00.000Z"},
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "type": "basal", "time": "2020-01-01T10:00:00.000Z", "createdTime": "2021-01-01T00:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	window := common.Date{Start: "2020-01-01T00:00:00.000Z", End: "2020-02-01T00:00:00.000Z"}
+	state, err := store.GetDataState(ctx, traceID, &common.Params{UserID: userID, Date: window}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataState: %s", err)
+	}
+	// The upload is counted whatever its time
+	if state.Count != 4 || state.LastModified != "2020-03-05T10:00:00.000Z" {
+		t.Fatalf("Expected 4 data modified at 2020-03-05, having %+v", state)
+	}
+
+	schemaVersion := &common.SchemaVersion{Minimum: 1, Maximum: 1}
+	state, err = store.GetDataState(ctx, traceID, &common.Params{UserID: userID, Date: window, SchemaVersion: schemaVersion}, []string{"upload"})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataState: %s", err)
+	}
+	if state.Count != 0 {
+		t.Fatalf("Expected no data in the schema version range, having %+v", state)
+	}
+
+	state, err = store.GetDataState(ctx, traceID, &common.Params{UserID: userID}, []string{"upload", "pumpSettings"})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataState: %s", err)
+	}
+	if state.Count != 4 || state.LastModified != "2020-03-02T00:00:00.000Z" {
+		t.Fatalf("Expected 4 data modified at 2020-03-02, having %+v", state)
+	}
+
+	state, err = store.GetDataState(ctx, traceID, &common.Params{UserID: "nodata"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDataState: %s", err)
+	}
+	if state.Count != 0 || state.LastModified != "" {
+		t.Fatalf("Expected an empty state, having %+v", state)
+	}
+}
+
+func TestStore_WatchData(t *testing.T) {
+	userID := "abcdef"
+	store := before(t)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	stream, err := store.WatchData(ctx, traceID, userID, nil, "", 100*time.Millisecond)
+	var errCommand mongo.CommandError
+	if errors.As(err, &errCommand) && errCommand.Code == 40573 {
+		t.Skip("Change streams need a replica set")
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error during WatchData: %s", err)
+	}
+	defer stream.Close(ctx)
+
+	docs := []interface{}{
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "id": "1", "type": "cbg", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "2", "type": "cbg", "time": "2020-01-01T10:05:00.000Z"},
+	}
+	if _, err := dataCollection(store).InsertMany(ctx, docs); err != nil {
+		t.Fatalf("Unable to insert documents: %s", err)
+	}
+	if _, err := dataCollection(store).UpdateOne(ctx, bson.M{"id": "1"}, bson.M{"$set": bson.M{"_active": true}}); err != nil {
+		t.Fatalf("Unable to update document: %s", err)
+	}
+
+	ids := make([]string, 0, 2)
+	resumeTokens := make([]string, 0, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ids) < 2 && time.Now().Before(deadline) {
+		if !stream.TryNext(ctx) {
+			if err := stream.Err(); err != nil {
+				t.Fatalf("Unexpected stream error: %s", err)
+			}
+			continue
+		}
+		var datum map[string]interface{}
+		if err := stream.Decode(&datum); err != nil {
+			t.Fatalf("Unexpected decode error: %s", err)
+		}
+		if _, found := datum["_userId"]; found {
+			t.Fatalf("Expected the unwanted fields to be removed, having %v", datum)
+		}
+		ids = append(ids, datum["id"].(string))
+		resumeTokens = append(resumeTokens, stream.ResumeToken())
+	}
+	if !reflect.DeepEqual(ids, []string{"2", "1"}) {
+		t.Fatalf("Expected the activated data [2 1], having %v", ids)
+	}
+
+	resumed, err := store.WatchData(ctx, traceID, userID, nil, resumeTokens[0], 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error during WatchData: %s", err)
+	}
+	defer resumed.Close(ctx)
+	var datum map[string]interface{}
+	for time.Now().Before(deadline) && !resumed.TryNext(ctx) {
+	}
+	if err := resumed.Decode(&datum); err != nil || datum["id"] != "1" {
+		t.Fatalf("Expected to resume with the datum 1, having %v (%v)", datum, err)
+	}
+
+	if _, err := store.WatchData(ctx, traceID, userID, nil, "not a token", time.Second); err != common.ErrInvalidResumeToken {
+		t.Fatalf("Expected an invalid resume token error, having %v", err)
+	}
+}
+
+func TestStore_GetDevicesDataCount(t *testing.T) {
+	userID := "abcdef"
+	store := before(t,
+		bson.M{"_userId": userID, "_active": true, "id": "1", "uploadId": "1", "deviceId": "pump1", "type": "upload", "time": "2020-01-01T00:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "2", "uploadId": "1", "deviceId": "pump1", "type": "basal", "time": "2020-01-01T10:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "3", "uploadId": "2", "deviceId": "pump1", "type": "basal", "time": "2020-02-01T08:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": false, "id": "4", "uploadId": "1", "deviceId": "pump1", "type": "basal", "time": "2020-03-01T12:00:00.000Z"},
+		bson.M{"_userId": userID, "_active": true, "id": "5", "uploadId": "3", "deviceId": "cgm1", "type": "cbg", "time": "2020-01-01T09:00:00.000Z"},
+		bson.M{"_userId": "a00000", "_active": true, "id": "a", "uploadId": "a", "deviceId": "pump1", "type": "basal", "time": "2021-01-01T00:00:00.000Z"},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+
+	counts, err := store.GetDevicesDataCount(ctx, traceID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error during GetDevicesDataCount: %s", err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 counts, having %v", counts)
+	}
+	for _, count := range counts {
+		switch count.DeviceID {
+		case "pump1":
+			if count.Type != "basal" || count.Count != 2 || count.Start != "2020-01-01T10:00:00.000Z" || count.End != "2020-02-01T08:00:00.000Z" {
+				t.Fatalf("Unexpected pump1 count %v", count)
+			}
+		case "cgm1":
+			if count.Type != "cbg" || count.Count != 1 {
+				t.Fatalf("Unexpected cgm1 count %v", count)
+			}
+		default:
+			t.Fatalf("Unexpected count %v", count)
+		}
+	}
+}
+
+func TestStore_GetBasalSecurityProfiles(t *testing.T) {
+	userID := "abcdef"
+	first := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	store := before(t,
+		bson.M{"_userId": userID, "type": "basalSecurity", "guid": "1", "time": first},
+		bson.M{"_userId": userID, "type": "basalSecurity", "guid": "2", "time": first.AddDate(0, 1, 0)},
+		bson.M{"_userId": userID, "type": "basalSecurity", "guid": "3", "time": first.AddDate(0, 2, 0)},
+		bson.M{"_userId": userID, "type": "basalSecurity", "guid": "4", "time": first.AddDate(0, 3, 0)},
+		bson.M{"_userId": "a00000", "type": "basalSecurity", "guid": "a", "time": first.AddDate(0, 1, 10)},
+	)
+	ctx := context.Background()
+	traceID := uuid.New().String()
+	guids := func(profiles []schema.DbProfile) []string {
+		result := make([]string, len(profiles))
+		for i, profile := range profiles {
+			result[i] = profile.Guid
+		}
+		return result
+	}
+
+	profiles, err := store.GetBasalSecurityProfiles(ctx, traceID, userID, first.AddDate(0, 1, 5), first.AddDate(0, 2, 5))
+	if err != nil {
+		t.Fatalf("Unexpected error during GetBasalSecurityProfiles: %s", err)
+	}
+	if !reflect.DeepEqual(guids(profiles), []string{"2", "3"}) {
+		t.Fatalf("Expected the profiles 2 & 3, having %v", guids(profiles))
+	}
+
+	profiles, err = store.GetBasalSecurityProfiles(ctx, traceID, userID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error during GetBasalSecurityProfiles: %s", err)
+	}
+	if !reflect.DeepEqual(guids(profiles), []string{"1", "2", "3", "4"}) {
+		t.Fatalf("Expected all the profiles, having %v", guids(profiles))
+	}
+}
@@ -0,0 +1,9 @@
+package schema
+
+// DbDataState the state of the data of a user in a time window, changing when they are modified
+type DbDataState struct {
+	// Count the number of data, the inactive ones included
+	Count int `bson:"count"`
+	// LastModified the newest modifiedTime of the data, their createdTime when they were never modified
+	LastModified string `bson:"lastModified"`
+}
@@ -0,0 +1,34 @@
+package schema
+
+type (
+	// DbUpload the upload (data set) datum, created by each device sync
+	DbUpload struct {
+		UploadID            string   `bson:"uploadId"`
+		Time                string   `bson:"time"`
+		Timezone            string   `bson:"timezone,omitempty"`
+		DeviceID            string   `bson:"deviceId,omitempty"`
+		DeviceModel         string   `bson:"deviceModel,omitempty"`
+		DeviceManufacturers []string `bson:"deviceManufacturers,omitempty"`
+		DeviceSerialNumber  string   `bson:"deviceSerialNumber,omitempty"`
+		DeviceTags          []string `bson:"deviceTags,omitempty"`
+		DataSetType         string   `bson:"dataSetType,omitempty"`
+	}
+
+	// DbUploadTypeCount the number of data of a type in an upload, with their time range
+	DbUploadTypeCount struct {
+		UploadID string `bson:"uploadId"`
+		Type     string `bson:"type"`
+		Count    int    `bson:"count"`
+		Start    string `bson:"start"`
+		End      string `bson:"end"`
+	}
+
+	// DbDeviceTypeCount the number of data of a type produced by a device, with their time range
+	DbDeviceTypeCount struct {
+		DeviceID string `bson:"deviceId"`
+		Type     string `bson:"type"`
+		Count    int    `bson:"count"`
+		Start    string `bson:"start"`
+		End      string `bson:"end"`
+	}
+)
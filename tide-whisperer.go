@@ -34,7 +34,6 @@ import (
 	"github.com/tidepool-org/tide-whisperer/infrastructure"
 	"github.com/tidepool-org/tide-whisperer/usecase"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/mdblp/go-common/clients/auth"
 	tideV2Client "github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
@@ -137,7 +136,7 @@ func main() {
 	patientDataMongoRepository.Start()
 	rtr := mux.NewRouter()
 
-	rtr.Use(instrumentation.Middleware)
+	rtr.Use(api.FlushMiddleware(instrumentation.Middleware))
 	rtr.Path("/metrics").Handler(promhttp.Handler())
 
 	/*
@@ -152,16 +151,37 @@ func main() {
 	}
 
 	dataUseCase := usecase.NewPatientDataUseCase(logger, tideV2Client, patientDataMongoRepository, envReadBasalBucket)
+	sourcePrecedence := usecase.DefaultSourcePrecedence
+	if envSourcePrecedence, found := os.LookupEnv("DATA_SOURCE_PRECEDENCE"); found {
+		if sourcePrecedence, err = usecase.ParseSourcePrecedence(envSourcePrecedence); err != nil {
+			logger.Fatalf("Invalid DATA_SOURCE_PRECEDENCE: %s", err)
+		}
+	}
+	logger.Printf("source precedence rules: %+v", sourcePrecedence)
+	dataUseCase.SetSourcePrecedence(sourcePrecedence)
+	parameterLevels := usecase.DefaultParameterLevels
+	if envParameterLevels, found := os.LookupEnv("PARAMETER_LEVELS"); found {
+		if parameterLevels, err = usecase.ParseParameterLevels(envParameterLevels); err != nil || len(parameterLevels) == 0 {
+			logger.Fatalf("Invalid PARAMETER_LEVELS: %q %v", envParameterLevels, err)
+		}
+	}
+	logger.Printf("device parameter levels: %v", parameterLevels)
+	dataUseCase.SetParameterLevels(parameterLevels)
+	dataUseCase.SetSchemaVersion(twconfig.SchemaVersion)
 	exportUseCase := usecase.NewExporter(logger, dataUseCase, uploader)
 	exportController := api.NewExportController(logger, exportUseCase)
 
-	api := api.InitAPI(exportController, dataUseCase, patientDataMongoRepository, authClient, permsClient, twconfig.SchemaVersion, logger, tideV2Client)
+	api := api.InitAPI(exportController, dataUseCase, patientDataMongoRepository, authClient, permsClient, logger, tideV2Client)
+	if envMaxStreams, err := strconv.Atoi(os.Getenv("MAX_DATA_STREAMS")); err == nil && envMaxStreams > 0 {
+		logger.Printf("environment variable MAX_DATA_STREAMS exported, at most %d data streams", envMaxStreams)
+		api.SetMaxStreams(envMaxStreams)
+	}
 	api.SetHandlers("", rtr)
 
 	// ability to return compressed (gzip/deflate) responses if client browser accepts it
 	// this is interesting to minimise network traffic especially if we expect to have long
 	// responses such as what the GetData() route here can return
-	gzipHandler := handlers.CompressHandler(rtr)
+	gzipHandler := api.CompressHandler(rtr)
 
 	done := make(chan bool)
 	server := common.NewServer(&http.Server{
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+const (
+	// DefaultAgpDays number of days used by the AGP when no window is requested
+	DefaultAgpDays = 14
+	// DefaultAgpSlotMinutes duration of the time of day slots of the AGP curves
+	DefaultAgpSlotMinutes = 15
+
+	// cgmSampleInterval expected interval between two cbg, used to compute the CGM active time
+	cgmSampleInterval = 5 * time.Minute
+	minutesPerDay     = 24 * 60
+)
+
+type (
+	// GetAgpArgs arguments of GetAgp
+	GetAgpArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// StartDate & EndDate the window of the AGP (ISO-8601 datetime), the last DefaultAgpDays by default
+		StartDate string
+		EndDate   string
+		// SlotMinutes duration of the time of day slots, DefaultAgpSlotMinutes by default
+		SlotMinutes int
+		// BgUnit the unit of the result, mg/dL by default
+		BgUnit string
+	}
+	// AgpSlot the cbg percentiles of a time of day slot
+	AgpSlot struct {
+		// Start of the slot, in minutes since midnight (local time of the samples)
+		StartMinute int `json:"startMinute"`
+		// Number of cbg in the slot, the percentiles are 0 when there is none
+		NumBgValues  int     `json:"numBgValues"`
+		Percentile5  float64 `json:"p5"`
+		Percentile25 float64 `json:"p25"`
+		Percentile50 float64 `json:"p50"`
+		Percentile75 float64 `json:"p75"`
+		Percentile95 float64 `json:"p95"`
+	}
+	// AgpResult Ambulatory Glucose Profile returned by the agp v1 route
+	AgpResult struct {
+		UserID string `json:"userId"`
+		// Window of the AGP (ISO-8601 datetime)
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		// The unit of the glucose values
+		BgUnit string `json:"bgUnit"`
+		// Number of cbg used
+		NumBgValues int `json:"numBgValues"`
+		// Mean glucose
+		MeanGlucose float64 `json:"meanGlucose"`
+		// Glucose management indicator (%)
+		GMI float64 `json:"gmi"`
+		// Coefficient of variation (%)
+		CoefficientOfVariation float64 `json:"coefficientOfVariation"`
+		// % of the window with CGM data
+		PercentCgmActive float64 `json:"percentCgmActive"`
+		// Duration of the slots in minutes
+		SlotMinutes int       `json:"slotMinutes"`
+		Slots       []AgpSlot `json:"slots"`
+	}
+)
+
+// GetAgp compute the Ambulatory Glucose Profile of a patient from the cbg: percentile curves by time of day
+// slots, using the local time of the samples, and the standard AGP metrics.
+func (p *PatientData) GetAgp(ctx context.Context, args GetAgpArgs) (*AgpResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getAgp")
+	defer common.TimeEnd(ctx, "getAgp")
+
+	unit := args.BgUnit
+	if unit != MmolL {
+		unit = MgdL
+	}
+	slotMinutes := args.SlotMinutes
+	if slotMinutes <= 0 {
+		slotMinutes = DefaultAgpSlotMinutes
+	}
+	startTime, endTime, err := getWindow(args.StartDate, args.EndDate, 0, DefaultAgpDays, time.Now())
+	if err == nil && minutesPerDay%slotMinutes != 0 {
+		err = fmt.Errorf("slotMinutes %d is not a divisor of a day", slotMinutes)
+	}
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetAgp", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+
+	// The metrics are computed in mg/dL, as the GMI formula
+	values, errValues := p.getCbgValues(ctx, args.TraceID, args.UserID, args.SessionToken, startTime, endTime, MgdL)
+	if errValues != nil {
+		return nil, errValues
+	}
+
+	result := &AgpResult{
+		UserID:      args.UserID,
+		StartDate:   startTime.UTC().Format(time.RFC3339Nano),
+		EndDate:     endTime.UTC().Format(time.RFC3339Nano),
+		BgUnit:      unit,
+		NumBgValues: len(values),
+		SlotMinutes: slotMinutes,
+		Slots:       make([]AgpSlot, minutesPerDay/slotMinutes),
+	}
+
+	slots := make([][]float64, len(result.Slots))
+	locations := make(map[string]*time.Location)
+	sum := 0.0
+	for _, bg := range values {
+		localTime := toLocalTime(bg.time, bg.timezone, bg.timezoneOffset, locations)
+		slot := (localTime.Hour()*60 + localTime.Minute()) / slotMinutes
+		slots[slot] = append(slots[slot], bg.value)
+		sum += bg.value
+	}
+
+	for i, slotValues := range slots {
+		sort.Float64s(slotValues)
+		result.Slots[i] = AgpSlot{
+			StartMinute:  i * slotMinutes,
+			NumBgValues:  len(slotValues),
+			Percentile5:  convertBgValue(percentile(slotValues, 5), MgdL, unit),
+			Percentile25: convertBgValue(percentile(slotValues, 25), MgdL, unit),
+			Percentile50: convertBgValue(percentile(slotValues, 50), MgdL, unit),
+			Percentile75: convertBgValue(percentile(slotValues, 75), MgdL, unit),
+			Percentile95: convertBgValue(percentile(slotValues, 95), MgdL, unit),
+		}
+	}
+
+	if len(values) > 0 {
+		mean := sum / float64(len(values))
+		variance := 0.0
+		for _, bg := range values {
+			variance += (bg.value - mean) * (bg.value - mean)
+		}
+		standardDeviation := math.Sqrt(variance / float64(len(values)))
+
+		result.MeanGlucose = convertBgValue(roundTo(mean, 0), MgdL, unit)
+		result.GMI = roundTo(3.31+0.02392*mean, 1)
+		result.CoefficientOfVariation = roundTo(standardDeviation*100/mean, 1)
+		expectedValues := float64(endTime.Sub(startTime) / cgmSampleInterval)
+		result.PercentCgmActive = roundTo(math.Min(100, float64(len(values))*100/expectedValues), 1)
+	}
+	return result, nil
+}
+
+// toLocalTime returns the time in the timezone of the sample, or using its offset (in minutes)
+// when the timezone is unknown
+func toLocalTime(t time.Time, timezone string, timezoneOffset int, locations map[string]*time.Location) time.Time {
+	location, found := locations[timezone]
+	if !found {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil || timezone == "" {
+			location = nil
+		}
+		locations[timezone] = location
+	}
+	if location == nil {
+		return t.UTC().Add(time.Duration(timezoneOffset) * time.Minute)
+	}
+	return t.In(location)
+}
+
+// percentile returns the nth percentile of sorted values, using a linear interpolation
+func percentile(sortedValues []float64, nth float64) float64 {
+	if len(sortedValues) == 0 {
+		return 0
+	}
+	rank := nth / 100 * float64(len(sortedValues)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	value := sortedValues[lower] + (sortedValues[upper]-sortedValues[lower])*(rank-float64(lower))
+	return roundTo(value, 0)
+}
+
+// roundTo round a value to the number of decimals
+func roundTo(value float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(value*factor) / factor
+}
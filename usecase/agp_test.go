@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{100, 110, 120, 130, 140}
+	assert.Equal(t, float64(0), percentile([]float64{}, 50))
+	assert.Equal(t, float64(102), percentile(values, 5))
+	assert.Equal(t, float64(110), percentile(values, 25))
+	assert.Equal(t, float64(120), percentile(values, 50))
+	assert.Equal(t, float64(130), percentile(values, 75))
+	assert.Equal(t, float64(138), percentile(values, 95))
+}
+
+func TestPatientData_GetAgp(t *testing.T) {
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+		{
+			Id:  "cbg1",
+			Day: day,
+			Samples: []tideV2Schema.CbgSample{
+				// 02:00 in Paris
+				{Value: 100, Units: MgdL, Timestamp: day, Timezone: "Europe/Paris", TimezoneOffset: 120},
+				{Value: 200, Units: MgdL, Timestamp: day.Add(5 * time.Minute), Timezone: "Europe/Paris", TimezoneOffset: 120},
+				// Unknown timezone: 11:00 using the offset
+				{Value: 150, Units: MgdL, Timestamp: day.Add(10 * time.Hour), TimezoneOffset: 60},
+				// Outside the window
+				{Value: 400, Units: MgdL, Timestamp: day.AddDate(0, 0, 1), Timezone: "UTC"},
+			},
+		},
+	}
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, false)
+
+	agp, err := p.GetAgp(testCtx, GetAgpArgs{
+		UserID:    "user1",
+		StartDate: "2023-04-01T00:00:00Z",
+		EndDate:   "2023-04-02T00:00:00Z",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, agp.NumBgValues)
+	assert.Equal(t, MgdL, agp.BgUnit)
+	assert.Equal(t, float64(150), agp.MeanGlucose)
+	assert.Equal(t, 6.9, agp.GMI)
+	assert.Equal(t, 27.2, agp.CoefficientOfVariation)
+	assert.Equal(t, 1.0, agp.PercentCgmActive)
+	assert.Len(t, agp.Slots, 96)
+	assert.Equal(t, AgpSlot{StartMinute: 120, NumBgValues: 2, Percentile5: 105, Percentile25: 125, Percentile50: 150, Percentile75: 175, Percentile95: 195}, agp.Slots[8])
+	assert.Equal(t, AgpSlot{StartMinute: 660, NumBgValues: 1, Percentile5: 150, Percentile25: 150, Percentile50: 150, Percentile75: 150, Percentile95: 150}, agp.Slots[44])
+	assert.Equal(t, AgpSlot{StartMinute: 0}, agp.Slots[0])
+
+	agp, err = p.GetAgp(testCtx, GetAgpArgs{
+		UserID:    "user1",
+		StartDate: "2023-04-01T00:00:00Z",
+		EndDate:   "2023-04-02T00:00:00Z",
+		BgUnit:    MmolL,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 8.3, agp.MeanGlucose)
+	assert.Equal(t, 8.3, agp.Slots[8].Percentile50)
+
+	_, err = p.GetAgp(testCtx, GetAgpArgs{UserID: "user1", SlotMinutes: 7})
+	assert.NotNil(t, err)
+	assert.Equal(t, errorInvalidParameters.Code, err.Code)
+}
@@ -0,0 +1,40 @@
+package usecase
+
+import (
+	"context"
+
+	internalSchema "github.com/tidepool-org/tide-whisperer/api/dto"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// GetBasalSecurityProfilesArgs arguments of GetBasalSecurityProfiles
+type GetBasalSecurityProfilesArgs struct {
+	UserID  string
+	TraceID string
+	// StartDate & EndDate the window (ISO-8601 datetime), by default from the first profile to now
+	StartDate string
+	EndDate   string
+}
+
+// GetBasalSecurityProfiles returns the basal security profiles applied during a window, in time order,
+// the one in effect at the beginning of the window included.
+// Each profile applies until the next one, its EndTime.
+func (p *PatientData) GetBasalSecurityProfiles(ctx context.Context, args GetBasalSecurityProfilesArgs) ([]*internalSchema.Profile, *common.DetailedError) {
+	common.TimeIt(ctx, "getBasalSecurityProfiles")
+	defer common.TimeEnd(ctx, "getBasalSecurityProfiles")
+
+	params, logError := p.getDataV1Params(args.UserID, args.TraceID, args.StartDate, args.EndDate, false)
+	if logError != nil {
+		return nil, logError
+	}
+	profiles, err := p.patientDataRepository.GetBasalSecurityProfiles(ctx, args.TraceID, args.UserID, params.startTime, params.endTime)
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("GetBasalSecurityProfiles", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	return TransformToExposedProfiles(profiles), nil
+}
@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	internalSchema "github.com/tidepool-org/tide-whisperer/api/dto"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+func TestPatientData_GetBasalSecurityProfiles(t *testing.T) {
+	first := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 1, 0)
+	startTime := first.AddDate(0, 0, 10)
+
+	t.Run("should return the profiles with the time they applied", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", startTime, mock.Anything).Return([]schema.DbProfile{
+			{Type: "basalSecurity", Time: first, Guid: "p1", BasalSchedule: []schema.DbSchedule{{Rate: 1, Start: 0}, {Rate: 0.5, Start: 360}}},
+			{Type: "basalSecurity", Time: second, Guid: "p2", BasalSchedule: []schema.DbSchedule{{Rate: 0.8, Start: 0}}},
+		}, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		profiles, err := p.GetBasalSecurityProfiles(testCtx, GetBasalSecurityProfilesArgs{UserID: "user1", StartDate: startTime.Format(time.RFC3339Nano)})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []*internalSchema.Profile{
+			{
+				Type: "basalSecurity", Time: first, Guid: "p1",
+				BasalSchedule: []internalSchema.Schedule{{Rate: 1, Start: 0, End: 360}, {Rate: 0.5, Start: 360, End: 0}},
+				EndTime:       &second,
+			},
+			{Type: "basalSecurity", Time: second, Guid: "p2", BasalSchedule: []internalSchema.Schedule{{Rate: 0.8, Start: 0, End: 0}}},
+		}, profiles)
+	})
+
+	t.Run("should return an empty list without profiles", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", time.Time{}, mock.Anything).Return([]schema.DbProfile{}, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		profiles, err := p.GetBasalSecurityProfiles(testCtx, GetBasalSecurityProfilesArgs{UserID: "user1"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []*internalSchema.Profile{}, profiles)
+	})
+
+	t.Run("should refuse an invalid window", func(t *testing.T) {
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, &MockPatientDataRepository{}, false)
+
+		profiles, err := p.GetBasalSecurityProfiles(testCtx, GetBasalSecurityProfilesArgs{UserID: "user1", StartDate: "2023-02-01T00:00:00Z", EndDate: "2023-01-01T00:00:00Z"})
+
+		assert.Nil(t, profiles)
+		assert.Equal(t, http.StatusBadRequest, err.Status)
+	})
+
+	t.Run("should return an error when the query fails", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", mock.Anything, mock.Anything).Return(nil, errors.New("query failed"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		profiles, err := p.GetBasalSecurityProfiles(testCtx, GetBasalSecurityProfilesArgs{UserID: "user1"})
+
+		assert.Nil(t, profiles)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
+
+func TestPatientData_GetData_BasalSecurityProfiles(t *testing.T) {
+	first := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 1, 0)
+	startTime := first.AddDate(0, 0, 10)
+	endTime := second.AddDate(0, 0, 10)
+	repository := &MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+	repository.On("GetLatestBasalSecurityProfile", mock.Anything, mock.Anything, "user1").Return(nil, nil)
+	repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", startTime, endTime).Return([]schema.DbProfile{
+		{Type: "basalSecurity", Time: first, Guid: "p1"},
+		{Type: "basalSecurity", Time: second, Guid: "p2"},
+	}, nil)
+	// The settings effective at the end of the window
+	repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", endTime, endTime).Return([]schema.DbProfile{
+		{Type: "basalSecurity", Time: second, Guid: "p2"},
+	}, nil)
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(&tideV2Schema.SettingsResult{}, nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, false)
+	buffer := &bytes.Buffer{}
+
+	err := p.GetData(testCtx, GetDataArgs{
+		UserID:           "user1",
+		StartDate:        startTime.Format(time.RFC3339Nano),
+		EndDate:          endTime.Format(time.RFC3339Nano),
+		WithPumpSettings: true,
+	}, buffer)
+
+	assert.Nil(t, err)
+	var data []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &data))
+	assert.Len(t, data, 1)
+	payload := data[0]["payload"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "basalSecurity", "time": "2023-01-01T00:00:00Z", "guid": "p1", "endTime": "2023-02-01T00:00:00Z"},
+		map[string]interface{}{"type": "basalSecurity", "time": "2023-02-01T00:00:00Z", "guid": "p2"},
+	}, payload["basalsecurityprofiles"])
+}
@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+
+	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+// Kinds of device
+const (
+	DeviceKindPump    = "pump"
+	DeviceKindCgm     = "cgm"
+	DeviceKindBgm     = "bgm"
+	DeviceKindHandset = "handset"
+)
+
+// deviceTagKinds the kind of device of the upload deviceTags
+var deviceTagKinds = map[string]string{
+	"insulin-pump": DeviceKindPump,
+	"cgm":          DeviceKindCgm,
+	"bgm":          DeviceKindBgm,
+}
+
+// dataTypeKinds the kind of device producing a data type, used when the uploads do not tell it
+var dataTypeKinds = map[string]string{
+	"basal":        DeviceKindPump,
+	"bolus":        DeviceKindPump,
+	"wizard":       DeviceKindPump,
+	"pumpSettings": DeviceKindPump,
+	"cbg":          DeviceKindCgm,
+	"smbg":         DeviceKindBgm,
+}
+
+type (
+	// GetDevicesArgs arguments of GetDevices
+	GetDevicesArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+	}
+	// DevicePeriod a device used by a patient, with the time range of the data it produced
+	DevicePeriod struct {
+		// DeviceID the device ID of the data, for the pump & CGM of the current settings the one of their handset
+		DeviceID      string   `json:"deviceId,omitempty"`
+		Kinds         []string `json:"kinds"`
+		Manufacturers []string `json:"manufacturers,omitempty"`
+		Model         string   `json:"model,omitempty"`
+		SerialNumber  string   `json:"serialNumber,omitempty"`
+		SwVersion     string   `json:"swVersion,omitempty"`
+		// FirstDataTime & LastDataTime the time range of the device data, empty when it has none
+		FirstDataTime string   `json:"firstDataTime,omitempty"`
+		LastDataTime  string   `json:"lastDataTime,omitempty"`
+		NumData       int      `json:"numData"`
+		Types         []string `json:"types,omitempty"`
+		NumUploads    int      `json:"numUploads"`
+		// Current the device is part of the current pump settings
+		Current bool `json:"current"`
+	}
+	// DevicesResult result of GetDevices
+	DevicesResult struct {
+		// Devices the timeline of the devices, ordered by their first data
+		Devices []DevicePeriod `json:"devices"`
+	}
+)
+
+// GetDevices returns the devices used by a patient and when they were used.
+//
+// The devices are found from the deviceId of the data, described by the upload datums
+// and by the current pump settings for the handset, its pump and its CGM.
+func (p *PatientData) GetDevices(ctx context.Context, args GetDevicesArgs) (*DevicesResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getDevices")
+	defer common.TimeEnd(ctx, "getDevices")
+
+	uploads, err := p.patientDataRepository.GetUploads(ctx, args.TraceID, args.UserID)
+	if err == nil {
+		var counts []schema.DbDeviceTypeCount
+		if counts, err = p.patientDataRepository.GetDevicesDataCount(ctx, args.TraceID, args.UserID); err == nil {
+			settings, errSettings := p.getCurrentSettings(ctx, args.TraceID, args.UserID, args.SessionToken)
+			if errSettings != nil {
+				return nil, errSettings
+			}
+			return &DevicesResult{Devices: buildDevicePeriods(uploads, counts, settings)}, nil
+		}
+	}
+	return nil, &common.DetailedError{
+		Status:          errorRunningQuery.Status,
+		Code:            errorRunningQuery.Code,
+		Message:         errorRunningQuery.Message,
+		InternalMessage: addContextToMessage("GetDevices", args.UserID, args.TraceID, err.Error()),
+	}
+}
+
+// buildDevicePeriods merge the uploads, the data counts and the current settings by device
+func buildDevicePeriods(uploads []schema.DbUpload, counts []schema.DbDeviceTypeCount, settings *schemaV2.SettingsResult) []DevicePeriod {
+	periods := make([]*DevicePeriod, 0)
+	devices := make(map[string]*DevicePeriod)
+	getDevice := func(deviceID string) *DevicePeriod {
+		device, found := devices[deviceID]
+		if !found {
+			device = &DevicePeriod{DeviceID: deviceID, Kinds: []string{}}
+			devices[deviceID] = device
+			periods = append(periods, device)
+		}
+		return device
+	}
+
+	// The uploads are the newest first: the newest description of a device is kept
+	for _, upload := range uploads {
+		if upload.DeviceID == "" {
+			continue
+		}
+		device := getDevice(upload.DeviceID)
+		device.NumUploads++
+		if device.Model == "" {
+			device.Model = upload.DeviceModel
+		}
+		if device.SerialNumber == "" {
+			device.SerialNumber = upload.DeviceSerialNumber
+		}
+		if len(device.Manufacturers) == 0 {
+			device.Manufacturers = upload.DeviceManufacturers
+		}
+		for _, tag := range upload.DeviceTags {
+			if kind, found := deviceTagKinds[tag]; found {
+				device.Kinds = appendUnique(device.Kinds, kind)
+			}
+		}
+	}
+
+	deviceCounts := make(map[string][]schema.DbDeviceTypeCount)
+	for _, count := range counts {
+		// The data without deviceId can not be attributed to a device
+		if count.DeviceID == "" {
+			continue
+		}
+		addDeviceCount(getDevice(count.DeviceID), count)
+		deviceCounts[count.DeviceID] = append(deviceCounts[count.DeviceID], count)
+	}
+	for _, device := range periods {
+		if len(device.Kinds) > 0 {
+			continue
+		}
+		for _, count := range deviceCounts[device.DeviceID] {
+			if kind, found := dataTypeKinds[count.Type]; found {
+				device.Kinds = appendUnique(device.Kinds, kind)
+			}
+		}
+	}
+
+	if settings != nil {
+		handsetID := ""
+		if handset := settings.CurrentSettings.Device; handset != nil && handset.DeviceID != "" {
+			handsetID = handset.DeviceID
+			device := getDevice(handsetID)
+			// The pump & CGM of the handset have their own period
+			device.Kinds = []string{DeviceKindHandset}
+			device.Current = true
+			device.SwVersion = handset.SwVersion
+			if handset.Name != "" {
+				device.Model = handset.Name
+			}
+			if handset.Manufacturer != "" {
+				device.Manufacturers = []string{handset.Manufacturer}
+			}
+		}
+		if pump := settings.CurrentSettings.Pump; pump != nil {
+			periods = append(periods, newSettingsDevicePeriod(handsetID, DeviceKindPump, pump.Manufacturer, pump.Name, deviceCounts[handsetID]))
+		}
+		if cgm := settings.CurrentSettings.Cgm; cgm != nil {
+			periods = append(periods, newSettingsDevicePeriod(handsetID, DeviceKindCgm, cgm.Manufacturer, cgm.Name, deviceCounts[handsetID]))
+		}
+	}
+
+	sort.SliceStable(periods, func(i, j int) bool {
+		if periods[i].FirstDataTime == "" || periods[j].FirstDataTime == "" {
+			return periods[j].FirstDataTime == "" && periods[i].FirstDataTime != ""
+		}
+		return periods[i].FirstDataTime < periods[j].FirstDataTime
+	})
+	result := make([]DevicePeriod, len(periods))
+	for i, device := range periods {
+		sort.Strings(device.Types)
+		result[i] = *device
+	}
+	return result
+}
+
+// newSettingsDevicePeriod returns the period of a pump or a CGM of the current settings,
+// from the data of their kind of the handset
+func newSettingsDevicePeriod(handsetID string, kind string, manufacturer string, model string, handsetCounts []schema.DbDeviceTypeCount) *DevicePeriod {
+	device := &DevicePeriod{
+		DeviceID: handsetID,
+		Kinds:    []string{kind},
+		Model:    model,
+		Current:  true,
+	}
+	if manufacturer != "" {
+		device.Manufacturers = []string{manufacturer}
+	}
+	for _, count := range handsetCounts {
+		if dataTypeKinds[count.Type] == kind {
+			addDeviceCount(device, count)
+		}
+	}
+	return device
+}
+
+// addDeviceCount add the data of a type to a device period
+func addDeviceCount(device *DevicePeriod, count schema.DbDeviceTypeCount) {
+	device.NumData += count.Count
+	device.Types = appendUnique(device.Types, count.Type)
+	if device.FirstDataTime == "" || count.Start < device.FirstDataTime {
+		device.FirstDataTime = count.Start
+	}
+	if count.End > device.LastDataTime {
+		device.LastDataTime = count.End
+	}
+}
+
+// appendUnique append a value not already in values
+func appendUnique(values []string, value string) []string {
+	if common.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
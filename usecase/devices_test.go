@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/mdblp/go-common/clients/status"
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+func TestPatientData_GetDevices(t *testing.T) {
+	t.Run("should build the timeline of the devices from the uploads and the data", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return([]schema.DbUpload{
+			{UploadID: "up3", DeviceID: "pump2", DeviceModel: "Pump v2", DeviceTags: []string{"insulin-pump"}},
+			{UploadID: "up2", DeviceID: "pump1", DeviceModel: "Pump v1.1", DeviceSerialNumber: "P1", DeviceTags: []string{"insulin-pump"}},
+			{UploadID: "up1", DeviceID: "pump1", DeviceModel: "Pump v1", DeviceTags: []string{"insulin-pump"}},
+		}, nil)
+		repository.On("GetDevicesDataCount", mock.Anything, mock.Anything, "user1").Return([]schema.DbDeviceTypeCount{
+			{DeviceID: "pump2", Type: "basal", Count: 5, Start: "2023-03-01T00:00:00Z", End: "2023-03-31T00:00:00Z"},
+			{DeviceID: "pump1", Type: "bolus", Count: 3, Start: "2023-01-02T00:00:00Z", End: "2023-02-27T00:00:00Z"},
+			{DeviceID: "pump1", Type: "basal", Count: 4, Start: "2023-01-01T00:00:00Z", End: "2023-02-28T00:00:00Z"},
+			{DeviceID: "meter1", Type: "smbg", Count: 2, Start: "2023-02-01T00:00:00Z", End: "2023-02-02T00:00:00Z"},
+			{DeviceID: "", Type: "food", Count: 1, Start: "2022-01-01T00:00:00Z", End: "2022-01-01T00:00:00Z"},
+		}, nil)
+		tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(nil, &status.StatusError{Status: status.NewStatus(http.StatusNotFound, "no settings")})
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, false)
+
+		result, err := p.GetDevices(testCtx, GetDevicesArgs{UserID: "user1"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []DevicePeriod{
+			{
+				DeviceID: "pump1", Kinds: []string{DeviceKindPump}, Model: "Pump v1.1", SerialNumber: "P1",
+				FirstDataTime: "2023-01-01T00:00:00Z", LastDataTime: "2023-02-28T00:00:00Z", NumData: 7, Types: []string{"basal", "bolus"}, NumUploads: 2,
+			},
+			{
+				DeviceID: "meter1", Kinds: []string{DeviceKindBgm},
+				FirstDataTime: "2023-02-01T00:00:00Z", LastDataTime: "2023-02-02T00:00:00Z", NumData: 2, Types: []string{"smbg"},
+			},
+			{
+				DeviceID: "pump2", Kinds: []string{DeviceKindPump}, Model: "Pump v2",
+				FirstDataTime: "2023-03-01T00:00:00Z", LastDataTime: "2023-03-31T00:00:00Z", NumData: 5, Types: []string{"basal"}, NumUploads: 1,
+			},
+		}, result.Devices)
+	})
+
+	t.Run("should describe the handset, its pump and its CGM from the current settings", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return([]schema.DbUpload{}, nil)
+		repository.On("GetDevicesDataCount", mock.Anything, mock.Anything, "user1").Return([]schema.DbDeviceTypeCount{
+			{DeviceID: "handset1", Type: "cbg", Count: 100, Start: "2023-03-02T00:00:00Z", End: "2023-03-31T00:00:00Z"},
+			{DeviceID: "handset1", Type: "bolus", Count: 10, Start: "2023-03-01T00:00:00Z", End: "2023-03-30T00:00:00Z"},
+		}, nil)
+		settings := &tideV2Schema.SettingsResult{}
+		settings.CurrentSettings.Device = &orcaSchema.Device{DeviceID: "handset1", Name: "DBLG1", Manufacturer: "Diabeloop", SwVersion: "1.2"}
+		settings.CurrentSettings.Pump = &orcaSchema.Pump{Name: "Kaleido", Manufacturer: "ViCentra"}
+		settings.CurrentSettings.Cgm = &orcaSchema.Cgm{Name: "G6", Manufacturer: "Dexcom"}
+		tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(settings, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, false)
+
+		result, err := p.GetDevices(testCtx, GetDevicesArgs{UserID: "user1"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []DevicePeriod{
+			{
+				DeviceID: "handset1", Kinds: []string{DeviceKindHandset}, Manufacturers: []string{"Diabeloop"}, Model: "DBLG1", SwVersion: "1.2",
+				FirstDataTime: "2023-03-01T00:00:00Z", LastDataTime: "2023-03-31T00:00:00Z", NumData: 110, Types: []string{"bolus", "cbg"}, Current: true,
+			},
+			{
+				DeviceID: "handset1", Kinds: []string{DeviceKindPump}, Manufacturers: []string{"ViCentra"}, Model: "Kaleido",
+				FirstDataTime: "2023-03-01T00:00:00Z", LastDataTime: "2023-03-30T00:00:00Z", NumData: 10, Types: []string{"bolus"}, Current: true,
+			},
+			{
+				DeviceID: "handset1", Kinds: []string{DeviceKindCgm}, Manufacturers: []string{"Dexcom"}, Model: "G6",
+				FirstDataTime: "2023-03-02T00:00:00Z", LastDataTime: "2023-03-31T00:00:00Z", NumData: 100, Types: []string{"cbg"}, Current: true,
+			},
+		}, result.Devices)
+	})
+
+	t.Run("should return an error when the query fails", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return(nil, errors.New("query failed"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		result, err := p.GetDevices(testCtx, GetDevicesArgs{UserID: "user1"})
+
+		assert.Nil(t, result)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
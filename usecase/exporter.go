@@ -34,7 +34,20 @@ type ExportArgs struct {
 	WithParametersChanges bool
 	SessionToken          string
 	BgUnit                string
-	FormatToCsv           bool
+	// Format the export file format: FormatCSV, FormatJSON or FormatNDJSON
+	Format string
+	// Timezone, WithLocalTime, Fields, ParameterLevels & TrustedToken see GetDataArgs
+	Timezone        string
+	WithLocalTime   bool
+	Fields          []string
+	ParameterLevels []int
+	TrustedToken    bool
+}
+
+// CheckExportArgs returns the error of invalid export arguments, to be called before launching Export
+// in the background
+func (e Exporter) CheckExportArgs(args ExportArgs) *common.DetailedError {
+	return e.patientData.CheckGetDataArgs(getExportDataArgs(args))
 }
 
 func (e Exporter) Export(args ExportArgs) {
@@ -42,18 +55,9 @@ func (e Exporter) Export(args ExportArgs) {
 	backgroundCtx := common.TimeItContext(context.Background())
 	exportTime := time.Now().UTC().Format("2006-01-02T15:04:05")
 	filename := strings.Join([]string{args.UserID, exportTime}, "_")
-	getDataArgs := GetDataArgs{
-		UserID:                     args.UserID,
-		TraceID:                    args.TraceID,
-		StartDate:                  args.StartDate,
-		EndDate:                    args.EndDate,
-		WithPumpSettings:           args.WithPumpSettings,
-		WithParametersHistory:      args.WithParametersChanges,
-		SessionToken:               args.SessionToken,
-		BgUnit:                     args.BgUnit,
-		FilteringParametersHistory: true,
-	}
-	buffer, err := e.patientData.GetData(backgroundCtx, getDataArgs)
+	getDataArgs := getExportDataArgs(args)
+	buffer := &bytes.Buffer{}
+	err := e.patientData.GetData(backgroundCtx, getDataArgs, buffer)
 	if err != nil {
 		e.logger.Printf("get patient data failed: %v \n", err)
 		return
@@ -61,8 +65,9 @@ func (e Exporter) Export(args ExportArgs) {
 
 	finalBuffer := buffer
 
-	/*Transform to CSV */
-	if args.FormatToCsv {
+	switch args.Format {
+	case FormatCSV:
+		/*Transform to CSV */
 		var csvBuffer *bytes.Buffer
 		var csvErr error
 		if csvBuffer, csvErr = jsonToCsv(buffer.String()); csvErr != nil {
@@ -71,7 +76,9 @@ func (e Exporter) Export(args ExportArgs) {
 		}
 		finalBuffer = csvBuffer
 		filename = fmt.Sprintf("%s.csv", filename)
-	} else {
+	case FormatNDJSON:
+		filename = fmt.Sprintf("%s.ndjson", filename)
+	default:
 		filename = fmt.Sprintf("%s.json", filename)
 	}
 
@@ -81,3 +88,27 @@ func (e Exporter) Export(args ExportArgs) {
 	}
 	e.logger.Println("upload to S3 done with success, terminating go routine")
 }
+
+// getExportDataArgs returns the GetData arguments of an export
+func getExportDataArgs(args ExportArgs) GetDataArgs {
+	getDataArgs := GetDataArgs{
+		UserID:                     args.UserID,
+		TraceID:                    args.TraceID,
+		StartDate:                  args.StartDate,
+		EndDate:                    args.EndDate,
+		WithPumpSettings:           args.WithPumpSettings,
+		WithParametersHistory:      args.WithParametersChanges,
+		SessionToken:               args.SessionToken,
+		BgUnit:                     args.BgUnit,
+		FilteringParametersHistory: true,
+		Timezone:                   args.Timezone,
+		WithLocalTime:              args.WithLocalTime,
+		Fields:                     args.Fields,
+		ParameterLevels:            args.ParameterLevels,
+		TrustedToken:               args.TrustedToken,
+	}
+	if args.Format == FormatNDJSON {
+		getDataArgs.Format = FormatNDJSON
+	}
+	return getDataArgs
+}
@@ -2,12 +2,17 @@ package usecase
 
 import (
 	"bytes"
+	"io"
 	"log"
+	"net/http"
 	"strings"
 	"testing"
 
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
 )
 
 var (
@@ -28,7 +33,7 @@ var (
 		WithParametersChanges: withParametersChanges,
 		SessionToken:          sessionToken,
 		BgUnit:                MgdL,
-		FormatToCsv:           false,
+		Format:                FormatJSON,
 	}
 	exportArgsFormatCsv = ExportArgs{
 		UserID:                userID,
@@ -39,7 +44,7 @@ var (
 		WithParametersChanges: withParametersChanges,
 		SessionToken:          sessionToken,
 		BgUnit:                MgdL,
-		FormatToCsv:           true,
+		Format:                FormatCSV,
 	}
 	argsMatcher = mock.MatchedBy(func(args GetDataArgs) bool {
 		return args.UserID == userID && args.TraceID == traceID && args.SessionToken == sessionToken &&
@@ -74,6 +79,10 @@ func TestExporter_Export(t *testing.T) {
 			name:  "should call uploader with csv filename extension when GetData returns valid JSON and format is csv",
 			given: emptyGiven().withFormatToCsvTrue().withGetDataUseCaseSuccessValidJSON().withSuccessUploaderCSVFile(),
 		},
+		{
+			name:  "should call uploader with ndjson filename extension when format is ndjson",
+			given: emptyGiven().withFormatNDJSON().withGetDataUseCaseSuccessNDJSON().withSuccessUploaderNDJSONFile(),
+		},
 		{
 			name:  "should not call uploader when GetData returns invalid json and formatToCsv is true",
 			given: emptyGiven().withFormatToCsvTrue().withGetDataUseCaseSuccessInvalidJSON().withEmptyMockUploader(),
@@ -92,21 +101,76 @@ func TestExporter_Export(t *testing.T) {
 	}
 }
 
+func TestExporter_Export_schemaVersion(t *testing.T) {
+	schemaVersion := common.SchemaVersion{Minimum: 1, Maximum: 2}
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return params.UserID == userID && assert.ObjectsAreEqual(&schemaVersion, params.SchemaVersion)
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"up1","time":"2023-04-01T08:00:00.000Z","units":"mg/dL","value":60}`,
+	}), nil)
+	repository.On("GetUploadData", mock.Anything, mock.Anything, []string{"up1"}, &schemaVersion).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"up1","type":"upload","uploadId":"up1","time":"2023-04-01T00:00:00.000Z"}`,
+	}), nil)
+	repository.On("CountSchemaVersionFiltered", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	patientData := NewPatientDataUseCase(testLogger, &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+	patientData.SetSchemaVersion(schemaVersion)
+	uploader := MockUploader{}
+	uploader.On("Upload", mock.Anything, mock.Anything, mock.MatchedBy(func(buffer *bytes.Buffer) bool {
+		return strings.Contains(buffer.String(), `"id":"smbg1"`) && strings.Contains(buffer.String(), `"id":"up1"`)
+	})).Return(nil)
+	e := NewExporter(testLogger, patientData, &uploader)
+
+	e.Export(ExportArgs{UserID: userID, TraceID: traceID, StartDate: startDate, EndDate: endDate, BgUnit: MgdL, Format: FormatNDJSON})
+
+	repository.AssertCalled(t, "GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	repository.AssertCalled(t, "GetUploadData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	uploader.AssertExpectations(t)
+}
+
+func TestExporter_CheckExportArgs(t *testing.T) {
+	patientData := MockPatientDataUseCase{}
+	checkError := &common.DetailedError{Status: http.StatusForbidden, Code: errorParameterLevelsForbidden.Code}
+	patientData.On("CheckGetDataArgs", mock.MatchedBy(func(args GetDataArgs) bool {
+		return args.UserID == "abcdef" && args.Timezone == "Europe/Paris" && assert.ObjectsAreEqual([]int{3}, args.ParameterLevels)
+	})).Return(checkError)
+	e := Exporter{patientData: &patientData}
+
+	err := e.CheckExportArgs(ExportArgs{UserID: "abcdef", Timezone: "Europe/Paris", ParameterLevels: []int{3}})
+
+	assert.Equal(t, checkError, err)
+	patientData.AssertExpectations(t)
+}
+
 func (g *given) withGetDataUseCaseError() *given {
 	patientData := MockPatientDataUseCase{}
-	patientData.On("GetData", mock.Anything, argsMatcher).Return(nil, &common.DetailedError{})
+	patientData.On("GetData", mock.Anything, argsMatcher, mock.Anything).Return(&common.DetailedError{})
 	g.patientData = &patientData
 	return g
 }
 func (g *given) withGetDataUseCaseSuccessValidJSON() *given {
 	patientData := MockPatientDataUseCase{}
-	patientData.On("GetData", mock.Anything, argsMatcher).Return(bytes.NewBufferString(`{"foo": "bar"}`), nil)
+	patientData.On("GetData", mock.Anything, argsMatcher, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte(`{"foo": "bar"}`))
+	}).Return(nil)
 	g.patientData = &patientData
 	return g
 }
 func (g *given) withGetDataUseCaseSuccessInvalidJSON() *given {
 	patientData := MockPatientDataUseCase{}
-	patientData.On("GetData", mock.Anything, argsMatcher).Return(bytes.NewBufferString(`{"foo": invalid}`), nil)
+	patientData.On("GetData", mock.Anything, argsMatcher, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte(`{"foo": invalid}`))
+	}).Return(nil)
+	g.patientData = &patientData
+	return g
+}
+func (g *given) withGetDataUseCaseSuccessNDJSON() *given {
+	patientData := MockPatientDataUseCase{}
+	patientData.On("GetData", mock.Anything, mock.MatchedBy(func(args GetDataArgs) bool {
+		return args.UserID == userID && args.Format == FormatNDJSON
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte("{\"foo\": \"bar\"}\n{\"foo\": \"baz\"}\n"))
+	}).Return(nil)
 	g.patientData = &patientData
 	return g
 }
@@ -124,6 +188,15 @@ func (g *given) withSuccessUploaderJSONFile() *given {
 	return g
 }
 
+func (g *given) withSuccessUploaderNDJSONFile() *given {
+	uploadSuccess := MockUploader{}
+	uploadSuccess.On("Upload", mock.Anything, mock.MatchedBy(func(filename string) bool {
+		return strings.HasSuffix(filename, ".ndjson")
+	}), mock.AnythingOfType("*bytes.Buffer")).Return(nil)
+	g.uploader = &uploadSuccess
+	return g
+}
+
 func (g *given) withSuccessUploaderCSVFile() *given {
 	uploadSuccess := MockUploader{}
 	uploadSuccess.On("Upload", mock.Anything, mock.MatchedBy(func(filename string) bool {
@@ -134,12 +207,17 @@ func (g *given) withSuccessUploaderCSVFile() *given {
 }
 
 func (g *given) withFormatToCsvTrue() *given {
-	g.exportArgs.FormatToCsv = true
+	g.exportArgs.Format = FormatCSV
 	return g
 }
 
 func (g *given) withFormatToCsvFalse() *given {
-	g.exportArgs.FormatToCsv = false
+	g.exportArgs.Format = FormatJSON
+	return g
+}
+
+func (g *given) withFormatNDJSON() *given {
+	g.exportArgs.Format = FormatNDJSON
 	return g
 }
 
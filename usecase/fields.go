@@ -0,0 +1,33 @@
+package usecase
+
+// dataRequiredFields the fields always returned with the requested ones
+var dataRequiredFields = []string{"id", "type", "time"}
+
+// dataPreparationFields the fields of the stored data used to prepare them (see prepareDatum(), addLocalTime()
+// & convertDatumUnits()), read from the database even when they are not requested
+var dataPreparationFields = []string{"uploadId", "subType", "level", "guid", "timezone", "units"}
+
+// newFieldsFilter returns the fields to keep in the written data: the requested ones, the required ones
+// and the localTime when it is requested
+func newFieldsFilter(fields []string, withLocalTime bool) map[string]bool {
+	filter := make(map[string]bool, len(fields)+len(dataRequiredFields)+1)
+	for _, field := range dataRequiredFields {
+		filter[field] = true
+	}
+	for _, field := range fields {
+		filter[field] = true
+	}
+	if withLocalTime {
+		filter["localTime"] = true
+	}
+	return filter
+}
+
+// filterFields remove the fields of a datum which are not requested
+func (p *writeFromIter) filterFields(datum map[string]interface{}) {
+	for field := range datum {
+		if !p.fields[field] {
+			delete(datum, field)
+		}
+	}
+}
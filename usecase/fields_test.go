@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestPatientData_GetData_fields(t *testing.T) {
+	userID := "userid_test_fields"
+	cbgDay := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+		{
+			Id:      "cbg1",
+			UserId:  userID,
+			Day:     cbgDay,
+			Samples: []tideV2Schema.CbgSample{{Value: 10, Units: MmolL, Timestamp: cbgDay.Add(12 * time.Hour), Timezone: "UTC"}},
+		},
+	}
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return assert.ObjectsAreEqual(append([]string{"value"}, dataPreparationFields...), params.Fields)
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T11:00:00.000Z","timezone":"UTC","value":5}`,
+	}), nil)
+
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, false)
+	res := &bytes.Buffer{}
+	err := p.GetData(testCtx, GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg", "cbg"},
+		Format: FormatNDJSON,
+		Fields: []string{"value"},
+	}, res)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"smbg1","time":"2023-04-01T11:00:00.000Z","type":"smbg","value":5}
+{"id":"cbg_cbg1_0","time":"2023-04-01T12:00:00Z","type":"cbg","value":10}
+`, res.String())
+	repository.AssertExpectations(t)
+}
+
+func TestNewFieldsFilter(t *testing.T) {
+	assert.Equal(t, map[string]bool{"id": true, "type": true, "time": true, "value": true}, newFieldsFilter([]string{"value"}, false))
+	assert.Equal(t, map[string]bool{"id": true, "type": true, "time": true, "localTime": true}, newFieldsFilter([]string{"time"}, true))
+}
+
+func TestPatientData_GetData_fieldsWithBgUnit(t *testing.T) {
+	userID := "userid_test_fields_bgunit"
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return common.Contains(params.Fields, "units")
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T11:00:00.000Z","timezone":"UTC","value":5.5,"units":"mmol/L"}`,
+	}), nil)
+
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+	res := &bytes.Buffer{}
+	err := p.GetData(testCtx, GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg"},
+		Format: FormatNDJSON,
+		Fields: []string{"time", "type", "value"},
+		BgUnit: MgdL,
+	}, res)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"smbg1","time":"2023-04-01T11:00:00.000Z","type":"smbg","value":99}
+`, res.String())
+	repository.AssertExpectations(t)
+}
@@ -0,0 +1,273 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+const (
+	// HypoEvent type of the glycemic events below the hypo threshold
+	HypoEvent = "hypo"
+	// HyperEvent type of the glycemic events above the hyper threshold
+	HyperEvent = "hyper"
+
+	// minEventDuration consecutive time out of range (resp. back in range) to start (resp. end) an event
+	minEventDuration = 15 * time.Minute
+	// maxCbgGap a longer gap between two cbg ends the current event
+	maxCbgGap = 15 * time.Minute
+	// cbgSampleInterval the time covered by a cbg: 3 consecutive cbg are 15 minutes
+	cbgSampleInterval = 5 * time.Minute
+	// nightEndHour the night is from midnight to 6AM (local time)
+	nightEndHour = 6
+)
+
+type (
+	// GetGlycemicEventsArgs arguments of GetGlycemicEvents
+	GetGlycemicEventsArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// StartDate & EndDate the window (ISO-8601 datetime), the last Days days by default
+		StartDate string
+		EndDate   string
+		// Days the window duration when StartDate is not set, DefaultSummaryDays by default
+		Days int
+		// BgUnit the unit of the result and of the thresholds, mg/dL by default
+		BgUnit string
+		// HypoThreshold & HyperThreshold override the patient's hypo & hyper limits when set
+		HypoThreshold  float64
+		HyperThreshold float64
+	}
+	// GlycemicEvent an hypoglycemia or hyperglycemia episode
+	GlycemicEvent struct {
+		// Type HypoEvent or HyperEvent
+		Type string `json:"type"`
+		// StartDate the first cbg out of range, EndDate the first cbg back in range
+		// (or the end of the last cbg out of range when the data stops)
+		StartDate       string `json:"startDate"`
+		EndDate         string `json:"endDate"`
+		DurationMinutes int    `json:"durationMinutes"`
+		// Nadir the lowest cbg of an hypo, Peak the highest cbg of an hyper
+		Nadir float64 `json:"nadir,omitempty"`
+		Peak  float64 `json:"peak,omitempty"`
+		Unit  string  `json:"unit"`
+	}
+	// GlycemicEventsDay the events starting during a day, at night (midnight to 6AM) or during the day-time
+	GlycemicEventsDay struct {
+		// Date the day, in the local time of the samples (YYYY-MM-DD)
+		Date  string          `json:"date"`
+		Night []GlycemicEvent `json:"night"`
+		Day   []GlycemicEvent `json:"day"`
+	}
+	// GlycemicEventsResult returned by the glycemic events v1 route
+	GlycemicEventsResult struct {
+		UserID         string              `json:"userId"`
+		StartDate      string              `json:"startDate"`
+		EndDate        string              `json:"endDate"`
+		BgUnit         string              `json:"bgUnit"`
+		HypoThreshold  float64             `json:"hypoThreshold"`
+		HyperThreshold float64             `json:"hyperThreshold"`
+		NumHypoEvents  int                 `json:"numHypoEvents"`
+		NumHyperEvents int                 `json:"numHyperEvents"`
+		Days           []GlycemicEventsDay `json:"days"`
+	}
+	// glycemicEventDetector detect the events of one type from the cbg, in time order
+	glycemicEventDetector struct {
+		eventType  string
+		outOfRange func(value float64) bool
+		// the current excursion out of range
+		current  *glycemicExcursion
+		lastTime time.Time
+		events   []glycemicExcursion
+	}
+	glycemicExcursion struct {
+		eventType string
+		// first the first cbg out of range, extreme the nadir or peak
+		first, extreme bgValue
+		lastOut        time.Time
+		// recovery the first cbg back in range, zero while out of range
+		recovery time.Time
+	}
+)
+
+// GetGlycemicEvents detect the hypoglycemia & hyperglycemia events from the cbg, using the consensus rules:
+// an event starts after at least 15 minutes out of range and ends after at least 15 minutes back in range.
+func (p *PatientData) GetGlycemicEvents(ctx context.Context, args GetGlycemicEventsArgs) (*GlycemicEventsResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getGlycemicEvents")
+	defer common.TimeEnd(ctx, "getGlycemicEvents")
+
+	unit := args.BgUnit
+	if unit != MmolL {
+		unit = MgdL
+	}
+	startTime, endTime, err := getWindow(args.StartDate, args.EndDate, args.Days, DefaultSummaryDays, time.Now())
+	if err == nil && args.HypoThreshold > 0 && args.HyperThreshold > 0 && args.HypoThreshold >= args.HyperThreshold {
+		err = fmt.Errorf("hypoThreshold %v is not below hyperThreshold %v", args.HypoThreshold, args.HyperThreshold)
+	}
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetGlycemicEvents", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+
+	hypoThreshold, hyperThreshold := args.HypoThreshold, args.HyperThreshold
+	if hypoThreshold == 0 || hyperThreshold == 0 {
+		settings, errSettings := p.getCurrentSettings(ctx, args.TraceID, args.UserID, args.SessionToken)
+		if errSettings != nil {
+			return nil, errSettings
+		}
+		hypoLimit, hyperLimit := getGlyLimits(settings, unit)
+		if hypoThreshold == 0 {
+			hypoThreshold = hypoLimit
+		}
+		if hyperThreshold == 0 {
+			hyperThreshold = hyperLimit
+		}
+	}
+
+	values, errValues := p.getCbgValues(ctx, args.TraceID, args.UserID, args.SessionToken, startTime, endTime, unit)
+	if errValues != nil {
+		return nil, errValues
+	}
+
+	detectors := []*glycemicEventDetector{
+		{eventType: HypoEvent, outOfRange: func(value float64) bool { return value < hypoThreshold }},
+		{eventType: HyperEvent, outOfRange: func(value float64) bool { return value > hyperThreshold }},
+	}
+	for _, bg := range values {
+		for _, detector := range detectors {
+			detector.add(bg)
+		}
+	}
+
+	result := &GlycemicEventsResult{
+		UserID:         args.UserID,
+		StartDate:      startTime.UTC().Format(time.RFC3339Nano),
+		EndDate:        endTime.UTC().Format(time.RFC3339Nano),
+		BgUnit:         unit,
+		HypoThreshold:  hypoThreshold,
+		HyperThreshold: hyperThreshold,
+		Days:           make([]GlycemicEventsDay, 0),
+	}
+	excursions := make([]glycemicExcursion, 0)
+	for _, detector := range detectors {
+		detector.close()
+		if detector.eventType == HypoEvent {
+			result.NumHypoEvents = len(detector.events)
+		} else {
+			result.NumHyperEvents = len(detector.events)
+		}
+		excursions = append(excursions, detector.events...)
+	}
+	sort.SliceStable(excursions, func(i, j int) bool {
+		return excursions[i].first.time.Before(excursions[j].first.time)
+	})
+
+	dayIndex := make(map[string]int)
+	locations := make(map[string]*time.Location)
+	for i := range excursions {
+		excursion := &excursions[i]
+		localStart := toLocalTime(excursion.first.time, excursion.first.timezone, excursion.first.timezoneOffset, locations)
+		date := localStart.Format("2006-01-02")
+		index, found := dayIndex[date]
+		if !found {
+			index = len(result.Days)
+			dayIndex[date] = index
+			result.Days = append(result.Days, GlycemicEventsDay{
+				Date:  date,
+				Night: make([]GlycemicEvent, 0),
+				Day:   make([]GlycemicEvent, 0),
+			})
+		}
+		event := excursion.event(unit)
+		if localStart.Hour() < nightEndHour {
+			result.Days[index].Night = append(result.Days[index].Night, event)
+		} else {
+			result.Days[index].Day = append(result.Days[index].Day, event)
+		}
+	}
+	return result, nil
+}
+
+// add process the next cbg
+func (d *glycemicEventDetector) add(bg bgValue) {
+	if d.current != nil && bg.time.Sub(d.lastTime) > maxCbgGap {
+		d.close()
+	}
+	d.lastTime = bg.time
+
+	if d.outOfRange(bg.value) {
+		if d.current == nil {
+			d.current = &glycemicExcursion{eventType: d.eventType, first: bg, extreme: bg}
+		}
+		d.current.lastOut = bg.time
+		d.current.recovery = time.Time{}
+		if d.isWorse(bg.value, d.current.extreme.value) {
+			d.current.extreme = bg
+		}
+		return
+	}
+
+	if d.current == nil {
+		return
+	}
+	if d.current.duration() < minEventDuration {
+		// Too short to be an event
+		d.current = nil
+		return
+	}
+	if d.current.recovery.IsZero() {
+		d.current.recovery = bg.time
+	}
+	if bg.time.Sub(d.current.recovery)+cbgSampleInterval >= minEventDuration {
+		d.close()
+	}
+}
+
+// close end the current excursion, keeping it when it lasted long enough to be an event
+func (d *glycemicEventDetector) close() {
+	if d.current != nil && d.current.duration() >= minEventDuration {
+		d.events = append(d.events, *d.current)
+	}
+	d.current = nil
+}
+
+func (d *glycemicEventDetector) isWorse(value float64, extreme float64) bool {
+	if d.eventType == HypoEvent {
+		return value < extreme
+	}
+	return value > extreme
+}
+
+// duration returns the time spent out of range, from the first cbg out of range to the end of the last one
+func (e *glycemicExcursion) duration() time.Duration {
+	return e.lastOut.Add(cbgSampleInterval).Sub(e.first.time)
+}
+
+// event returns the API event of an excursion
+func (e *glycemicExcursion) event(unit string) GlycemicEvent {
+	end := e.lastOut.Add(cbgSampleInterval)
+	if !e.recovery.IsZero() {
+		end = e.recovery
+	}
+	event := GlycemicEvent{
+		Type:            e.eventType,
+		StartDate:       e.first.time.UTC().Format(time.RFC3339Nano),
+		EndDate:         end.UTC().Format(time.RFC3339Nano),
+		DurationMinutes: int(end.Sub(e.first.time).Minutes()),
+		Unit:            unit,
+	}
+	if e.eventType == HypoEvent {
+		event.Nadir = e.extreme.value
+	} else {
+		event.Peak = e.extreme.value
+	}
+	return event
+}
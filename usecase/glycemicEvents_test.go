@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/clients/status"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPatientData_GetGlycemicEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     GetGlycemicEventsArgs
+		expected *GlycemicEventsResult
+		err      string
+	}{
+		{
+			name: "should detect the events using the default limits",
+			args: GetGlycemicEventsArgs{UserID: "user1", StartDate: "2023-04-01T00:00:00Z", EndDate: "2023-04-02T00:00:00Z"},
+			expected: &GlycemicEventsResult{
+				UserID:         "user1",
+				StartDate:      "2023-04-01T00:00:00Z",
+				EndDate:        "2023-04-02T00:00:00Z",
+				BgUnit:         MgdL,
+				HypoThreshold:  70,
+				HyperThreshold: 180,
+				NumHypoEvents:  3,
+				NumHyperEvents: 1,
+				Days: []GlycemicEventsDay{
+					{
+						Date: "2023-04-01",
+						Night: []GlycemicEvent{
+							{Type: HypoEvent, StartDate: "2023-04-01T02:00:00Z", EndDate: "2023-04-01T02:20:00Z", DurationMinutes: 20, Nadir: 50, Unit: MgdL},
+						},
+						Day: []GlycemicEvent{
+							{Type: HypoEvent, StartDate: "2023-04-01T10:00:00Z", EndDate: "2023-04-01T10:15:00Z", DurationMinutes: 15, Nadir: 60, Unit: MgdL},
+							{Type: HyperEvent, StartDate: "2023-04-01T14:00:00Z", EndDate: "2023-04-01T14:30:00Z", DurationMinutes: 30, Peak: 250, Unit: MgdL},
+							{Type: HypoEvent, StartDate: "2023-04-01T20:00:00Z", EndDate: "2023-04-01T20:20:00Z", DurationMinutes: 20, Nadir: 60, Unit: MgdL},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "should use the requested thresholds",
+			args: GetGlycemicEventsArgs{UserID: "user1", StartDate: "2023-04-01T00:00:00Z", EndDate: "2023-04-02T00:00:00Z", HypoThreshold: 40, HyperThreshold: 300},
+			expected: &GlycemicEventsResult{
+				UserID:         "user1",
+				StartDate:      "2023-04-01T00:00:00Z",
+				EndDate:        "2023-04-02T00:00:00Z",
+				BgUnit:         MgdL,
+				HypoThreshold:  40,
+				HyperThreshold: 300,
+				Days:           []GlycemicEventsDay{},
+			},
+		},
+		{
+			name: "should fail when the hypo threshold is above the hyper one",
+			args: GetGlycemicEventsArgs{UserID: "user1", HypoThreshold: 200, HyperThreshold: 180},
+			err:  errorInvalidParameters.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+			tideV2Client.MockedCbg = glycemicEventsCbgBuckets()
+			tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(nil, &status.StatusError{Status: status.NewStatus(http.StatusNotFound, "no settings")})
+			p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, false)
+
+			events, err := p.GetGlycemicEvents(testCtx, tt.args)
+
+			if tt.err != "" {
+				assert.NotNil(t, err)
+				assert.Equal(t, tt.err, err.Code)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, events)
+		})
+	}
+}
+
+// glycemicEventsCbgBuckets returns a day of cbg (mg/dL) with a night hypo, a too short hypo, a 3 cbg hypo,
+// an hyper going briefly back in range and an hypo interrupted by the end of the data
+func glycemicEventsCbgBuckets() []tideV2Schema.CbgBucket {
+	series := []struct {
+		start  time.Duration
+		values []float64
+	}{
+		{2 * time.Hour, []float64{60, 55, 50, 65, 100, 100, 100, 100}},
+		{8 * time.Hour, []float64{60, 60, 100}},
+		{10 * time.Hour, []float64{60, 60, 60, 100, 100, 100}},
+		{14 * time.Hour, []float64{200, 250, 220, 210, 150, 190, 150, 150, 150, 150}},
+		{20 * time.Hour, []float64{60, 60, 60, 60}},
+	}
+	samples := make([]tideV2Schema.CbgSample, 0)
+	for _, s := range series {
+		for i, value := range s.values {
+			samples = append(samples, tideV2Schema.CbgSample{
+				Value:     value,
+				Units:     MgdL,
+				Timestamp: summaryDay.Add(s.start + time.Duration(i)*5*time.Minute),
+				Timezone:  "UTC",
+			})
+		}
+	}
+	return []tideV2Schema.CbgBucket{{Id: "cbg1", Day: summaryDay, Samples: samples}}
+}
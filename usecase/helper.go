@@ -1,18 +1,16 @@
 package usecase
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"io"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mdblp/go-common/clients/status"
-	appContext "github.com/mdblp/go-common/context"
 	orcaSchema "github.com/mdblp/orca/schema"
 	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
 	"github.com/tidepool-org/go-common/clients/mongo"
@@ -159,7 +157,45 @@ func TransformToExposedModel(lastestProfile *schema.DbProfile) *internalSchema.P
 	return result
 }
 
+// getBasalSecurityProfiles returns the basal security profiles applied during a window, nil when there are none or on error:
+// as for the latest profile, the pump settings are returned without them
+func (p *PatientData) getBasalSecurityProfiles(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time) []*internalSchema.Profile {
+	common.TimeIt(ctx, "getBasalSecurityProfiles")
+	defer common.TimeEnd(ctx, "getBasalSecurityProfiles")
+	profiles, err := p.patientDataRepository.GetBasalSecurityProfiles(ctx, traceID, userID, startTime, endTime)
+	if err != nil {
+		p.logger.Printf("{%s} - {GetBasalSecurityProfiles:\"%s\"}", traceID, err)
+		return nil
+	}
+	if len(profiles) == 0 {
+		return nil
+	}
+	return TransformToExposedProfiles(profiles)
+}
+
+// TransformToExposedProfiles transform the profiles in time order, each one applying until the next one
+func TransformToExposedProfiles(profiles []schema.DbProfile) []*internalSchema.Profile {
+	result := make([]*internalSchema.Profile, len(profiles))
+	for i := range profiles {
+		result[i] = TransformToExposedModel(&profiles[i])
+		if i < len(profiles)-1 {
+			endTime := profiles[i+1].Time
+			result[i].EndTime = &endTime
+		}
+	}
+	return result
+}
+
 func newWriteError(err error) *common.DetailedError {
+	var errIter iteratorError
+	if errors.As(err, &errIter) {
+		return &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: err.Error(),
+		}
+	}
 	return &common.DetailedError{
 		Status:          errorWriteBuffer.Status,
 		Code:            errorWriteBuffer.Code,
@@ -167,8 +203,33 @@ func newWriteError(err error) *common.DetailedError {
 		InternalMessage: err.Error(),
 	}
 }
-func (p *PatientData) writeDataToBuffer(
+
+// iteratorError the error which ended a database iteration, reported as a query error by newWriteError
+type iteratorError struct {
+	err error
+}
+
+func (e iteratorError) Error() string {
+	return "iterator: " + e.err.Error()
+}
+
+func (e iteratorError) Unwrap() error {
+	return e.err
+}
+
+// iterErr returns the error which ended the iteration of iter, if any: Next() also returns false
+// when the cursor fails in the middle of the data. Only the iterators with an Err() method (mongo.Cursor) can report it.
+func iterErr(iter mongo.StorageIterator) error {
+	if errIter, ok := iter.(interface{ Err() error }); ok {
+		if err := errIter.Err(); err != nil {
+			return iteratorError{err: err}
+		}
+	}
+	return nil
+}
+func (p *PatientData) writeData(
 	ctx context.Context,
+	res io.Writer,
 	traceID string,
 	includePumpSettings bool,
 	includeParameterChanges bool,
@@ -181,75 +242,79 @@ func (p *PatientData) writeDataToBuffer(
 	filteringParameterChanges bool,
 	startTime time.Time,
 	endTime time.Time,
-) (*bytes.Buffer, *common.DetailedError) {
-	buff := bytes.Buffer{}
+) *common.DetailedError {
 	var iterUploads mongo.StorageIterator
-	common.TimeIt(ctx, "writeDataToBuffer")
-	defer common.TimeEnd(ctx, "writeDataToBuffer")
-	// We return a JSON array, first character is: '['
-	_, err := buff.WriteString("[\n")
+	common.TimeIt(ctx, "writeData")
+	defer common.TimeEnd(ctx, "writeData")
+	err := writeParams.writeStart(res)
 	if err != nil {
-		return nil, newWriteError(err)
+		return newWriteError(err)
 	}
 
 	if includePumpSettings && pumpSettings != nil {
 		writeParams.settings = pumpSettings
 		common.TimeIt(ctx, "writePumpSettings")
-		err = writePumpSettings(ctx, &buff, writeParams, bgUnit)
+		err = writePumpSettings(ctx, res, writeParams, bgUnit)
+		common.TimeEnd(ctx, "writePumpSettings")
 		if err != nil {
-			common.TimeEnd(ctx, "writePumpSettings")
-			return nil, newWriteError(err)
+			return endArrayOnError(res, writeParams, err)
 		}
-		common.TimeEnd(ctx, "writePumpSettings")
 	}
 
 	if includeParameterChanges && pumpSettings != nil {
 		writeParams.settings = pumpSettings
 		common.TimeIt(ctx, "writeDeviceParameterChanges")
-		err = writeDeviceParameterChanges(ctx, &buff, writeParams, filteringParameterChanges, bgUnit, startTime, endTime)
+		err = writeDeviceParameterChanges(ctx, res, writeParams, filteringParameterChanges, bgUnit, startTime, endTime)
+		common.TimeEnd(ctx, "writeDeviceParameterChanges")
 		if err != nil {
-			common.TimeEnd(ctx, "writeDeviceParameterChanges")
-			return nil, newWriteError(err)
+			return endArrayOnError(res, writeParams, err)
 		}
-		common.TimeEnd(ctx, "writeDeviceParameterChanges")
-
 	}
 
-	common.TimeIt(ctx, "writeFromIterV1")
-	writeParams.iter = iterData
-	err = writeFromIterV1(ctx, &buff, bgUnit, writeParams)
-	if err != nil {
-		common.TimeEnd(ctx, "writeFromIterV1")
-		return nil, newWriteError(err)
-	}
-	common.TimeEnd(ctx, "writeFromIterV1")
-
-	if len(Cbgs) > 0 {
-		common.TimeIt(ctx, "writeCbgs")
+	if writeParams.limit > 0 {
+		common.TimeIt(ctx, "writePage")
+		writeParams.iter = iterData
 		writeParams.cbgs = Cbgs
-		err = writeCbgs(ctx, bgUnit, &buff, writeParams)
+		writeParams.basals = Basals
+		err = writePage(ctx, res, bgUnit, writeParams)
+		common.TimeEnd(ctx, "writePage")
+		if err != nil {
+			return endArrayOnError(res, writeParams, err)
+		}
+	} else {
+		common.TimeIt(ctx, "writeFromIterV1")
+		writeParams.iter = iterData
+		err = writeFromIterV1(ctx, res, bgUnit, writeParams)
+		common.TimeEnd(ctx, "writeFromIterV1")
 		if err != nil {
+			return endArrayOnError(res, writeParams, err)
+		}
+
+		if len(Cbgs) > 0 {
+			common.TimeIt(ctx, "writeCbgs")
+			writeParams.cbgs = Cbgs
+			err = writeCbgs(ctx, bgUnit, res, writeParams)
 			common.TimeEnd(ctx, "writeCbgs")
-			return nil, newWriteError(err)
+			if err != nil {
+				return endArrayOnError(res, writeParams, err)
+			}
 		}
-		common.TimeEnd(ctx, "writeCbgs")
-	}
 
-	if len(Basals) > 0 {
-		common.TimeIt(ctx, "writeBasals")
-		writeParams.basals = Basals
-		err = writeBasals(ctx, &buff, writeParams)
-		if err != nil {
+		if len(Basals) > 0 {
+			common.TimeIt(ctx, "writeBasals")
+			writeParams.basals = Basals
+			err = writeBasals(ctx, res, writeParams)
 			common.TimeEnd(ctx, "writeBasals")
-			return nil, newWriteError(err)
+			if err != nil {
+				return endArrayOnError(res, writeParams, err)
+			}
 		}
-		common.TimeEnd(ctx, "writeBasals")
 	}
 
 	// Fetch uploads
-	if len(writeParams.uploadIDs) > 0 {
+	if len(writeParams.uploadIDs) > 0 && !writeParams.skipUploads {
 		common.TimeIt(ctx, "getUploads")
-		iterUploads, err = p.patientDataRepository.GetUploadData(ctx, traceID, writeParams.uploadIDs)
+		iterUploads, err = p.patientDataRepository.GetUploadData(ctx, traceID, writeParams.uploadIDs, writeParams.schemaVersion)
 		if err != nil {
 			// Just log the problem, don't crash the query
 			writeParams.parametersHistory = nil
@@ -257,10 +322,10 @@ func (p *PatientData) writeDataToBuffer(
 		} else {
 			defer iterUploads.Close(ctx)
 			writeParams.iter = iterUploads
-			err = writeFromIterV1(ctx, &buff, bgUnit, writeParams)
+			err = writeFromIterV1(ctx, res, bgUnit, writeParams)
 			if err != nil {
 				common.TimeEnd(ctx, "getUploads")
-				return nil, newWriteError(err)
+				return endArrayOnError(res, writeParams, err)
 			}
 		}
 		common.TimeEnd(ctx, "getUploads")
@@ -274,23 +339,85 @@ func (p *PatientData) writeDataToBuffer(
 		p.logger.Printf("{%s} - {nErrors:%d,jsonMarshall:\"%s\"}", traceID, writeParams.jsonError.numErrors, writeParams.jsonError.firstError)
 	}
 
+	err = writeParams.writeEnd(res)
+	if err != nil {
+		return newWriteError(err)
+	}
+	return nil
+}
+
+// endArrayOnError try to close the JSON array after a failure in the middle of the write,
+// so the client still receive a well-formed document
+func endArrayOnError(res io.Writer, p *writeFromIter, err error) *common.DetailedError {
+	p.writeEnd(res)
+	return newWriteError(err)
+}
+
+// writeStart write the beginning of the output
+func (p *writeFromIter) writeStart(res io.Writer) error {
+	if p.format == FormatNDJSON {
+		return nil
+	}
+	// We return a JSON array, first character is: '['
+	_, err := io.WriteString(res, "[\n")
+	return err
+}
+
+// writeEnd write the end of the output
+func (p *writeFromIter) writeEnd(res io.Writer) error {
+	if p.format == FormatNDJSON {
+		return nil
+	}
 	// Last JSON array character:
-	_, err = buff.WriteString("]\n")
+	_, err := io.WriteString(res, "]\n")
+	return err
+}
+
+// writeDatum marshal and write one datum to the output, using the requested format.
+// JSON marshall errors are recorded and the datum is skipped. The localTime field is added
+// and the fields are filtered when requested.
+func (p *writeFromIter) writeDatum(res io.Writer, datum map[string]interface{}) error {
+	if p.withLocalTime {
+		p.addLocalTime(datum)
+	}
+	if p.fields != nil {
+		p.filterFields(datum)
+	}
+	jsonDatum, err := json.Marshal(datum)
+	if err != nil {
+		if p.jsonError.firstError == nil {
+			p.jsonError.firstError = err
+		}
+		p.jsonError.numErrors++
+		return nil
+	}
+	if p.format == FormatNDJSON {
+		// One datum per line
+		jsonDatum = append(jsonDatum, '\n')
+	} else if p.writeCount > 0 {
+		// Add the coma and line return (for readability)
+		_, err = io.WriteString(res, ",\n")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = res.Write(jsonDatum)
 	if err != nil {
-		return nil, newWriteError(err)
+		return err
 	}
-	return &buff, nil
+	p.writeCount++
+	return nil
 }
 
-func isConvertibleUnit(unit string) bool {
-	return unit == MgdL || unit == MmolL
+// isTypeRequested returns true when no types filter is set or when datumType is part of it
+func isTypeRequested(types []string, datumType string) bool {
+	return len(types) == 0 || common.Contains(types, datumType)
 }
 
-func writeDeviceParameterChanges(ctx context.Context, res *bytes.Buffer, p *writeFromIter, filteringParameterChanges bool, bgUnit string, startTime time.Time, endTime time.Time) error {
-	logger := appContext.GetLogger(ctx)
+func writeDeviceParameterChanges(ctx context.Context, res io.Writer, p *writeFromIter, filteringParameterChanges bool, bgUnit string, startTime time.Time, endTime time.Time) error {
 	settings := p.settings
 
-	for _, paramChange := range settings.HistoryParameters {
+	for _, paramChange := range convertHistoryParameters(settings.HistoryParameters, bgUnit) {
 		if filteringParameterChanges && (paramChange.Timestamp.Before(startTime) || paramChange.Timestamp.After(endTime)) {
 			continue
 		}
@@ -313,70 +440,19 @@ func writeDeviceParameterChanges(ctx context.Context, res *bytes.Buffer, p *writ
 			datum["previousValue"] = paramChange.PreviousValue
 		}
 
-		/*Handle conversion if bgUnit is not empty*/
-		if bgUnit != "" {
-			if datum["units"] != bgUnit && isConvertibleUnit(datum["units"].(string)) {
-				val, err := convertToFloat64(datum["value"], datum["name"])
-				if err != nil {
-					logger.Errorf("cannot convert device parameter change with name=%s having value=%s \n error=%v \n Continuing with original unit and value.", datum["name"], datum["value"], err)
-				} else {
-					if datum["units"] == MgdL {
-						datum["units"] = MmolL
-						datum["value"] = fmt.Sprintf("%g", convertToMmol(val))
-					} else {
-						datum["units"] = MgdL
-						datum["value"] = fmt.Sprintf("%g", convertToMgdl(val))
-					}
-				}
-
-			}
-
-			if paramChange.PreviousUnit != bgUnit && paramChange.PreviousValue != "" && isConvertibleUnit(paramChange.PreviousUnit) {
-				val, err := convertToFloat64(datum["previousValue"], datum["name"])
-				if err != nil {
-					logger.Errorf("cannot convert device parameter change with name=%s having previousValue=%s \n error=%v \n Continuing with original previousUnit and previousValue.", datum["name"], datum["previousValue"], err)
-				}
-				if paramChange.PreviousUnit == MgdL {
-					datum["previousValue"] = fmt.Sprintf("%g", convertToMmol(val))
-				} else {
-					datum["previousValue"] = fmt.Sprintf("%g", convertToMgdl(val))
-				}
-			}
-		}
-
-		jsonDatum, err := json.Marshal(datum)
-		if err != nil {
-			if p.jsonError.firstError == nil {
-				p.jsonError.firstError = err
-			}
-			p.jsonError.numErrors++
-		}
-		if p.writeCount > 0 {
-			// Add the coma and line return (for readability)
-			_, err = res.WriteString(",\n")
-			if err != nil {
-				return err
-			}
-		}
-		_, err = res.Write(jsonDatum)
-		if err != nil {
+		if err := p.writeDatum(res, datum); err != nil {
 			return err
 		}
-		p.writeCount++
 	}
 	return nil
 }
 
-func convertToFloat64(value interface{}, name interface{}) (float64, error) {
-	val, err := strconv.ParseFloat(value.(string), 64)
-	if err != nil {
-		return 0, fmt.Errorf("conversion failed because previousValue=%s for param %s is not a number", value.(string), name.(string))
-	}
-	return val, nil
+func writePumpSettings(ctx context.Context, res io.Writer, p *writeFromIter, bgUnit string) error {
+	return p.writeDatum(res, pumpSettingsDatum(ctx, p, bgUnit))
 }
 
-func writePumpSettings(ctx context.Context, res *bytes.Buffer, p *writeFromIter, bgUnit string) error {
-	logger := appContext.GetLogger(ctx)
+// pumpSettingsDatum map the V2 pump settings to the V1 schema
+func pumpSettingsDatum(ctx context.Context, p *writeFromIter, bgUnit string) map[string]interface{} {
 	settings := p.settings
 	datum := make(map[string]interface{})
 	datum["id"] = uuid.New().String()
@@ -389,88 +465,20 @@ func writePumpSettings(ctx context.Context, res *bytes.Buffer, p *writeFromIter,
 	if settings.Device != nil {
 		datum["deviceId"] = settings.CurrentSettings.Device.DeviceID
 	}
-	/* Perform conversion */
-	if bgUnit != "" {
-		for _, hp := range settings.HistoryParameters {
-			if hp.Unit != bgUnit && isConvertibleUnit(hp.Unit) {
-				val, err := convertToFloat64(datum["value"], datum["name"])
-				if err != nil {
-					logger.Errorf("cannot convert param=%s having value=%s \n error=%v \n Continuing with original unit and value.", datum["name"], datum["value"], err)
-				} else {
-					if hp.Unit == MgdL {
-						hp.Unit = MmolL
-						hp.Value = fmt.Sprintf("%g", convertToMmol(val))
-					} else {
-						hp.Unit = MgdL
-						hp.Value = fmt.Sprintf("%g", convertToMgdl(val))
-					}
-				}
-			}
-
-			if hp.PreviousUnit != bgUnit && isConvertibleUnit(hp.PreviousUnit) {
-				val, err := convertToFloat64(datum["previousValue"], datum["name"])
-				if err != nil {
-					logger.Errorf("cannot convert historyParam with name=%s having previousValue=%s \n error=%v \n Continuing with original previousUnit and previousValue.", datum["name"], datum["previousValue"], err)
-				} else {
-					if hp.PreviousUnit == MgdL {
-						hp.PreviousUnit = MmolL
-						hp.PreviousValue = fmt.Sprintf("%g", convertToMmol(val))
-					} else {
-						hp.PreviousUnit = MgdL
-						hp.PreviousValue = fmt.Sprintf("%g", convertToMgdl(val))
-					}
-				}
-			}
-		}
-		for _, p := range settings.CurrentSettings.Parameters {
-			if p.Unit != bgUnit && isConvertibleUnit(p.Unit) {
-				val, err := convertToFloat64(datum["value"], datum["name"])
-				if err != nil {
-					logger.Errorf("cannot convert current parameter with name=%s having value=%s \n error=%v \n Continuing with original unit and value.", datum["name"], datum["value"], err)
-				} else {
-					if p.Unit == MgdL {
-						p.Unit = MmolL
-						p.Value = fmt.Sprintf("%g", convertToMmol(val))
-					} else {
-						p.Unit = MgdL
-						p.Value = fmt.Sprintf("%g", convertToMgdl(val))
-					}
-				}
-			}
-		}
-	}
-
-	groupedHistoryParameters := groupByChangeDate(settings.HistoryParameters)
+	groupedHistoryParameters := groupByChangeDate(convertHistoryParameters(settings.HistoryParameters, bgUnit))
 	payload := map[string]interface{}{
 		"basalsecurityprofile": p.basalSecurityProfile,
 		"cgm":                  settings.CurrentSettings.Cgm,
 		"device":               settings.CurrentSettings.Device,
 		"pump":                 settings.CurrentSettings.Pump,
-		"parameters":           settings.CurrentSettings.Parameters,
+		"parameters":           convertCurrentParameters(settings.CurrentSettings.Parameters, bgUnit),
 		"history":              groupedHistoryParameters,
 	}
-	datum["payload"] = payload
-
-	jsonDatum, err := json.Marshal(datum)
-	if err != nil {
-		if p.jsonError.firstError == nil {
-			p.jsonError.firstError = err
-		}
-		p.jsonError.numErrors++
-	}
-	if p.writeCount > 0 {
-		// Add the coma and line return (for readability)
-		_, err = res.WriteString(",\n")
-		if err != nil {
-			return err
-		}
-	}
-	_, err = res.Write(jsonDatum)
-	if err != nil {
-		return err
+	if p.basalSecurityProfiles != nil {
+		payload["basalsecurityprofiles"] = p.basalSecurityProfiles
 	}
-	p.writeCount++
-	return nil
+	datum["payload"] = payload
+	return datum
 }
 
 type GroupedHistoryParameters struct {
@@ -502,98 +510,65 @@ func groupByChangeDate(parameters []orcaSchema.HistoryParameter) []GroupedHistor
 	return finalArray
 }
 
-func convertToMgdl(value float64) float64 {
-	return math.Round(value * MmolLToMgdLConversionFactor)
-}
-
-func convertToMmol(value float64) float64 {
-	roundedValue := math.Round(value / MmolLToMgdLConversionFactor * MmolLToMgdLPrecisionFactor)
-	floatValue := roundedValue / MmolLToMgdLPrecisionFactor
-	return floatValue
-}
-
 // Mapping V2 Bucket schema to expected V1 schema + write to output
-func writeCbgs(ctx context.Context, bgUnit string, res *bytes.Buffer, p *writeFromIter) error {
-	var err error
+func writeCbgs(ctx context.Context, bgUnit string, res io.Writer, p *writeFromIter) error {
 	for _, bucket := range p.cbgs {
 		for i, sample := range bucket.Samples {
-			datum := make(map[string]interface{})
-			// Building a fake id (bucket.Id/range index)
-			datum["id"] = fmt.Sprintf("cbg_%s_%d", bucket.Id, i)
-			datum["type"] = "cbg"
-			datum["time"] = sample.Timestamp
-			datum["timezone"] = sample.Timezone
-			datum["units"] = sample.Units
-			datum["value"] = sample.Value
-			if bgUnit != "" && datum["units"] != bgUnit {
-				if datum["units"] == MmolL {
-					datum["units"] = MgdL
-					datum["value"] = convertToMgdl(sample.Value)
-				} else {
-					datum["units"] = MmolL
-					datum["value"] = convertToMmol(sample.Value)
-				}
-			}
-			jsonDatum, err := json.Marshal(datum)
-			if err != nil {
-				if p.jsonError.firstError == nil {
-					p.jsonError.firstError = err
-				}
-				p.jsonError.numErrors++
+			if p.bucketSources.excludes("cbg", sample.Timestamp) {
 				continue
 			}
-			if p.writeCount > 0 {
-				// Add the coma and line return (for readability)
-				_, err = res.WriteString(",\n")
-				if err != nil {
-					return err
-				}
-			}
-			_, err = res.Write(jsonDatum)
-			if err != nil {
+			if err := p.writeDatum(res, cbgDatum(bucket.Id, i, sample, bgUnit)); err != nil {
 				return err
 			}
-			p.writeCount++
 		}
 	}
-	return err
+	return nil
+}
+
+// bucketSampleID returns the id of a tide-v2 sample, built from its bucket id & its index in the bucket
+func bucketSampleID(datumType string, bucketID string, index int) string {
+	return fmt.Sprintf("%s_%s_%d", datumType, bucketID, index)
+}
+
+// cbgDatum map a V2 cbg sample to the V1 schema
+func cbgDatum(bucketID string, index int, sample schemaV2.CbgSample, bgUnit string) map[string]interface{} {
+	datum := make(map[string]interface{})
+	// Building a fake id (bucket.Id/range index)
+	datum["id"] = bucketSampleID("cbg", bucketID, index)
+	datum["type"] = "cbg"
+	datum["time"] = sample.Timestamp
+	datum["timezone"] = sample.Timezone
+	datum["units"] = sample.Units
+	datum["value"] = sample.Value
+	convertDatumUnits(datum, bgUnit)
+	return datum
 }
 
 // Mapping V2 Bucket schema to expected V1 schema + write to output
-func writeBasals(ctx context.Context, res *bytes.Buffer, p *writeFromIter) error {
-	var err error
+func writeBasals(ctx context.Context, res io.Writer, p *writeFromIter) error {
 	for _, bucket := range p.basals {
 		for i, sample := range bucket.Samples {
-			datum := make(map[string]interface{})
-			// Building a fake id (bucket.Id/range index)
-			datum["id"] = fmt.Sprintf("basal_%s_%d", bucket.Id, i)
-			datum["type"] = "basal"
-			datum["time"] = sample.Timestamp
-			datum["timezone"] = sample.Timezone
-			datum["deliveryType"] = sample.DeliveryType
-			datum["rate"] = sample.Rate
-			datum["duration"] = sample.Duration
-			jsonDatum, err := json.Marshal(datum)
-			if err != nil {
-				if p.jsonError.firstError == nil {
-					p.jsonError.firstError = err
-				}
-				p.jsonError.numErrors++
+			if p.bucketSources.excludes("basal", sample.Timestamp) {
 				continue
 			}
-			if p.writeCount > 0 {
-				// Add the coma and line return (for readability)
-				_, err = res.WriteString(",\n")
-				if err != nil {
-					return err
-				}
-			}
-			_, err = res.Write(jsonDatum)
-			if err != nil {
+			if err := p.writeDatum(res, basalDatum(bucket.Id, i, sample)); err != nil {
 				return err
 			}
-			p.writeCount++
 		}
 	}
-	return err
+	return nil
+}
+
+// basalDatum map a V2 basal sample to the V1 schema
+func basalDatum(bucketID string, index int, sample schemaV2.BasalSample) map[string]interface{} {
+	datum := make(map[string]interface{})
+	// Building a fake id (bucket.Id/range index)
+	datum["id"] = bucketSampleID("basal", bucketID, index)
+	datum["type"] = "basal"
+	datum["time"] = sample.Timestamp
+	datum["timezone"] = sample.Timezone
+	datum["deliveryType"] = sample.DeliveryType
+	datum["rate"] = sample.Rate
+	datum["duration"] = sample.Duration
+	return datum
 }
@@ -0,0 +1,257 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+const (
+	// DefaultInsulinDays number of days used by the insulin route when no window is requested
+	DefaultInsulinDays = 14
+	// minBasalCoverage part of a day the basal deliveries must cover for the day to be complete
+	minBasalCoverage = 0.95
+	// maxBasalDuration the basals are fetched from this long before the window, to get the ones
+	// started before it and still delivered during it
+	maxBasalDuration = 24 * time.Hour
+)
+
+type (
+	// GetInsulinArgs arguments of GetInsulin
+	GetInsulinArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// StartDate & EndDate the window (ISO-8601 datetime), the last Days days by default
+		StartDate string
+		EndDate   string
+		// Days the window duration when StartDate is not set, DefaultInsulinDays by default
+		Days int
+	}
+	// InsulinDay insulin delivered during a day, in units
+	InsulinDay struct {
+		// Date the day, in the local time of the data (YYYY-MM-DD)
+		Date  string  `json:"date"`
+		Basal float64 `json:"basal"`
+		Bolus float64 `json:"bolus"`
+		Total float64 `json:"total"`
+		// Incomplete true when the basal deliveries do not cover the whole day (missing pump data)
+		Incomplete bool `json:"incomplete"`
+	}
+	// InsulinResult total daily dose returned by the insulin v1 route
+	InsulinResult struct {
+		UserID    string       `json:"userId"`
+		StartDate string       `json:"startDate"`
+		EndDate   string       `json:"endDate"`
+		Days      []InsulinDay `json:"days"`
+		// Number of complete days used to compute the averages
+		NumCompleteDays int `json:"numCompleteDays"`
+		// Averages of the complete days, in units
+		AverageBasal float64 `json:"averageBasal"`
+		AverageBolus float64 `json:"averageBolus"`
+		AverageTotal float64 `json:"averageTotal"`
+	}
+	// insulinDatum the fields of the basal & bolus datums used to compute the insulin delivered
+	insulinDatum struct {
+		Type           string  `bson:"type"`
+		Time           string  `bson:"time"`
+		Timezone       string  `bson:"timezone"`
+		TimezoneOffset int     `bson:"timezoneOffset"`
+		Rate           float64 `bson:"rate"`
+		Duration       int64   `bson:"duration"`
+		Normal         float64 `bson:"normal"`
+		Extended       float64 `bson:"extended"`
+	}
+	// insulinDay the insulin delivered during a day, with the basal coverage
+	insulinDay struct {
+		InsulinDay
+		// basalDuration the basal delivery time of the day
+		basalDuration time.Duration
+		// dayDuration the duration of the local day (DST)
+		dayDuration time.Duration
+	}
+	// insulinDays the insulin delivered by local day, during the [start, end) window
+	insulinDays struct {
+		days      map[string]*insulinDay
+		locations map[string]*time.Location
+		start     time.Time
+		end       time.Time
+	}
+)
+
+// GetInsulin compute the total daily dose of insulin, split into basal and bolus.
+//
+// The basal is the rate × duration of the delivered basals (from the tide-v2 buckets when readBasalBucket is set),
+// the bolus the normal + extended parts of the bolus.
+func (p *PatientData) GetInsulin(ctx context.Context, args GetInsulinArgs) (*InsulinResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getInsulin")
+	defer common.TimeEnd(ctx, "getInsulin")
+
+	startTime, endTime, err := getWindow(args.StartDate, args.EndDate, args.Days, DefaultInsulinDays, time.Now())
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetInsulin", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	startDate := startTime.UTC().Format(time.RFC3339Nano)
+	endDate := endTime.UTC().Format(time.RFC3339Nano)
+	basalStartDate := startTime.Add(-maxBasalDuration).UTC().Format(time.RFC3339Nano)
+
+	insulin := &insulinDays{
+		days:      make(map[string]*insulinDay),
+		locations: make(map[string]*time.Location),
+		start:     startTime,
+		end:       endTime,
+	}
+
+	types := []string{"basal", "bolus"}
+	if p.readBasalBucket {
+		types = []string{"bolus"}
+		common.TimeIt(ctx, "getBasalBuckets")
+		buckets, errBasal := p.tideV2Client.GetBasalV2WithContext(ctx, args.UserID, args.SessionToken, basalStartDate, endDate)
+		common.TimeEnd(ctx, "getBasalBuckets")
+		if errBasal != nil {
+			return nil, &common.DetailedError{
+				Status:          errorTideV2Http.Status,
+				Code:            errorTideV2Http.Code,
+				Message:         errorTideV2Http.Message,
+				InternalMessage: addContextToMessage("GetInsulin", args.UserID, args.TraceID, errBasal.Error()),
+			}
+		}
+		for _, bucket := range buckets {
+			for _, sample := range bucket.Samples {
+				insulin.addBasal(sample.Timestamp, sample.Timezone, sample.TimezoneOffset, sample.Rate, time.Duration(sample.Duration)*time.Millisecond)
+			}
+		}
+	}
+
+	params := &common.Params{
+		UserID:        args.UserID,
+		Types:         types,
+		Date:          common.Date{Start: startDate, End: endDate},
+		SchemaVersion: p.getSchemaVersion(false),
+		// The timezoneOffset is not returned by default
+		Fields: []string{"timezone", "timezoneOffset", "rate", "duration", "normal", "extended"},
+	}
+	if !p.readBasalBucket {
+		// The bolus before the window are skipped below
+		params.Date.Start = basalStartDate
+	}
+	iter, errStore := p.patientDataRepository.GetDataInDeviceData(ctx, args.TraceID, params, []string{})
+	if errStore != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("GetInsulin", args.UserID, args.TraceID, errStore.Error()),
+		}
+	}
+	defer iter.Close(ctx)
+	for iter.Next(ctx) {
+		var datum insulinDatum
+		if err := iter.Decode(&datum); err != nil {
+			continue
+		}
+		datumTime, err := time.Parse(time.RFC3339Nano, datum.Time)
+		if err != nil {
+			continue
+		}
+		switch datum.Type {
+		case "basal":
+			insulin.addBasal(datumTime, datum.Timezone, datum.TimezoneOffset, datum.Rate, time.Duration(datum.Duration)*time.Millisecond)
+		case "bolus":
+			if datumTime.Before(startTime) || !datumTime.Before(endTime) {
+				continue
+			}
+			insulin.day(datumTime, datum.Timezone, datum.TimezoneOffset).Bolus += datum.Normal + datum.Extended
+		}
+	}
+	if err := iterErr(iter); err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("GetInsulin", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+
+	return insulin.result(args.UserID, startDate, endDate), nil
+}
+
+// day returns the insulin day of a time, using its local time
+func (d *insulinDays) day(t time.Time, timezone string, timezoneOffset int) *insulinDay {
+	localTime := toLocalTime(t, timezone, timezoneOffset, d.locations)
+	date := localTime.Format("2006-01-02")
+	day, found := d.days[date]
+	if !found {
+		dayStart := time.Date(localTime.Year(), localTime.Month(), localTime.Day(), 0, 0, 0, 0, localTime.Location())
+		day = &insulinDay{
+			InsulinDay:  InsulinDay{Date: date},
+			dayDuration: dayStart.AddDate(0, 0, 1).Sub(dayStart),
+		}
+		d.days[date] = day
+	}
+	return day
+}
+
+// addBasal add a basal delivery (rate in U/h), clipped to the window and split at the local midnights
+func (d *insulinDays) addBasal(start time.Time, timezone string, timezoneOffset int, rate float64, duration time.Duration) {
+	end := start.Add(duration)
+	if start.Before(d.start) {
+		start = d.start
+	}
+	if end.After(d.end) {
+		end = d.end
+	}
+	for start.Before(end) {
+		localTime := toLocalTime(start, timezone, timezoneOffset, d.locations)
+		nextDay := time.Date(localTime.Year(), localTime.Month(), localTime.Day()+1, 0, 0, 0, 0, localTime.Location())
+		segmentEnd := start.Add(nextDay.Sub(localTime))
+		if segmentEnd.After(end) {
+			segmentEnd = end
+		}
+		day := d.day(start, timezone, timezoneOffset)
+		segment := segmentEnd.Sub(start)
+		day.Basal += rate * segment.Hours()
+		day.basalDuration += segment
+		start = segmentEnd
+	}
+}
+
+// result returns the days in order and the averages of the complete days
+func (d *insulinDays) result(userID string, startDate string, endDate string) *InsulinResult {
+	result := &InsulinResult{
+		UserID:    userID,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Days:      make([]InsulinDay, 0, len(d.days)),
+	}
+	var sumBasal, sumBolus float64
+	for _, day := range d.days {
+		day.Incomplete = day.basalDuration.Seconds() < day.dayDuration.Seconds()*minBasalCoverage
+		if !day.Incomplete {
+			result.NumCompleteDays++
+			sumBasal += day.Basal
+			sumBolus += day.Bolus
+		}
+		day.Total = roundTo(day.Basal+day.Bolus, 2)
+		day.Basal = roundTo(day.Basal, 2)
+		day.Bolus = roundTo(day.Bolus, 2)
+		result.Days = append(result.Days, day.InsulinDay)
+	}
+	sort.Slice(result.Days, func(i, j int) bool {
+		return result.Days[i].Date < result.Days[j].Date
+	})
+	if result.NumCompleteDays > 0 {
+		numDays := float64(result.NumCompleteDays)
+		result.AverageBasal = roundTo(sumBasal/numDays, 2)
+		result.AverageBolus = roundTo(sumBolus/numDays, 2)
+		result.AverageTotal = roundTo((sumBasal+sumBolus)/numDays, 2)
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestPatientData_GetInsulin(t *testing.T) {
+	args := GetInsulinArgs{UserID: "user1", StartDate: "2023-04-01T00:00:00Z", EndDate: "2023-04-03T00:00:00Z"}
+	expectedDays := []InsulinDay{
+		// 1 U/h for 23h of the first day, then 2 U/h up to 02:00 the next day, the first day is complete
+		{Date: "2023-04-01", Basal: 25, Bolus: 5.5, Total: 30.5},
+		{Date: "2023-04-02", Basal: 4, Bolus: 1, Total: 5, Incomplete: true},
+	}
+
+	t.Run("should compute the insulin from the basal datums", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return assert.ObjectsAreEqual([]string{"basal", "bolus"}, params.Types)
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+			`{"type":"basal","time":"2023-04-01T00:00:00.000Z","timezone":"UTC","rate":1,"duration":82800000}`,
+			`{"type":"bolus","time":"2023-04-01T08:00:00.000Z","timezone":"UTC","normal":4.5}`,
+			`{"type":"basal","time":"2023-04-01T23:00:00.000Z","timezone":"UTC","rate":2,"duration":10800000}`,
+			`{"type":"bolus","time":"2023-04-01T12:00:00.000Z","timezone":"UTC","normal":0.5,"extended":0.5}`,
+			`{"type":"bolus","time":"2023-04-02T12:00:00.000Z","timezone":"UTC","normal":1}`,
+		}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, repository, false)
+
+		insulin, err := p.GetInsulin(testCtx, args)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expectedDays, insulin.Days)
+		assert.Equal(t, 1, insulin.NumCompleteDays)
+		assert.Equal(t, 25.0, insulin.AverageBasal)
+		assert.Equal(t, 5.5, insulin.AverageBolus)
+		assert.Equal(t, 30.5, insulin.AverageTotal)
+	})
+
+	t.Run("should clip the basals to the window", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			// The basals started the day before the window are fetched
+			return params.Date.Start == "2023-03-31T00:00:00Z" && params.Date.End == "2023-04-03T00:00:00Z"
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+			`{"type":"bolus","time":"2023-03-31T22:00:00.000Z","timezone":"UTC","normal":3}`,
+			`{"type":"basal","time":"2023-03-31T23:00:00.000Z","timezone":"UTC","rate":1,"duration":7200000}`,
+			`{"type":"basal","time":"2023-04-02T23:00:00.000Z","timezone":"UTC","rate":2,"duration":10800000}`,
+		}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, repository, false)
+
+		insulin, err := p.GetInsulin(testCtx, args)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []InsulinDay{
+			{Date: "2023-04-01", Basal: 1, Total: 1, Incomplete: true},
+			{Date: "2023-04-02", Basal: 2, Total: 2, Incomplete: true},
+		}, insulin.Days)
+	})
+
+	t.Run("should compute the basal from the buckets when readBasalBucket is set", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return assert.ObjectsAreEqual([]string{"bolus"}, params.Types)
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+			`{"type":"bolus","time":"2023-04-01T08:00:00.000Z","timezone":"UTC","normal":4.5}`,
+			`{"type":"bolus","time":"2023-04-01T12:00:00.000Z","timezone":"UTC","normal":0.5,"extended":0.5}`,
+			`{"type":"bolus","time":"2023-04-02T12:00:00.000Z","timezone":"UTC","normal":1}`,
+		}), nil)
+		day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+		tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.MockedBasal = []tideV2Schema.BasalBucket{
+			{
+				Id:  "basal1",
+				Day: day,
+				Samples: []tideV2Schema.BasalSample{
+					{Sample: tideV2Schema.Sample{Timestamp: day, Timezone: "UTC"}, DeliveryType: "automated", Rate: 1, Duration: 82800000},
+					{Sample: tideV2Schema.Sample{Timestamp: day.Add(23 * time.Hour), Timezone: "UTC"}, DeliveryType: "automated", Rate: 2, Duration: 10800000},
+				},
+			},
+		}
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, true)
+
+		insulin, err := p.GetInsulin(testCtx, args)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expectedDays, insulin.Days)
+	})
+	t.Run("should fail when the cursor fails in the middle of the data", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewFailingMockDbAdapterIterator([]string{
+			`{"type":"bolus","time":"2023-04-01T08:00:00.000Z","timezone":"UTC","normal":4.5}`,
+		}, errors.New("connection lost")), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, repository, false)
+
+		insulin, err := p.GetInsulin(testCtx, args)
+
+		assert.Nil(t, insulin)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
@@ -3,6 +3,8 @@ package usecase
 import (
 	"bytes"
 	"context"
+	"io"
+	"time"
 
 	goComMgo "github.com/tidepool-org/go-common/clients/mongo"
 	"github.com/tidepool-org/tide-whisperer/common"
@@ -10,10 +12,20 @@ import (
 )
 
 type PatientDataRepository interface {
-	GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error)
-	GetDataInDeviceData(ctx context.Context, traceID string, userID string, dates *common.Date, excludeTypes []string) (goComMgo.StorageIterator, error)
+	GetDataRangeLegacy(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion) (*common.Date, error)
+	GetDataInDeviceData(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (goComMgo.StorageIterator, error)
 	GetLatestBasalSecurityProfile(ctx context.Context, traceID string, userID string) (*schema.DbProfile, error)
-	GetUploadData(ctx context.Context, traceID string, uploadIds []string) (goComMgo.StorageIterator, error)
+	GetBasalSecurityProfiles(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time) ([]schema.DbProfile, error)
+	GetUploadData(ctx context.Context, traceID string, uploadIds []string, schemaVersion *common.SchemaVersion) (goComMgo.StorageIterator, error)
+	GetLatestDatum(ctx context.Context, traceID string, userID string, datumType string, schemaVersion *common.SchemaVersion) (map[string]interface{}, error)
+	GetUploads(ctx context.Context, traceID string, userID string) ([]schema.DbUpload, error)
+	GetUploadsDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbUploadTypeCount, error)
+	GetDevicesDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbDeviceTypeCount, error)
+	GetDataInUpload(ctx context.Context, traceID string, params *common.Params) (goComMgo.StorageIterator, error)
+	GetUploadsDataRange(ctx context.Context, traceID string, userID string, uploadIDs []string) (*common.Date, error)
+	CountSchemaVersionFiltered(ctx context.Context, traceID string, params *common.Params) (int64, error)
+	GetDataState(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (*schema.DbDataState, error)
+	WatchData(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion, resumeToken string, maxAwaitTime time.Duration) (common.DataStream, error)
 }
 
 type DatabaseAdapter interface {
@@ -21,7 +33,8 @@ type DatabaseAdapter interface {
 }
 
 type PatientDataUseCase interface {
-	GetData(ctx context.Context, args GetDataArgs) (*bytes.Buffer, *common.DetailedError)
+	GetData(ctx context.Context, args GetDataArgs, res io.Writer) *common.DetailedError
+	CheckGetDataArgs(args GetDataArgs) *common.DetailedError
 }
 type Uploader interface {
 	Upload(ctx context.Context, filename string, buffer *bytes.Buffer) error
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// DefaultLatestTypes types returned by GetLatestData when none are requested
+var DefaultLatestTypes = []string{"cbg", "smbg", "bolus", "basal", "pumpSettings"}
+
+// latestBucketLookbackDays the tide-v2 buckets are read by window: the newest sample is
+// searched in the last day first, then in larger windows
+var latestBucketLookbackDays = []int{1, 7, 30}
+
+type (
+	// GetLatestDataArgs arguments of GetLatestData
+	GetLatestDataArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// Types the requested data types, DefaultLatestTypes by default
+		Types []string
+		// BgUnit the unit of the blood glucose values, as they are in database by default
+		BgUnit string
+		// AllSchemaVersions use the data of the database of all the schema versions instead of the configured range
+		AllSchemaVersions bool
+	}
+	// LatestData the newest datum of each requested type, using the V1 schema.
+	// The types without data are not part of it.
+	LatestData map[string]map[string]interface{}
+)
+
+// GetLatestData returns the newest datum of each requested type.
+//
+// The cbg (and the basal when readBasalBucket is set) are the last sample of the tide-v2 buckets,
+// the pump settings the current tide-v2 settings, the other types are read from the database.
+func (p *PatientData) GetLatestData(ctx context.Context, args GetLatestDataArgs) (LatestData, *common.DetailedError) {
+	common.TimeIt(ctx, "getLatestData")
+	defer common.TimeEnd(ctx, "getLatestData")
+
+	types := args.Types
+	if len(types) == 0 {
+		types = DefaultLatestTypes
+	}
+	latest := make(LatestData, len(types))
+	for _, datumType := range types {
+		var datum map[string]interface{}
+		var err *common.DetailedError
+		switch {
+		case datumType == "cbg":
+			datum, err = p.getLatestCbg(ctx, args)
+		case datumType == "basal" && p.readBasalBucket:
+			datum, err = p.getLatestBasal(ctx, args)
+		case datumType == "pumpSettings":
+			writer := &writeFromIter{}
+			if writer.settings, err = p.getLatestPumpSettings(ctx, args.TraceID, args.UserID, writer, args.SessionToken); err == nil && writer.settings != nil {
+				writer.settings = filterParameterLevels(writer.settings, p.defaultParameterLevels())
+				datum = pumpSettingsDatum(ctx, writer, args.BgUnit)
+			}
+		default:
+			datum, err = p.getLatestDatum(ctx, args, datumType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if datum != nil {
+			latest[datumType] = datum
+		}
+	}
+	return latest, nil
+}
+
+// getLatestDatum returns the newest datum of a type from the database
+func (p *PatientData) getLatestDatum(ctx context.Context, args GetLatestDataArgs, datumType string) (map[string]interface{}, *common.DetailedError) {
+	common.TimeIt(ctx, "getLatestDatum")
+	defer common.TimeEnd(ctx, "getLatestDatum")
+	datum, err := p.patientDataRepository.GetLatestDatum(ctx, args.TraceID, args.UserID, datumType, p.getSchemaVersion(args.AllSchemaVersions))
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("getLatestDatum", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	if datum == nil || !(&writeFromIter{parameterLevels: p.defaultParameterLevels()}).prepareDatum(datum, args.BgUnit) {
+		return nil, nil
+	}
+	return datum, nil
+}
+
+// getLatestCbg returns the last sample of the newest cbg bucket
+func (p *PatientData) getLatestCbg(ctx context.Context, args GetLatestDataArgs) (map[string]interface{}, *common.DetailedError) {
+	common.TimeIt(ctx, "getLatestCbg")
+	defer common.TimeEnd(ctx, "getLatestCbg")
+	now := time.Now()
+	for _, days := range latestBucketLookbackDays {
+		startDate := now.AddDate(0, 0, -days).UTC().Format(time.RFC3339Nano)
+		buckets, err := p.tideV2Client.GetCbgV2WithContext(ctx, args.UserID, args.SessionToken, startDate, now.UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return nil, newLatestTideV2Error(args, err)
+		}
+		var latest *schemaV2.CbgSample
+		var bucketID string
+		var index int
+		for _, bucket := range buckets {
+			for i := range bucket.Samples {
+				if latest == nil || bucket.Samples[i].Timestamp.After(latest.Timestamp) {
+					latest, bucketID, index = &bucket.Samples[i], bucket.Id, i
+				}
+			}
+		}
+		if latest != nil {
+			return cbgDatum(bucketID, index, *latest, args.BgUnit), nil
+		}
+	}
+	return nil, nil
+}
+
+// getLatestBasal returns the last sample of the newest basal bucket
+func (p *PatientData) getLatestBasal(ctx context.Context, args GetLatestDataArgs) (map[string]interface{}, *common.DetailedError) {
+	common.TimeIt(ctx, "getLatestBasal")
+	defer common.TimeEnd(ctx, "getLatestBasal")
+	now := time.Now()
+	for _, days := range latestBucketLookbackDays {
+		startDate := now.AddDate(0, 0, -days).UTC().Format(time.RFC3339Nano)
+		buckets, err := p.tideV2Client.GetBasalV2WithContext(ctx, args.UserID, args.SessionToken, startDate, now.UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return nil, newLatestTideV2Error(args, err)
+		}
+		var latest *schemaV2.BasalSample
+		var bucketID string
+		var index int
+		for _, bucket := range buckets {
+			for i := range bucket.Samples {
+				if latest == nil || bucket.Samples[i].Timestamp.After(latest.Timestamp) {
+					latest, bucketID, index = &bucket.Samples[i], bucket.Id, i
+				}
+			}
+		}
+		if latest != nil {
+			return basalDatum(bucketID, index, *latest), nil
+		}
+	}
+	return nil, nil
+}
+
+func newLatestTideV2Error(args GetLatestDataArgs, err error) *common.DetailedError {
+	return &common.DetailedError{
+		Status:          errorTideV2Http.Status,
+		Code:            errorTideV2Http.Code,
+		Message:         errorTideV2Http.Message,
+		InternalMessage: addContextToMessage("GetLatestData", args.UserID, args.TraceID, err.Error()),
+	}
+}
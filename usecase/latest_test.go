@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/clients/status"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPatientData_GetLatestData(t *testing.T) {
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("should return the newest datum of the default types", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetLatestDatum", mock.Anything, mock.Anything, "user1", "smbg", mock.Anything).Return(map[string]interface{}{
+			"id": "smbg1", "type": "smbg", "uploadId": "upload1", "time": "2023-04-01T08:00:00.000Z", "units": MgdL, "value": 180.0,
+		}, nil)
+		repository.On("GetLatestDatum", mock.Anything, mock.Anything, "user1", "bolus", mock.Anything).Return(nil, nil)
+		repository.On("GetLatestDatum", mock.Anything, mock.Anything, "user1", "basal", mock.Anything).Return(map[string]interface{}{
+			"id": "basal1", "type": "basal", "uploadId": "upload1", "time": "2023-04-01T07:00:00.000Z", "rate": 0.8,
+		}, nil)
+		repository.On("GetLatestBasalSecurityProfile", mock.Anything, mock.Anything, "user1").Return(nil, nil)
+		tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+			{Id: "cbg2", Day: day, Samples: []tideV2Schema.CbgSample{
+				{Value: 5.5, Units: MmolL, Timestamp: day.Add(10 * time.Minute), Timezone: "UTC"},
+				{Value: 6, Units: MmolL, Timestamp: day.Add(15 * time.Minute), Timezone: "UTC"},
+			}},
+			{Id: "cbg1", Day: day, Samples: []tideV2Schema.CbgSample{
+				{Value: 4, Units: MmolL, Timestamp: day.Add(5 * time.Minute), Timezone: "UTC"},
+			}},
+		}
+		tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(nil, &status.StatusError{Status: status.NewStatus(http.StatusNotFound, "no settings")})
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, false)
+
+		latest, err := p.GetLatestData(testCtx, GetLatestDataArgs{UserID: "user1", BgUnit: MmolL})
+
+		assert.Nil(t, err)
+		assert.Equal(t, LatestData{
+			"cbg": {"id": "cbg_cbg2_1", "type": "cbg", "time": day.Add(15 * time.Minute), "timezone": "UTC", "units": MmolL, "value": 6.0},
+			"smbg": {
+				"id": "smbg1", "type": "smbg", "uploadId": "upload1", "time": "2023-04-01T08:00:00.000Z", "units": MmolL, "value": 10.0,
+			},
+			"basal": {"id": "basal1", "type": "basal", "uploadId": "upload1", "time": "2023-04-01T07:00:00.000Z", "rate": 0.8},
+		}, latest)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should return the newest basal sample of the buckets when readBasalBucket is set", func(t *testing.T) {
+		tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.MockedBasal = []tideV2Schema.BasalBucket{
+			{Id: "basal1", Day: day, Samples: []tideV2Schema.BasalSample{
+				{Sample: tideV2Schema.Sample{Timestamp: day, Timezone: "UTC"}, DeliveryType: "automated", Rate: 1, Duration: 300000},
+				{Sample: tideV2Schema.Sample{Timestamp: day.Add(5 * time.Minute), Timezone: "UTC"}, DeliveryType: "automated", Rate: 1.5, Duration: 300000},
+			}},
+		}
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, true)
+
+		latest, err := p.GetLatestData(testCtx, GetLatestDataArgs{UserID: "user1", Types: []string{"basal"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, LatestData{
+			"basal": basalDatum("basal1", 1, tideV2Client.MockedBasal[0].Samples[1]),
+		}, latest)
+	})
+
+	t.Run("should fail when the database query fails", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetLatestDatum", mock.Anything, mock.Anything, "user1", "bolus", mock.Anything).Return(nil, errors.New("connection lost"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, repository, false)
+
+		_, err := p.GetLatestData(testCtx, GetLatestDataArgs{UserID: "user1", Types: []string{"bolus"}})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
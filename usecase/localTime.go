@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// localDateFormat & localDateTimeFormat the formats of the dates given in the requested timezone
+	localDateFormat     = "2006-01-02"
+	localDateTimeFormat = "2006-01-02T15:04:05"
+	// localTimeFormat the wall clock time of the localTime datum field, without offset
+	localTimeFormat = "2006-01-02T15:04:05"
+)
+
+// parseLocation returns the location of an IANA timezone, nil when the timezone is empty
+func parseLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", timezone)
+	}
+	return location, nil
+}
+
+// localWindowDates returns startDate & endDate as UTC ISO datetimes, when they are given as local dates (2006-01-02)
+// or datetimes without offset (2006-01-02T15:04:05) in location.
+// A local endDate without time includes its whole day. The dates with an offset are returned unchanged,
+// as are all the dates when location is nil.
+func localWindowDates(startDate string, endDate string, location *time.Location) (string, string, error) {
+	if location == nil {
+		return startDate, endDate, nil
+	}
+	start, err := localDateToUTC(startDate, location, false)
+	if err != nil {
+		return "", "", err
+	}
+	end, err := localDateToUTC(endDate, location, true)
+	if err != nil {
+		return "", "", err
+	}
+	return start, end, nil
+}
+
+// localDateToUTC convert a local date or datetime to an UTC ISO datetime, the end of the day for a date
+// when endOfDay is true
+func localDateToUTC(date string, location *time.Location, endOfDay bool) (string, error) {
+	if date == "" {
+		return date, nil
+	}
+	if _, err := time.Parse(time.RFC3339Nano, date); err == nil {
+		return date, nil
+	}
+	if localTime, err := time.ParseInLocation(localDateTimeFormat, date, location); err == nil {
+		return localTime.UTC().Format(cursorTimeFormat), nil
+	}
+	localDay, err := time.ParseInLocation(localDateFormat, date, location)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q", date)
+	}
+	if endOfDay {
+		localDay = localDay.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return localDay.UTC().Format(cursorTimeFormat), nil
+}
+
+// addLocalTime add the localTime field to a datum: its time in its own timezone, in the requested one when the datum
+// has none, or using its timezoneOffset as a last resort. The datum is unchanged when its time is unknown.
+func (p *writeFromIter) addLocalTime(datum map[string]interface{}) {
+	var datumTime time.Time
+	switch value := datum["time"].(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return
+		}
+		datumTime = parsed
+	case time.Time:
+		datumTime = value
+	case *time.Time:
+		if value == nil {
+			return
+		}
+		datumTime = *value
+	default:
+		return
+	}
+
+	timezone, _ := datum["timezone"].(string)
+	if timezone == "" && p.location != nil {
+		datum["localTime"] = datumTime.In(p.location).Format(localTimeFormat)
+		return
+	}
+	var timezoneOffset int
+	switch value := datum["timezoneOffset"].(type) {
+	case int:
+		timezoneOffset = value
+	case int32:
+		timezoneOffset = int(value)
+	case int64:
+		timezoneOffset = int(value)
+	case float64:
+		timezoneOffset = int(value)
+	default:
+		if timezone == "" {
+			return
+		}
+	}
+	if p.locations == nil {
+		p.locations = make(map[string]*time.Location)
+	}
+	datum["localTime"] = toLocalTime(datumTime, timezone, timezoneOffset, p.locations).Format(localTimeFormat)
+}
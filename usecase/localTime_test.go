@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestLocalWindowDates(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	tests := []struct {
+		name          string
+		startDate     string
+		endDate       string
+		location      *time.Location
+		expectedStart string
+		expectedEnd   string
+		expectedError bool
+	}{
+		{"No timezone", "2023-03-03T00:00:00Z", "", nil, "2023-03-03T00:00:00Z", "", false},
+		{"Local dates", "2023-03-03", "2023-03-03", paris, "2023-03-02T23:00:00.000Z", "2023-03-03T22:59:59.999Z", false},
+		{"Local date times", "2023-07-03T08:00:00", "2023-07-03T20:30:00", paris, "2023-07-03T06:00:00.000Z", "2023-07-03T18:30:00.000Z", false},
+		{"Dates with offset are unchanged", "2023-03-03T00:00:00+02:00", "2023-03-04T00:00:00Z", paris, "2023-03-03T00:00:00+02:00", "2023-03-04T00:00:00Z", false},
+		{"Empty dates", "", "", paris, "", "", false},
+		{"Invalid date", "03/03/2023", "", paris, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := localWindowDates(tt.startDate, tt.endDate, tt.location)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStart, start)
+			assert.Equal(t, tt.expectedEnd, end)
+		})
+	}
+}
+
+func TestWriteFromIter_addLocalTime(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	utcTime := time.Date(2023, time.March, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		datum             map[string]interface{}
+		location          *time.Location
+		expectedLocalTime interface{}
+	}{
+		{"String time with timezone", map[string]interface{}{"time": "2023-03-03T12:00:00.000Z", "timezone": "Europe/Paris"}, nil, "2023-03-03T13:00:00"},
+		{"Bucket sample time", map[string]interface{}{"time": utcTime, "timezone": "Asia/Tokyo"}, nil, "2023-03-03T21:00:00"},
+		{"Settings time", map[string]interface{}{"time": &utcTime, "timezone": "Europe/Paris"}, newYork, "2023-03-03T13:00:00"},
+		{"Requested timezone when the datum has none", map[string]interface{}{"time": "2023-03-03T12:00:00.000Z", "timezoneOffset": int32(60)}, newYork, "2023-03-03T07:00:00"},
+		{"Timezone offset when the timezone is unknown", map[string]interface{}{"time": "2023-03-03T12:00:00.000Z", "timezoneOffset": int32(-300)}, nil, "2023-03-03T07:00:00"},
+		{"No timezone", map[string]interface{}{"time": "2023-03-03T12:00:00.000Z"}, nil, nil},
+		{"No time", map[string]interface{}{"timezone": "Europe/Paris"}, newYork, nil},
+		{"Nil settings time", map[string]interface{}{"time": (*time.Time)(nil), "timezone": "Europe/Paris"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &writeFromIter{location: tt.location}
+			writer.addLocalTime(tt.datum)
+			assert.Equal(t, tt.expectedLocalTime, tt.datum["localTime"])
+		})
+	}
+}
+
+func TestPatientData_GetData_timezone(t *testing.T) {
+	userID := "userid_test_timezone"
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return params.Date.Start == "2023-03-02T23:00:00.000Z" && params.Date.End == "2023-03-03T22:59:59.999Z"
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-03-03T22:30:00.000Z","timezone":"Europe/Paris","units":"mmol/L","value":5}`,
+	}), nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+	args := GetDataArgs{
+		UserID:        userID,
+		StartDate:     "2023-03-03",
+		EndDate:       "2023-03-03",
+		Timezone:      "Europe/Paris",
+		WithLocalTime: true,
+		Types:         []string{"smbg"},
+		Format:        FormatNDJSON,
+	}
+
+	t.Run("should filter the local day and add the local time", func(t *testing.T) {
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, args, res)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"id":"smbg1","localTime":"2023-03-03T23:30:00","time":"2023-03-03T22:30:00.000Z","timezone":"Europe/Paris","type":"smbg","units":"mmol/L","uploadId":"upload1","value":5}
+`, res.String())
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should return an error on invalid timezone", func(t *testing.T) {
+		invalidArgs := args
+		invalidArgs.Timezone = "Mars/Olympus_Mons"
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, invalidArgs, res)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorInvalidParameters.Code, err.Code)
+		assert.Equal(t, 0, res.Len())
+	})
+}
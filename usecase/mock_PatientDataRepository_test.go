@@ -4,6 +4,7 @@ package usecase
 
 import (
 	context "context"
+	time "time"
 
 	common "github.com/tidepool-org/tide-whisperer/common"
 
@@ -27,13 +28,109 @@ func (_m *MockPatientDataRepository) EXPECT() *MockPatientDataRepository_Expecte
 	return &MockPatientDataRepository_Expecter{mock: &_m.Mock}
 }
 
-// GetDataInDeviceData provides a mock function with given fields: ctx, traceID, userID, dates, excludeTypes
-func (_m *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, traceID string, userID string, dates *common.Date, excludeTypes []string) (mongo.StorageIterator, error) {
-	ret := _m.Called(ctx, traceID, userID, dates, excludeTypes)
+// CountSchemaVersionFiltered provides a mock function with given fields: ctx, traceID, params
+func (_m *MockPatientDataRepository) CountSchemaVersionFiltered(ctx context.Context, traceID string, params *common.Params) (int64, error) {
+	ret := _m.Called(ctx, traceID, params)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, string, *common.Params) int64); ok {
+		r0 = rf(ctx, traceID, params)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *common.Params) error); ok {
+		r1 = rf(ctx, traceID, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_CountSchemaVersionFiltered_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CountSchemaVersionFiltered'
+type MockPatientDataRepository_CountSchemaVersionFiltered_Call struct {
+	*mock.Call
+}
+
+// CountSchemaVersionFiltered is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - params *common.Params
+func (_e *MockPatientDataRepository_Expecter) CountSchemaVersionFiltered(ctx interface{}, traceID interface{}, params interface{}) *MockPatientDataRepository_CountSchemaVersionFiltered_Call {
+	return &MockPatientDataRepository_CountSchemaVersionFiltered_Call{Call: _e.mock.On("CountSchemaVersionFiltered", ctx, traceID, params)}
+}
+
+func (_c *MockPatientDataRepository_CountSchemaVersionFiltered_Call) Run(run func(ctx context.Context, traceID string, params *common.Params)) *MockPatientDataRepository_CountSchemaVersionFiltered_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(*common.Params))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_CountSchemaVersionFiltered_Call) Return(_a0 int64, _a1 error) *MockPatientDataRepository_CountSchemaVersionFiltered_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetBasalSecurityProfiles provides a mock function with given fields: ctx, traceID, userID, startTime, endTime
+func (_m *MockPatientDataRepository) GetBasalSecurityProfiles(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time) ([]schema.DbProfile, error) {
+	ret := _m.Called(ctx, traceID, userID, startTime, endTime)
+
+	var r0 []schema.DbProfile
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time, time.Time) []schema.DbProfile); ok {
+		r0 = rf(ctx, traceID, userID, startTime, endTime)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]schema.DbProfile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, traceID, userID, startTime, endTime)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetBasalSecurityProfiles_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetBasalSecurityProfiles'
+type MockPatientDataRepository_GetBasalSecurityProfiles_Call struct {
+	*mock.Call
+}
+
+// GetBasalSecurityProfiles is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+//  - startTime time.Time
+//  - endTime time.Time
+func (_e *MockPatientDataRepository_Expecter) GetBasalSecurityProfiles(ctx interface{}, traceID interface{}, userID interface{}, startTime interface{}, endTime interface{}) *MockPatientDataRepository_GetBasalSecurityProfiles_Call {
+	return &MockPatientDataRepository_GetBasalSecurityProfiles_Call{Call: _e.mock.On("GetBasalSecurityProfiles", ctx, traceID, userID, startTime, endTime)}
+}
+
+func (_c *MockPatientDataRepository_GetBasalSecurityProfiles_Call) Run(run func(ctx context.Context, traceID string, userID string, startTime time.Time, endTime time.Time)) *MockPatientDataRepository_GetBasalSecurityProfiles_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(time.Time), args[4].(time.Time))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetBasalSecurityProfiles_Call) Return(_a0 []schema.DbProfile, _a1 error) *MockPatientDataRepository_GetBasalSecurityProfiles_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetDataInDeviceData provides a mock function with given fields: ctx, traceID, params, excludeTypes
+func (_m *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (mongo.StorageIterator, error) {
+	ret := _m.Called(ctx, traceID, params, excludeTypes)
 
 	var r0 mongo.StorageIterator
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, *common.Date, []string) mongo.StorageIterator); ok {
-		r0 = rf(ctx, traceID, userID, dates, excludeTypes)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *common.Params, []string) mongo.StorageIterator); ok {
+		r0 = rf(ctx, traceID, params, excludeTypes)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(mongo.StorageIterator)
@@ -41,8 +138,8 @@ func (_m *MockPatientDataRepository) GetDataInDeviceData(ctx context.Context, tr
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, *common.Date, []string) error); ok {
-		r1 = rf(ctx, traceID, userID, dates, excludeTypes)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *common.Params, []string) error); ok {
+		r1 = rf(ctx, traceID, params, excludeTypes)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -58,16 +155,15 @@ type MockPatientDataRepository_GetDataInDeviceData_Call struct {
 // GetDataInDeviceData is a helper method to define mock.On call
 //  - ctx context.Context
 //  - traceID string
-//  - userID string
-//  - dates *common.Date
+//  - params *common.Params
 //  - excludeTypes []string
-func (_e *MockPatientDataRepository_Expecter) GetDataInDeviceData(ctx interface{}, traceID interface{}, userID interface{}, dates interface{}, excludeTypes interface{}) *MockPatientDataRepository_GetDataInDeviceData_Call {
-	return &MockPatientDataRepository_GetDataInDeviceData_Call{Call: _e.mock.On("GetDataInDeviceData", ctx, traceID, userID, dates, excludeTypes)}
+func (_e *MockPatientDataRepository_Expecter) GetDataInDeviceData(ctx interface{}, traceID interface{}, params interface{}, excludeTypes interface{}) *MockPatientDataRepository_GetDataInDeviceData_Call {
+	return &MockPatientDataRepository_GetDataInDeviceData_Call{Call: _e.mock.On("GetDataInDeviceData", ctx, traceID, params, excludeTypes)}
 }
 
-func (_c *MockPatientDataRepository_GetDataInDeviceData_Call) Run(run func(ctx context.Context, traceID string, userID string, dates *common.Date, excludeTypes []string)) *MockPatientDataRepository_GetDataInDeviceData_Call {
+func (_c *MockPatientDataRepository_GetDataInDeviceData_Call) Run(run func(ctx context.Context, traceID string, params *common.Params, excludeTypes []string)) *MockPatientDataRepository_GetDataInDeviceData_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(*common.Date), args[4].([]string))
+		run(args[0].(context.Context), args[1].(string), args[2].(*common.Params), args[3].([]string))
 	})
 	return _c
 }
@@ -77,13 +173,61 @@ func (_c *MockPatientDataRepository_GetDataInDeviceData_Call) Return(_a0 mongo.S
 	return _c
 }
 
-// GetDataRangeLegacy provides a mock function with given fields: ctx, traceID, userID
-func (_m *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error) {
-	ret := _m.Called(ctx, traceID, userID)
+// GetDataInUpload provides a mock function with given fields: ctx, traceID, params
+func (_m *MockPatientDataRepository) GetDataInUpload(ctx context.Context, traceID string, params *common.Params) (mongo.StorageIterator, error) {
+	ret := _m.Called(ctx, traceID, params)
+
+	var r0 mongo.StorageIterator
+	if rf, ok := ret.Get(0).(func(context.Context, string, *common.Params) mongo.StorageIterator); ok {
+		r0 = rf(ctx, traceID, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.StorageIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *common.Params) error); ok {
+		r1 = rf(ctx, traceID, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetDataInUpload_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDataInUpload'
+type MockPatientDataRepository_GetDataInUpload_Call struct {
+	*mock.Call
+}
+
+// GetDataInUpload is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - params *common.Params
+func (_e *MockPatientDataRepository_Expecter) GetDataInUpload(ctx interface{}, traceID interface{}, params interface{}) *MockPatientDataRepository_GetDataInUpload_Call {
+	return &MockPatientDataRepository_GetDataInUpload_Call{Call: _e.mock.On("GetDataInUpload", ctx, traceID, params)}
+}
+
+func (_c *MockPatientDataRepository_GetDataInUpload_Call) Run(run func(ctx context.Context, traceID string, params *common.Params)) *MockPatientDataRepository_GetDataInUpload_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(*common.Params))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetDataInUpload_Call) Return(_a0 mongo.StorageIterator, _a1 error) *MockPatientDataRepository_GetDataInUpload_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetDataRangeLegacy provides a mock function with given fields: ctx, traceID, userID, schemaVersion
+func (_m *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion) (*common.Date, error) {
+	ret := _m.Called(ctx, traceID, userID, schemaVersion)
 
 	var r0 *common.Date
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *common.Date); ok {
-		r0 = rf(ctx, traceID, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *common.SchemaVersion) *common.Date); ok {
+		r0 = rf(ctx, traceID, userID, schemaVersion)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*common.Date)
@@ -91,8 +235,8 @@ func (_m *MockPatientDataRepository) GetDataRangeLegacy(ctx context.Context, tra
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, traceID, userID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *common.SchemaVersion) error); ok {
+		r1 = rf(ctx, traceID, userID, schemaVersion)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -109,13 +253,14 @@ type MockPatientDataRepository_GetDataRangeLegacy_Call struct {
 //  - ctx context.Context
 //  - traceID string
 //  - userID string
-func (_e *MockPatientDataRepository_Expecter) GetDataRangeLegacy(ctx interface{}, traceID interface{}, userID interface{}) *MockPatientDataRepository_GetDataRangeLegacy_Call {
-	return &MockPatientDataRepository_GetDataRangeLegacy_Call{Call: _e.mock.On("GetDataRangeLegacy", ctx, traceID, userID)}
+//  - schemaVersion *common.SchemaVersion
+func (_e *MockPatientDataRepository_Expecter) GetDataRangeLegacy(ctx interface{}, traceID interface{}, userID interface{}, schemaVersion interface{}) *MockPatientDataRepository_GetDataRangeLegacy_Call {
+	return &MockPatientDataRepository_GetDataRangeLegacy_Call{Call: _e.mock.On("GetDataRangeLegacy", ctx, traceID, userID, schemaVersion)}
 }
 
-func (_c *MockPatientDataRepository_GetDataRangeLegacy_Call) Run(run func(ctx context.Context, traceID string, userID string)) *MockPatientDataRepository_GetDataRangeLegacy_Call {
+func (_c *MockPatientDataRepository_GetDataRangeLegacy_Call) Run(run func(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion)) *MockPatientDataRepository_GetDataRangeLegacy_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string))
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(*common.SchemaVersion))
 	})
 	return _c
 }
@@ -125,6 +270,103 @@ func (_c *MockPatientDataRepository_GetDataRangeLegacy_Call) Return(_a0 *common.
 	return _c
 }
 
+// GetDataState provides a mock function with given fields: ctx, traceID, params, excludeTypes
+func (_m *MockPatientDataRepository) GetDataState(ctx context.Context, traceID string, params *common.Params, excludeTypes []string) (*schema.DbDataState, error) {
+	ret := _m.Called(ctx, traceID, params, excludeTypes)
+
+	var r0 *schema.DbDataState
+	if rf, ok := ret.Get(0).(func(context.Context, string, *common.Params, []string) *schema.DbDataState); ok {
+		r0 = rf(ctx, traceID, params, excludeTypes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*schema.DbDataState)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *common.Params, []string) error); ok {
+		r1 = rf(ctx, traceID, params, excludeTypes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetDataState_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDataState'
+type MockPatientDataRepository_GetDataState_Call struct {
+	*mock.Call
+}
+
+// GetDataState is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - params *common.Params
+//  - excludeTypes []string
+func (_e *MockPatientDataRepository_Expecter) GetDataState(ctx interface{}, traceID interface{}, params interface{}, excludeTypes interface{}) *MockPatientDataRepository_GetDataState_Call {
+	return &MockPatientDataRepository_GetDataState_Call{Call: _e.mock.On("GetDataState", ctx, traceID, params, excludeTypes)}
+}
+
+func (_c *MockPatientDataRepository_GetDataState_Call) Run(run func(ctx context.Context, traceID string, params *common.Params, excludeTypes []string)) *MockPatientDataRepository_GetDataState_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(*common.Params), args[3].([]string))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetDataState_Call) Return(_a0 *schema.DbDataState, _a1 error) *MockPatientDataRepository_GetDataState_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetDevicesDataCount provides a mock function with given fields: ctx, traceID, userID
+func (_m *MockPatientDataRepository) GetDevicesDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbDeviceTypeCount, error) {
+	ret := _m.Called(ctx, traceID, userID)
+
+	var r0 []schema.DbDeviceTypeCount
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []schema.DbDeviceTypeCount); ok {
+		r0 = rf(ctx, traceID, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]schema.DbDeviceTypeCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, traceID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetDevicesDataCount_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDevicesDataCount'
+type MockPatientDataRepository_GetDevicesDataCount_Call struct {
+	*mock.Call
+}
+
+// GetDevicesDataCount is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+func (_e *MockPatientDataRepository_Expecter) GetDevicesDataCount(ctx interface{}, traceID interface{}, userID interface{}) *MockPatientDataRepository_GetDevicesDataCount_Call {
+	return &MockPatientDataRepository_GetDevicesDataCount_Call{Call: _e.mock.On("GetDevicesDataCount", ctx, traceID, userID)}
+}
+
+func (_c *MockPatientDataRepository_GetDevicesDataCount_Call) Run(run func(ctx context.Context, traceID string, userID string)) *MockPatientDataRepository_GetDevicesDataCount_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetDevicesDataCount_Call) Return(_a0 []schema.DbDeviceTypeCount, _a1 error) *MockPatientDataRepository_GetDevicesDataCount_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // GetLatestBasalSecurityProfile provides a mock function with given fields: ctx, traceID, userID
 func (_m *MockPatientDataRepository) GetLatestBasalSecurityProfile(ctx context.Context, traceID string, userID string) (*schema.DbProfile, error) {
 	ret := _m.Called(ctx, traceID, userID)
@@ -173,13 +415,63 @@ func (_c *MockPatientDataRepository_GetLatestBasalSecurityProfile_Call) Return(_
 	return _c
 }
 
-// GetUploadData provides a mock function with given fields: ctx, traceID, uploadIds
-func (_m *MockPatientDataRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string) (mongo.StorageIterator, error) {
-	ret := _m.Called(ctx, traceID, uploadIds)
+// GetLatestDatum provides a mock function with given fields: ctx, traceID, userID, datumType, schemaVersion
+func (_m *MockPatientDataRepository) GetLatestDatum(ctx context.Context, traceID string, userID string, datumType string, schemaVersion *common.SchemaVersion) (map[string]interface{}, error) {
+	ret := _m.Called(ctx, traceID, userID, datumType, schemaVersion)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, *common.SchemaVersion) map[string]interface{}); ok {
+		r0 = rf(ctx, traceID, userID, datumType, schemaVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, *common.SchemaVersion) error); ok {
+		r1 = rf(ctx, traceID, userID, datumType, schemaVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetLatestDatum_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLatestDatum'
+type MockPatientDataRepository_GetLatestDatum_Call struct {
+	*mock.Call
+}
+
+// GetLatestDatum is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+//  - datumType string
+//  - schemaVersion *common.SchemaVersion
+func (_e *MockPatientDataRepository_Expecter) GetLatestDatum(ctx interface{}, traceID interface{}, userID interface{}, datumType interface{}, schemaVersion interface{}) *MockPatientDataRepository_GetLatestDatum_Call {
+	return &MockPatientDataRepository_GetLatestDatum_Call{Call: _e.mock.On("GetLatestDatum", ctx, traceID, userID, datumType, schemaVersion)}
+}
+
+func (_c *MockPatientDataRepository_GetLatestDatum_Call) Run(run func(ctx context.Context, traceID string, userID string, datumType string, schemaVersion *common.SchemaVersion)) *MockPatientDataRepository_GetLatestDatum_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(string), args[4].(*common.SchemaVersion))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetLatestDatum_Call) Return(_a0 map[string]interface{}, _a1 error) *MockPatientDataRepository_GetLatestDatum_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetUploadData provides a mock function with given fields: ctx, traceID, uploadIds, schemaVersion
+func (_m *MockPatientDataRepository) GetUploadData(ctx context.Context, traceID string, uploadIds []string, schemaVersion *common.SchemaVersion) (mongo.StorageIterator, error) {
+	ret := _m.Called(ctx, traceID, uploadIds, schemaVersion)
 
 	var r0 mongo.StorageIterator
-	if rf, ok := ret.Get(0).(func(context.Context, string, []string) mongo.StorageIterator); ok {
-		r0 = rf(ctx, traceID, uploadIds)
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string, *common.SchemaVersion) mongo.StorageIterator); ok {
+		r0 = rf(ctx, traceID, uploadIds, schemaVersion)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(mongo.StorageIterator)
@@ -187,8 +479,8 @@ func (_m *MockPatientDataRepository) GetUploadData(ctx context.Context, traceID
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
-		r1 = rf(ctx, traceID, uploadIds)
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string, *common.SchemaVersion) error); ok {
+		r1 = rf(ctx, traceID, uploadIds, schemaVersion)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -205,13 +497,14 @@ type MockPatientDataRepository_GetUploadData_Call struct {
 //  - ctx context.Context
 //  - traceID string
 //  - uploadIds []string
-func (_e *MockPatientDataRepository_Expecter) GetUploadData(ctx interface{}, traceID interface{}, uploadIds interface{}) *MockPatientDataRepository_GetUploadData_Call {
-	return &MockPatientDataRepository_GetUploadData_Call{Call: _e.mock.On("GetUploadData", ctx, traceID, uploadIds)}
+//  - schemaVersion *common.SchemaVersion
+func (_e *MockPatientDataRepository_Expecter) GetUploadData(ctx interface{}, traceID interface{}, uploadIds interface{}, schemaVersion interface{}) *MockPatientDataRepository_GetUploadData_Call {
+	return &MockPatientDataRepository_GetUploadData_Call{Call: _e.mock.On("GetUploadData", ctx, traceID, uploadIds, schemaVersion)}
 }
 
-func (_c *MockPatientDataRepository_GetUploadData_Call) Run(run func(ctx context.Context, traceID string, uploadIds []string)) *MockPatientDataRepository_GetUploadData_Call {
+func (_c *MockPatientDataRepository_GetUploadData_Call) Run(run func(ctx context.Context, traceID string, uploadIds []string, schemaVersion *common.SchemaVersion)) *MockPatientDataRepository_GetUploadData_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].([]string))
+		run(args[0].(context.Context), args[1].(string), args[2].([]string), args[3].(*common.SchemaVersion))
 	})
 	return _c
 }
@@ -221,6 +514,202 @@ func (_c *MockPatientDataRepository_GetUploadData_Call) Return(_a0 mongo.Storage
 	return _c
 }
 
+// GetUploads provides a mock function with given fields: ctx, traceID, userID
+func (_m *MockPatientDataRepository) GetUploads(ctx context.Context, traceID string, userID string) ([]schema.DbUpload, error) {
+	ret := _m.Called(ctx, traceID, userID)
+
+	var r0 []schema.DbUpload
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []schema.DbUpload); ok {
+		r0 = rf(ctx, traceID, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]schema.DbUpload)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, traceID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetUploads_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUploads'
+type MockPatientDataRepository_GetUploads_Call struct {
+	*mock.Call
+}
+
+// GetUploads is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+func (_e *MockPatientDataRepository_Expecter) GetUploads(ctx interface{}, traceID interface{}, userID interface{}) *MockPatientDataRepository_GetUploads_Call {
+	return &MockPatientDataRepository_GetUploads_Call{Call: _e.mock.On("GetUploads", ctx, traceID, userID)}
+}
+
+func (_c *MockPatientDataRepository_GetUploads_Call) Run(run func(ctx context.Context, traceID string, userID string)) *MockPatientDataRepository_GetUploads_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetUploads_Call) Return(_a0 []schema.DbUpload, _a1 error) *MockPatientDataRepository_GetUploads_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetUploadsDataCount provides a mock function with given fields: ctx, traceID, userID
+func (_m *MockPatientDataRepository) GetUploadsDataCount(ctx context.Context, traceID string, userID string) ([]schema.DbUploadTypeCount, error) {
+	ret := _m.Called(ctx, traceID, userID)
+
+	var r0 []schema.DbUploadTypeCount
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []schema.DbUploadTypeCount); ok {
+		r0 = rf(ctx, traceID, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]schema.DbUploadTypeCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, traceID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetUploadsDataCount_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUploadsDataCount'
+type MockPatientDataRepository_GetUploadsDataCount_Call struct {
+	*mock.Call
+}
+
+// GetUploadsDataCount is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+func (_e *MockPatientDataRepository_Expecter) GetUploadsDataCount(ctx interface{}, traceID interface{}, userID interface{}) *MockPatientDataRepository_GetUploadsDataCount_Call {
+	return &MockPatientDataRepository_GetUploadsDataCount_Call{Call: _e.mock.On("GetUploadsDataCount", ctx, traceID, userID)}
+}
+
+func (_c *MockPatientDataRepository_GetUploadsDataCount_Call) Run(run func(ctx context.Context, traceID string, userID string)) *MockPatientDataRepository_GetUploadsDataCount_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetUploadsDataCount_Call) Return(_a0 []schema.DbUploadTypeCount, _a1 error) *MockPatientDataRepository_GetUploadsDataCount_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetUploadsDataRange provides a mock function with given fields: ctx, traceID, userID, uploadIDs
+func (_m *MockPatientDataRepository) GetUploadsDataRange(ctx context.Context, traceID string, userID string, uploadIDs []string) (*common.Date, error) {
+	ret := _m.Called(ctx, traceID, userID, uploadIDs)
+
+	var r0 *common.Date
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) *common.Date); ok {
+		r0 = rf(ctx, traceID, userID, uploadIDs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*common.Date)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []string) error); ok {
+		r1 = rf(ctx, traceID, userID, uploadIDs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_GetUploadsDataRange_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUploadsDataRange'
+type MockPatientDataRepository_GetUploadsDataRange_Call struct {
+	*mock.Call
+}
+
+// GetUploadsDataRange is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+//  - uploadIDs []string
+func (_e *MockPatientDataRepository_Expecter) GetUploadsDataRange(ctx interface{}, traceID interface{}, userID interface{}, uploadIDs interface{}) *MockPatientDataRepository_GetUploadsDataRange_Call {
+	return &MockPatientDataRepository_GetUploadsDataRange_Call{Call: _e.mock.On("GetUploadsDataRange", ctx, traceID, userID, uploadIDs)}
+}
+
+func (_c *MockPatientDataRepository_GetUploadsDataRange_Call) Run(run func(ctx context.Context, traceID string, userID string, uploadIDs []string)) *MockPatientDataRepository_GetUploadsDataRange_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].([]string))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_GetUploadsDataRange_Call) Return(_a0 *common.Date, _a1 error) *MockPatientDataRepository_GetUploadsDataRange_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// WatchData provides a mock function with given fields: ctx, traceID, userID, schemaVersion, resumeToken, maxAwaitTime
+func (_m *MockPatientDataRepository) WatchData(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion, resumeToken string, maxAwaitTime time.Duration) (common.DataStream, error) {
+	ret := _m.Called(ctx, traceID, userID, schemaVersion, resumeToken, maxAwaitTime)
+
+	var r0 common.DataStream
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *common.SchemaVersion, string, time.Duration) common.DataStream); ok {
+		r0 = rf(ctx, traceID, userID, schemaVersion, resumeToken, maxAwaitTime)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(common.DataStream)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *common.SchemaVersion, string, time.Duration) error); ok {
+		r1 = rf(ctx, traceID, userID, schemaVersion, resumeToken, maxAwaitTime)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockPatientDataRepository_WatchData_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WatchData'
+type MockPatientDataRepository_WatchData_Call struct {
+	*mock.Call
+}
+
+// WatchData is a helper method to define mock.On call
+//  - ctx context.Context
+//  - traceID string
+//  - userID string
+//  - schemaVersion *common.SchemaVersion
+//  - resumeToken string
+//  - maxAwaitTime time.Duration
+func (_e *MockPatientDataRepository_Expecter) WatchData(ctx interface{}, traceID interface{}, userID interface{}, schemaVersion interface{}, resumeToken interface{}, maxAwaitTime interface{}) *MockPatientDataRepository_WatchData_Call {
+	return &MockPatientDataRepository_WatchData_Call{Call: _e.mock.On("WatchData", ctx, traceID, userID, schemaVersion, resumeToken, maxAwaitTime)}
+}
+
+func (_c *MockPatientDataRepository_WatchData_Call) Run(run func(ctx context.Context, traceID string, userID string, schemaVersion *common.SchemaVersion, resumeToken string, maxAwaitTime time.Duration)) *MockPatientDataRepository_WatchData_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(*common.SchemaVersion), args[4].(string), args[5].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataRepository_WatchData_Call) Return(_a0 common.DataStream, _a1 error) *MockPatientDataRepository_WatchData_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type NewMockPatientDataRepositoryT interface {
 	mock.TestingT
 	Cleanup(func())
@@ -3,8 +3,8 @@
 package usecase
 
 import (
-	bytes "bytes"
 	context "context"
+	io "io"
 
 	common "github.com/tidepool-org/tide-whisperer/common"
 
@@ -24,29 +24,59 @@ func (_m *MockPatientDataUseCase) EXPECT() *MockPatientDataUseCase_Expecter {
 	return &MockPatientDataUseCase_Expecter{mock: &_m.Mock}
 }
 
-// GetData provides a mock function with given fields: ctx, args
-func (_m *MockPatientDataUseCase) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buffer, *common.DetailedError) {
-	ret := _m.Called(ctx, args)
+// CheckGetDataArgs provides a mock function with given fields: args
+func (_m *MockPatientDataUseCase) CheckGetDataArgs(args GetDataArgs) *common.DetailedError {
+	ret := _m.Called(args)
 
-	var r0 *bytes.Buffer
-	if rf, ok := ret.Get(0).(func(context.Context, GetDataArgs) *bytes.Buffer); ok {
-		r0 = rf(ctx, args)
+	var r0 *common.DetailedError
+	if rf, ok := ret.Get(0).(func(GetDataArgs) *common.DetailedError); ok {
+		r0 = rf(args)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*bytes.Buffer)
+			r0 = ret.Get(0).(*common.DetailedError)
 		}
 	}
 
-	var r1 *common.DetailedError
-	if rf, ok := ret.Get(1).(func(context.Context, GetDataArgs) *common.DetailedError); ok {
-		r1 = rf(ctx, args)
+	return r0
+}
+
+// MockPatientDataUseCase_CheckGetDataArgs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CheckGetDataArgs'
+type MockPatientDataUseCase_CheckGetDataArgs_Call struct {
+	*mock.Call
+}
+
+// CheckGetDataArgs is a helper method to define mock.On call
+//  - args GetDataArgs
+func (_e *MockPatientDataUseCase_Expecter) CheckGetDataArgs(args interface{}) *MockPatientDataUseCase_CheckGetDataArgs_Call {
+	return &MockPatientDataUseCase_CheckGetDataArgs_Call{Call: _e.mock.On("CheckGetDataArgs", args)}
+}
+
+func (_c *MockPatientDataUseCase_CheckGetDataArgs_Call) Run(run func(args GetDataArgs)) *MockPatientDataUseCase_CheckGetDataArgs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(GetDataArgs))
+	})
+	return _c
+}
+
+func (_c *MockPatientDataUseCase_CheckGetDataArgs_Call) Return(_a0 *common.DetailedError) *MockPatientDataUseCase_CheckGetDataArgs_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// GetData provides a mock function with given fields: ctx, args, res
+func (_m *MockPatientDataUseCase) GetData(ctx context.Context, args GetDataArgs, res io.Writer) *common.DetailedError {
+	ret := _m.Called(ctx, args, res)
+
+	var r0 *common.DetailedError
+	if rf, ok := ret.Get(0).(func(context.Context, GetDataArgs, io.Writer) *common.DetailedError); ok {
+		r0 = rf(ctx, args, res)
 	} else {
-		if ret.Get(1) != nil {
-			r1 = ret.Get(1).(*common.DetailedError)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*common.DetailedError)
 		}
 	}
 
-	return r0, r1
+	return r0
 }
 
 // MockPatientDataUseCase_GetData_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetData'
@@ -57,19 +87,20 @@ type MockPatientDataUseCase_GetData_Call struct {
 // GetData is a helper method to define mock.On call
 //  - ctx context.Context
 //  - args GetDataArgs
-func (_e *MockPatientDataUseCase_Expecter) GetData(ctx interface{}, args interface{}) *MockPatientDataUseCase_GetData_Call {
-	return &MockPatientDataUseCase_GetData_Call{Call: _e.mock.On("GetData", ctx, args)}
+//  - res io.Writer
+func (_e *MockPatientDataUseCase_Expecter) GetData(ctx interface{}, args interface{}, res interface{}) *MockPatientDataUseCase_GetData_Call {
+	return &MockPatientDataUseCase_GetData_Call{Call: _e.mock.On("GetData", ctx, args, res)}
 }
 
-func (_c *MockPatientDataUseCase_GetData_Call) Run(run func(ctx context.Context, args GetDataArgs)) *MockPatientDataUseCase_GetData_Call {
+func (_c *MockPatientDataUseCase_GetData_Call) Run(run func(ctx context.Context, args GetDataArgs, res io.Writer)) *MockPatientDataUseCase_GetData_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(GetDataArgs))
+		run(args[0].(context.Context), args[1].(GetDataArgs), args[2].(io.Writer))
 	})
 	return _c
 }
 
-func (_c *MockPatientDataUseCase_GetData_Call) Return(_a0 *bytes.Buffer, _a1 *common.DetailedError) *MockPatientDataUseCase_GetData_Call {
-	_c.Call.Return(_a0, _a1)
+func (_c *MockPatientDataUseCase_GetData_Call) Return(_a0 *common.DetailedError) *MockPatientDataUseCase_GetData_Call {
+	_c.Call.Return(_a0)
 	return _c
 }
 
@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// cursorTimeFormat time format of the cursors, same as the deviceData time. The cursor times are compared
+// as strings by the database query: they are always normalised to this format, see newCursor()
+const cursorTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// pageDatum a datum of a page with its position
+type pageDatum struct {
+	time   time.Time
+	cursor common.Cursor
+	datum  map[string]interface{}
+}
+
+// newCursor returns the cursor of a datum position, its time in the cursorTimeFormat
+// whatever the format of the datum time ("...00Z" or "...00.000Z")
+func newCursor(datumTime time.Time, datumID string) common.Cursor {
+	return common.Cursor{Time: datumTime.UTC().Format(cursorTimeFormat), ID: datumID}
+}
+
+// encodeCursor returns the opaque value of a cursor given to the clients
+func encodeCursor(cursor common.Cursor) string {
+	jsonCursor, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+
+// decodeCursor decode a cursor value returned by encodeCursor
+func decodeCursor(value string) (*common.Cursor, time.Time, error) {
+	var cursor common.Cursor
+	jsonCursor, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if err = json.Unmarshal(jsonCursor, &cursor); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	cursorTime, err := time.Parse(time.RFC3339Nano, cursor.Time)
+	if err != nil || cursor.ID == "" {
+		return nil, time.Time{}, fmt.Errorf("invalid cursor: %s", jsonCursor)
+	}
+	cursor = newCursor(cursorTime, cursor.ID)
+	return &cursor, cursorTime, nil
+}
+
+// isAfterCursor returns true if the datum position is after the requested cursor
+func (p *writeFromIter) isAfterCursor(datumTime time.Time, datumID string) bool {
+	if p.after == nil {
+		return true
+	}
+	return datumTime.After(p.afterTime) || (datumTime.Equal(p.afterTime) && datumID > p.after.ID)
+}
+
+// writePage merge the database data and the tide-v2 buckets in (time, id) order,
+// then write the first p.limit of them. p.nextCursor is set when more data are available.
+//
+// The database iterator is expected to be already sorted and limited to p.limit + 1 rows.
+// Whether more data are available is decided on the rows read and the selected samples,
+// not on the written data: some of them are ignored (see prepareDatum).
+func writePage(ctx context.Context, res io.Writer, bgUnit string, p *writeFromIter) error {
+	iter := p.iter
+	p.iter = nil
+
+	page := make([]pageDatum, 0, p.limit+1)
+	var lastRow *pageDatum
+	rows := 0
+	for iter.Next(ctx) {
+		rows++
+		var datum map[string]interface{}
+		err := iter.Decode(&datum)
+		if err != nil {
+			p.decode.numErrors++
+			if p.decode.firstError == nil {
+				p.decode.firstError = err
+			}
+			continue
+		}
+		datumTime, haveTime := datum["time"].(string)
+		parsedTime, err := time.Parse(time.RFC3339Nano, datumTime)
+		datumID, haveID := datum["id"].(string)
+		if !haveTime || !haveID || err != nil {
+			// Ignore datum with no valid position, they can't be paginated
+			continue
+		}
+		row := pageDatum{time: parsedTime, cursor: newCursor(parsedTime, datumID), datum: datum}
+		lastRow = &row
+		// The database compares the times as strings, the same position in another format may be returned again
+		if !p.isAfterCursor(parsedTime, datumID) || !p.prepareDatum(datum, bgUnit) {
+			continue
+		}
+		page = append(page, row)
+	}
+	if err := iterErr(iter); err != nil {
+		return err
+	}
+	// boundary the position after which the data are not known yet, nil when all of them were read:
+	// the database has more data when it returns the p.limit + 1 rows requested
+	var boundary *pageDatum
+	if rows > p.limit && lastRow != nil {
+		boundary = lastRow
+	}
+
+	// Only the first samples after the cursor can be part of the page: they are selected before building their datum
+	samples := &pageSamples{}
+	for b, bucket := range p.cbgs {
+		for i, sample := range bucket.Samples {
+			if !p.bucketSources.excludes("cbg", sample.Timestamp) {
+				p.selectBucketSample(samples, sample.Timestamp, "cbg", bucket.Id, b, i)
+			}
+		}
+	}
+	for b, bucket := range p.basals {
+		for i, sample := range bucket.Samples {
+			if !p.bucketSources.excludes("basal", sample.Timestamp) {
+				p.selectBucketSample(samples, sample.Timestamp, "basal", bucket.Id, b, i)
+			}
+		}
+	}
+	if samples.Len() > p.limit {
+		last := (*samples)[0]
+		if boundary == nil || isPositionBefore(last.time, last.id, boundary.time, boundary.cursor.ID) {
+			boundary = &pageDatum{time: last.time, cursor: newCursor(last.time, last.id)}
+		}
+	}
+	for _, sample := range *samples {
+		var datum map[string]interface{}
+		if sample.datumType == "basal" {
+			datum = basalDatum(p.basals[sample.bucket].Id, sample.index, p.basals[sample.bucket].Samples[sample.index])
+		} else {
+			datum = cbgDatum(p.cbgs[sample.bucket].Id, sample.index, p.cbgs[sample.bucket].Samples[sample.index], bgUnit)
+		}
+		page = append(page, pageDatum{
+			time:   sample.time,
+			cursor: newCursor(sample.time, sample.id),
+			datum:  datum,
+		})
+	}
+
+	sort.SliceStable(page, func(i, j int) bool {
+		return isPositionBefore(page[i].time, page[i].cursor.ID, page[j].time, page[j].cursor.ID)
+	})
+
+	if boundary != nil {
+		// The data after the boundary may be preceded by data not read yet: they are part of the next pages
+		known := sort.Search(len(page), func(i int) bool {
+			return isPositionBefore(boundary.time, boundary.cursor.ID, page[i].time, page[i].cursor.ID)
+		})
+		page = page[:known]
+	}
+	if len(page) > p.limit {
+		page = page[:p.limit]
+		p.nextCursor = encodeCursor(page[len(page)-1].cursor)
+	} else if boundary != nil {
+		p.nextCursor = encodeCursor(boundary.cursor)
+	}
+
+	for _, d := range page {
+		if err := p.writeDatum(res, d.datum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageSample the position of a tide-v2 bucket sample selected for a page
+type pageSample struct {
+	time      time.Time
+	id        string
+	datumType string
+	// bucket & index the position of the sample in the buckets
+	bucket int
+	index  int
+}
+
+// pageSamples the selected samples, a heap with the last position first (see container/heap)
+type pageSamples []pageSample
+
+func (s pageSamples) Len() int { return len(s) }
+func (s pageSamples) Less(i, j int) bool {
+	return isPositionBefore(s[j].time, s[j].id, s[i].time, s[i].id)
+}
+func (s pageSamples) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *pageSamples) Push(x interface{}) { *s = append(*s, x.(pageSample)) }
+func (s *pageSamples) Pop() interface{} {
+	old := *s
+	last := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return last
+}
+
+// isPositionBefore returns true when the (time, id) position of a datum is before another one
+func isPositionBefore(time1 time.Time, id1 string, time2 time.Time, id2 string) bool {
+	if time1.Equal(time2) {
+		return id1 < id2
+	}
+	return time1.Before(time2)
+}
+
+// selectBucketSample add a tide-v2 sample to the selected ones if it is after the cursor and one of the first
+// p.limit + 1 positions (one more to know if there is a next page)
+func (p *writeFromIter) selectBucketSample(samples *pageSamples, sampleTime time.Time, datumType string, bucketID string, bucket int, index int) {
+	// Same precision as the cursor
+	sampleTime = sampleTime.Truncate(time.Millisecond)
+	// Cheap checks first, the id is only built for the samples which may be selected
+	full := samples.Len() > p.limit
+	if (p.after != nil && sampleTime.Before(p.afterTime)) || (full && sampleTime.After((*samples)[0].time)) {
+		return
+	}
+	id := bucketSampleID(datumType, bucketID, index)
+	if !p.isAfterCursor(sampleTime, id) {
+		return
+	}
+	if full {
+		last := (*samples)[0]
+		if !isPositionBefore(sampleTime, id, last.time, last.id) {
+			return
+		}
+		heap.Pop(samples)
+	}
+	heap.Push(samples, pageSample{time: sampleTime, id: id, datumType: datumType, bucket: bucket, index: index})
+}
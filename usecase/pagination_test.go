@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	goComMgo "github.com/tidepool-org/go-common/clients/mongo"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestCursor_encodeDecode(t *testing.T) {
+	cursor := common.Cursor{Time: "2023-04-01T12:32:00.000Z", ID: "cbg_cbg1_0"}
+	decoded, decodedTime, err := decodeCursor(encodeCursor(cursor))
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+	assert.Equal(t, time.Date(2023, time.April, 1, 12, 32, 0, 0, time.UTC), decodedTime)
+
+	// Same position, another time format
+	decoded, _, err = decodeCursor(encodeCursor(common.Cursor{Time: "2023-04-01T14:32:00+02:00", ID: "cbg_cbg1_0"}))
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", encodeCursor(common.Cursor{Time: "yesterday", ID: "abc"}), encodeCursor(common.Cursor{Time: "2023-04-01T12:32:00.000Z"})} {
+		_, _, err = decodeCursor(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPatientData_GetDataPage(t *testing.T) {
+	userID := "userid_test_getDataPage"
+	cbgDay := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+		{
+			Id:     "cbg1",
+			UserId: userID,
+			Day:    cbgDay,
+			Samples: []tideV2Schema.CbgSample{
+				{Value: 10, Units: MmolL, Timestamp: cbgDay.Add(12*time.Hour + 32*time.Minute), Timezone: "UTC"},
+				{Value: 11, Units: MmolL, Timestamp: cbgDay.Add(12*time.Hour + 50*time.Minute), Timezone: "UTC"},
+			},
+		},
+	}
+	repository := MockPatientDataRepository{}
+	// The repository returns the data after the cursor, in time order
+	repository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.MatchedBy(func(params *common.Params) bool {
+		return params.Limit == 3 && params.After == nil
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:00:00.000Z","units":"mmol/L","value":5}`,
+		`{"id":"smbg2","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:40:00.000Z","units":"mmol/L","value":6}`,
+	}), nil).Once()
+	repository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.MatchedBy(func(params *common.Params) bool {
+		return params.Limit == 3 && params.After != nil && params.After.ID == "cbg_cbg1_0" && params.After.Time == "2023-04-01T12:32:00.000Z"
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg2","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:40:00.000Z","units":"mmol/L","value":6}`,
+	}), nil).Once()
+
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, false)
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg", "cbg"},
+		Format: FormatNDJSON,
+		Limit:  2,
+	}
+
+	firstPage := &bytes.Buffer{}
+	nextCursor, err := p.GetDataPage(testCtx, args, firstPage)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, nextCursor)
+	assert.Equal(t, `{"id":"smbg1","time":"2023-04-01T12:00:00.000Z","type":"smbg","units":"mmol/L","uploadId":"upload1","value":5}
+{"id":"cbg_cbg1_0","time":"2023-04-01T12:32:00Z","timezone":"UTC","type":"cbg","units":"mmol/L","value":10}
+`, firstPage.String())
+
+	args.Cursor = nextCursor
+	lastPage := &bytes.Buffer{}
+	nextCursor, err = p.GetDataPage(testCtx, args, lastPage)
+	assert.Nil(t, err)
+	assert.Empty(t, nextCursor)
+	assert.Equal(t, `{"id":"smbg2","time":"2023-04-01T12:40:00.000Z","type":"smbg","units":"mmol/L","uploadId":"upload1","value":6}
+{"id":"cbg_cbg1_1","time":"2023-04-01T12:50:00Z","timezone":"UTC","type":"cbg","units":"mmol/L","value":11}
+`, lastPage.String())
+
+	repository.AssertExpectations(t)
+}
+
+func TestPatientData_GetDataPage_ignoredRows(t *testing.T) {
+	userID := "userid_test_getDataPage_ignored"
+	repository := MockPatientDataRepository{}
+	// A full page of rows, one of them ignored (no uploadId): more data may be available
+	repository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.MatchedBy(func(params *common.Params) bool {
+		return params.Limit == 3 && params.After == nil
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:00:00Z","units":"mmol/L","value":5}`,
+		`{"id":"smbg2","type":"smbg","time":"2023-04-01T12:10:00Z","units":"mmol/L","value":6}`,
+		`{"id":"smbg3","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:20:00Z","units":"mmol/L","value":7}`,
+	}), nil).Once()
+	// The cursor time is normalised, the database may return the last datum again
+	repository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.MatchedBy(func(params *common.Params) bool {
+		return params.Limit == 3 && params.After != nil && params.After.ID == "smbg3" && params.After.Time == "2023-04-01T12:20:00.000Z"
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg3","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:20:00Z","units":"mmol/L","value":7}`,
+		`{"id":"smbg4","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:30:00Z","units":"mmol/L","value":8}`,
+	}), nil).Once()
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg"},
+		Format: FormatNDJSON,
+		Fields: []string{"value"},
+		Limit:  2,
+	}
+
+	firstPage := &bytes.Buffer{}
+	nextCursor, err := p.GetDataPage(testCtx, args, firstPage)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"smbg1","time":"2023-04-01T12:00:00Z","type":"smbg","value":5}
+{"id":"smbg3","time":"2023-04-01T12:20:00Z","type":"smbg","value":7}
+`, firstPage.String())
+	cursor, _, errCursor := decodeCursor(nextCursor)
+	assert.NoError(t, errCursor)
+	assert.Equal(t, common.Cursor{Time: "2023-04-01T12:20:00.000Z", ID: "smbg3"}, *cursor)
+
+	args.Cursor = nextCursor
+	lastPage := &bytes.Buffer{}
+	nextCursor, err = p.GetDataPage(testCtx, args, lastPage)
+	assert.Nil(t, err)
+	assert.Empty(t, nextCursor)
+	assert.Equal(t, `{"id":"smbg4","time":"2023-04-01T12:30:00Z","type":"smbg","value":8}
+`, lastPage.String())
+
+	repository.AssertExpectations(t)
+}
+
+func TestPatientData_GetDataPage_invalidCursor(t *testing.T) {
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &MockPatientDataRepository{}, false)
+	res := &bytes.Buffer{}
+	_, err := p.GetDataPage(testCtx, GetDataArgs{UserID: "userid_test_getDataPage", Limit: 2, Cursor: "invalid"}, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errorInvalidParameters.Code, err.Code)
+	assert.Equal(t, 0, res.Len())
+}
+
+func TestPatientData_GetDataPage_buckets(t *testing.T) {
+	userID := "userid_test_getDataPage_buckets"
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+	// Samples not in time order on purpose
+	tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+		{Id: "cbg2", UserId: userID, Day: day.AddDate(0, 0, 1), Samples: []tideV2Schema.CbgSample{
+			{Value: 13, Units: MmolL, Timestamp: day.Add(25 * time.Hour), Timezone: "UTC"},
+			{Value: 12, Units: MmolL, Timestamp: day.Add(24 * time.Hour), Timezone: "UTC"},
+		}},
+		{Id: "cbg1", UserId: userID, Day: day, Samples: []tideV2Schema.CbgSample{
+			{Value: 11, Units: MmolL, Timestamp: day.Add(2 * time.Hour), Timezone: "UTC"},
+			{Value: 10, Units: MmolL, Timestamp: day.Add(1 * time.Hour), Timezone: "UTC"},
+			{Value: 14, Units: MmolL, Timestamp: day.Add(2 * time.Hour), Timezone: "UTC"},
+		}},
+	}
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(func(_ context.Context, _ string, _ *common.Params, _ []string) goComMgo.StorageIterator {
+		return infrastructure.NewMockDbAdapterIterator([]string{})
+	}, nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, false)
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"cbg", "upload"},
+		Format: FormatNDJSON,
+		Fields: []string{"value"},
+		Limit:  2,
+	}
+
+	var pages []string
+	for {
+		page := &bytes.Buffer{}
+		nextCursor, err := p.GetDataPage(testCtx, args, page)
+		assert.Nil(t, err)
+		pages = append(pages, page.String())
+		if nextCursor == "" || len(pages) > 3 {
+			break
+		}
+		args.Cursor = nextCursor
+	}
+	assert.Equal(t, []string{
+		`{"id":"cbg_cbg1_1","time":"2023-04-01T01:00:00Z","type":"cbg","value":10}
+{"id":"cbg_cbg1_0","time":"2023-04-01T02:00:00Z","type":"cbg","value":11}
+`,
+		`{"id":"cbg_cbg1_2","time":"2023-04-01T02:00:00Z","type":"cbg","value":14}
+{"id":"cbg_cbg2_1","time":"2023-04-02T00:00:00Z","type":"cbg","value":12}
+`,
+		`{"id":"cbg_cbg2_0","time":"2023-04-02T01:00:00Z","type":"cbg","value":13}
+`,
+	}, pages)
+	// The upload data are not part of the pages
+	repository.AssertNotCalled(t, "GetUploadData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPageSamples_selectBucketSample(t *testing.T) {
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	p := &writeFromIter{limit: 2}
+	samples := &pageSamples{}
+	for i, hours := range []int{5, 1, 4, 2, 3} {
+		p.selectBucketSample(samples, day.Add(time.Duration(hours)*time.Hour), "cbg", "b", 0, i)
+	}
+	// Only the first limit + 1 positions are kept
+	indexes := make([]int, 0, samples.Len())
+	for _, sample := range *samples {
+		indexes = append(indexes, sample.index)
+	}
+	assert.ElementsMatch(t, []int{1, 3, 4}, indexes)
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// DefaultParameterLevels the levels of the device parameters returned when none are configured
+var DefaultParameterLevels = []int{1, 2}
+
+var errorParameterLevelsForbidden = common.DetailedError{Status: http.StatusForbidden, Code: "data_parameter_levels_forbidden", Message: "these parameter levels are reserved to the server & clinician tokens"}
+
+// ParseParameterLevels returns the levels of a comma separated list of device parameter levels
+func ParseParameterLevels(value string) ([]int, error) {
+	levels := []int{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		level, err := strconv.Atoi(item)
+		if err != nil || level < 1 {
+			return nil, fmt.Errorf("invalid parameter level %q", item)
+		}
+		if !common.ContainsInt(levels, level) {
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+// SetParameterLevels set the levels of the device parameters returned when the request does not choose them,
+// DefaultParameterLevels when not set
+func (p *PatientData) SetParameterLevels(levels []int) {
+	p.parameterLevels = levels
+}
+
+// defaultParameterLevels returns the configured levels of the device parameters
+func (p *PatientData) defaultParameterLevels() []int {
+	if len(p.parameterLevels) == 0 {
+		return DefaultParameterLevels
+	}
+	return p.parameterLevels
+}
+
+// getParameterLevels returns the levels of the device parameters to return for the request:
+// the requested ones, or the configured ones when none are requested, see allowedParameterLevels()
+func (p *PatientData) getParameterLevels(args GetDataArgs) ([]int, *common.DetailedError) {
+	return p.allowedParameterLevels(args.ParameterLevels, args.TrustedToken, args.UserID, args.TraceID)
+}
+
+// allowedParameterLevels returns the requested levels, or the configured ones when none are requested.
+// The levels which are not configured are only returned to the server & clinician tokens.
+func (p *PatientData) allowedParameterLevels(levels []int, trustedToken bool, userID string, traceID string) ([]int, *common.DetailedError) {
+	defaultLevels := p.defaultParameterLevels()
+	if len(levels) == 0 {
+		return defaultLevels, nil
+	}
+	if !trustedToken {
+		for _, level := range levels {
+			if !common.ContainsInt(defaultLevels, level) {
+				return nil, &common.DetailedError{
+					Status:          errorParameterLevelsForbidden.Status,
+					Code:            errorParameterLevelsForbidden.Code,
+					Message:         errorParameterLevelsForbidden.Message,
+					InternalMessage: addContextToMessage("getParameterLevels", userID, traceID, fmt.Sprintf("level %d requested", level)),
+				}
+			}
+		}
+	}
+	return levels, nil
+}
+
+// isParameterLevelKept returns true when the level of a device parameter datum is part of levels,
+// the data without level (or with an invalid one) are kept
+func isParameterLevelKept(datum map[string]interface{}, levels []int) bool {
+	datumLevel, haveLevel := datum["level"]
+	if !haveLevel {
+		return true
+	}
+	intLevel, err := strconv.Atoi(fmt.Sprintf("%v", datumLevel))
+	return err != nil || common.ContainsInt(levels, intLevel)
+}
+
+// filterParameterLevels returns a copy of the settings with only the current & history parameters of these levels
+func filterParameterLevels(settings *schemaV2.SettingsResult, levels []int) *schemaV2.SettingsResult {
+	if settings == nil {
+		return nil
+	}
+	filtered := *settings
+	if settings.CurrentSettings.Parameters != nil {
+		filtered.CurrentSettings.Parameters = make([]orcaSchema.CurrentParameter, 0, len(settings.CurrentSettings.Parameters))
+		for _, parameter := range settings.CurrentSettings.Parameters {
+			if common.ContainsInt(levels, parameter.Level) {
+				filtered.CurrentSettings.Parameters = append(filtered.CurrentSettings.Parameters, parameter)
+			}
+		}
+	}
+	if settings.HistoryParameters != nil {
+		filtered.HistoryParameters = make([]orcaSchema.HistoryParameter, 0, len(settings.HistoryParameters))
+		for _, parameter := range settings.HistoryParameters {
+			if common.ContainsInt(levels, parameter.Level) {
+				filtered.HistoryParameters = append(filtered.HistoryParameters, parameter)
+			}
+		}
+	}
+	return &filtered
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestParseParameterLevels(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedLevels []int
+		expectedError  bool
+	}{
+		{"Empty", "", []int{}, false},
+		{"List", "1, 3,1", []int{1, 3}, false},
+		{"Not a number", "1,high", nil, true},
+		{"Zero", "0", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, err := ParseParameterLevels(tt.value)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLevels, levels)
+		})
+	}
+}
+
+func TestPatientData_GetData_parameterLevels(t *testing.T) {
+	userID := "userid_test_levels"
+	data := []string{
+		`{"id":"param1","type":"deviceEvent","subType":"deviceParameter","uploadId":"upload1","time":"2023-04-01T10:00:00.000Z","level":"1"}`,
+		`{"id":"param3","type":"deviceEvent","subType":"deviceParameter","uploadId":"upload1","time":"2023-04-01T11:00:00.000Z","level":"3"}`,
+	}
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"deviceEvent"},
+		Format: FormatNDJSON,
+	}
+	tests := []struct {
+		name             string
+		configuredLevels []int
+		requestedLevels  []int
+		trustedToken     bool
+		expectedLevels   []int
+		expectedIDs      []string
+	}{
+		{"Default levels", nil, nil, false, DefaultParameterLevels, []string{"param1"}},
+		{"Configured levels", []int{1, 2, 3}, nil, false, []int{1, 2, 3}, []string{"param1", "param3"}},
+		{"Fewer levels", nil, []int{1}, false, []int{1}, []string{"param1"}},
+		{"Other levels for a trusted token", nil, []int{3}, true, []int{3}, []string{"param3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := MockPatientDataRepository{}
+			repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+				return assert.ObjectsAreEqual(tt.expectedLevels, params.LevelFilter)
+			}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator(data), nil)
+			p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+			p.SetParameterLevels(tt.configuredLevels)
+			levelsArgs := args
+			levelsArgs.ParameterLevels = tt.requestedLevels
+			levelsArgs.TrustedToken = tt.trustedToken
+
+			res := &bytes.Buffer{}
+			err := p.GetData(testCtx, levelsArgs, res)
+			assert.Nil(t, err)
+			for _, id := range []string{"param1", "param3"} {
+				if common.Contains(tt.expectedIDs, id) {
+					assert.Contains(t, res.String(), id)
+				} else {
+					assert.NotContains(t, res.String(), id)
+				}
+			}
+			repository.AssertExpectations(t)
+		})
+	}
+
+	t.Run("should return an error when other levels are requested without a trusted token", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		levelsArgs := args
+		levelsArgs.ParameterLevels = []int{1, 3}
+
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, levelsArgs, res)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorParameterLevelsForbidden.Code, err.Code)
+		assert.Equal(t, 0, res.Len())
+		repository.AssertNotCalled(t, "GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestFilterParameterLevels(t *testing.T) {
+	settings := &tideV2Schema.SettingsResult{HistoryParameters: []orcaSchema.HistoryParameter{
+		{CurrentParameter: orcaSchema.CurrentParameter{Name: "WEIGHT", Level: 1}},
+		{CurrentParameter: orcaSchema.CurrentParameter{Name: "PATIENT_GLY_HYPO_LIMIT", Level: 3}},
+	}}
+	settings.CurrentSettings.Parameters = []orcaSchema.CurrentParameter{
+		{Name: "WEIGHT", Level: 1},
+		{Name: "PATIENT_GLY_HYPO_LIMIT", Level: 3},
+	}
+
+	filtered := filterParameterLevels(settings, []int{1, 2})
+	assert.Equal(t, []orcaSchema.CurrentParameter{{Name: "WEIGHT", Level: 1}}, filtered.CurrentSettings.Parameters)
+	assert.Len(t, filtered.HistoryParameters, 1)
+	assert.Equal(t, "WEIGHT", filtered.HistoryParameters[0].Name)
+	// The settings are not modified
+	assert.Len(t, settings.CurrentSettings.Parameters, 2)
+	assert.Len(t, settings.HistoryParameters, 2)
+	assert.Nil(t, filterParameterLevels(nil, []int{1}))
+}
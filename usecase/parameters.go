@@ -0,0 +1,259 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+type (
+	// GetParametersArgs arguments of GetParametersHistory and CompareParameters
+	GetParametersArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// Names filter on the parameters, all parameters when empty
+		Names []string
+		// Levels filter on the parameters, the configured levels when empty (see SetParameterLevels)
+		Levels []int
+		// TrustedToken the request is made with a server or clinician token, allowed to request any Levels
+		TrustedToken bool
+		// StartDate & EndDate the window of the changes (ISO-8601 datetime), GetParametersHistory only.
+		// No bound by default.
+		StartDate string
+		EndDate   string
+		// From & To the dates to compare (ISO-8601 datetime), CompareParameters only
+		From string
+		To   string
+		// BgUnit the unit of the blood glucose parameters, as they are in the settings by default
+		BgUnit string
+	}
+	// ParametersHistoryResult result of GetParametersHistory
+	ParametersHistoryResult struct {
+		// Parameters the parameter changes, in effective date order
+		Parameters []orcaSchema.HistoryParameter `json:"parameters"`
+	}
+	// ParameterValue the value of a parameter at a date
+	ParameterValue struct {
+		Value string `json:"value"`
+		Unit  string `json:"unit"`
+	}
+	// ParameterComparison the values of a parameter at the compared dates, nil when not set
+	ParameterComparison struct {
+		Name    string          `json:"name"`
+		Level   int             `json:"level"`
+		From    *ParameterValue `json:"from"`
+		To      *ParameterValue `json:"to"`
+		Changed bool            `json:"changed"`
+	}
+	// ParametersCompareResult result of CompareParameters
+	ParametersCompareResult struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+		// Parameters the parameters set at one of the dates at least, ordered by level & name
+		Parameters []ParameterComparison `json:"parameters"`
+	}
+)
+
+// GetParametersHistory returns the changes of the pump settings parameters, filtered by name, level & window.
+// The levels which are not configured are only returned to the server & clinician tokens.
+func (p *PatientData) GetParametersHistory(ctx context.Context, args GetParametersArgs) (*ParametersHistoryResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getParametersHistory")
+	defer common.TimeEnd(ctx, "getParametersHistory")
+
+	var startTime, endTime time.Time
+	var err error
+	if args.StartDate != "" {
+		startTime, err = time.Parse(time.RFC3339Nano, args.StartDate)
+	}
+	if err == nil && args.EndDate != "" {
+		endTime, err = time.Parse(time.RFC3339Nano, args.EndDate)
+	}
+	if err == nil && !startTime.IsZero() && !endTime.IsZero() && !startTime.Before(endTime) {
+		err = fmt.Errorf("startDate is after endDate")
+	}
+	if err != nil {
+		return nil, newParametersInvalidError("GetParametersHistory", args, err)
+	}
+	levels, errLevels := p.allowedParameterLevels(args.Levels, args.TrustedToken, args.UserID, args.TraceID)
+	if errLevels != nil {
+		return nil, errLevels
+	}
+	args.Levels = levels
+
+	settings, errSettings := p.getSettings(ctx, args.TraceID, args.UserID, args.SessionToken, true)
+	if errSettings != nil {
+		return nil, errSettings
+	}
+	result := &ParametersHistoryResult{Parameters: []orcaSchema.HistoryParameter{}}
+	if settings == nil {
+		return result, nil
+	}
+	for _, change := range sortedParameterChanges(settings.HistoryParameters) {
+		changeTime := getEffectiveDate(change)
+		if !isParameterRequested(args, change.Name, change.Level) ||
+			(!startTime.IsZero() && changeTime.Before(startTime)) ||
+			(!endTime.IsZero() && changeTime.After(endTime)) {
+			continue
+		}
+		if args.BgUnit != "" {
+			change.Value, change.Unit = convertParameterValue(change.Value, change.Unit, args.BgUnit)
+			if change.PreviousValue != "" {
+				change.PreviousValue, change.PreviousUnit = convertParameterValue(change.PreviousValue, change.PreviousUnit, args.BgUnit)
+			}
+		}
+		result.Parameters = append(result.Parameters, change)
+	}
+	return result, nil
+}
+
+// CompareParameters returns the effective value of the pump settings parameters at two dates, and which ones changed.
+//
+// The value of a parameter at a date is the one of its last change effective at this date.
+// Before its first change, it is the previous value of this change, and a parameter
+// without history has its current value at any date.
+func (p *PatientData) CompareParameters(ctx context.Context, args GetParametersArgs) (*ParametersCompareResult, *common.DetailedError) {
+	common.TimeIt(ctx, "compareParameters")
+	defer common.TimeEnd(ctx, "compareParameters")
+
+	fromTime, err := time.Parse(time.RFC3339Nano, args.From)
+	var toTime time.Time
+	if err == nil {
+		toTime, err = time.Parse(time.RFC3339Nano, args.To)
+	}
+	if err != nil {
+		return nil, newParametersInvalidError("CompareParameters", args, err)
+	}
+	levels, errLevels := p.allowedParameterLevels(args.Levels, args.TrustedToken, args.UserID, args.TraceID)
+	if errLevels != nil {
+		return nil, errLevels
+	}
+	args.Levels = levels
+
+	settings, errSettings := p.getSettings(ctx, args.TraceID, args.UserID, args.SessionToken, true)
+	if errSettings != nil {
+		return nil, errSettings
+	}
+	result := &ParametersCompareResult{From: fromTime, To: toTime, Parameters: []ParameterComparison{}}
+	if settings == nil {
+		return result, nil
+	}
+
+	type parameterKey struct {
+		name  string
+		level int
+	}
+	history := make(map[parameterKey][]orcaSchema.HistoryParameter)
+	keys := make([]parameterKey, 0)
+	for _, change := range sortedParameterChanges(settings.HistoryParameters) {
+		key := parameterKey{name: change.Name, level: change.Level}
+		if _, found := history[key]; !found {
+			keys = append(keys, key)
+		}
+		history[key] = append(history[key], change)
+	}
+	current := make(map[parameterKey]orcaSchema.CurrentParameter)
+	for _, parameter := range settings.CurrentSettings.Parameters {
+		key := parameterKey{name: parameter.Name, level: parameter.Level}
+		if _, found := history[key]; !found {
+			keys = append(keys, key)
+		}
+		current[key] = parameter
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return keys[i].level < keys[j].level
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	for _, key := range keys {
+		if !isParameterRequested(args, key.name, key.level) {
+			continue
+		}
+		var from, to *ParameterValue
+		if changes, found := history[key]; found {
+			from = getParameterValueAt(changes, fromTime)
+			to = getParameterValueAt(changes, toTime)
+		} else {
+			parameter := current[key]
+			from = &ParameterValue{Value: parameter.Value, Unit: parameter.Unit}
+			to = &ParameterValue{Value: parameter.Value, Unit: parameter.Unit}
+		}
+		if from == nil && to == nil {
+			continue
+		}
+		if args.BgUnit != "" {
+			for _, value := range []*ParameterValue{from, to} {
+				if value != nil {
+					value.Value, value.Unit = convertParameterValue(value.Value, value.Unit, args.BgUnit)
+				}
+			}
+		}
+		result.Parameters = append(result.Parameters, ParameterComparison{
+			Name:    key.name,
+			Level:   key.level,
+			From:    from,
+			To:      to,
+			Changed: from == nil || to == nil || *from != *to,
+		})
+	}
+	return result, nil
+}
+
+// getParameterValueAt returns the value of a parameter at a date from its changes in effective date order,
+// nil when it is not set
+func getParameterValueAt(changes []orcaSchema.HistoryParameter, at time.Time) *ParameterValue {
+	var value *ParameterValue
+	for i, change := range changes {
+		if getEffectiveDate(change).After(at) {
+			if i == 0 && change.ChangeType != orcaSchema.ADDED && change.PreviousValue != "" {
+				value = &ParameterValue{Value: change.PreviousValue, Unit: change.PreviousUnit}
+			}
+			break
+		}
+		if change.ChangeType == orcaSchema.DELETED {
+			value = nil
+		} else {
+			value = &ParameterValue{Value: change.Value, Unit: change.Unit}
+		}
+	}
+	return value
+}
+
+// sortedParameterChanges returns a copy of the parameter changes in effective date order
+func sortedParameterChanges(changes []orcaSchema.HistoryParameter) []orcaSchema.HistoryParameter {
+	sorted := make([]orcaSchema.HistoryParameter, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return getEffectiveDate(sorted[i]).Before(getEffectiveDate(sorted[j]))
+	})
+	return sorted
+}
+
+// getEffectiveDate returns the time the parameter was changed on the device,
+// the time of the change request when it is unknown
+func getEffectiveDate(change orcaSchema.HistoryParameter) time.Time {
+	if change.EffectiveDate != nil {
+		return *change.EffectiveDate
+	}
+	return change.Timestamp
+}
+
+func isParameterRequested(args GetParametersArgs, name string, level int) bool {
+	return (len(args.Names) == 0 || common.Contains(args.Names, name)) &&
+		(len(args.Levels) == 0 || common.ContainsInt(args.Levels, level))
+}
+
+func newParametersInvalidError(function string, args GetParametersArgs, err error) *common.DetailedError {
+	return &common.DetailedError{
+		Status:          errorInvalidParameters.Status,
+		Code:            errorInvalidParameters.Code,
+		Message:         errorInvalidParameters.Message,
+		InternalMessage: addContextToMessage(function, args.UserID, args.TraceID, err.Error()),
+	}
+}
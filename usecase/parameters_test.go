@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func parametersSettings() *tideV2Schema.SettingsResult {
+	day := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	change := func(name string, level int, changeType string, value string, unit string, previousValue string, days int) orcaSchema.HistoryParameter {
+		effectiveDate := day.AddDate(0, 0, days)
+		return orcaSchema.HistoryParameter{
+			CurrentParameter: orcaSchema.CurrentParameter{Name: name, Value: value, Unit: unit, Level: level, EffectiveDate: &effectiveDate},
+			ChangeType:       changeType,
+			PreviousValue:    previousValue,
+			PreviousUnit:     unit,
+			Timestamp:        effectiveDate.Add(time.Hour),
+		}
+	}
+	settings := &tideV2Schema.SettingsResult{}
+	settings.CurrentSettings.Parameters = []orcaSchema.CurrentParameter{
+		{Name: HypoLimitParameter, Value: "60", Unit: MgdL, Level: 1},
+		{Name: "WEIGHT", Value: "72", Unit: "kg", Level: 1},
+		{Name: "MEAL_RATIO", Value: "10", Unit: "g", Level: 2},
+		{Name: "PID_GAIN", Value: "4", Unit: "", Level: 3},
+	}
+	// Not in time order on purpose
+	settings.HistoryParameters = []orcaSchema.HistoryParameter{
+		change("WEIGHT", 1, orcaSchema.UPDATED, "72", "kg", "70", 20),
+		change(HypoLimitParameter, 1, orcaSchema.UPDATED, "60", MgdL, "70", 10),
+		change("TARGET", 2, orcaSchema.ADDED, "110", MgdL, "", 5),
+		change("TARGET", 2, orcaSchema.DELETED, "110", MgdL, "", 15),
+	}
+	return settings
+}
+
+func TestPatientData_GetParametersHistory(t *testing.T) {
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(parametersSettings(), nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, false)
+
+	t.Run("should return the changes in effective date order", func(t *testing.T) {
+		result, err := p.GetParametersHistory(testCtx, GetParametersArgs{UserID: "user1"})
+
+		assert.Nil(t, err)
+		names := make([]string, len(result.Parameters))
+		for i, change := range result.Parameters {
+			names[i] = change.Name + ":" + change.ChangeType
+		}
+		assert.Equal(t, []string{"TARGET:added", HypoLimitParameter + ":updated", "TARGET:deleted", "WEIGHT:updated"}, names)
+	})
+
+	t.Run("should filter the changes and convert their unit", func(t *testing.T) {
+		result, err := p.GetParametersHistory(testCtx, GetParametersArgs{
+			UserID: "user1", Levels: []int{1}, StartDate: "2023-01-08T00:00:00Z", EndDate: "2023-01-15T00:00:00Z", BgUnit: MmolL,
+		})
+
+		assert.Nil(t, err)
+		assert.Len(t, result.Parameters, 1)
+		assert.Equal(t, HypoLimitParameter, result.Parameters[0].Name)
+		assert.Equal(t, "3.3", result.Parameters[0].Value)
+		assert.Equal(t, MmolL, result.Parameters[0].Unit)
+		assert.Equal(t, "3.9", result.Parameters[0].PreviousValue)
+		assert.Equal(t, MmolL, result.Parameters[0].PreviousUnit)
+	})
+
+	t.Run("should refuse an invalid window", func(t *testing.T) {
+		result, err := p.GetParametersHistory(testCtx, GetParametersArgs{UserID: "user1", StartDate: "2023-01-08", EndDate: "2023-01-15T00:00:00Z"})
+
+		assert.Nil(t, result)
+		assert.Equal(t, http.StatusBadRequest, err.Status)
+	})
+}
+
+func TestPatientData_CompareParameters(t *testing.T) {
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(parametersSettings(), nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, false)
+
+	t.Run("should return the value of every parameter at both dates", func(t *testing.T) {
+		result, err := p.CompareParameters(testCtx, GetParametersArgs{UserID: "user1", From: "2023-01-08T00:00:00Z", To: "2023-01-31T00:00:00Z", BgUnit: MmolL})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []ParameterComparison{
+			{
+				Name: HypoLimitParameter, Level: 1,
+				From: &ParameterValue{Value: "3.9", Unit: MmolL}, To: &ParameterValue{Value: "3.3", Unit: MmolL}, Changed: true,
+			},
+			{Name: "WEIGHT", Level: 1, From: &ParameterValue{Value: "70", Unit: "kg"}, To: &ParameterValue{Value: "72", Unit: "kg"}, Changed: true},
+			{Name: "MEAL_RATIO", Level: 2, From: &ParameterValue{Value: "10", Unit: "g"}, To: &ParameterValue{Value: "10", Unit: "g"}, Changed: false},
+			{Name: "TARGET", Level: 2, From: &ParameterValue{Value: "6.1", Unit: MmolL}, To: nil, Changed: true},
+		}, result.Parameters)
+	})
+
+	t.Run("should skip the parameters not set at both dates", func(t *testing.T) {
+		result, err := p.CompareParameters(testCtx, GetParametersArgs{UserID: "user1", From: "2023-01-02T00:00:00Z", To: "2023-01-03T00:00:00Z", Names: []string{"TARGET", "WEIGHT"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []ParameterComparison{
+			{Name: "WEIGHT", Level: 1, From: &ParameterValue{Value: "70", Unit: "kg"}, To: &ParameterValue{Value: "70", Unit: "kg"}, Changed: false},
+		}, result.Parameters)
+	})
+
+	t.Run("should only return the other levels to a trusted token", func(t *testing.T) {
+		args := GetParametersArgs{UserID: "user1", From: "2023-01-02T00:00:00Z", To: "2023-01-03T00:00:00Z", Levels: []int{3}}
+		result, err := p.CompareParameters(testCtx, args)
+
+		assert.Nil(t, result)
+		assert.Equal(t, errorParameterLevelsForbidden.Code, err.Code)
+
+		args.TrustedToken = true
+		result, err = p.CompareParameters(testCtx, args)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []ParameterComparison{
+			{Name: "PID_GAIN", Level: 3, From: &ParameterValue{Value: "4", Unit: ""}, To: &ParameterValue{Value: "4", Unit: ""}, Changed: false},
+		}, result.Parameters)
+	})
+
+	t.Run("should refuse a missing date", func(t *testing.T) {
+		result, err := p.CompareParameters(testCtx, GetParametersArgs{UserID: "user1", From: "2023-01-02T00:00:00Z"})
+
+		assert.Nil(t, result)
+		assert.Equal(t, http.StatusBadRequest, err.Status)
+	})
+}
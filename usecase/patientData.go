@@ -1,14 +1,12 @@
 package usecase
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
@@ -18,6 +16,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/tidepool-org/go-common/clients/mongo"
 	goComMgo "github.com/tidepool-org/go-common/clients/mongo"
+	internalSchema "github.com/tidepool-org/tide-whisperer/api/dto"
 	"github.com/tidepool-org/tide-whisperer/common"
 )
 
@@ -27,6 +26,13 @@ const (
 
 	MmolLToMgdLConversionFactor float64 = 18.01577
 	MmolLToMgdLPrecisionFactor  float64 = 10.0
+
+	// FormatJSON output the data as a JSON array
+	FormatJSON = "json"
+	// FormatNDJSON output the data as newline delimited JSON, one datum per line
+	FormatNDJSON = "ndjson"
+	// FormatCSV output the data as CSV, only available for exports
+	FormatCSV = "csv"
 )
 
 var (
@@ -52,10 +58,39 @@ type (
 		parametersHistory map[string]interface{}
 		// basalSecurityProfile
 		basalSecurityProfile interface{}
+		// basalSecurityProfiles the profiles applied during the requested window
+		basalSecurityProfiles []*internalSchema.Profile
 		// uploadIDs encountered during the operation
 		uploadIDs []string
 		// writeCount the number of data written
 		writeCount int
+		// format the output format: FormatJSON or FormatNDJSON
+		format string
+		// skipUploads do not write the upload data of the uploadIDs encountered
+		skipUploads bool
+		// schemaVersion when not nil, the schema version range of the upload data
+		schemaVersion *common.SchemaVersion
+		// parameterLevels the levels of the device parameters to write
+		parameterLevels []int
+		// bucketSources when not nil, the tide-v2 samples replaced by the data of a preferred cloud sync are not written
+		bucketSources *bucketSourceRanges
+		// limit when > 0, write only one page of data, see writePage()
+		limit int
+		// after the position of the requested page
+		after     *common.Cursor
+		afterTime time.Time
+		// nextCursor set by writePage() when more data are available
+		nextCursor string
+		// withLocalTime add the localTime field to the data, see addLocalTime()
+		withLocalTime bool
+		// location the requested timezone, for the data without timezone
+		location *time.Location
+		// locations cache of the data timezones
+		locations map[string]*time.Location
+		// fields when not nil, only write these fields of the data, see filterFields()
+		fields map[string]bool
+		// withTombstones write the tombstone of the inactive data, see getTombstone()
+		withTombstones bool
 		// datum decode errors
 		decode errorCounter
 		// datum JSON marshall errors
@@ -69,7 +104,7 @@ type (
 		RangeStart string `json:"rangeStart"`
 		// Last upload data date (ISO-8601 datetime)
 		RangeEnd string `json:"rangeEnd"`
-		// Number of days used to compute the TIR & TBR
+		// Number of days used to compute the TIR & TBR: the local days of the window having blood glucose values
 		ComputeDays int `json:"computeDays"`
 		// % of cbg/smbg in range (TIR)
 		PercentTimeInRange int `json:"percentTimeInRange"`
@@ -106,9 +141,6 @@ type (
 	}
 )
 
-// Parameters level to keep in api response
-var parameterLevelFilter = [...]int{1, 2}
-
 var dataFromStoreTimer = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:      "data_from_store_time",
 	Help:      "A histogram for getDataFromStore execution time (ms)",
@@ -117,6 +149,20 @@ var dataFromStoreTimer = promauto.NewHistogram(prometheus.HistogramOpts{
 	Namespace: "dblp",
 })
 
+const (
+	// schemaVersionCountInterval the minimum interval between two counts of the data of a patient
+	// excluded by their schema version, the count is a sample: it is not needed on each request
+	schemaVersionCountInterval = time.Hour
+	schemaVersionCountTimeout  = time.Minute
+)
+
+var schemaVersionFilteredCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name:      "schema_version_filtered_data_total",
+	Help:      "The number of data not returned because of their schema version, counted at most hourly per patient",
+	Subsystem: "tidewhisperer",
+	Namespace: "dblp",
+})
+
 var dataFromTideV2Timer = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:      "data_from_tidev2_time",
 	Help:      "A histogram for dataFromTideV2Timer execution time (ms)",
@@ -130,6 +176,18 @@ type PatientData struct {
 	tideV2Client          tideV2Client.ClientInterface
 	logger                *log.Logger
 	readBasalBucket       bool
+	// sourcePrecedence the rules applied where the data of several sources overlap
+	sourcePrecedence SourcePrecedence
+	// parameterLevels the levels of the device parameters returned by default, see SetParameterLevels
+	parameterLevels []int
+	// sourcesCache the sources of the patients recently read, see getPatientSources()
+	sourcesCache map[sourcesKey]*patientSources
+	sourcesMutex sync.Mutex
+	// schemaVersion the schema version range of the data to return, all the versions when nil, see SetSchemaVersion
+	schemaVersion *common.SchemaVersion
+	// schemaVersionCounts the time of the last count of each patient, see isSchemaVersionCountDue()
+	schemaVersionCounts map[string]time.Time
+	schemaVersionMutex  sync.Mutex
 }
 
 func NewPatientDataUseCase(logger *log.Logger, tideV2Client tideV2Client.ClientInterface, patientDataRepository PatientDataRepository, readBasalBucket bool) *PatientData {
@@ -177,11 +235,32 @@ func (p *PatientData) getBasalFromTideV2(ctx context.Context, wg *sync.WaitGroup
 	dataFromTideV2Timer.Observe(float64(elapsedTime))
 }
 
-func (p *PatientData) GetDataRangeLegacy(ctx context.Context, traceID string, userID string) (*common.Date, error) {
+// SetSchemaVersion set the schema version range of the data returned, used by all the reads of the database
+// unless they request all the schema versions. All the versions are returned when the range is not set (Maximum 0).
+func (p *PatientData) SetSchemaVersion(schemaVersion common.SchemaVersion) {
+	if schemaVersion.Maximum == 0 {
+		p.schemaVersion = nil
+		return
+	}
+	p.schemaVersion = &schemaVersion
+}
+
+// getSchemaVersion returns the schema version range of the data to read: the configured one,
+// nil for all the versions when allSchemaVersions is set
+func (p *PatientData) getSchemaVersion(allSchemaVersions bool) *common.SchemaVersion {
+	if allSchemaVersions {
+		return nil
+	}
+	return p.schemaVersion
+}
+
+// GetDataRangeLegacy returns the time range of the data of a user, in the configured schema version range
+// unless allSchemaVersions is set
+func (p *PatientData) GetDataRangeLegacy(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*common.Date, error) {
 	if userID == "" {
 		return nil, errors.New("user id is missing")
 	}
-	return p.patientDataRepository.GetDataRangeLegacy(ctx, traceID, userID)
+	return p.patientDataRepository.GetDataRangeLegacy(ctx, traceID, userID, p.getSchemaVersion(allSchemaVersions))
 }
 
 /*
@@ -209,17 +288,118 @@ type GetDataArgs struct {
 	WithParametersHistory      bool
 	FilteringParametersHistory bool
 	BgUnit                     string
+	// Format the output format, FormatJSON (default) or FormatNDJSON
+	Format string
+	// Types when not empty, only return the data of these types
+	Types []string
+	// SubTypes when not empty, only return the data of these sub types (data without sub type are not filtered)
+	SubTypes []string
+	// Limit when > 0, only return one page of Limit data, see GetDataPage()
+	Limit int
+	// Cursor the position of the requested page, as returned by GetDataPage()
+	Cursor string
+	// Timezone IANA timezone of StartDate & EndDate when they are given as local dates or datetimes
+	// (without offset), UTC ISO datetimes are expected by default
+	Timezone string
+	// WithLocalTime add the localTime field to the data: their wall clock time in their timezone
+	// (in Timezone for the data without one)
+	WithLocalTime bool
+	// Fields when not empty, only return these fields of the data, with their id, type & time
+	Fields []string
+	// ModifiedSince when set, only return the data created or modified after this time (ISO-8601 datetime),
+	// with a tombstone for the deleted ones, see getTombstone(). Can not be used with Limit.
+	ModifiedSince string
+	// RawSources the sources (carelink, dexcom, medtronic or all) for which the source precedence rules are
+	// not applied: their data are returned even where they overlap the data of a preferred source
+	RawSources []string
+	// AllSchemaVersions return the data of all the schema versions instead of the configured range, see SetSchemaVersion
+	AllSchemaVersions bool
+	// ParameterLevels when not empty, only return the device parameters of these levels instead of the configured ones
+	ParameterLevels []int
+	// TrustedToken the request is made with a server or clinician token, allowed to request any ParameterLevels
+	TrustedToken bool
+	// Validate when set, called with the validator of the data before they are written:
+	// nothing is written when it returns false (the client already has them)
+	Validate func(validator DataValidator) bool
+}
+
+// GetData write the patient data as a JSON array (or one JSON datum per line with FormatNDJSON) to res.
+//
+// Nothing is written when an error is returned before the data are fetched,
+// a failure during the write ends the array before returning the error.
+func (p *PatientData) GetData(ctx context.Context, args GetDataArgs, res io.Writer) *common.DetailedError {
+	_, err := p.getData(ctx, args, res)
+	return err
+}
+
+// GetDataPage write one page of args.Limit data, starting after args.Cursor, and returns the cursor of the next page
+// (empty for the last page).
+//
+// The data from the database and the tide-v2 buckets are merged in time order, so the pages are consistent across sources.
+// The pump settings and the parameters history are only part of the first page, the upload data are not part of the pages.
+func (p *PatientData) GetDataPage(ctx context.Context, args GetDataArgs, res io.Writer) (string, *common.DetailedError) {
+	return p.getData(ctx, args, res)
+}
+
+// CheckGetDataArgs returns the error GetData would return for invalid arguments, before fetching the data:
+// for the callers writing the data in the background (see Exporter)
+func (p *PatientData) CheckGetDataArgs(args GetDataArgs) *common.DetailedError {
+	location, errArgs := parseLocation(args.Timezone)
+	if errArgs == nil {
+		_, _, errArgs = localWindowDates(args.StartDate, args.EndDate, location)
+	}
+	if errArgs != nil {
+		return &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("CheckGetDataArgs", args.UserID, args.TraceID, errArgs.Error()),
+		}
+	}
+	_, err := p.getParameterLevels(args)
+	return err
 }
 
-func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buffer, *common.DetailedError) {
+func (p *PatientData) getData(ctx context.Context, args GetDataArgs, res io.Writer) (string, *common.DetailedError) {
 	common.TimeIt(ctx, "getData")
 	defer common.TimeEnd(ctx, "getData")
-	params, err := p.getDataV1Params(args.UserID, args.TraceID, args.StartDate, args.EndDate, p.readBasalBucket)
+	location, errArgs := parseLocation(args.Timezone)
+	startDate, endDate := args.StartDate, args.EndDate
+	if errArgs == nil {
+		startDate, endDate, errArgs = localWindowDates(args.StartDate, args.EndDate, location)
+	}
+	var modifiedSince time.Time
+	if errArgs == nil && args.ModifiedSince != "" {
+		modifiedSince, errArgs = parseModifiedSince(args)
+	}
+	sourceRules := p.sourcePrecedence
+	if errArgs == nil && len(args.RawSources) > 0 {
+		sourceRules, errArgs = sourceRules.withoutRawSources(args.RawSources)
+	}
+	if errArgs != nil {
+		return "", &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("getData", args.UserID, args.TraceID, errArgs.Error()),
+		}
+	}
+	parameterLevels, err := p.getParameterLevels(args)
+	if err != nil {
+		return "", err
+	}
+	params, err := p.getDataV1Params(args.UserID, args.TraceID, startDate, endDate, p.readBasalBucket)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	var pumpSettings *schemaV2.SettingsResult
 
+	// Do not fetch what is not requested
+	params.source["cbgBucket"] = params.source["cbgBucket"] && isTypeRequested(args.Types, "cbg")
+	params.source["basalBucket"] = params.source["basalBucket"] && isTypeRequested(args.Types, "basal")
+	withPumpSettings := args.WithPumpSettings && isTypeRequested(args.Types, "pumpSettings")
+	withParametersHistory := args.WithParametersHistory && isTypeRequested(args.Types, "deviceEvent") && isTypeRequested(args.SubTypes, "deviceParameter")
+
 	var exclusions = map[string]string{
 		"cbgBucket":   "cbg",
 		"basalBucket": "basal",
@@ -234,14 +414,107 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 		}
 	}
 	dates := &params.dates
+	schemaVersion := p.getSchemaVersion(args.AllSchemaVersions)
+	storeParams := &common.Params{
+		UserID:        args.UserID,
+		Date:          params.dates,
+		Types:         args.Types,
+		SubTypes:      args.SubTypes,
+		SchemaVersion: schemaVersion,
+		LevelFilter:   parameterLevels,
+	}
+
+	bucketSources, errSources := p.addSourcePrecedence(ctx, args.TraceID, args.UserID, sourceRules, storeParams)
+	if errSources != nil {
+		return "", &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("getData", args.UserID, args.TraceID, errSources.Error()),
+		}
+	}
 
 	writeParams := &params.writer
+	writeParams.format = args.Format
+	writeParams.schemaVersion = schemaVersion
+	writeParams.parameterLevels = parameterLevels
+	writeParams.bucketSources = bucketSources
+	writeParams.skipUploads = !isTypeRequested(args.Types, "upload")
+	writeParams.withLocalTime = args.WithLocalTime
+	writeParams.location = location
+	if len(args.Fields) > 0 {
+		writeParams.fields = newFieldsFilter(args.Fields, args.WithLocalTime)
+		storeParams.Fields = append(append([]string{}, args.Fields...), dataPreparationFields...)
+	}
+	if args.ModifiedSince != "" {
+		storeParams.ModifiedSince = modifiedSince.UTC().Format(cursorTimeFormat)
+		writeParams.withTombstones = true
+		if writeParams.fields != nil {
+			writeParams.fields["deleted"] = true
+			writeParams.fields["modifiedTime"] = true
+		}
+		// The settings have no modification time, they are not part of the incremental sync
+		withPumpSettings = false
+		withParametersHistory = false
+		// The tide-v2 buckets are only known by their day: the ones since the checkpoint day are returned whole
+		sinceDay := modifiedSince.UTC().Truncate(24 * time.Hour)
+		if sinceDay.After(params.startTime) {
+			dates.Start = sinceDay.Format(cursorTimeFormat)
+		}
+	}
+
+	if args.Limit > 0 {
+		writeParams.limit = args.Limit
+		// The upload data are not in the (time, id) order of the pages, see GetUploads
+		writeParams.skipUploads = true
+		// One more to know if there is a next page
+		storeParams.Limit = args.Limit + 1
+		if args.Cursor != "" {
+			after, afterTime, errCursor := decodeCursor(args.Cursor)
+			if errCursor != nil {
+				return "", &common.DetailedError{
+					Status:          errorInvalidParameters.Status,
+					Code:            errorInvalidParameters.Code,
+					Message:         errorInvalidParameters.Message,
+					InternalMessage: addContextToMessage("getData", args.UserID, args.TraceID, errCursor.Error()),
+				}
+			}
+			writeParams.after = after
+			writeParams.afterTime = afterTime
+			storeParams.After = after
+			// No need to fetch the buckets before the cursor
+			if afterTime.After(params.startTime) {
+				dates.Start = after.Time
+			}
+			withPumpSettings = false
+			withParametersHistory = false
+		}
+	}
 
-	if args.WithPumpSettings || args.WithParametersHistory {
+	// Before fetching the data: nothing to fetch when the client already has them
+	if args.Validate != nil {
+		withTideV2 := params.source["cbgBucket"] || params.source["basalBucket"] || withPumpSettings
+		stateParams := &common.Params{UserID: args.UserID, Date: *dates, SchemaVersion: schemaVersion}
+		validator, errValidator := p.getDataValidator(ctx, args.TraceID, stateParams, nil, withTideV2)
+		if errValidator != nil {
+			return "", errValidator
+		}
+		if !args.Validate(*validator) {
+			return "", nil
+		}
+	}
+
+	if withPumpSettings || withParametersHistory {
 		pumpSettings, err = p.getLatestPumpSettings(ctx, args.TraceID, args.UserID, writeParams, args.SessionToken)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+		// For a window in the past, the settings effective at its end
+		if pumpSettings != nil && endDate != "" && params.endTime.Before(time.Now()) {
+			pumpSettings = p.getPumpSettingsAsOf(ctx, args.TraceID, args.UserID, pumpSettings, writeParams, params.endTime)
+		}
+		pumpSettings = filterParameterLevels(pumpSettings, parameterLevels)
+		writeParams.basalSecurityProfiles = p.getBasalSecurityProfiles(ctx, args.TraceID, args.UserID, params.startTime, params.endTime)
 	}
 
 	// Fetch data from patientData and V2 API (for cbg)
@@ -249,7 +522,7 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 	var wg sync.WaitGroup
 	// Parallel routines
 	wg.Add(1)
-	go p.getDataFromStore(ctx, &wg, args.TraceID, args.UserID, dates, exclusionList, channel)
+	go p.getDataFromStore(ctx, &wg, args.TraceID, storeParams, exclusionList, channel)
 
 	if params.source["cbgBucket"] {
 		wg.Add(1)
@@ -259,6 +532,10 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 		wg.Add(1)
 		go p.getBasalFromTideV2(ctx, &wg, args.TraceID, args.UserID, args.SessionToken, dates, channel)
 	}
+	if storeParams.SchemaVersion != nil && p.isSchemaVersionCountDue(args.UserID) {
+		// Not waited for: the count does not delay the response
+		go p.countSchemaVersionFiltered(context.WithoutCancel(ctx), args.TraceID, *storeParams)
+	}
 
 	/*To stop the range loop reading channels once all data are read from it*/
 	/*This is due to the fact that writing into a channel will terminate once a read is done
@@ -276,7 +553,7 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 	for chanData := range channel {
 		switch d := chanData.(type) {
 		case *common.DetailedError:
-			return nil, d
+			return "", d
 		case goComMgo.StorageIterator:
 			iterData = d
 		case []schemaV2.CbgBucket:
@@ -289,11 +566,12 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 
 	defer iterData.Close(ctx)
 
-	return p.writeDataToBuffer(
+	err = p.writeData(
 		ctx,
+		res,
 		args.TraceID,
-		args.WithPumpSettings,
-		args.WithParametersHistory,
+		withPumpSettings,
+		withParametersHistory,
 		pumpSettings,
 		iterData,
 		cbgs,
@@ -304,18 +582,19 @@ func (p *PatientData) GetData(ctx context.Context, args GetDataArgs) (*bytes.Buf
 		params.startTime,
 		params.endTime,
 	)
+	return writeParams.nextCursor, err
 }
 
-func (p *PatientData) getDataFromStore(ctx context.Context, wg *sync.WaitGroup, traceID string, userID string, dates *common.Date, excludes []string, channel chan interface{}) {
+func (p *PatientData) getDataFromStore(ctx context.Context, wg *sync.WaitGroup, traceID string, params *common.Params, excludes []string, channel chan interface{}) {
 	defer wg.Done()
 	start := time.Now()
-	data, err := p.patientDataRepository.GetDataInDeviceData(ctx, traceID, userID, dates, excludes)
+	data, err := p.patientDataRepository.GetDataInDeviceData(ctx, traceID, params, excludes)
 	if err != nil {
 		channel <- &common.DetailedError{
 			Status:          errorRunningQuery.Status,
 			Code:            errorRunningQuery.Code,
 			Message:         errorRunningQuery.Message,
-			InternalMessage: addContextToMessage("getDataFromStore", userID, traceID, err.Error()),
+			InternalMessage: addContextToMessage("getDataFromStore", params.UserID, traceID, err.Error()),
 		}
 	} else {
 		channel <- data
@@ -324,18 +603,53 @@ func (p *PatientData) getDataFromStore(ctx context.Context, wg *sync.WaitGroup,
 	dataFromStoreTimer.Observe(float64(elapsedTime))
 }
 
-// writeFromIterV1 Common code to write
-func writeFromIterV1(ctx context.Context, res *bytes.Buffer, bgUnit string, p *writeFromIter) error {
-	var err error
+// isSchemaVersionCountDue returns true when the data of a patient excluded by their schema version
+// were not counted for schemaVersionCountInterval, and records the count as done
+func (p *PatientData) isSchemaVersionCountDue(userID string) bool {
+	now := time.Now()
+	p.schemaVersionMutex.Lock()
+	defer p.schemaVersionMutex.Unlock()
+	if p.schemaVersionCounts == nil {
+		p.schemaVersionCounts = make(map[string]time.Time)
+	}
+	if lastCount, found := p.schemaVersionCounts[userID]; found && now.Sub(lastCount) < schemaVersionCountInterval {
+		return false
+	}
+	for countedUserID, lastCount := range p.schemaVersionCounts {
+		if now.Sub(lastCount) >= schemaVersionCountInterval {
+			delete(p.schemaVersionCounts, countedUserID)
+		}
+	}
+	p.schemaVersionCounts[userID] = now
+	return true
+}
+
+// countSchemaVersionFiltered report the number of data of the request excluded by their schema version,
+// to plan the data migrations. It runs aside of the request, see isSchemaVersionCountDue().
+func (p *PatientData) countSchemaVersionFiltered(ctx context.Context, traceID string, params common.Params) {
+	ctx, cancel := context.WithTimeout(ctx, schemaVersionCountTimeout)
+	defer cancel()
+	count, err := p.patientDataRepository.CountSchemaVersionFiltered(ctx, traceID, &params)
+	if err != nil {
+		// Just log the problem, the data are not impacted
+		p.logger.Printf("{%s} - {CountSchemaVersionFiltered:\"%s\"}", traceID, err)
+		return
+	}
+	if count > 0 {
+		p.logger.Printf("{%s} - {user:\"%s\", schemaVersionFiltered:%d}", traceID, params.UserID, count)
+		schemaVersionFilteredCounter.Add(float64(count))
+	}
+}
 
+// writeFromIterV1 Common code to write
+func writeFromIterV1(ctx context.Context, res io.Writer, bgUnit string, p *writeFromIter) error {
 	iter := p.iter
 	p.iter = nil
 
 	for iter.Next(ctx) {
-		var jsonDatum []byte
 		var datum map[string]interface{}
 
-		err = iter.Decode(&datum)
+		err := iter.Decode(&datum)
 		if err != nil {
 			p.decode.numErrors++
 			if p.decode.firstError == nil {
@@ -343,112 +657,83 @@ func writeFromIterV1(ctx context.Context, res *bytes.Buffer, bgUnit string, p *w
 			}
 			continue
 		}
-		if len(datum) > 0 {
-			datumID, haveID := datum["id"].(string)
-			if !haveID {
-				// Ignore datum with no id, should never happend
-				continue
-			}
-
-			// temp code for a DBGL1 release, allow to no change the front
-			datumGuid, haveGuId := datum["guid"].(string)
-			if haveGuId {
-				datum["eventId"] = datumGuid
-			}
-
-			datumType, haveType := datum["type"].(string)
-			if !haveType {
-				// Ignore datum with no type, should never happend
-				continue
-			}
-			uploadID, haveUploadID := datum["uploadId"].(string)
-			if !haveUploadID {
-				// No upload ID, abnormal situation
-				continue
-			}
-			if datumType == "deviceEvent" {
-				datumSubType, haveSubType := datum["subType"].(string)
-				if haveSubType && datumSubType == "deviceParameter" {
-					datumLevel, haveLevel := datum["level"]
-					if haveLevel {
-						intLevel, err := strconv.Atoi(fmt.Sprintf("%v", datumLevel))
-						if err == nil && !common.ContainsInt(parameterLevelFilter[:], intLevel) {
-							continue
-						}
-					}
+		if p.withTombstones {
+			if tombstone := getTombstone(datum); tombstone != nil {
+				if err := p.writeDatum(res, tombstone); err != nil {
+					return err
 				}
+				continue
 			}
-			// Record the uploadID
-			if !(datumType == "upload" && uploadID == datumID) {
-				if !common.Contains(p.uploadIDs, uploadID) {
-					p.uploadIDs = append(p.uploadIDs, uploadID)
-				}
+		}
+		if len(datum) > 0 && p.prepareDatum(datum, bgUnit) {
+			if err := p.writeDatum(res, datum); err != nil {
+				return err
 			}
+		} // else ignore
+	}
+	return iterErr(iter)
+}
 
-			if datumType == "pumpSettings" && (p.parametersHistory != nil || p.basalSecurityProfile != nil) {
-				payload := datum["payload"].(map[string]interface{})
-
-				// Add the parameter history to the pump settings
-				if p.parametersHistory != nil {
-					payload["history"] = p.parametersHistory["history"]
-				}
+// prepareDatum update a datum read from the database before it is written: record its uploadID,
+// add the history to the pump settings and convert the units.
+// Returns false if the datum must be ignored.
+func (p *writeFromIter) prepareDatum(datum map[string]interface{}, bgUnit string) bool {
+	datumID, haveID := datum["id"].(string)
+	if !haveID {
+		// Ignore datum with no id, should never happend
+		return false
+	}
 
-				// Add the basal security profile to the pump settings
-				if p.basalSecurityProfile != nil {
-					payload["basalsecurityprofile"] = p.basalSecurityProfile
-				}
+	// temp code for a DBGL1 release, allow to no change the front
+	datumGuid, haveGuId := datum["guid"].(string)
+	if haveGuId {
+		datum["eventId"] = datumGuid
+	}
 
-				datum["payload"] = payload
+	datumType, haveType := datum["type"].(string)
+	if !haveType {
+		// Ignore datum with no type, should never happend
+		return false
+	}
+	uploadID, haveUploadID := datum["uploadId"].(string)
+	if !haveUploadID {
+		// No upload ID, abnormal situation
+		return false
+	}
+	if datumType == "deviceEvent" {
+		datumSubType, haveSubType := datum["subType"].(string)
+		if haveSubType && datumSubType == "deviceParameter" {
+			if !isParameterLevelKept(datum, p.parameterLevels) {
+				return false
 			}
+		}
+	}
+	// Record the uploadID
+	if !(datumType == "upload" && uploadID == datumID) {
+		if !common.Contains(p.uploadIDs, uploadID) {
+			p.uploadIDs = append(p.uploadIDs, uploadID)
+		}
+	}
 
-			/*perform mmol -> mgdl conversion if needed*/
-			if bgUnit != "" {
-				switch datum["type"] {
-				case "smbg":
-					if datum["units"] != bgUnit && isConvertibleUnit(datum["units"].(string)) {
-						if datum["units"] == MmolL {
-							datum["units"] = MgdL
-							datum["value"] = convertToMgdl(datum["value"].(float64))
-						} else {
-							datum["units"] = MmolL
-							datum["value"] = convertToMmol(datum["value"].(float64))
-						}
-					}
-				case "wizard":
-					/*For wizard, we don't have anymore fields in mmol, so we're changing the unit but no conversion is done.
-					The associated bolus is separated and will be converted in another function.*/
-					if datum["units"] != bgUnit {
-						if datum["units"] == MmolL {
-							datum["units"] = MgdL
-						} else {
-							datum["units"] = MmolL
-						}
-					}
-				}
-			}
+	if datumType == "pumpSettings" && (p.parametersHistory != nil || p.basalSecurityProfile != nil || p.basalSecurityProfiles != nil) {
+		payload := datum["payload"].(map[string]interface{})
 
-			// Create the JSON string for this datum
-			if jsonDatum, err = json.Marshal(datum); err != nil {
-				if p.jsonError.firstError == nil {
-					p.jsonError.firstError = err
-				}
-				p.jsonError.numErrors++
-				continue
-			}
+		// Add the parameter history to the pump settings
+		if p.parametersHistory != nil {
+			payload["history"] = p.parametersHistory["history"]
+		}
 
-			if p.writeCount > 0 {
-				// Add the coma and line return (for readability)
-				_, err = res.WriteString(",\n")
-				if err != nil {
-					return err
-				}
-			}
-			_, err = res.Write(jsonDatum)
-			if err != nil {
-				return err
-			}
-			p.writeCount++
-		} // else ignore
+		// Add the basal security profile to the pump settings
+		if p.basalSecurityProfile != nil {
+			payload["basalsecurityprofile"] = p.basalSecurityProfile
+		}
+		if p.basalSecurityProfiles != nil {
+			payload["basalsecurityprofiles"] = p.basalSecurityProfiles
+		}
+
+		datum["payload"] = payload
 	}
-	return nil
+
+	convertDatumUnits(datum, bgUnit)
+	return true
 }
@@ -3,6 +3,7 @@ package usecase
 import (
 	"bytes"
 	"context"
+	"errors"
 	"log"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	orcaSchema "github.com/mdblp/orca/schema"
 	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
 	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/tidepool-org/tide-whisperer/common"
@@ -38,6 +40,8 @@ var (
 `
 	oneCbgResultMmol = `[
 {"id":"cbg_cbg1_0","time":"2023-04-01T12:32:00Z","timezone":"UTC","type":"cbg","units":"mmol/L","value":10}]
+`
+	oneCbgResultNDJSON = `{"id":"cbg_cbg1_0","time":"2023-04-01T12:32:00Z","timezone":"UTC","type":"cbg","units":"mmol/L","value":10}
 `
 )
 
@@ -176,6 +180,44 @@ func TestPatientData_GetData(t *testing.T) {
 				expectParameterAreNotConverted,
 			},
 		},
+		{
+			name: "should write one datum per line when format is ndjson",
+			given: []func(patientDataGiven) patientDataGiven{
+				paramBgUnitMmol,
+				paramFormatNDJSON,
+				noDeviceDataReturnedByRepository,
+				oneCbgReturnedInMmolByTideV2,
+			},
+			expected: []func(*testing.T, patientDataExpected){
+				expectErrIsNil,
+				expectCbgResultIsNDJSON,
+			},
+		},
+		{
+			name: "should only fetch the requested types",
+			given: []func(patientDataGiven) patientDataGiven{
+				paramBgUnitMmol,
+				paramTypesSmbg,
+				noDeviceDataReturnedByRepositoryForTypesSmbg,
+				oneCbgReturnedInMmolByTideV2,
+			},
+			expected: []func(*testing.T, patientDataExpected){
+				expectErrIsNil,
+				expectResultIsEmptyArray,
+			},
+		},
+		{
+			name: "should not write anything when device data cannot be fetched",
+			given: []func(patientDataGiven) patientDataGiven{
+				paramBgUnitMgdl,
+				errorReturnedByRepository,
+				nothingReturnedByTideV2,
+			},
+			expected: []func(*testing.T, patientDataExpected){
+				expectErrIsNotNil,
+				expectResultIsEmpty,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -189,7 +231,8 @@ func TestPatientData_GetData(t *testing.T) {
 				logger:                given.logger,
 				readBasalBucket:       given.readBasalBucket,
 			}
-			res, err := p.GetData(testCtx, given.getDataArgs)
+			res := &bytes.Buffer{}
+			err := p.GetData(testCtx, given.getDataArgs, res)
 			expected := patientDataExpected{
 				err:    err,
 				result: res,
@@ -207,6 +250,18 @@ func expectErrIsNil(t *testing.T, p patientDataExpected) {
 	assert.Nil(t, p.err)
 }
 
+func expectErrIsNotNil(t *testing.T, p patientDataExpected) {
+	assert.NotNil(t, p.err)
+}
+
+func expectResultIsEmpty(t *testing.T, p patientDataExpected) {
+	assert.Equal(t, 0, p.result.Len())
+}
+
+func expectResultIsEmptyArray(t *testing.T, p patientDataExpected) {
+	assert.Equal(t, "[\n]\n", p.result.String())
+}
+
 func expectCbgResultIsInMgdl(t *testing.T, p patientDataExpected) {
 	assert.Equal(t, oneCbgResultMgdl, p.result.String())
 }
@@ -215,6 +270,10 @@ func expectCbgResultIsInMmol(t *testing.T, p patientDataExpected) {
 	assert.Equal(t, oneCbgResultMmol, p.result.String())
 }
 
+func expectCbgResultIsNDJSON(t *testing.T, p patientDataExpected) {
+	assert.Equal(t, oneCbgResultNDJSON, p.result.String())
+}
+
 func expectSmbgResultIsInMgdl(t *testing.T, p patientDataExpected) {
 	unexpectedUnits := MmolL
 	/*convert smbg1 and smbg2 because given is mmol*/
@@ -297,6 +356,16 @@ func paramBgUnitMmol(p patientDataGiven) patientDataGiven {
 	return p
 }
 
+func paramFormatNDJSON(p patientDataGiven) patientDataGiven {
+	p.getDataArgs.Format = FormatNDJSON
+	return p
+}
+
+func paramTypesSmbg(p patientDataGiven) patientDataGiven {
+	p.getDataArgs.Types = []string{"smbg"}
+	return p
+}
+
 func paramBgUnitEmpty(p patientDataGiven) patientDataGiven {
 	p.getDataArgs.BgUnit = ""
 	return p
@@ -310,6 +379,7 @@ func mockGetLatestBasalSecurityProfileWithDummyReturn(p patientDataGiven) patien
 		Guid:          "osefduguid",
 		BasalSchedule: nil,
 	}, nil)
+	p.patientDataRepository.(*MockPatientDataRepository).On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, p.getDataArgs.UserID, mock.Anything, mock.Anything).Return(nil, nil)
 	return p
 }
 
@@ -340,16 +410,37 @@ func paramEndDate5MinAgo(p patientDataGiven) patientDataGiven {
 
 func noDeviceDataReturnedByRepository(p patientDataGiven) patientDataGiven {
 	patientDataRepository := MockPatientDataRepository{}
-	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
+	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
+		infrastructure.NewEmptyMockDbAdapterIterator(),
+		nil,
+	)
+	p.patientDataRepository = &patientDataRepository
+	return p
+}
+func noDeviceDataReturnedByRepositoryForTypesSmbg(p patientDataGiven) patientDataGiven {
+	patientDataRepository := MockPatientDataRepository{}
+	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.MatchedBy(func(params *common.Params) bool {
+		return len(params.Types) == 1 && params.Types[0] == "smbg"
+	}), mock.Anything).Return(
 		infrastructure.NewEmptyMockDbAdapterIterator(),
 		nil,
 	)
 	p.patientDataRepository = &patientDataRepository
 	return p
 }
+func errorReturnedByRepository(p patientDataGiven) patientDataGiven {
+	patientDataRepository := MockPatientDataRepository{}
+	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
+		nil,
+		errors.New("connection lost"),
+	)
+	p.patientDataRepository = &patientDataRepository
+	return p
+}
+
 func smbgReturnedByRepository(p patientDataGiven) patientDataGiven {
 	patientDataRepository := MockPatientDataRepository{}
-	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
+	patientDataRepository.On("GetDataInDeviceData", mock.Anything, mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
 		infrastructure.NewMockDbAdapterIterator([]string{
 			"{\"id\":\"1\",\"_userId\":\"user01\",\"uploadId\":\"upload01\",\"time\":\"2021-01-10T00:00:01.000Z\",\"timezone\":\"Europe/Paris\",\"type\":\"smbg\",\"units\":\"mmol/L\",\"value\":10}",
 			"{\"id\":\"2\",\"_userId\":\"user01\",\"uploadId\":\"upload01\",\"time\":\"2021-01-10T00:05:01.000Z\",\"timezone\":\"Europe/Paris\",\"type\":\"smbg\",\"units\":\"mmol/L\",\"value\":15}",
@@ -357,7 +448,7 @@ func smbgReturnedByRepository(p patientDataGiven) patientDataGiven {
 		}),
 		nil,
 	)
-	patientDataRepository.On("GetUploadData", mock.Anything, p.getDataArgs.TraceID, []string{"upload01"}).Return(
+	patientDataRepository.On("GetUploadData", mock.Anything, p.getDataArgs.TraceID, []string{"upload01"}, mock.Anything).Return(
 		infrastructure.NewMockDbAdapterIterator([]string{
 			"{\"time\":\"2022-08-08T16:40:00Z\",\"type\":\"upload\",\"id\":\"upload01\",\"timezone\":\"UTC\",\"_dataState\":\"open\",\"_deduplicator\":{\"name\":\"org.tidepool.deduplicator.none\",\"version\":\"1.0.0\"},\"_state\":\"open\",\"client\":{\"name\":\"portal-api.yourloops.com\",\"version\":\"1.0.0\" },\"dataSetType\":\"continuous\",\"deviceManufacturers\":[\"Diabeloop\"],\"deviceModel\":\"DBLG1\",\"deviceTags\":[\"cgm\",\"insulin-pump\"],\"revision\": 1,\"uploadId\":\"33031f76c78461670a1a95b5f032bb6a\",\"version\":\"1.0.0\",\"_userId\":\"osef\"}",
 		}),
@@ -531,3 +622,120 @@ func emptyPatientDataGiven(userid string) patientDataGiven {
 		},
 	}
 }
+
+func TestPatientData_GetData_schemaVersion(t *testing.T) {
+	userID := "userid_test_schema"
+	schemaVersion := common.SchemaVersion{Minimum: 1, Maximum: 99}
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg"},
+		Format: FormatNDJSON,
+	}
+
+	t.Run("should filter the data and count the excluded ones", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return assert.ObjectsAreEqual(&schemaVersion, params.SchemaVersion)
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		repository.On("CountSchemaVersionFiltered", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.UserID == userID && assert.ObjectsAreEqual(&schemaVersion, params.SchemaVersion)
+		})).Return(int64(3), nil)
+		logs := &bytes.Buffer{}
+		p := NewPatientDataUseCase(log.New(logs, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSchemaVersion(schemaVersion)
+		filtered := testutil.ToFloat64(schemaVersionFilteredCounter)
+
+		err := p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.Nil(t, err)
+		// The count is not waited for by the request
+		assert.Eventually(t, func() bool {
+			return testutil.ToFloat64(schemaVersionFilteredCounter) == filtered+3
+		}, time.Second, time.Millisecond)
+		assert.Contains(t, logs.String(), "schemaVersionFiltered:3")
+
+		// Counted once per interval
+		err = p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertNumberOfCalls(t, "CountSchemaVersionFiltered", 1)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should not count the data when all the versions are requested", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.SchemaVersion == nil
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSchemaVersion(schemaVersion)
+		allArgs := args
+		allArgs.AllSchemaVersions = true
+
+		err := p.GetData(testCtx, allArgs, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertNotCalled(t, "CountSchemaVersionFiltered", mock.Anything, mock.Anything, mock.Anything)
+		repository.AssertExpectations(t)
+	})
+}
+
+func TestPatientData_GetData_iteratorError(t *testing.T) {
+	newRepository := func() *MockPatientDataRepository {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewFailingMockDbAdapterIterator([]string{
+			`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T12:00:00.000Z","units":"mmol/L","value":5}`,
+		}, errors.New("connection lost")), nil)
+		return repository
+	}
+	args := GetDataArgs{UserID: "userid_test_iterator", Types: []string{"smbg"}}
+
+	t.Run("should end the array and fail when the cursor fails in the middle of the data", func(t *testing.T) {
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, newRepository(), false)
+		buffer := &bytes.Buffer{}
+
+		err := p.GetData(testCtx, args, buffer)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+		assert.Contains(t, err.InternalMessage, "connection lost")
+		assert.JSONEq(t, `[{"id":"smbg1","time":"2023-04-01T12:00:00.000Z","type":"smbg","units":"mmol/L","uploadId":"upload1","value":5}]`, buffer.String())
+	})
+
+	t.Run("should fail a page when the cursor fails in the middle of the data", func(t *testing.T) {
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, newRepository(), false)
+		pageArgs := args
+		pageArgs.Limit = 10
+		pageArgs.Format = FormatNDJSON
+		buffer := &bytes.Buffer{}
+
+		nextCursor, err := p.GetDataPage(testCtx, pageArgs, buffer)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+		assert.Empty(t, nextCursor)
+		assert.Empty(t, buffer.String())
+	})
+}
+
+func TestPatientData_CheckGetDataArgs(t *testing.T) {
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &MockPatientDataRepository{}, false)
+	tests := []struct {
+		name         string
+		args         GetDataArgs
+		expectedCode string
+	}{
+		{"Valid arguments", GetDataArgs{UserID: "user1", Timezone: "Europe/Paris", StartDate: "2023-04-01", ParameterLevels: []int{1}}, ""},
+		{"Invalid timezone", GetDataArgs{UserID: "user1", Timezone: "Mars/Olympus"}, errorInvalidParameters.Code},
+		{"Invalid local date", GetDataArgs{UserID: "user1", Timezone: "Europe/Paris", StartDate: "04/01/2023"}, errorInvalidParameters.Code},
+		{"Forbidden levels", GetDataArgs{UserID: "user1", ParameterLevels: []int{3}}, errorParameterLevelsForbidden.Code},
+		{"Levels of a trusted token", GetDataArgs{UserID: "user1", ParameterLevels: []int{3}, TrustedToken: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckGetDataArgs(tt.args)
+			if tt.expectedCode == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, tt.expectedCode, err.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// getPumpSettingsAsOf returns the pump settings effective at asOf, rebuilt from the current ones.
+//
+// The parameters are rebuilt from their history, the basal security profile is the one in effect at asOf,
+// and the device is the one of the last pump upload before asOf when the patient changed of device since.
+// The writer basal security profile is updated accordingly.
+func (p *PatientData) getPumpSettingsAsOf(ctx context.Context, traceID string, userID string, settings *schemaV2.SettingsResult, writer *writeFromIter, asOf time.Time) *schemaV2.SettingsResult {
+	common.TimeIt(ctx, "getPumpSettingsAsOf")
+	defer common.TimeEnd(ctx, "getPumpSettingsAsOf")
+
+	settings = settingsAsOf(settings, asOf)
+
+	profiles, err := p.patientDataRepository.GetBasalSecurityProfiles(ctx, traceID, userID, asOf, asOf)
+	if err != nil {
+		p.logger.Printf("{%s} - {GetBasalSecurityProfiles:\"%s\"}", traceID, err)
+	} else if len(profiles) > 0 {
+		writer.basalSecurityProfile = TransformToExposedModel(&profiles[len(profiles)-1])
+	} else {
+		writer.basalSecurityProfile = nil
+	}
+
+	if settings.CurrentSettings.Device == nil {
+		return settings
+	}
+	uploads, err := p.patientDataRepository.GetUploads(ctx, traceID, userID)
+	if err != nil {
+		p.logger.Printf("{%s} - {GetUploads:\"%s\"}", traceID, err)
+		return settings
+	}
+	// The uploads are the newest first
+	for _, upload := range uploads {
+		uploadTime, errTime := time.Parse(time.RFC3339Nano, upload.Time)
+		if errTime != nil || uploadTime.After(asOf) || upload.DeviceID == "" || !common.Contains(upload.DeviceTags, "insulin-pump") {
+			continue
+		}
+		if upload.DeviceID != settings.CurrentSettings.Device.DeviceID {
+			// The pump & CGM of a previous device are not known
+			device := &orcaSchema.Device{DeviceID: upload.DeviceID, Name: upload.DeviceModel}
+			if len(upload.DeviceManufacturers) > 0 {
+				device.Manufacturer = upload.DeviceManufacturers[0]
+			}
+			settings.CurrentSettings.Device = device
+			settings.CurrentSettings.Pump = nil
+			settings.CurrentSettings.Cgm = nil
+		}
+		break
+	}
+	return settings
+}
+
+// settingsAsOf returns a copy of the settings effective at asOf: the parameter changes made after it
+// are replayed backwards from the current parameters. The history is left unchanged, the deviceParameter
+// events and the pumpSettings history are filtered by the data window, if requested.
+func settingsAsOf(settings *schemaV2.SettingsResult, asOf time.Time) *schemaV2.SettingsResult {
+	type parameterKey struct {
+		name  string
+		level int
+	}
+	parameters := make(map[parameterKey]orcaSchema.CurrentParameter, len(settings.CurrentSettings.Parameters))
+	keys := make([]parameterKey, 0, len(settings.CurrentSettings.Parameters))
+	for _, parameter := range settings.CurrentSettings.Parameters {
+		key := parameterKey{name: parameter.Name, level: parameter.Level}
+		parameters[key] = parameter
+		keys = append(keys, key)
+	}
+
+	changes := sortedParameterChanges(settings.HistoryParameters)
+	lastEffectiveDates := make(map[parameterKey]time.Time)
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		key := parameterKey{name: change.Name, level: change.Level}
+		effectiveDate := getEffectiveDate(change)
+		if !effectiveDate.After(asOf) {
+			if _, found := lastEffectiveDates[key]; !found {
+				lastEffectiveDates[key] = effectiveDate
+			}
+			continue
+		}
+		switch change.ChangeType {
+		case orcaSchema.ADDED:
+			delete(parameters, key)
+		case orcaSchema.DELETED:
+			if _, found := parameters[key]; !found {
+				keys = append(keys, key)
+			}
+			parameters[key] = orcaSchema.CurrentParameter{Name: change.Name, Value: change.Value, Unit: change.Unit, Level: change.Level}
+		default:
+			if change.PreviousValue != "" {
+				if _, found := parameters[key]; !found {
+					keys = append(keys, key)
+				}
+				parameters[key] = orcaSchema.CurrentParameter{Name: change.Name, Value: change.PreviousValue, Unit: change.PreviousUnit, Level: change.Level}
+			}
+		}
+	}
+
+	rebuilt := make([]orcaSchema.CurrentParameter, 0, len(parameters))
+	done := make(map[parameterKey]bool, len(parameters))
+	for _, key := range keys {
+		parameter, found := parameters[key]
+		if !found || done[key] {
+			continue
+		}
+		done[key] = true
+		if effectiveDate, changed := lastEffectiveDates[key]; changed {
+			parameter.EffectiveDate = &effectiveDate
+		} else if parameter.EffectiveDate != nil && parameter.EffectiveDate.After(asOf) {
+			parameter.EffectiveDate = nil
+		}
+		rebuilt = append(rebuilt, parameter)
+	}
+
+	result := *settings
+	result.CurrentSettings.Parameters = rebuilt
+	if result.Time != nil && result.Time.After(asOf) {
+		settingsTime := asOf
+		result.Time = &settingsTime
+	}
+	return &result
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	internalSchema "github.com/tidepool-org/tide-whisperer/api/dto"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+func TestSettingsAsOf(t *testing.T) {
+	day := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		date := day.AddDate(0, 0, days)
+		return &date
+	}
+	change := func(name string, changeType string, value string, previousValue string, days int) orcaSchema.HistoryParameter {
+		return orcaSchema.HistoryParameter{
+			CurrentParameter: orcaSchema.CurrentParameter{Name: name, Value: value, Unit: "kg", Level: 1, EffectiveDate: at(days)},
+			ChangeType:       changeType,
+			PreviousValue:    previousValue,
+			PreviousUnit:     "kg",
+			Timestamp:        *at(days),
+		}
+	}
+	settings := &tideV2Schema.SettingsResult{}
+	settings.Time = at(100)
+	settings.CurrentSettings.Parameters = []orcaSchema.CurrentParameter{
+		{Name: "WEIGHT", Value: "80", Unit: "kg", Level: 1, EffectiveDate: at(50)},
+		{Name: "HEIGHT", Value: "180", Unit: "cm", Level: 1, EffectiveDate: at(0)},
+		{Name: "NEW", Value: "1", Unit: "kg", Level: 1, EffectiveDate: at(40)},
+	}
+	settings.HistoryParameters = []orcaSchema.HistoryParameter{
+		change("WEIGHT", orcaSchema.UPDATED, "80", "75", 50),
+		change("WEIGHT", orcaSchema.UPDATED, "75", "70", 20),
+		change("WEIGHT", orcaSchema.ADDED, "70", "", 0),
+		change("NEW", orcaSchema.ADDED, "1", "", 40),
+		change("OLD", orcaSchema.DELETED, "3", "", 30),
+	}
+
+	result := settingsAsOf(settings, *at(25))
+
+	assert.Equal(t, []orcaSchema.CurrentParameter{
+		{Name: "WEIGHT", Value: "75", Unit: "kg", Level: 1, EffectiveDate: at(20)},
+		{Name: "HEIGHT", Value: "180", Unit: "cm", Level: 1, EffectiveDate: at(0)},
+		{Name: "OLD", Value: "3", Unit: "kg", Level: 1},
+	}, result.CurrentSettings.Parameters)
+	assert.Equal(t, at(25), result.Time)
+	assert.Equal(t, settings.HistoryParameters, result.HistoryParameters)
+	// The current settings are unchanged
+	assert.Len(t, settings.CurrentSettings.Parameters, 3)
+	assert.Equal(t, "80", settings.CurrentSettings.Parameters[0].Value)
+	assert.Equal(t, at(100), settings.Time)
+}
+
+func TestPatientData_getPumpSettingsAsOf(t *testing.T) {
+	asOf := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+	newSettings := func() *tideV2Schema.SettingsResult {
+		settings := &tideV2Schema.SettingsResult{}
+		settings.CurrentSettings.Device = &orcaSchema.Device{DeviceID: "handset2", Name: "DBLG2"}
+		settings.CurrentSettings.Pump = &orcaSchema.Pump{Name: "Kaleido"}
+		return settings
+	}
+	uploads := []schema.DbUpload{
+		{UploadID: "up3", Time: "2023-01-01T00:00:00Z", DeviceID: "handset2", DeviceTags: []string{"insulin-pump"}},
+		{UploadID: "up2", Time: "2022-05-01T00:00:00Z", DeviceID: "cgm1", DeviceTags: []string{"cgm"}},
+		{UploadID: "up1", Time: "2022-04-01T00:00:00Z", DeviceID: "handset1", DeviceModel: "DBLG1", DeviceManufacturers: []string{"Diabeloop"}, DeviceTags: []string{"insulin-pump"}},
+	}
+
+	t.Run("should use the device and the basal security profile of the date", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", asOf, asOf).Return([]schema.DbProfile{
+			{Type: "basalSecurity", Time: asOf.AddDate(0, -1, 0), Guid: "p1"},
+		}, nil)
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return(uploads, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+		writer := &writeFromIter{}
+
+		settings := p.getPumpSettingsAsOf(testCtx, "", "user1", newSettings(), writer, asOf)
+
+		assert.Equal(t, &orcaSchema.Device{DeviceID: "handset1", Name: "DBLG1", Manufacturer: "Diabeloop"}, settings.CurrentSettings.Device)
+		assert.Nil(t, settings.CurrentSettings.Pump)
+		assert.Equal(t, &internalSchema.Profile{Type: "basalSecurity", Time: asOf.AddDate(0, -1, 0), Guid: "p1"}, writer.basalSecurityProfile)
+	})
+
+	t.Run("should keep the current device when it did not change", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetBasalSecurityProfiles", mock.Anything, mock.Anything, "user1", mock.Anything, mock.Anything).Return(nil, nil)
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return(uploads, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+		writer := &writeFromIter{basalSecurityProfile: &internalSchema.Profile{Guid: "latest"}}
+
+		settings := p.getPumpSettingsAsOf(testCtx, "", "user1", newSettings(), writer, asOf.AddDate(1, 0, 0))
+
+		assert.Equal(t, "handset2", settings.CurrentSettings.Device.DeviceID)
+		assert.Equal(t, &orcaSchema.Pump{Name: "Kaleido"}, settings.CurrentSettings.Pump)
+		assert.Nil(t, writer.basalSecurityProfile)
+	})
+}
@@ -0,0 +1,297 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Names of the source precedence rules, see SourcePrecedence
+const (
+	SourceCarelink  = "carelink"
+	SourceDexcom    = "dexcom"
+	SourceMedtronic = "medtronic"
+	// SourceAll all the sources, to request the raw data
+	SourceAll = "all"
+	// SourceNone no source precedence rule
+	SourceNone = "none"
+)
+
+const (
+	dexcomManufacturer    = "Dexcom"
+	medtronicManufacturer = "Medtronic"
+	// continuousDataSetType the data set type of the cloud syncs, the direct uploads are "normal" data sets
+	continuousDataSetType = "continuous"
+)
+
+// SourcePrecedence the rules deciding which source wins where the data of several sources overlap
+type SourcePrecedence struct {
+	// Carelink the data imported from Carelink are excluded, in favor of the direct uploads of the same pumps
+	Carelink bool
+	// Dexcom the cbg of the Dexcom cloud syncs win over the cbg of the other sources during their time range
+	Dexcom bool
+	// Medtronic the basal, bolus & cbg of the Medtronic cloud syncs win over the ones of the Medtronic direct uploads,
+	// from their first datum
+	Medtronic bool
+}
+
+// DefaultSourcePrecedence all the rules are applied
+var DefaultSourcePrecedence = SourcePrecedence{Carelink: true, Dexcom: true, Medtronic: true}
+
+// ParseSourcePrecedence returns the rules of a comma separated list of rule names (carelink, dexcom, medtronic),
+// all or none
+func ParseSourcePrecedence(value string) (SourcePrecedence, error) {
+	rules := SourcePrecedence{}
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case SourceCarelink:
+			rules.Carelink = true
+		case SourceDexcom:
+			rules.Dexcom = true
+		case SourceMedtronic:
+			rules.Medtronic = true
+		case SourceAll:
+			rules = DefaultSourcePrecedence
+		case SourceNone, "":
+		default:
+			return SourcePrecedence{}, fmt.Errorf("invalid source %q", name)
+		}
+	}
+	return rules, nil
+}
+
+// SetSourcePrecedence set the rules applied by GetData & GetDataPage, none by default
+func (p *PatientData) SetSourcePrecedence(rules SourcePrecedence) {
+	p.sourcePrecedence = rules
+}
+
+// withoutRawSources returns the rules which are not disabled by the raw sources requested
+func (rules SourcePrecedence) withoutRawSources(rawSources []string) (SourcePrecedence, error) {
+	raw, err := ParseSourcePrecedence(strings.Join(rawSources, ","))
+	if err != nil {
+		return rules, err
+	}
+	rules.Carelink = rules.Carelink && !raw.Carelink
+	rules.Dexcom = rules.Dexcom && !raw.Dexcom
+	rules.Medtronic = rules.Medtronic && !raw.Medtronic
+	return rules, nil
+}
+
+// sourcesCacheDuration how long the sources of a patient are reused, e.g. by the following pages of a paged read
+const sourcesCacheDuration = time.Minute
+
+type (
+	// sourcesKey the cache key of the sources of a patient, they depend on the rules applied
+	sourcesKey struct {
+		userID string
+		rules  SourcePrecedence
+	}
+	// patientSources the cloud syncs overlapping the other sources of a patient, see addSourcePrecedence()
+	patientSources struct {
+		expiration         time.Time
+		dexcomDataSource   bson.M
+		medtronicDate      string
+		medtronicUploadIds []string
+		// cloudSyncIds the Dexcom & Medtronic cloud syncs winning over the other sources
+		cloudSyncIds []string
+		// bucketRanges the time ranges of the tide-v2 samples replaced by the data of the cloud syncs
+		bucketRanges *bucketSourceRanges
+	}
+)
+
+// addSourcePrecedence set the source filters of the params, using the uploads of the patient to find
+// the Dexcom & Medtronic cloud syncs, and returns the ranges of the tide-v2 samples to exclude, nil when there is none.
+// The rules which can not apply to the requested types are skipped, the sources found are cached
+// for sourcesCacheDuration.
+func (p *PatientData) addSourcePrecedence(ctx context.Context, traceID string, userID string, rules SourcePrecedence, params *common.Params) (*bucketSourceRanges, error) {
+	// Dexcom: cbg only, Medtronic: basal, bolus & cbg
+	rules.Dexcom = rules.Dexcom && isTypeRequested(params.Types, "cbg")
+	rules.Medtronic = rules.Medtronic && (isTypeRequested(params.Types, "basal") ||
+		isTypeRequested(params.Types, "bolus") || isTypeRequested(params.Types, "cbg"))
+	if !rules.Carelink && !rules.Dexcom && !rules.Medtronic {
+		return nil, nil
+	}
+	common.TimeIt(ctx, "addSourcePrecedence")
+	defer common.TimeEnd(ctx, "addSourcePrecedence")
+
+	params.SourcePrecedence = true
+	params.Carelink = !rules.Carelink
+	params.Dexcom = !rules.Dexcom
+	params.Medtronic = !rules.Medtronic
+	if !rules.Dexcom && !rules.Medtronic {
+		return nil, nil
+	}
+
+	sources, err := p.getPatientSources(ctx, traceID, userID, rules)
+	if err != nil {
+		return nil, err
+	}
+	params.DexcomDataSource = sources.dexcomDataSource
+	params.MedtronicDate = sources.medtronicDate
+	params.MedtronicUploadIds = sources.medtronicUploadIds
+	params.CbgUploadIds = sources.cloudSyncIds
+	return sources.bucketRanges, nil
+}
+
+// getPatientSources returns the cloud syncs of the patient overlapping the other sources, from the cache when available
+func (p *PatientData) getPatientSources(ctx context.Context, traceID string, userID string, rules SourcePrecedence) (*patientSources, error) {
+	key := sourcesKey{userID: userID, rules: rules}
+	now := time.Now()
+	p.sourcesMutex.Lock()
+	cached, found := p.sourcesCache[key]
+	p.sourcesMutex.Unlock()
+	if found && now.Before(cached.expiration) {
+		return cached, nil
+	}
+
+	uploads, err := p.patientDataRepository.GetUploads(ctx, traceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	var dexcomSyncs, medtronicSyncs, medtronicUploads []string
+	for _, upload := range uploads {
+		cloudSync := upload.DataSetType == continuousDataSetType
+		switch {
+		case rules.Dexcom && cloudSync && common.Contains(upload.DeviceManufacturers, dexcomManufacturer):
+			dexcomSyncs = append(dexcomSyncs, upload.UploadID)
+		case rules.Medtronic && cloudSync && common.Contains(upload.DeviceManufacturers, medtronicManufacturer):
+			medtronicSyncs = append(medtronicSyncs, upload.UploadID)
+		case rules.Medtronic && common.Contains(upload.DeviceManufacturers, medtronicManufacturer):
+			medtronicUploads = append(medtronicUploads, upload.UploadID)
+		}
+	}
+
+	sources := &patientSources{expiration: now.Add(sourcesCacheDuration)}
+	var dexcomStart, dexcomEnd time.Time
+	if len(dexcomSyncs) > 0 {
+		dataRange, err := p.patientDataRepository.GetUploadsDataRange(ctx, traceID, userID, dexcomSyncs)
+		if err != nil {
+			return nil, err
+		}
+		earliestDataTime, errStart := time.Parse(time.RFC3339Nano, dataRange.Start)
+		latestDataTime, errEnd := time.Parse(time.RFC3339Nano, dataRange.End)
+		if errStart == nil && errEnd == nil {
+			dexcomStart, dexcomEnd = earliestDataTime, latestDataTime
+			sources.dexcomDataSource = bson.M{
+				"dataSetIds":       dexcomSyncs,
+				"earliestDataTime": earliestDataTime,
+				"latestDataTime":   latestDataTime,
+			}
+			sources.cloudSyncIds = append(sources.cloudSyncIds, dexcomSyncs...)
+		}
+	}
+	if len(medtronicSyncs) > 0 && len(medtronicUploads) > 0 {
+		dataRange, err := p.patientDataRepository.GetUploadsDataRange(ctx, traceID, userID, medtronicSyncs)
+		if err != nil {
+			return nil, err
+		}
+		if dataRange.Start != "" {
+			sources.medtronicDate = dataRange.Start
+			sources.medtronicUploadIds = medtronicUploads
+			sources.cloudSyncIds = append(sources.cloudSyncIds, medtronicSyncs...)
+		}
+	}
+	if sources.dexcomDataSource != nil || sources.medtronicDate != "" {
+		counts, err := p.patientDataRepository.GetUploadsDataCount(ctx, traceID, userID)
+		if err != nil {
+			return nil, err
+		}
+		medtronicDate, _ := time.Parse(time.RFC3339Nano, sources.medtronicDate)
+		sources.bucketRanges = newBucketSourceRanges(counts, dexcomSyncs, dexcomStart, dexcomEnd, medtronicUploads, medtronicDate)
+	}
+
+	p.sourcesMutex.Lock()
+	defer p.sourcesMutex.Unlock()
+	if p.sourcesCache == nil {
+		p.sourcesCache = make(map[sourcesKey]*patientSources)
+	}
+	for cachedKey, cachedSources := range p.sourcesCache {
+		if !now.Before(cachedSources.expiration) {
+			delete(p.sourcesCache, cachedKey)
+		}
+	}
+	p.sourcesCache[key] = sources
+	return sources, nil
+}
+
+// sourceRange a time range, bounds included
+type sourceRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// bucketSourceRanges the time ranges where the tide-v2 samples are replaced by the data of a preferred cloud sync.
+// The samples do not know their upload: like the database source filters (see infrastructure sourceFilters()),
+// they are excluded where the data of the same type of an overlapped upload are:
+// the cbg of the other uploads during the Dexcom data source time range, and the basal & cbg
+// of the Medtronic direct uploads after the first datum of the Medtronic cloud syncs.
+type bucketSourceRanges struct {
+	cbg   []sourceRange
+	basal []sourceRange
+}
+
+// newBucketSourceRanges returns the ranges of the data of the uploads overlapped by the cloud syncs, from the data counts
+// of the uploads, nil when there is none. The Dexcom rule applies when dexcomStart is set, the Medtronic one when medtronicDate is set.
+func newBucketSourceRanges(counts []schema.DbUploadTypeCount, dexcomSyncs []string, dexcomStart time.Time, dexcomEnd time.Time, medtronicUploads []string, medtronicDate time.Time) *bucketSourceRanges {
+	ranges := bucketSourceRanges{}
+	for _, count := range counts {
+		if count.Type != "cbg" && count.Type != "basal" {
+			continue
+		}
+		start, errStart := time.Parse(time.RFC3339Nano, count.Start)
+		end, errEnd := time.Parse(time.RFC3339Nano, count.End)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if count.Type == "cbg" && !dexcomStart.IsZero() && !common.Contains(dexcomSyncs, count.UploadID) {
+			ranges.add(count.Type, start, end, dexcomStart, dexcomEnd)
+		}
+		if !medtronicDate.IsZero() && common.Contains(medtronicUploads, count.UploadID) {
+			ranges.add(count.Type, start, end, medtronicDate, end)
+		}
+	}
+	if len(ranges.cbg) == 0 && len(ranges.basal) == 0 {
+		return nil
+	}
+	return &ranges
+}
+
+// add the intersection of the [start, end] range of an upload data with the [ruleStart, ruleEnd] range of a rule
+func (ranges *bucketSourceRanges) add(datumType string, start time.Time, end time.Time, ruleStart time.Time, ruleEnd time.Time) {
+	if start.Before(ruleStart) {
+		start = ruleStart
+	}
+	if end.After(ruleEnd) {
+		end = ruleEnd
+	}
+	if end.Before(start) {
+		return
+	}
+	if datumType == "basal" {
+		ranges.basal = append(ranges.basal, sourceRange{start: start, end: end})
+	} else {
+		ranges.cbg = append(ranges.cbg, sourceRange{start: start, end: end})
+	}
+}
+
+// excludes returns true when a tide-v2 sample of this type is in one of the ranges
+func (ranges *bucketSourceRanges) excludes(datumType string, sampleTime time.Time) bool {
+	if ranges == nil {
+		return false
+	}
+	typeRanges := ranges.cbg
+	if datumType == "basal" {
+		typeRanges = ranges.basal
+	}
+	for _, r := range typeRanges {
+		if !sampleTime.Before(r.start) && !sampleTime.After(r.end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+	"github.com/tidepool-org/tide-whisperer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSourcePrecedence(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expectedRules SourcePrecedence
+		expectedError bool
+	}{
+		{"Empty", "", SourcePrecedence{}, false},
+		{"None", "none", SourcePrecedence{}, false},
+		{"All", "all", DefaultSourcePrecedence, false},
+		{"List", "dexcom, carelink", SourcePrecedence{Carelink: true, Dexcom: true}, false},
+		{"Unknown source", "dexcom,libre", SourcePrecedence{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseSourcePrecedence(tt.value)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedRules, rules)
+		})
+	}
+}
+
+func TestPatientData_GetData_sourcePrecedence(t *testing.T) {
+	userID := "userid_test_sources"
+	uploads := []schema.DbUpload{
+		{UploadID: "dexcomSync", DataSetType: "continuous", DeviceManufacturers: []string{"Dexcom"}},
+		{UploadID: "medtronicSync", DataSetType: "continuous", DeviceManufacturers: []string{"Medtronic"}},
+		{UploadID: "medtronicUpload", DataSetType: "normal", DeviceManufacturers: []string{"Medtronic"}},
+		{UploadID: "dexcomUpload", DataSetType: "normal", DeviceManufacturers: []string{"Dexcom"}},
+		{UploadID: "handset", DataSetType: "normal", DeviceManufacturers: []string{"Diabeloop"}},
+	}
+	earliestDataTime, _ := time.Parse(time.RFC3339Nano, "2023-03-01T00:00:00.000Z")
+	latestDataTime, _ := time.Parse(time.RFC3339Nano, "2023-03-10T00:00:00.000Z")
+	args := GetDataArgs{
+		UserID: userID,
+		Types:  []string{"smbg", "bolus", "cbg"},
+		Format: FormatNDJSON,
+	}
+
+	t.Run("should exclude the data of the less preferred sources", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, userID).Return(uploads, nil)
+		repository.On("GetUploadsDataRange", mock.Anything, mock.Anything, userID, []string{"dexcomSync"}).Return(&common.Date{Start: "2023-03-01T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"}, nil)
+		repository.On("GetUploadsDataRange", mock.Anything, mock.Anything, userID, []string{"medtronicSync"}).Return(&common.Date{Start: "2023-02-01T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"}, nil)
+		repository.On("GetUploadsDataCount", mock.Anything, mock.Anything, userID).Return([]schema.DbUploadTypeCount{}, nil)
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.SourcePrecedence && !params.Carelink && !params.Dexcom && !params.Medtronic &&
+				assert.ObjectsAreEqual(bson.M{"dataSetIds": []string{"dexcomSync"}, "earliestDataTime": earliestDataTime, "latestDataTime": latestDataTime}, params.DexcomDataSource) &&
+				params.MedtronicDate == "2023-02-01T00:00:00.000Z" &&
+				assert.ObjectsAreEqual([]string{"medtronicUpload"}, params.MedtronicUploadIds) &&
+				assert.ObjectsAreEqual([]string{"dexcomSync", "medtronicSync"}, params.CbgUploadIds)
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+
+		err := p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.Nil(t, err)
+		// The sources are cached for the next requests
+		err = p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertNumberOfCalls(t, "GetUploads", 1)
+		repository.AssertNumberOfCalls(t, "GetUploadsDataCount", 1)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should skip the rules which can not apply to the requested types", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.SourcePrecedence && !params.Carelink && params.Dexcom && params.Medtronic
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+		smbgArgs := args
+		smbgArgs.Types = []string{"smbg"}
+
+		err := p.GetData(testCtx, smbgArgs, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertNotCalled(t, "GetUploads", mock.Anything, mock.Anything, mock.Anything)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should exclude the tide-v2 cbg of the uploads overlapping the Dexcom cloud sync", func(t *testing.T) {
+		day := time.Date(2023, time.March, 9, 0, 0, 0, 0, time.UTC)
+		tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+			{Id: "cbg1", UserId: userID, Day: day, Samples: []tideV2Schema.CbgSample{
+				{Value: 10, Units: MmolL, Timestamp: day, Timezone: "UTC"},
+				{Value: 11, Units: MmolL, Timestamp: day.Add(25 * time.Hour), Timezone: "UTC"},
+				{Value: 12, Units: MmolL, Timestamp: day.Add(23 * time.Hour), Timezone: "UTC"},
+			}},
+		}
+		repository := MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, userID).Return([]schema.DbUpload{uploads[0], uploads[4]}, nil)
+		repository.On("GetUploadsDataRange", mock.Anything, mock.Anything, userID, []string{"dexcomSync"}).Return(&common.Date{Start: "2023-03-01T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"}, nil)
+		// The handset cbg overlap the Dexcom cloud sync until the 9th at 12:00, the ones of the Dexcom cloud sync are read from the database
+		repository.On("GetUploadsDataCount", mock.Anything, mock.Anything, userID).Return([]schema.DbUploadTypeCount{
+			{UploadID: "dexcomSync", Type: "cbg", Count: 2600, Start: "2023-03-01T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"},
+			{UploadID: "handset", Type: "cbg", Count: 2000, Start: "2023-02-01T00:00:00.000Z", End: "2023-03-09T12:00:00.000Z"},
+			{UploadID: "handset", Type: "cbg", Count: 20, Start: "2023-03-10T01:00:00.000Z", End: "2023-03-10T02:00:00.000Z"},
+		}, nil)
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+			`{"id":"dexcom1","type":"cbg","uploadId":"dexcomSync","time":"2023-03-09T00:00:00.000Z","units":"mmol/L","value":9}`,
+		}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, false)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+		cbgArgs := args
+		cbgArgs.Types = []string{"cbg"}
+		cbgArgs.Fields = []string{"value"}
+
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, cbgArgs, res)
+		assert.Nil(t, err)
+		// In the Dexcom range without an overlapped upload, or after it: kept
+		assert.Equal(t, `{"id":"dexcom1","time":"2023-03-09T00:00:00.000Z","type":"cbg","value":9}
+{"id":"cbg_cbg1_1","time":"2023-03-10T01:00:00Z","type":"cbg","value":11}
+{"id":"cbg_cbg1_2","time":"2023-03-09T23:00:00Z","type":"cbg","value":12}
+`, res.String())
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should exclude the tide-v2 cbg & basal of the Medtronic direct uploads after the Medtronic cloud sync", func(t *testing.T) {
+		day := time.Date(2023, time.February, 10, 0, 0, 0, 0, time.UTC)
+		tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+		tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+			{Id: "cbg1", UserId: userID, Day: day, Samples: []tideV2Schema.CbgSample{
+				{Value: 10, Units: MmolL, Timestamp: day.AddDate(0, 0, -20), Timezone: "UTC"},
+				{Value: 11, Units: MmolL, Timestamp: day, Timezone: "UTC"},
+				{Value: 12, Units: MmolL, Timestamp: day.AddDate(0, 0, 15), Timezone: "UTC"},
+			}},
+		}
+		tideV2Client.MockedBasal = []tideV2Schema.BasalBucket{
+			{Id: "basal1", UserId: userID, Day: day, Samples: []tideV2Schema.BasalSample{
+				{Sample: tideV2Schema.Sample{Timestamp: day, Timezone: "UTC"}, DeliveryType: "automated", Rate: 1, Duration: 300000},
+				{Sample: tideV2Schema.Sample{Timestamp: day.AddDate(0, 0, 15), Timezone: "UTC"}, DeliveryType: "automated", Rate: 2, Duration: 300000},
+			}},
+		}
+		repository := MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, userID).Return([]schema.DbUpload{uploads[1], uploads[2], uploads[4]}, nil)
+		repository.On("GetUploadsDataRange", mock.Anything, mock.Anything, userID, []string{"medtronicSync"}).Return(&common.Date{Start: "2023-02-01T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"}, nil)
+		// The Medtronic direct upload stops on the 15th, then the handset is used
+		repository.On("GetUploadsDataCount", mock.Anything, mock.Anything, userID).Return([]schema.DbUploadTypeCount{
+			{UploadID: "medtronicUpload", Type: "cbg", Count: 12000, Start: "2023-01-01T00:00:00.000Z", End: "2023-02-15T00:00:00.000Z"},
+			{UploadID: "medtronicUpload", Type: "basal", Count: 12000, Start: "2023-01-01T00:00:00.000Z", End: "2023-02-15T00:00:00.000Z"},
+			{UploadID: "handset", Type: "cbg", Count: 3000, Start: "2023-02-16T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"},
+			{UploadID: "handset", Type: "basal", Count: 3000, Start: "2023-02-16T00:00:00.000Z", End: "2023-03-10T00:00:00.000Z"},
+		}, nil)
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, true)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+		bucketArgs := args
+		bucketArgs.Types = []string{"cbg", "basal"}
+		bucketArgs.Fields = []string{"value", "rate"}
+
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, bucketArgs, res)
+		assert.Nil(t, err)
+		// Before the Medtronic cloud sync, or from the handset: kept
+		assert.Equal(t, `{"id":"cbg_cbg1_0","time":"2023-01-21T00:00:00Z","type":"cbg","value":10}
+{"id":"cbg_cbg1_2","time":"2023-02-25T00:00:00Z","type":"cbg","value":12}
+{"id":"basal_basal1_1","rate":2,"time":"2023-02-25T00:00:00Z","type":"basal"}
+`, res.String())
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should not apply the rules to the raw sources", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.SourcePrecedence && !params.Carelink && params.Dexcom && params.Medtronic && params.DexcomDataSource == nil
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+		rawArgs := args
+		rawArgs.RawSources = []string{SourceDexcom, SourceMedtronic}
+
+		err := p.GetData(testCtx, rawArgs, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertNotCalled(t, "GetUploads", mock.Anything, mock.Anything, mock.Anything)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should not filter the sources without rules", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return !params.SourcePrecedence
+		}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+
+		err := p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.Nil(t, err)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should return an error on invalid raw source", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		invalidArgs := args
+		invalidArgs.RawSources = []string{"libre"}
+
+		err := p.GetData(testCtx, invalidArgs, &bytes.Buffer{})
+		assert.NotNil(t, err)
+		assert.Equal(t, errorInvalidParameters.Code, err.Code)
+	})
+
+	t.Run("should return an error when the uploads can not be read", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, userID).Return(nil, errors.New("db error"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		p.SetSourcePrecedence(DefaultSourcePrecedence)
+
+		err := p.GetData(testCtx, args, &bytes.Buffer{})
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
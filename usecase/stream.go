@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+const (
+	// streamOpenComment first comment of a data stream, sent once the change stream is opened
+	streamOpenComment = ": stream open\n\n"
+	// streamHeartbeatComment comment sent when no datum is received for a while, to keep the connection alive
+	streamHeartbeatComment = ": heartbeat\n\n"
+	// defaultStreamHeartbeat default interval of the heartbeat comments
+	defaultStreamHeartbeat = 15 * time.Second
+)
+
+// StreamDataArgs arguments of StreamData
+type StreamDataArgs struct {
+	UserID  string
+	TraceID string
+	// LastEventID the id of the last event received by the client, the stream resumes after it when set
+	LastEventID string
+	// BgUnit the unit of the blood glucose values, as they are in database by default
+	BgUnit string
+	// Heartbeat the maximum duration without writing anything, defaultStreamHeartbeat by default
+	Heartbeat time.Duration
+}
+
+// StreamData write the datums activated for a patient as Server-Sent Events, until ctx is done.
+//
+// Each event data is a datum formatted as by GetData, its id is the position to resume the stream after it.
+// A comment is written when no datum is received during args.Heartbeat. Each event is written by one call
+// to res.Write, so res can flush after each call. Nothing is written when the stream cannot be opened.
+func (p *PatientData) StreamData(ctx context.Context, args StreamDataArgs, res io.Writer) *common.DetailedError {
+	heartbeat := args.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+
+	stream, err := p.patientDataRepository.WatchData(ctx, args.TraceID, args.UserID, p.getSchemaVersion(false), args.LastEventID, heartbeat)
+	if err != nil {
+		errorQuery := errorRunningQuery
+		if errors.Is(err, common.ErrInvalidResumeToken) {
+			errorQuery = errorInvalidParameters
+		}
+		return &common.DetailedError{
+			Status:          errorQuery.Status,
+			Code:            errorQuery.Code,
+			Message:         errorQuery.Message,
+			InternalMessage: addContextToMessage("StreamData", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	// ctx is most likely done here, closing the change stream must not depend on it
+	defer stream.Close(context.Background())
+
+	if _, err := io.WriteString(res, streamOpenComment); err != nil {
+		return newWriteError(err)
+	}
+
+	writer := &writeFromIter{uploadIDs: make([]string, 0, 16), parameterLevels: p.defaultParameterLevels()}
+	lastWrite := time.Now()
+	for ctx.Err() == nil {
+		if stream.TryNext(ctx) {
+			var datum map[string]interface{}
+			if err := stream.Decode(&datum); err != nil {
+				p.logger.Printf("{%s} - {StreamData:\"%s\"}", args.TraceID, err)
+				continue
+			}
+			if !writer.prepareDatum(datum, args.BgUnit) {
+				continue
+			}
+			jsonDatum, err := json.Marshal(datum)
+			if err != nil {
+				p.logger.Printf("{%s} - {StreamData:\"%s\"}", args.TraceID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "id: %s\ndata: %s\n\n", stream.ResumeToken(), jsonDatum); err != nil {
+				return newWriteError(err)
+			}
+			lastWrite = time.Now()
+			continue
+		}
+
+		if err := stream.Err(); err != nil {
+			if ctx.Err() != nil {
+				// The client is gone
+				return nil
+			}
+			return &common.DetailedError{
+				Status:          errorRunningQuery.Status,
+				Code:            errorRunningQuery.Code,
+				Message:         errorRunningQuery.Message,
+				InternalMessage: addContextToMessage("StreamData", args.UserID, args.TraceID, err.Error()),
+			}
+		}
+		if time.Since(lastWrite) >= heartbeat {
+			if _, err := io.WriteString(res, streamHeartbeatComment); err != nil {
+				return newWriteError(err)
+			}
+			lastWrite = time.Now()
+		}
+	}
+	return nil
+}
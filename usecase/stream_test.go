@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestPatientData_StreamData(t *testing.T) {
+	userID := "userid_test_stream"
+
+	t.Run("should write the data as events until the context is done", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		stream := infrastructure.NewMockDataStream([]string{
+			`{"id":"cbg1","type":"cbg","uploadId":"upload1","time":"2023-03-03T12:00:00.000Z","units":"mmol/L","value":5.5}`,
+			`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-03-03T12:05:00.000Z","units":"mmol/L","value":10}`,
+		})
+		repository.On("WatchData", mock.Anything, "trace", userID, (*common.SchemaVersion)(nil), "", 20*time.Millisecond).Return(stream, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		res := &bytes.Buffer{}
+		err := p.StreamData(ctx, StreamDataArgs{UserID: userID, TraceID: "trace", BgUnit: MgdL, Heartbeat: 20 * time.Millisecond}, res)
+		assert.Nil(t, err)
+		assert.True(t, stream.Closed)
+		output := res.String()
+		assert.True(t, bytes.HasPrefix(res.Bytes(), []byte(`: stream open
+
+id: 1
+data: {"id":"cbg1","time":"2023-03-03T12:00:00.000Z","type":"cbg","units":"mg/dL","uploadId":"upload1","value":99}
+
+id: 2
+data: {"id":"smbg1","time":"2023-03-03T12:05:00.000Z","type":"smbg","units":"mg/dL","uploadId":"upload1","value":180}
+
+`)), output)
+		assert.Contains(t, output, ": heartbeat\n\n")
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should resume after the last event", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("WatchData", mock.Anything, "trace", userID, (*common.SchemaVersion)(nil), "token", defaultStreamHeartbeat).Return(infrastructure.NewMockDataStream(nil), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		res := &bytes.Buffer{}
+		err := p.StreamData(ctx, StreamDataArgs{UserID: userID, TraceID: "trace", LastEventID: "token"}, res)
+		assert.Nil(t, err)
+		assert.Equal(t, ": stream open\n\n", res.String())
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("should return an error on invalid resume token", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		repository.On("WatchData", mock.Anything, mock.Anything, userID, mock.Anything, "invalid", mock.Anything).Return(nil, common.ErrInvalidResumeToken)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+
+		res := &bytes.Buffer{}
+		err := p.StreamData(testCtx, StreamDataArgs{UserID: userID, LastEventID: "invalid"}, res)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorInvalidParameters.Code, err.Code)
+		assert.Equal(t, 0, res.Len())
+	})
+
+	t.Run("should return an error when the stream fails", func(t *testing.T) {
+		repository := MockPatientDataRepository{}
+		stream := infrastructure.NewMockDataStream(nil)
+		stream.Error = errors.New("stream error")
+		repository.On("WatchData", mock.Anything, mock.Anything, userID, mock.Anything, "", mock.Anything).Return(stream, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+
+		res := &bytes.Buffer{}
+		err := p.StreamData(testCtx, StreamDataArgs{UserID: userID}, res)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+		assert.True(t, stream.Closed)
+	})
+}
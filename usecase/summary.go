@@ -0,0 +1,319 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mdblp/go-common/clients/status"
+	orcaSchema "github.com/mdblp/orca/schema"
+	schemaV2 "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+const (
+	// HypoLimitParameter name of the pump settings parameter holding the hypoglycemia limit
+	HypoLimitParameter = "PATIENT_GLY_HYPO_LIMIT"
+	// HyperLimitParameter name of the pump settings parameter holding the hyperglycemia limit
+	HyperLimitParameter = "PATIENT_GLY_HYPER_LIMIT"
+
+	// Limits used when the patient has no pump settings
+	defaultHypoLimitMgdl  float64 = 70
+	defaultHyperLimitMgdl float64 = 180
+
+	// DefaultSummaryDays number of days used by the summary when no window is requested
+	DefaultSummaryDays = 14
+)
+
+type (
+	// GetSummaryArgs arguments of GetSummary
+	GetSummaryArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// StartDate & EndDate the window used to compute the summary (ISO-8601 datetime).
+		// By default, the window ends with the last data of the patient.
+		StartDate string
+		EndDate   string
+		// Days the window duration when StartDate is not set, DefaultSummaryDays by default
+		Days int
+		// BgUnit the unit of the result, mg/dL by default
+		BgUnit string
+	}
+	// bgValue one blood glucose value, in the requested unit
+	bgValue struct {
+		time           time.Time
+		timezone       string
+		timezoneOffset int
+		value          float64
+	}
+)
+
+// GetSummary compute the time in range and time below range of a patient, using the cbg
+// or the smbg when no cbg are available.
+func (p *PatientData) GetSummary(ctx context.Context, args GetSummaryArgs) (*SummaryResultV1, *common.DetailedError) {
+	common.TimeIt(ctx, "getSummary")
+	defer common.TimeEnd(ctx, "getSummary")
+
+	unit := args.BgUnit
+	if unit != MmolL {
+		unit = MgdL
+	}
+
+	dataRange, err := p.patientDataRepository.GetDataRangeLegacy(ctx, args.TraceID, args.UserID, p.getSchemaVersion(false))
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("GetSummary", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	result := &SummaryResultV1{
+		UserID:  args.UserID,
+		GlyUnit: unit,
+	}
+	lastDataTime := time.Now()
+	if dataRange != nil {
+		result.RangeStart = dataRange.Start
+		result.RangeEnd = dataRange.End
+		if rangeEnd, errParse := time.Parse(time.RFC3339Nano, dataRange.End); errParse == nil {
+			lastDataTime = rangeEnd
+		}
+	}
+
+	startTime, endTime, errWindow := getWindow(args.StartDate, args.EndDate, args.Days, DefaultSummaryDays, lastDataTime)
+	if errWindow != nil {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetSummary", args.UserID, args.TraceID, errWindow.Error()),
+		}
+	}
+
+	settings, errSettings := p.getCurrentSettings(ctx, args.TraceID, args.UserID, args.SessionToken)
+	if errSettings != nil {
+		return nil, errSettings
+	}
+	result.GlyHypoLimit, result.GlyHyperLimit = getGlyLimits(settings, unit)
+
+	values, errValues := p.getBgValues(ctx, args.TraceID, args.UserID, args.SessionToken, startTime, endTime, unit)
+	if errValues != nil {
+		return nil, errValues
+	}
+
+	inRange, belowRange := 0, 0
+	dates := make(map[string]bool)
+	locations := make(map[string]*time.Location)
+	for _, bg := range values {
+		dates[toLocalTime(bg.time, bg.timezone, bg.timezoneOffset, locations).Format("2006-01-02")] = true
+		if bg.value < result.GlyHypoLimit {
+			belowRange++
+		} else if bg.value <= result.GlyHyperLimit {
+			inRange++
+		}
+	}
+	result.NumBgValues = len(values)
+	result.ComputeDays = len(dates)
+	result.PercentTimeInRange = percentOf(inRange, len(values))
+	result.PercentTimeBelowRange = percentOf(belowRange, len(values))
+	return result, nil
+}
+
+// getWindow returns the time window from the requested dates: by default it ends at defaultEnd
+// and lasts days (or defaultDays).
+func getWindow(startDate string, endDate string, days int, defaultDays int, defaultEnd time.Time) (time.Time, time.Time, error) {
+	var startTime, endTime time.Time
+	var err error
+	if days <= 0 {
+		days = defaultDays
+	}
+	endTime = defaultEnd
+	if endDate != "" {
+		if endTime, err = time.Parse(time.RFC3339Nano, endDate); err != nil {
+			return startTime, endTime, err
+		}
+	}
+	startTime = endTime.AddDate(0, 0, -days)
+	if startDate != "" {
+		if startTime, err = time.Parse(time.RFC3339Nano, startDate); err != nil {
+			return startTime, endTime, err
+		}
+	}
+	if !startTime.Before(endTime) {
+		return startTime, endTime, fmt.Errorf("startDate is after endDate")
+	}
+	return startTime, endTime, nil
+}
+
+// getCurrentSettings returns the current pump settings of a patient, nil if the patient has none
+func (p *PatientData) getCurrentSettings(ctx context.Context, traceID string, userID string, token string) (*schemaV2.SettingsResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getCurrentSettings")
+	defer common.TimeEnd(ctx, "getCurrentSettings")
+	return p.getSettings(ctx, traceID, userID, token, false)
+}
+
+// getSettings returns the pump settings of a patient, with their parameters history when withHistory is set,
+// nil if the patient has none
+func (p *PatientData) getSettings(ctx context.Context, traceID string, userID string, token string, withHistory bool) (*schemaV2.SettingsResult, *common.DetailedError) {
+	settings, err := p.tideV2Client.GetSettings(ctx, userID, token, withHistory)
+	if err != nil {
+		if statusErr, ok := err.(*status.StatusError); ok && statusErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, &common.DetailedError{
+			Status:          errorTideV2Http.Status,
+			Code:            errorTideV2Http.Code,
+			Message:         errorTideV2Http.Message,
+			InternalMessage: addContextToMessage("getSettings", userID, traceID, err.Error()),
+		}
+	}
+	return settings, nil
+}
+
+// getGlyLimits returns the hypo & hyper limits from the pump settings, in the requested unit
+func getGlyLimits(settings *schemaV2.SettingsResult, unit string) (float64, float64) {
+	hypoLimit := convertBgValue(defaultHypoLimitMgdl, MgdL, unit)
+	hyperLimit := convertBgValue(defaultHyperLimitMgdl, MgdL, unit)
+	if settings == nil {
+		return hypoLimit, hyperLimit
+	}
+	if value, ok := getBgParameter(settings.CurrentSettings.Parameters, HypoLimitParameter, unit); ok {
+		hypoLimit = value
+	}
+	if value, ok := getBgParameter(settings.CurrentSettings.Parameters, HyperLimitParameter, unit); ok {
+		hyperLimit = value
+	}
+	return hypoLimit, hyperLimit
+}
+
+// getBgParameter returns the value of a blood glucose parameter, in the requested unit
+func getBgParameter(parameters []orcaSchema.CurrentParameter, name string, unit string) (float64, bool) {
+	for _, parameter := range parameters {
+		if parameter.Name != name || !isConvertibleUnit(parameter.Unit) {
+			continue
+		}
+		value, err := strconv.ParseFloat(parameter.Value, 64)
+		if err != nil {
+			return 0, false
+		}
+		return convertBgValue(value, parameter.Unit, unit), true
+	}
+	return 0, false
+}
+
+// getCbgValues returns the cbg values of the window, in time order
+func (p *PatientData) getCbgValues(ctx context.Context, traceID string, userID string, token string, startTime time.Time, endTime time.Time, unit string) ([]bgValue, *common.DetailedError) {
+	common.TimeIt(ctx, "getCbgValues")
+	defer common.TimeEnd(ctx, "getCbgValues")
+	buckets, err := p.tideV2Client.GetCbgV2WithContext(ctx, userID, token, startTime.UTC().Format(time.RFC3339Nano), endTime.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorTideV2Http.Status,
+			Code:            errorTideV2Http.Code,
+			Message:         errorTideV2Http.Message,
+			InternalMessage: addContextToMessage("getCbgValues", userID, traceID, err.Error()),
+		}
+	}
+	values := make([]bgValue, 0, 1024)
+	for _, bucket := range buckets {
+		for _, sample := range bucket.Samples {
+			if sample.Timestamp.Before(startTime) || !sample.Timestamp.Before(endTime) {
+				continue
+			}
+			values = append(values, bgValue{
+				time:           sample.Timestamp,
+				timezone:       sample.Timezone,
+				timezoneOffset: sample.TimezoneOffset,
+				value:          convertBgValue(sample.Value, sample.Units, unit),
+			})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].time.Before(values[j].time)
+	})
+	return values, nil
+}
+
+// getBgValues returns the cbg values of the window, in time order, or the smbg values if there is no cbg
+func (p *PatientData) getBgValues(ctx context.Context, traceID string, userID string, token string, startTime time.Time, endTime time.Time, unit string) ([]bgValue, *common.DetailedError) {
+	common.TimeIt(ctx, "getBgValues")
+	defer common.TimeEnd(ctx, "getBgValues")
+	startDate := startTime.UTC().Format(time.RFC3339Nano)
+	endDate := endTime.UTC().Format(time.RFC3339Nano)
+
+	values, errCbg := p.getCbgValues(ctx, traceID, userID, token, startTime, endTime, unit)
+	if errCbg != nil {
+		return nil, errCbg
+	}
+
+	if len(values) == 0 {
+		// Fallback on the smbg
+		params := &common.Params{
+			UserID:        userID,
+			Types:         []string{"smbg"},
+			Date:          common.Date{Start: startDate, End: endDate},
+			SchemaVersion: p.getSchemaVersion(false),
+			// The timezoneOffset is not returned by default
+			Fields: []string{"timezone", "timezoneOffset", "units", "value"},
+		}
+		iter, err := p.patientDataRepository.GetDataInDeviceData(ctx, traceID, params, []string{})
+		if err != nil {
+			return nil, &common.DetailedError{
+				Status:          errorRunningQuery.Status,
+				Code:            errorRunningQuery.Code,
+				Message:         errorRunningQuery.Message,
+				InternalMessage: addContextToMessage("getBgValues", userID, traceID, err.Error()),
+			}
+		}
+		defer iter.Close(ctx)
+		for iter.Next(ctx) {
+			var smbg struct {
+				Time           string  `bson:"time"`
+				Timezone       string  `bson:"timezone"`
+				TimezoneOffset int     `bson:"timezoneOffset"`
+				Units          string  `bson:"units"`
+				Value          float64 `bson:"value"`
+			}
+			if err := iter.Decode(&smbg); err != nil {
+				continue
+			}
+			smbgTime, err := time.Parse(time.RFC3339Nano, smbg.Time)
+			if err != nil {
+				continue
+			}
+			values = append(values, bgValue{
+				time:           smbgTime,
+				timezone:       smbg.Timezone,
+				timezoneOffset: smbg.TimezoneOffset,
+				value:          convertBgValue(smbg.Value, smbg.Units, unit),
+			})
+		}
+		if err := iterErr(iter); err != nil {
+			return nil, &common.DetailedError{
+				Status:          errorRunningQuery.Status,
+				Code:            errorRunningQuery.Code,
+				Message:         errorRunningQuery.Message,
+				InternalMessage: addContextToMessage("getBgValues", userID, traceID, err.Error()),
+			}
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].time.Before(values[j].time)
+	})
+	return values, nil
+}
+
+// percentOf returns the rounded percentage of value in total, 0 when total is 0
+func percentOf(value int, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(float64(value) * 100 / float64(total)))
+}
@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/clients/status"
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+var (
+	summaryDay           = time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	summarySchemaVersion = common.SchemaVersion{Minimum: 1, Maximum: 2}
+)
+
+func TestPatientData_GetSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		given    func(*MockPatientDataRepository, *tidewhisperer.TideWhispererV2MockClient)
+		args     GetSummaryArgs
+		expected *SummaryResultV1
+		err      string
+	}{
+		{
+			name: "should compute TIR & TBR from the cbg using the pump settings limits",
+			given: func(repository *MockPatientDataRepository, tideV2Client *tidewhisperer.TideWhispererV2MockClient) {
+				repository.On("GetDataRangeLegacy", mock.Anything, mock.Anything, "user1", &summarySchemaVersion).Return(&common.Date{Start: "2023-03-01T00:00:00.000Z", End: "2023-04-02T00:00:00.000Z"}, nil)
+				tideV2Client.MockedCbg = summaryCbgBuckets(3, 5.5, 12, 8)
+				tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(summarySettings("3.9", "10", MmolL), nil)
+			},
+			args: GetSummaryArgs{UserID: "user1", Days: 2, BgUnit: MgdL},
+			expected: &SummaryResultV1{
+				UserID:                "user1",
+				RangeStart:            "2023-03-01T00:00:00.000Z",
+				RangeEnd:              "2023-04-02T00:00:00.000Z",
+				ComputeDays:           1,
+				PercentTimeInRange:    50,
+				PercentTimeBelowRange: 25,
+				NumBgValues:           4,
+				GlyHypoLimit:          70,
+				GlyHyperLimit:         180,
+				GlyUnit:               MgdL,
+			},
+		},
+		{
+			name: "should fallback on smbg and default limits without cbg and pump settings",
+			given: func(repository *MockPatientDataRepository, tideV2Client *tidewhisperer.TideWhispererV2MockClient) {
+				repository.On("GetDataRangeLegacy", mock.Anything, mock.Anything, "user1", &summarySchemaVersion).Return(nil, nil)
+				repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+					return len(params.Types) == 1 && params.Types[0] == "smbg" && params.Date.Start == "2023-04-01T00:00:00Z" &&
+						assert.ObjectsAreEqual(&summarySchemaVersion, params.SchemaVersion) && common.Contains(params.Fields, "timezoneOffset")
+				}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+					`{"id":"smbg1","type":"smbg","time":"2023-04-01T08:00:00.000Z","units":"mg/dL","value":60}`,
+					`{"id":"smbg2","type":"smbg","time":"2023-04-01T23:30:00.000Z","timezoneOffset":60,"units":"mmol/L","value":6}`,
+				}), nil)
+				tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(nil, &status.StatusError{Status: status.NewStatus(http.StatusNotFound, "no settings")})
+			},
+			args: GetSummaryArgs{UserID: "user1", StartDate: "2023-04-01T00:00:00Z", EndDate: "2023-04-02T00:00:00Z", BgUnit: MmolL},
+			expected: &SummaryResultV1{
+				UserID:                "user1",
+				ComputeDays:           2,
+				PercentTimeInRange:    50,
+				PercentTimeBelowRange: 50,
+				NumBgValues:           2,
+				GlyHypoLimit:          3.9,
+				GlyHyperLimit:         10,
+				GlyUnit:               MmolL,
+			},
+		},
+		{
+			name: "should fail when the pump settings can not be fetched",
+			given: func(repository *MockPatientDataRepository, tideV2Client *tidewhisperer.TideWhispererV2MockClient) {
+				repository.On("GetDataRangeLegacy", mock.Anything, mock.Anything, "user1", &summarySchemaVersion).Return(nil, nil)
+				tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(nil, errors.New("connection lost"))
+			},
+			args: GetSummaryArgs{UserID: "user1"},
+			err:  errorTideV2Http.Code,
+		},
+		{
+			name: "should fail with an invalid window",
+			given: func(repository *MockPatientDataRepository, tideV2Client *tidewhisperer.TideWhispererV2MockClient) {
+				repository.On("GetDataRangeLegacy", mock.Anything, mock.Anything, "user1", &summarySchemaVersion).Return(nil, nil)
+			},
+			args: GetSummaryArgs{UserID: "user1", StartDate: "2023-04-02T00:00:00Z", EndDate: "2023-04-01T00:00:00Z"},
+			err:  errorInvalidParameters.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &MockPatientDataRepository{}
+			tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+			tt.given(repository, tideV2Client)
+			p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, repository, false)
+			p.SetSchemaVersion(summarySchemaVersion)
+
+			summary, err := p.GetSummary(testCtx, tt.args)
+
+			if tt.err != "" {
+				assert.NotNil(t, err)
+				assert.Equal(t, tt.err, err.Code)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, summary)
+			repository.AssertExpectations(t)
+		})
+	}
+}
+
+func summaryCbgBuckets(values ...float64) []tideV2Schema.CbgBucket {
+	samples := make([]tideV2Schema.CbgSample, 0, len(values))
+	for i, value := range values {
+		samples = append(samples, tideV2Schema.CbgSample{
+			Value:     value,
+			Units:     MmolL,
+			Timestamp: summaryDay.Add(time.Duration(i) * 5 * time.Minute),
+			Timezone:  "UTC",
+		})
+	}
+	return []tideV2Schema.CbgBucket{{Id: "cbg1", Day: summaryDay, Samples: samples}}
+}
+
+func summarySettings(hypoLimit string, hyperLimit string, unit string) *tideV2Schema.SettingsResult {
+	settings := &tideV2Schema.SettingsResult{}
+	settings.CurrentSettings.Parameters = []orcaSchema.CurrentParameter{
+		{Name: HypoLimitParameter, Value: hypoLimit, Unit: unit},
+		{Name: HyperLimitParameter, Value: hyperLimit, Unit: unit},
+	}
+	return settings
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// syncTokenMargin the sync checkpoints are taken this duration before the request,
+// so the data written during the request, or by a server with a late clock, are not missed
+const syncTokenMargin = time.Minute
+
+// syncToken the content of the opaque sync tokens given to the clients
+type syncToken struct {
+	ModifiedSince string `json:"modifiedSince"`
+}
+
+// NewSyncToken returns the sync token to get the data modified after a request made at requestTime
+func NewSyncToken(requestTime time.Time) string {
+	jsonToken, _ := json.Marshal(syncToken{ModifiedSince: requestTime.Add(-syncTokenMargin).UTC().Format(cursorTimeFormat)})
+	return base64.RawURLEncoding.EncodeToString(jsonToken)
+}
+
+// DecodeSyncToken returns the modifiedSince time (ISO-8601 datetime) of a token returned by NewSyncToken
+func DecodeSyncToken(value string) (string, error) {
+	var token syncToken
+	jsonToken, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid sync token: %w", err)
+	}
+	if err = json.Unmarshal(jsonToken, &token); err != nil {
+		return "", fmt.Errorf("invalid sync token: %w", err)
+	}
+	if _, err = time.Parse(time.RFC3339Nano, token.ModifiedSince); err != nil {
+		return "", fmt.Errorf("invalid sync token: %s", jsonToken)
+	}
+	return token.ModifiedSince, nil
+}
+
+// parseModifiedSince returns the modifiedSince time of the data arguments, the incremental sync is not paginated
+func parseModifiedSince(args GetDataArgs) (time.Time, error) {
+	if args.Limit > 0 {
+		return time.Time{}, fmt.Errorf("modifiedSince can not be used with limit")
+	}
+	modifiedSince, err := time.Parse(time.RFC3339Nano, args.ModifiedSince)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid modifiedSince: %w", err)
+	}
+	return modifiedSince, nil
+}
+
+// getTombstone returns the tombstone of a deleted (inactive) datum read with a modifiedSince filter,
+// nil when the datum is active. The _active field is removed from the datum.
+func getTombstone(datum map[string]interface{}) map[string]interface{} {
+	active, found := datum["_active"].(bool)
+	if !found {
+		return nil
+	}
+	delete(datum, "_active")
+	if active {
+		return nil
+	}
+	tombstone := map[string]interface{}{"deleted": true}
+	for _, field := range []string{"id", "type", "time", "modifiedTime"} {
+		if value, found := datum[field]; found {
+			tombstone[field] = value
+		}
+	}
+	return tombstone
+}
@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+)
+
+func TestSyncToken(t *testing.T) {
+	requestTime := time.Date(2023, time.April, 1, 12, 0, 0, 0, time.UTC)
+	modifiedSince, err := DecodeSyncToken(NewSyncToken(requestTime))
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-04-01T11:59:00.000Z", modifiedSince)
+
+	for _, invalid := range []string{"invalid", "e30", NewSyncToken(requestTime)[1:]} {
+		_, err = DecodeSyncToken(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGetTombstone(t *testing.T) {
+	datum := map[string]interface{}{"id": "1", "type": "smbg", "time": "2023-04-01T12:00:00.000Z", "value": 5, "_active": true}
+	assert.Nil(t, getTombstone(datum))
+	assert.NotContains(t, datum, "_active")
+	assert.Nil(t, getTombstone(map[string]interface{}{"id": "1", "type": "upload"}))
+
+	datum = map[string]interface{}{"id": "2", "type": "smbg", "time": "2023-04-01T12:00:00.000Z", "value": 5, "_active": false, "modifiedTime": "2023-04-02T00:00:00.000Z"}
+	assert.Equal(t, map[string]interface{}{"id": "2", "type": "smbg", "time": "2023-04-01T12:00:00.000Z", "modifiedTime": "2023-04-02T00:00:00.000Z", "deleted": true}, getTombstone(datum))
+}
+
+func TestPatientData_GetData_modifiedSince(t *testing.T) {
+	userID := "userid_test_modifiedSince"
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return params.ModifiedSince == "2023-04-01T10:00:00.000Z" && params.Date.Start == ""
+	}), mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-03-01T11:00:00.000Z","units":"mmol/L","value":5,"_active":true,"modifiedTime":"2023-04-01T11:00:00.000Z"}`,
+		`{"id":"smbg2","type":"smbg","uploadId":"upload1","time":"2023-03-01T12:00:00.000Z","units":"mmol/L","value":6,"_active":false,"modifiedTime":"2023-04-01T11:30:00.000Z"}`,
+	}), nil)
+	tideV2Client := tidewhisperer.TideWhispererV2MockClient{}
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tideV2Client, &repository, false)
+
+	t.Run("should return the modified data and the tombstones", func(t *testing.T) {
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, GetDataArgs{
+			UserID:           userID,
+			ModifiedSince:    "2023-04-01T10:00:00Z",
+			WithPumpSettings: true,
+			Types:            []string{"smbg", "pumpSettings"},
+			Format:           FormatNDJSON,
+		}, res)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"id":"smbg1","modifiedTime":"2023-04-01T11:00:00.000Z","time":"2023-03-01T11:00:00.000Z","type":"smbg","units":"mmol/L","uploadId":"upload1","value":5}
+{"deleted":true,"id":"smbg2","modifiedTime":"2023-04-01T11:30:00.000Z","time":"2023-03-01T12:00:00.000Z","type":"smbg"}
+`, res.String())
+		// The pump settings are not part of the sync
+		tideV2Client.AssertNotCalled(t, "GetSettings", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should not be paginated", func(t *testing.T) {
+		res := &bytes.Buffer{}
+		_, err := p.GetDataPage(testCtx, GetDataArgs{UserID: userID, ModifiedSince: "2023-04-01T10:00:00Z", Limit: 10}, res)
+		assert.NotNil(t, err)
+		assert.Equal(t, errorInvalidParameters.Code, err.Code)
+	})
+}
@@ -0,0 +1,191 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+)
+
+// International consensus thresholds, in mg/dL
+const (
+	defaultVeryLowThresholdMgdl  float64 = 54
+	defaultVeryHighThresholdMgdl float64 = 250
+)
+
+type (
+	// TimeInRangeThresholds limits of the time in range bands, in the result unit.
+	//
+	// The bands are: very low < VeryLow <= low < Low <= target <= High < high <= VeryHigh < very high
+	TimeInRangeThresholds struct {
+		VeryLow  float64 `json:"veryLow"`
+		Low      float64 `json:"low"`
+		High     float64 `json:"high"`
+		VeryHigh float64 `json:"veryHigh"`
+	}
+	// GetTimeInRangeArgs arguments of GetTimeInRange
+	GetTimeInRangeArgs struct {
+		UserID       string
+		TraceID      string
+		SessionToken string
+		// StartDate & EndDate the window (ISO-8601 datetime), the last Days days by default
+		StartDate string
+		EndDate   string
+		// Days the window duration when StartDate is not set, DefaultSummaryDays by default
+		Days int
+		// BgUnit the unit of the result and of the Thresholds, mg/dL by default
+		BgUnit string
+		// Thresholds overrides the default thresholds, the values set to 0 are not overridden.
+		// Low & High defaults are the patient's hypo & hyper limits
+		Thresholds TimeInRangeThresholds
+	}
+	// TimeInRangeBands % of cbg in each band
+	TimeInRangeBands struct {
+		NumBgValues     int     `json:"numBgValues"`
+		PercentVeryLow  float64 `json:"percentVeryLow"`
+		PercentLow      float64 `json:"percentLow"`
+		PercentTarget   float64 `json:"percentTarget"`
+		PercentHigh     float64 `json:"percentHigh"`
+		PercentVeryHigh float64 `json:"percentVeryHigh"`
+	}
+	// TimeInRangeDay time in range bands of a day
+	TimeInRangeDay struct {
+		// Date the day, in the local time of the samples (YYYY-MM-DD)
+		Date string `json:"date"`
+		TimeInRangeBands
+	}
+	// TimeInRangeResult returned by the tir v1 route
+	TimeInRangeResult struct {
+		UserID     string                `json:"userId"`
+		StartDate  string                `json:"startDate"`
+		EndDate    string                `json:"endDate"`
+		BgUnit     string                `json:"bgUnit"`
+		Thresholds TimeInRangeThresholds `json:"thresholds"`
+		Overall    TimeInRangeBands      `json:"overall"`
+		Days       []TimeInRangeDay      `json:"days"`
+	}
+	// timeInRangeCounter count the cbg in each band
+	timeInRangeCounter struct {
+		total, veryLow, low, target, high, veryHigh int
+	}
+)
+
+// GetTimeInRange compute the % of cbg in the five consensus bands (very low, low, target, high, very high),
+// by day and for the whole window.
+func (p *PatientData) GetTimeInRange(ctx context.Context, args GetTimeInRangeArgs) (*TimeInRangeResult, *common.DetailedError) {
+	common.TimeIt(ctx, "getTimeInRange")
+	defer common.TimeEnd(ctx, "getTimeInRange")
+
+	unit := args.BgUnit
+	if unit != MmolL {
+		unit = MgdL
+	}
+	startTime, endTime, err := getWindow(args.StartDate, args.EndDate, args.Days, DefaultSummaryDays, time.Now())
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetTimeInRange", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+
+	thresholds := args.Thresholds
+	if thresholds.Low == 0 || thresholds.High == 0 {
+		settings, errSettings := p.getCurrentSettings(ctx, args.TraceID, args.UserID, args.SessionToken)
+		if errSettings != nil {
+			return nil, errSettings
+		}
+		hypoLimit, hyperLimit := getGlyLimits(settings, unit)
+		if thresholds.Low == 0 {
+			thresholds.Low = hypoLimit
+		}
+		if thresholds.High == 0 {
+			thresholds.High = hyperLimit
+		}
+	}
+	if thresholds.VeryLow == 0 {
+		thresholds.VeryLow = convertBgValue(defaultVeryLowThresholdMgdl, MgdL, unit)
+	}
+	if thresholds.VeryHigh == 0 {
+		thresholds.VeryHigh = convertBgValue(defaultVeryHighThresholdMgdl, MgdL, unit)
+	}
+	if !(thresholds.VeryLow < thresholds.Low && thresholds.Low < thresholds.High && thresholds.High < thresholds.VeryHigh) {
+		return nil, &common.DetailedError{
+			Status:          errorInvalidParameters.Status,
+			Code:            errorInvalidParameters.Code,
+			Message:         errorInvalidParameters.Message,
+			InternalMessage: addContextToMessage("GetTimeInRange", args.UserID, args.TraceID, fmt.Sprintf("thresholds are not in ascending order: %+v", thresholds)),
+		}
+	}
+
+	values, errValues := p.getCbgValues(ctx, args.TraceID, args.UserID, args.SessionToken, startTime, endTime, unit)
+	if errValues != nil {
+		return nil, errValues
+	}
+
+	result := &TimeInRangeResult{
+		UserID:     args.UserID,
+		StartDate:  startTime.UTC().Format(time.RFC3339Nano),
+		EndDate:    endTime.UTC().Format(time.RFC3339Nano),
+		BgUnit:     unit,
+		Thresholds: thresholds,
+		Days:       make([]TimeInRangeDay, 0),
+	}
+	var overall timeInRangeCounter
+	days := make([]*timeInRangeCounter, 0)
+	dayIndex := make(map[string]int)
+	locations := make(map[string]*time.Location)
+	for _, bg := range values {
+		// A timezone change may bring back a previous day
+		date := toLocalTime(bg.time, bg.timezone, bg.timezoneOffset, locations).Format("2006-01-02")
+		index, found := dayIndex[date]
+		if !found {
+			index = len(days)
+			dayIndex[date] = index
+			days = append(days, &timeInRangeCounter{})
+			result.Days = append(result.Days, TimeInRangeDay{Date: date})
+		}
+		overall.add(bg.value, &thresholds)
+		days[index].add(bg.value, &thresholds)
+	}
+	for i, day := range days {
+		result.Days[i].TimeInRangeBands = day.bands()
+	}
+	result.Overall = overall.bands()
+	return result, nil
+}
+
+func (c *timeInRangeCounter) add(value float64, thresholds *TimeInRangeThresholds) {
+	c.total++
+	switch {
+	case value < thresholds.VeryLow:
+		c.veryLow++
+	case value < thresholds.Low:
+		c.low++
+	case value <= thresholds.High:
+		c.target++
+	case value <= thresholds.VeryHigh:
+		c.high++
+	default:
+		c.veryHigh++
+	}
+}
+
+func (c *timeInRangeCounter) bands() TimeInRangeBands {
+	percent := func(value int) float64 {
+		if c.total == 0 {
+			return 0
+		}
+		return roundTo(float64(value)*100/float64(c.total), 1)
+	}
+	return TimeInRangeBands{
+		NumBgValues:     c.total,
+		PercentVeryLow:  percent(c.veryLow),
+		PercentLow:      percent(c.low),
+		PercentTarget:   percent(c.target),
+		PercentHigh:     percent(c.high),
+		PercentVeryHigh: percent(c.veryHigh),
+	}
+}
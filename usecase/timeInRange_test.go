@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	tideV2Schema "github.com/mdblp/tide-whisperer-v2/v2/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPatientData_GetTimeInRange(t *testing.T) {
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	cbgBucket := func(bucketDay time.Time, values ...float64) tideV2Schema.CbgBucket {
+		bucket := tideV2Schema.CbgBucket{Id: bucketDay.Format("2006-01-02"), Day: bucketDay}
+		for i, value := range values {
+			bucket.Samples = append(bucket.Samples, tideV2Schema.CbgSample{
+				Value:     value,
+				Units:     MgdL,
+				Timestamp: bucketDay.Add(time.Duration(i) * 5 * time.Minute),
+				Timezone:  "UTC",
+			})
+		}
+		return bucket
+	}
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.MockedCbg = []tideV2Schema.CbgBucket{
+		// very low, low, target, target (limit), high (limit), very high
+		cbgBucket(day, 40, 60, 100, 180, 250, 300),
+		cbgBucket(day.AddDate(0, 0, 1), 100, 200),
+	}
+	tideV2Client.On("GetSettings", mock.Anything, "user1", mock.Anything).Return(summarySettings("70", "180", MgdL), nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &MockPatientDataRepository{}, false)
+
+	tir, err := p.GetTimeInRange(testCtx, GetTimeInRangeArgs{
+		UserID:    "user1",
+		StartDate: "2023-04-01T00:00:00Z",
+		EndDate:   "2023-04-03T00:00:00Z",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, TimeInRangeThresholds{VeryLow: 54, Low: 70, High: 180, VeryHigh: 250}, tir.Thresholds)
+	assert.Equal(t, TimeInRangeBands{NumBgValues: 8, PercentVeryLow: 12.5, PercentLow: 12.5, PercentTarget: 37.5, PercentHigh: 25, PercentVeryHigh: 12.5}, tir.Overall)
+	assert.Equal(t, []TimeInRangeDay{
+		{Date: "2023-04-01", TimeInRangeBands: TimeInRangeBands{NumBgValues: 6, PercentVeryLow: 16.7, PercentLow: 16.7, PercentTarget: 33.3, PercentHigh: 16.7, PercentVeryHigh: 16.7}},
+		{Date: "2023-04-02", TimeInRangeBands: TimeInRangeBands{NumBgValues: 2, PercentTarget: 50, PercentHigh: 50}},
+	}, tir.Days)
+
+	// Thresholds in mmol/L, no need of the pump settings
+	tir, err = p.GetTimeInRange(testCtx, GetTimeInRangeArgs{
+		UserID:     "user1",
+		StartDate:  "2023-04-01T00:00:00Z",
+		EndDate:    "2023-04-02T00:00:00Z",
+		BgUnit:     MmolL,
+		Thresholds: TimeInRangeThresholds{Low: 5, High: 9},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, TimeInRangeThresholds{VeryLow: 3, Low: 5, High: 9, VeryHigh: 13.9}, tir.Thresholds)
+	assert.Equal(t, TimeInRangeBands{NumBgValues: 6, PercentVeryLow: 16.7, PercentLow: 16.7, PercentTarget: 16.7, PercentHigh: 33.3, PercentVeryHigh: 16.7}, tir.Overall)
+	tideV2Client.AssertNumberOfCalls(t, "GetSettings", 1)
+
+	_, err = p.GetTimeInRange(testCtx, GetTimeInRangeArgs{UserID: "user1", Thresholds: TimeInRangeThresholds{Low: 10, High: 5}})
+	assert.NotNil(t, err)
+	assert.Equal(t, errorInvalidParameters.Code, err.Code)
+}
@@ -0,0 +1,239 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bgFields the blood glucose fields of a datum type, converted together to the requested unit
+type bgFields struct {
+	// unitsPath the path of the field holding the unit of the values
+	unitsPath string
+	// paths of the values: dot separated field names, "[]" after a name for each element of an array,
+	// "*" for each field of an object (e.g. the schedules of the pump settings)
+	paths []string
+}
+
+// bgDatumFields the blood glucose fields of each datum type, by type or "type/subType".
+// The ranges & insulin sensitivities are converted like the values: the conversion is linear.
+// Not converted: the ketones (mmol/L, but not glucose) and the rates of change of the CGM alerts (mg/dL/min).
+var bgDatumFields = map[string]bgFields{
+	"cbg":  {unitsPath: "units", paths: []string{"value"}},
+	"smbg": {unitsPath: "units", paths: []string{"value"}},
+	"wizard": {unitsPath: "units", paths: []string{
+		"bgInput",
+		"bgTarget.target", "bgTarget.low", "bgTarget.high", "bgTarget.range",
+		"insulinSensitivity",
+	}},
+	"deviceEvent/calibration":     {unitsPath: "units", paths: []string{"value"}},
+	"deviceEvent/deviceParameter": {unitsPath: "units", paths: []string{"value", "previousValue"}},
+	"cgmSettings":                 {unitsPath: "units", paths: []string{"highAlerts.level", "lowAlerts.level"}},
+	"pumpSettings": {unitsPath: "units.bg", paths: []string{
+		"bgTarget[].target", "bgTarget[].low", "bgTarget[].high", "bgTarget[].range",
+		"bgTargets.*[].target", "bgTargets.*[].low", "bgTargets.*[].high", "bgTargets.*[].range",
+		"insulinSensitivity[].amount",
+		"insulinSensitivities.*[].amount",
+	}},
+}
+
+func isConvertibleUnit(unit string) bool {
+	return unit == MgdL || unit == MmolL
+}
+
+func convertToMgdl(value float64) float64 {
+	return math.Round(value * MmolLToMgdLConversionFactor)
+}
+
+func convertToMmol(value float64) float64 {
+	roundedValue := math.Round(value / MmolLToMgdLConversionFactor * MmolLToMgdLPrecisionFactor)
+	floatValue := roundedValue / MmolLToMgdLPrecisionFactor
+	return floatValue
+}
+
+// convertBgValue convert a blood glucose value from its unit to the requested one
+func convertBgValue(value float64, valueUnit string, unit string) float64 {
+	if valueUnit == unit || !isConvertibleUnit(valueUnit) || !isConvertibleUnit(unit) {
+		return value
+	}
+	if unit == MgdL {
+		return convertToMgdl(value)
+	}
+	return convertToMmol(value)
+}
+
+// convertParameterValue convert the value of a blood glucose parameter to bgUnit,
+// the other parameters are unchanged
+func convertParameterValue(value string, unit string, bgUnit string) (string, string) {
+	if unit == bgUnit || !isConvertibleUnit(unit) || !isConvertibleUnit(bgUnit) {
+		return value, unit
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value, unit
+	}
+	return fmt.Sprintf("%g", convertBgValue(number, unit, bgUnit)), bgUnit
+}
+
+// convertCurrentParameters returns a copy of the parameters with the blood glucose values in bgUnit
+func convertCurrentParameters(parameters []orcaSchema.CurrentParameter, bgUnit string) []orcaSchema.CurrentParameter {
+	if parameters == nil || !isConvertibleUnit(bgUnit) {
+		return parameters
+	}
+	converted := make([]orcaSchema.CurrentParameter, len(parameters))
+	for i, parameter := range parameters {
+		parameter.Value, parameter.Unit = convertParameterValue(parameter.Value, parameter.Unit, bgUnit)
+		converted[i] = parameter
+	}
+	return converted
+}
+
+// convertHistoryParameters returns a copy of the parameter changes with the blood glucose values
+// and previous values in bgUnit
+func convertHistoryParameters(parameters []orcaSchema.HistoryParameter, bgUnit string) []orcaSchema.HistoryParameter {
+	if parameters == nil || !isConvertibleUnit(bgUnit) {
+		return parameters
+	}
+	converted := make([]orcaSchema.HistoryParameter, len(parameters))
+	for i, parameter := range parameters {
+		parameter.Value, parameter.Unit = convertParameterValue(parameter.Value, parameter.Unit, bgUnit)
+		if parameter.PreviousValue != "" {
+			parameter.PreviousValue, parameter.PreviousUnit = convertParameterValue(parameter.PreviousValue, parameter.PreviousUnit, bgUnit)
+		}
+		converted[i] = parameter
+	}
+	return converted
+}
+
+// convertDatumUnits convert the blood glucose fields of a datum to bgUnit, see bgDatumFields.
+// The datum is unchanged when its unit is missing or not a blood glucose one.
+func convertDatumUnits(datum map[string]interface{}, bgUnit string) {
+	if !isConvertibleUnit(bgUnit) {
+		return
+	}
+	datumType, _ := datum["type"].(string)
+	fields, found := bgDatumFields[datumType]
+	if subType, haveSubType := datum["subType"].(string); haveSubType {
+		if subTypeFields, foundSubType := bgDatumFields[datumType+"/"+subType]; foundSubType {
+			fields, found = subTypeFields, true
+		}
+	}
+	if !found {
+		return
+	}
+	unitsPath := strings.Split(fields.unitsPath, ".")
+	unitsParent := getBgObject(datum, unitsPath[:len(unitsPath)-1])
+	if unitsParent == nil {
+		return
+	}
+	unit, _ := unitsParent[unitsPath[len(unitsPath)-1]].(string)
+	if unit == bgUnit || !isConvertibleUnit(unit) {
+		return
+	}
+	for _, path := range fields.paths {
+		convertBgField(datum, strings.Split(path, "."), unit, bgUnit)
+	}
+	unitsParent[unitsPath[len(unitsPath)-1]] = bgUnit
+}
+
+// convertBgField convert the values at path in node, from unit to bgUnit
+func convertBgField(node interface{}, path []string, unit string, bgUnit string) {
+	object := asBgObject(node)
+	if object == nil || len(path) == 0 {
+		return
+	}
+	name := strings.TrimSuffix(path[0], "[]")
+	isArray := name != path[0]
+	var names []string
+	if name == "*" {
+		for key := range object {
+			names = append(names, key)
+		}
+	} else {
+		names = []string{name}
+	}
+	for _, key := range names {
+		value, found := object[key]
+		if !found {
+			continue
+		}
+		if !isArray {
+			if len(path) == 1 {
+				object[key] = convertBgNumber(value, unit, bgUnit)
+			} else {
+				convertBgField(value, path[1:], unit, bgUnit)
+			}
+			continue
+		}
+		items := asBgArray(value)
+		for i, item := range items {
+			if len(path) == 1 {
+				items[i] = convertBgNumber(item, unit, bgUnit)
+			} else {
+				convertBgField(item, path[1:], unit, bgUnit)
+			}
+		}
+	}
+}
+
+// convertBgNumber convert a number, or a number stored as a string, from unit to bgUnit.
+// The other values are unchanged.
+func convertBgNumber(value interface{}, unit string, bgUnit string) interface{} {
+	switch number := value.(type) {
+	case float64:
+		return convertBgValue(number, unit, bgUnit)
+	case float32:
+		return convertBgValue(float64(number), unit, bgUnit)
+	case int:
+		return convertBgValue(float64(number), unit, bgUnit)
+	case int32:
+		return convertBgValue(float64(number), unit, bgUnit)
+	case int64:
+		return convertBgValue(float64(number), unit, bgUnit)
+	case string:
+		converted, _ := convertParameterValue(number, unit, bgUnit)
+		return converted
+	default:
+		return value
+	}
+}
+
+// getBgObject returns the object at path in datum, nil when there is none
+func getBgObject(datum map[string]interface{}, path []string) map[string]interface{} {
+	object := datum
+	for _, name := range path {
+		if object = asBgObject(object[name]); object == nil {
+			return nil
+		}
+	}
+	return object
+}
+
+// asBgObject returns the value as a map, nil when it is not an object.
+// The nested objects of the stored data are decoded as maps or bson documents.
+func asBgObject(value interface{}) map[string]interface{} {
+	switch object := value.(type) {
+	case map[string]interface{}:
+		return object
+	case primitive.M:
+		return object
+	default:
+		return nil
+	}
+}
+
+// asBgArray returns the value as a slice sharing its elements, nil when it is not an array
+func asBgArray(value interface{}) []interface{} {
+	switch array := value.(type) {
+	case []interface{}:
+		return array
+	case primitive.A:
+		return array
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,254 @@
+package usecase
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	orcaSchema "github.com/mdblp/orca/schema"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_convertToMgdl(t *testing.T) {
+	tests := []struct {
+		name  string
+		given float64
+		want  float64
+	}{
+		{"should handle positive value", 10, 180},
+		{"should handle 0 value mmol", 0, 0},
+		{"should handle positive value with decimal", 2.5, 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertToMgdl(tt.given)
+			assert.Equalf(t, tt.want, got, "convertToMgdl(%v)", tt.given)
+		})
+	}
+}
+
+func TestIsConvertibleUnit(t *testing.T) {
+	tests := []struct {
+		name     string
+		given    string
+		expected bool
+	}{
+		{"Valid Unit - mg/dL", MgdL, true},
+		{"Valid Unit - mmol/L", MmolL, true},
+		{"Invalid Unit - g/L", "g/L", false},
+		{"Empty Unit", "", false},
+		{"Random String", "random", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := isConvertibleUnit(tt.given)
+			if result != tt.expected {
+				t.Errorf("isConvertibleUnit(%q) = %v, expected %v", tt.given, result, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_convertToMmol(t *testing.T) {
+	tests := []struct {
+		name  string
+		given float64
+		want  float64
+	}{
+		{"should handle 0 value", 0, 0},
+		{"should handle positive value", 180, 10},
+		{"should handle positive value with decimal", 45.1, 2.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertToMmol(tt.given)
+			assert.Equalf(t, tt.want, got, "convertToMmol(%v)", tt.given)
+		})
+	}
+}
+
+// Reference values: 1 mmol/L = 18.01577 mg/dL, mg/dL rounded to the unit and mmol/L to the tenth
+func TestConvertBgValue(t *testing.T) {
+	tests := []struct {
+		value     float64
+		valueUnit string
+		unit      string
+		expected  float64
+	}{
+		{1, MmolL, MgdL, 18},
+		{3, MmolL, MgdL, 54},
+		{3.9, MmolL, MgdL, 70},
+		{5.5, MmolL, MgdL, 99},
+		{10, MmolL, MgdL, 180},
+		{13.9, MmolL, MgdL, 250},
+		{16.7, MmolL, MgdL, 301},
+		{22.2, MmolL, MgdL, 400},
+		{54, MgdL, MmolL, 3},
+		{70, MgdL, MmolL, 3.9},
+		{100, MgdL, MmolL, 5.6},
+		{180, MgdL, MmolL, 10},
+		{250, MgdL, MmolL, 13.9},
+		{400, MgdL, MmolL, 22.2},
+		{5.5, MmolL, MmolL, 5.5},
+		{5.5, "g/L", MgdL, 5.5},
+		{5.5, MmolL, "", 5.5},
+	}
+	for _, tt := range tests {
+		assert.Equalf(t, tt.expected, convertBgValue(tt.value, tt.valueUnit, tt.unit), "convertBgValue(%v, %s, %s)", tt.value, tt.valueUnit, tt.unit)
+	}
+}
+
+func TestConvertDatumUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		bgUnit   string
+		datum    string
+		expected string
+	}{
+		{
+			"smbg",
+			MgdL,
+			`{"type":"smbg","units":"mmol/L","value":5.5}`,
+			`{"type":"smbg","units":"mg/dL","value":99}`,
+		},
+		{
+			"cbg",
+			MmolL,
+			`{"type":"cbg","units":"mg/dL","value":180}`,
+			`{"type":"cbg","units":"mmol/L","value":10}`,
+		},
+		{
+			"wizard",
+			MgdL,
+			`{"type":"wizard","units":"mmol/L","bgInput":7.2,"bgTarget":{"low":5,"high":7,"target":6,"range":1},"insulinSensitivity":2.8,"carbInput":45}`,
+			`{"type":"wizard","units":"mg/dL","bgInput":130,"bgTarget":{"low":90,"high":126,"target":108,"range":18},"insulinSensitivity":50,"carbInput":45}`,
+		},
+		{
+			"wizard without glucose fields",
+			MmolL,
+			`{"type":"wizard","units":"mg/dL","carbInput":45}`,
+			`{"type":"wizard","units":"mmol/L","carbInput":45}`,
+		},
+		{
+			"calibration",
+			MmolL,
+			`{"type":"deviceEvent","subType":"calibration","units":"mg/dL","value":100}`,
+			`{"type":"deviceEvent","subType":"calibration","units":"mmol/L","value":5.6}`,
+		},
+		{
+			"blood glucose device parameter",
+			MmolL,
+			`{"type":"deviceEvent","subType":"deviceParameter","name":"PATIENT_GLY_HYPO_LIMIT","units":"mg/dL","value":"70","previousValue":"80"}`,
+			`{"type":"deviceEvent","subType":"deviceParameter","name":"PATIENT_GLY_HYPO_LIMIT","units":"mmol/L","value":"3.9","previousValue":"4.4"}`,
+		},
+		{
+			"other device parameter",
+			MmolL,
+			`{"type":"deviceEvent","subType":"deviceParameter","name":"WEIGHT","units":"kg","value":"70"}`,
+			`{"type":"deviceEvent","subType":"deviceParameter","name":"WEIGHT","units":"kg","value":"70"}`,
+		},
+		{
+			"other device event",
+			MmolL,
+			`{"type":"deviceEvent","subType":"reservoirChange","units":"mg/dL","value":100}`,
+			`{"type":"deviceEvent","subType":"reservoirChange","units":"mg/dL","value":100}`,
+		},
+		{
+			"cgm settings",
+			MmolL,
+			`{"type":"cgmSettings","units":"mg/dL","highAlerts":{"enabled":true,"level":250},"lowAlerts":{"enabled":true,"level":70}}`,
+			`{"type":"cgmSettings","units":"mmol/L","highAlerts":{"enabled":true,"level":13.9},"lowAlerts":{"enabled":true,"level":3.9}}`,
+		},
+		{
+			"pump settings",
+			MgdL,
+			`{"type":"pumpSettings","units":{"bg":"mmol/L","carb":"grams"},"bgTarget":[{"start":0,"low":5,"high":7}],"bgTargets":{"Normal":[{"start":0,"target":6}]},"insulinSensitivity":[{"start":0,"amount":2.8}],"insulinSensitivities":{"Normal":[{"start":0,"amount":2.8}]},"carbRatio":[{"start":0,"amount":10}]}`,
+			`{"type":"pumpSettings","units":{"bg":"mg/dL","carb":"grams"},"bgTarget":[{"start":0,"low":90,"high":126}],"bgTargets":{"Normal":[{"start":0,"target":108}]},"insulinSensitivity":[{"start":0,"amount":50}],"insulinSensitivities":{"Normal":[{"start":0,"amount":50}]},"carbRatio":[{"start":0,"amount":10}]}`,
+		},
+		{
+			"ketones are not glucose",
+			MgdL,
+			`{"type":"bloodKetone","units":"mmol/L","value":0.5}`,
+			`{"type":"bloodKetone","units":"mmol/L","value":0.5}`,
+		},
+		{
+			"same unit",
+			MmolL,
+			`{"type":"smbg","units":"mmol/L","value":5.5}`,
+			`{"type":"smbg","units":"mmol/L","value":5.5}`,
+		},
+		{
+			"no unit",
+			MgdL,
+			`{"type":"smbg","value":5.5}`,
+			`{"type":"smbg","value":5.5}`,
+		},
+		{
+			"no requested unit",
+			"",
+			`{"type":"smbg","units":"mmol/L","value":5.5}`,
+			`{"type":"smbg","units":"mmol/L","value":5.5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var datum, expected map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(tt.datum), &datum))
+			assert.NoError(t, json.Unmarshal([]byte(tt.expected), &expected))
+			convertDatumUnits(datum, tt.bgUnit)
+			assert.Equal(t, expected, datum)
+		})
+	}
+
+	t.Run("should convert the stored data types", func(t *testing.T) {
+		datum := map[string]interface{}{
+			"type":     "pumpSettings",
+			"units":    primitive.M{"bg": MgdL},
+			"bgTarget": primitive.A{primitive.M{"low": int32(70), "high": int64(180)}},
+		}
+		convertDatumUnits(datum, MmolL)
+		assert.Equal(t, map[string]interface{}{
+			"type":     "pumpSettings",
+			"units":    primitive.M{"bg": MmolL},
+			"bgTarget": primitive.A{primitive.M{"low": 3.9, "high": 10.0}},
+		}, datum)
+	})
+}
+
+func TestConvertSettingsParameters(t *testing.T) {
+	changeTime := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	current := []orcaSchema.CurrentParameter{
+		{Name: "PATIENT_GLY_HYPER_LIMIT", Value: "180", Unit: MgdL, Level: 1},
+		{Name: "WEIGHT", Value: "70", Unit: "kg", Level: 1},
+	}
+	history := []orcaSchema.HistoryParameter{
+		{
+			CurrentParameter: orcaSchema.CurrentParameter{Name: "PATIENT_GLY_HYPO_LIMIT", Value: "3.9", Unit: MmolL, Level: 1},
+			PreviousValue:    "80",
+			PreviousUnit:     MgdL,
+			Timestamp:        changeTime,
+		},
+	}
+
+	convertedCurrent := convertCurrentParameters(current, MmolL)
+	assert.Equal(t, []orcaSchema.CurrentParameter{
+		{Name: "PATIENT_GLY_HYPER_LIMIT", Value: "10", Unit: MmolL, Level: 1},
+		{Name: "WEIGHT", Value: "70", Unit: "kg", Level: 1},
+	}, convertedCurrent)
+	convertedHistory := convertHistoryParameters(history, MmolL)
+	assert.Equal(t, "3.9", convertedHistory[0].Value)
+	assert.Equal(t, "4.4", convertedHistory[0].PreviousValue)
+	assert.Equal(t, MmolL, convertedHistory[0].PreviousUnit)
+	convertedHistory = convertHistoryParameters(history, MgdL)
+	assert.Equal(t, "70", convertedHistory[0].Value)
+	assert.Equal(t, MgdL, convertedHistory[0].Unit)
+	assert.Equal(t, "80", convertedHistory[0].PreviousValue)
+	// The settings are not modified
+	assert.Equal(t, "180", current[0].Value)
+	assert.Equal(t, "3.9", history[0].Value)
+	assert.Equal(t, "80", history[0].PreviousValue)
+	assert.Equal(t, current, convertCurrentParameters(current, ""))
+}
@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+type (
+	// GetUploadsArgs arguments of GetUploads
+	GetUploadsArgs struct {
+		UserID  string
+		TraceID string
+	}
+	// Upload an upload (data set), created by a device sync
+	Upload struct {
+		UploadID            string   `json:"uploadId"`
+		Time                string   `json:"time,omitempty"`
+		Timezone            string   `json:"timezone,omitempty"`
+		DeviceID            string   `json:"deviceId,omitempty"`
+		DeviceModel         string   `json:"deviceModel,omitempty"`
+		DeviceManufacturers []string `json:"deviceManufacturers,omitempty"`
+		DeviceSerialNumber  string   `json:"deviceSerialNumber,omitempty"`
+		DataSetType         string   `json:"dataSetType,omitempty"`
+		// StartDate & EndDate the time range of the upload data, empty when it has none
+		StartDate string `json:"startDate,omitempty"`
+		EndDate   string `json:"endDate,omitempty"`
+		// NumData the number of data of the upload, the upload datum excluded
+		NumData int `json:"numData"`
+		// DataCounts the number of data by type
+		DataCounts map[string]int `json:"dataCounts"`
+	}
+	// GetDataInUploadArgs arguments of GetDataInUpload
+	GetDataInUploadArgs struct {
+		UserID   string
+		TraceID  string
+		UploadID string
+		// AllSchemaVersions return the data of all the schema versions instead of the configured range
+		AllSchemaVersions bool
+		// BgUnit the unit of the blood glucose values, as they are in database by default
+		BgUnit string
+		// Format the output format, FormatJSON (default) or FormatNDJSON
+		Format string
+	}
+)
+
+// GetUploads returns the uploads of a patient, the newest first, with the number of data they contain.
+//
+// The data which upload datum is missing are reported as uploads with only their upload ID, after the others.
+func (p *PatientData) GetUploads(ctx context.Context, args GetUploadsArgs) ([]Upload, *common.DetailedError) {
+	common.TimeIt(ctx, "getUploads")
+	defer common.TimeEnd(ctx, "getUploads")
+
+	dbUploads, err := p.patientDataRepository.GetUploads(ctx, args.TraceID, args.UserID)
+	if err == nil {
+		var counts []schema.DbUploadTypeCount
+		if counts, err = p.patientDataRepository.GetUploadsDataCount(ctx, args.TraceID, args.UserID); err == nil {
+			return buildUploads(dbUploads, counts), nil
+		}
+	}
+	return nil, &common.DetailedError{
+		Status:          errorRunningQuery.Status,
+		Code:            errorRunningQuery.Code,
+		Message:         errorRunningQuery.Message,
+		InternalMessage: addContextToMessage("GetUploads", args.UserID, args.TraceID, err.Error()),
+	}
+}
+
+// buildUploads merge the upload datums with the data counts
+func buildUploads(dbUploads []schema.DbUpload, counts []schema.DbUploadTypeCount) []Upload {
+	uploads := make([]Upload, 0, len(dbUploads))
+	uploadIndex := make(map[string]int, len(dbUploads))
+	for _, dbUpload := range dbUploads {
+		uploadIndex[dbUpload.UploadID] = len(uploads)
+		uploads = append(uploads, Upload{
+			UploadID:            dbUpload.UploadID,
+			Time:                dbUpload.Time,
+			Timezone:            dbUpload.Timezone,
+			DeviceID:            dbUpload.DeviceID,
+			DeviceModel:         dbUpload.DeviceModel,
+			DeviceManufacturers: dbUpload.DeviceManufacturers,
+			DeviceSerialNumber:  dbUpload.DeviceSerialNumber,
+			DataSetType:         dbUpload.DataSetType,
+			DataCounts:          make(map[string]int),
+		})
+	}
+
+	numUploads := len(uploads)
+	for _, count := range counts {
+		index, found := uploadIndex[count.UploadID]
+		if !found {
+			index = len(uploads)
+			uploadIndex[count.UploadID] = index
+			uploads = append(uploads, Upload{UploadID: count.UploadID, DataCounts: make(map[string]int)})
+		}
+		upload := &uploads[index]
+		upload.DataCounts[count.Type] += count.Count
+		upload.NumData += count.Count
+		if upload.StartDate == "" || count.Start < upload.StartDate {
+			upload.StartDate = count.Start
+		}
+		if count.End > upload.EndDate {
+			upload.EndDate = count.End
+		}
+	}
+	orphans := uploads[numUploads:]
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].UploadID < orphans[j].UploadID
+	})
+	return uploads
+}
+
+// GetDataInUpload write the data of one upload of a patient, the upload datum included, in time order,
+// as a JSON array (or one JSON datum per line with FormatNDJSON) to res.
+func (p *PatientData) GetDataInUpload(ctx context.Context, args GetDataInUploadArgs, res io.Writer) *common.DetailedError {
+	common.TimeIt(ctx, "getDataInUpload")
+	defer common.TimeEnd(ctx, "getDataInUpload")
+
+	params := &common.Params{
+		UserID:        args.UserID,
+		UploadID:      args.UploadID,
+		SchemaVersion: p.getSchemaVersion(args.AllSchemaVersions),
+		// All the data of the upload, whatever their source
+		Carelink: true,
+	}
+	iter, err := p.patientDataRepository.GetDataInUpload(ctx, args.TraceID, params)
+	if err != nil {
+		return &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("GetDataInUpload", args.UserID, args.TraceID, err.Error()),
+		}
+	}
+	defer iter.Close(ctx)
+
+	writer := &writeFromIter{
+		iter:            iter,
+		format:          args.Format,
+		uploadIDs:       make([]string, 0, 1),
+		parameterLevels: p.defaultParameterLevels(),
+		// The upload datum is part of the data
+		skipUploads: true,
+	}
+	if err := writer.writeStart(res); err != nil {
+		return newWriteError(err)
+	}
+	if err := writeFromIterV1(ctx, res, args.BgUnit, writer); err != nil {
+		return endArrayOnError(res, writer, err)
+	}
+	if writer.decode.firstError != nil {
+		p.logger.Printf("{%s} - {nErrors:%d,MongoDecode:\"%s\"}", args.TraceID, writer.decode.numErrors, writer.decode.firstError)
+	}
+	if writer.jsonError.firstError != nil {
+		p.logger.Printf("{%s} - {nErrors:%d,jsonMarshall:\"%s\"}", args.TraceID, writer.jsonError.numErrors, writer.jsonError.firstError)
+	}
+	if err := writer.writeEnd(res); err != nil {
+		return newWriteError(err)
+	}
+	return nil
+}
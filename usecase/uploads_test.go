@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+func TestPatientData_GetUploads(t *testing.T) {
+	t.Run("should merge the uploads with their data counts", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return([]schema.DbUpload{
+			{UploadID: "up2", Time: "2023-04-02T00:00:00Z", DeviceModel: "Dexcom G6", DeviceSerialNumber: "1234", DeviceManufacturers: []string{"Dexcom"}},
+			{UploadID: "up1", Time: "2023-04-01T00:00:00Z", DeviceModel: "Kaleido"},
+		}, nil)
+		repository.On("GetUploadsDataCount", mock.Anything, mock.Anything, "user1").Return([]schema.DbUploadTypeCount{
+			{UploadID: "up2", Type: "cbg", Count: 10, Start: "2023-04-01T10:00:00Z", End: "2023-04-01T20:00:00Z"},
+			{UploadID: "up2", Type: "smbg", Count: 2, Start: "2023-04-01T08:00:00Z", End: "2023-04-01T12:00:00Z"},
+			{UploadID: "up3", Type: "bolus", Count: 1, Start: "2023-03-01T08:00:00Z", End: "2023-03-01T08:00:00Z"},
+			{UploadID: "lost", Type: "basal", Count: 3, Start: "2023-03-01T08:00:00Z", End: "2023-03-01T09:00:00Z"},
+		}, nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		uploads, err := p.GetUploads(testCtx, GetUploadsArgs{UserID: "user1"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Upload{
+			{
+				UploadID: "up2", Time: "2023-04-02T00:00:00Z", DeviceModel: "Dexcom G6", DeviceSerialNumber: "1234", DeviceManufacturers: []string{"Dexcom"},
+				StartDate: "2023-04-01T08:00:00Z", EndDate: "2023-04-01T20:00:00Z", NumData: 12, DataCounts: map[string]int{"cbg": 10, "smbg": 2},
+			},
+			{UploadID: "up1", Time: "2023-04-01T00:00:00Z", DeviceModel: "Kaleido", DataCounts: map[string]int{}},
+			{UploadID: "lost", StartDate: "2023-03-01T08:00:00Z", EndDate: "2023-03-01T09:00:00Z", NumData: 3, DataCounts: map[string]int{"basal": 3}},
+			{UploadID: "up3", StartDate: "2023-03-01T08:00:00Z", EndDate: "2023-03-01T08:00:00Z", NumData: 1, DataCounts: map[string]int{"bolus": 1}},
+		}, uploads)
+	})
+
+	t.Run("should return an error when the counts fail", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetUploads", mock.Anything, mock.Anything, "user1").Return([]schema.DbUpload{}, nil)
+		repository.On("GetUploadsDataCount", mock.Anything, mock.Anything, "user1").Return(nil, errors.New("aggregate failed"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+
+		uploads, err := p.GetUploads(testCtx, GetUploadsArgs{UserID: "user1"})
+
+		assert.Nil(t, uploads)
+		assert.Equal(t, http.StatusInternalServerError, err.Status)
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+	})
+}
+
+func TestPatientData_GetDataInUpload(t *testing.T) {
+	schemaVersion := common.SchemaVersion{Minimum: 1, Maximum: 2}
+
+	t.Run("should write the data of the upload", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInUpload", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+			return params.UserID == "user1" && params.UploadID == "up1" &&
+				assert.ObjectsAreEqual(&schemaVersion, params.SchemaVersion)
+		})).Return(infrastructure.NewMockDbAdapterIterator([]string{
+			`{"id":"up1","type":"upload","uploadId":"up1","time":"2023-04-01T00:00:00Z","deviceModel":"Kaleido"}`,
+			`{"id":"smbg1","type":"smbg","uploadId":"up1","time":"2023-04-01T08:00:00Z","units":"mg/dL","value":180}`,
+		}), nil)
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+		p.SetSchemaVersion(schemaVersion)
+		buffer := &bytes.Buffer{}
+
+		err := p.GetDataInUpload(testCtx, GetDataInUploadArgs{UserID: "user1", UploadID: "up1", BgUnit: MmolL}, buffer)
+
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[
+			{"id":"up1","type":"upload","uploadId":"up1","time":"2023-04-01T00:00:00Z","deviceModel":"Kaleido"},
+			{"id":"smbg1","type":"smbg","uploadId":"up1","time":"2023-04-01T08:00:00Z","units":"mmol/L","value":10}
+		]`, buffer.String())
+		repository.AssertNotCalled(t, "GetUploadData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return an error when the query fails", func(t *testing.T) {
+		repository := &MockPatientDataRepository{}
+		repository.On("GetDataInUpload", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("query failed"))
+		p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, repository, false)
+		buffer := &bytes.Buffer{}
+
+		err := p.GetDataInUpload(testCtx, GetDataInUploadArgs{UserID: "user1", UploadID: "up1"}, buffer)
+
+		assert.Equal(t, errorRunningQuery.Code, err.Code)
+		assert.Empty(t, buffer.String())
+	})
+}
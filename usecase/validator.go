@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+// DataValidator the validator of the data of a patient, changing when they are modified
+type DataValidator struct {
+	// ETag the strong validator of the data, without the quotes
+	ETag string
+	// LastModified the newest modification of the data, zero when unknown or when tide-v2 data are returned
+	LastModified time.Time
+}
+
+// dataRangeExcludedTypes the types the data range is not computed from, see PatientDataRepository.GetDataRangeLegacy
+var dataRangeExcludedTypes = []string{"upload", "pumpSettings"}
+
+// GetDataRangeValidator returns the validator of the data range of a patient: the state of the data the range
+// is computed from, in the configured schema version range unless allSchemaVersions is set
+func (p *PatientData) GetDataRangeValidator(ctx context.Context, traceID string, userID string, allSchemaVersions bool) (*DataValidator, *common.DetailedError) {
+	common.TimeIt(ctx, "getDataRangeValidator")
+	defer common.TimeEnd(ctx, "getDataRangeValidator")
+	params := &common.Params{UserID: userID, SchemaVersion: p.getSchemaVersion(allSchemaVersions)}
+	return p.getDataValidator(ctx, traceID, params, dataRangeExcludedTypes, false)
+}
+
+// getDataValidator returns the validator of the data from the database state of the params,
+// see newDataValidator for withTideV2
+func (p *PatientData) getDataValidator(ctx context.Context, traceID string, params *common.Params, excludeTypes []string, withTideV2 bool) (*DataValidator, *common.DetailedError) {
+	state, err := p.patientDataRepository.GetDataState(ctx, traceID, params, excludeTypes)
+	if err != nil {
+		return nil, &common.DetailedError{
+			Status:          errorRunningQuery.Status,
+			Code:            errorRunningQuery.Code,
+			Message:         errorRunningQuery.Message,
+			InternalMessage: addContextToMessage("getDataValidator", params.UserID, traceID, err.Error()),
+		}
+	}
+	validator := newDataValidator(state, withTideV2)
+	return &validator, nil
+}
+
+// newDataValidator returns the validator of the data from their database state.
+//
+// It is known before the tide-v2 buckets & the pump settings are fetched: they are fed by the uploads,
+// part of the state (see GetDataState). Only the database state has a modification time: the times of the
+// bucket samples & of the settings are device times, a late upload (backfill) adds older ones.
+// So the validator has no LastModified when tide-v2 data are returned (withTideV2), only the ETag.
+func newDataValidator(state *schema.DbDataState, withTideV2 bool) DataValidator {
+	digest := sha256.New()
+	var lastModified time.Time
+	if state != nil {
+		fmt.Fprintf(digest, "data:%d:%s\n", state.Count, state.LastModified)
+		lastModified, _ = time.Parse(time.RFC3339Nano, state.LastModified)
+	}
+	if withTideV2 {
+		lastModified = time.Time{}
+	}
+	return DataValidator{
+		ETag:         hex.EncodeToString(digest.Sum(nil)),
+		LastModified: lastModified.UTC(),
+	}
+}
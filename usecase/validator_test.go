@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdblp/tide-whisperer-v2/v2/client/tidewhisperer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidepool-org/tide-whisperer/common"
+	"github.com/tidepool-org/tide-whisperer/infrastructure"
+	"github.com/tidepool-org/tide-whisperer/schema"
+)
+
+func TestNewDataValidator(t *testing.T) {
+	day := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	state := &schema.DbDataState{Count: 2, LastModified: "2023-04-01T10:00:00.000Z"}
+
+	validator := newDataValidator(state, true)
+	assert.NotEmpty(t, validator.ETag)
+	// The sample times are not modification times
+	assert.True(t, validator.LastModified.IsZero())
+	assert.Equal(t, validator, newDataValidator(state, true))
+
+	t.Run("should change when the data change", func(t *testing.T) {
+		modifiedState := &schema.DbDataState{Count: 1, LastModified: "2023-04-01T10:00:00.000Z"}
+		assert.NotEqual(t, validator.ETag, newDataValidator(modifiedState, true).ETag)
+		// A backfill: an upload with older data
+		modifiedState = &schema.DbDataState{Count: 3, LastModified: "2023-04-02T10:00:00.000Z"}
+		assert.NotEqual(t, validator.ETag, newDataValidator(modifiedState, true).ETag)
+	})
+
+	t.Run("should use the database modification time without tide-v2 data", func(t *testing.T) {
+		dbValidator := newDataValidator(state, false)
+		assert.Equal(t, day.Add(10*time.Hour), dbValidator.LastModified)
+		assert.Equal(t, validator.ETag, dbValidator.ETag)
+	})
+}
+
+func TestPatientData_GetData_validate(t *testing.T) {
+	userID := "userid_test_validate"
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{
+		`{"id":"smbg1","type":"smbg","uploadId":"upload1","time":"2023-04-01T11:00:00.000Z","value":5}`,
+	}), nil)
+	repository.On("GetDataState", mock.Anything, mock.Anything, mock.MatchedBy(func(params *common.Params) bool {
+		return params.UserID == userID && params.Date.Start == "2023-04-01T00:00:00Z"
+	}), []string(nil)).Return(&schema.DbDataState{Count: 1, LastModified: "2023-04-01T12:00:00.000Z"}, nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), &tidewhisperer.TideWhispererV2MockClient{}, &repository, false)
+
+	for _, modified := range []bool{false, true} {
+		var validator DataValidator
+		res := &bytes.Buffer{}
+		err := p.GetData(testCtx, GetDataArgs{
+			UserID:    userID,
+			StartDate: "2023-04-01T00:00:00Z",
+			Types:     []string{"smbg"},
+			Format:    FormatNDJSON,
+			Validate: func(dataValidator DataValidator) bool {
+				validator = dataValidator
+				return modified
+			},
+		}, res)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, validator.ETag)
+		assert.Equal(t, time.Date(2023, time.April, 1, 12, 0, 0, 0, time.UTC), validator.LastModified)
+		if modified {
+			assert.NotEmpty(t, res.String())
+		} else {
+			assert.Empty(t, res.String())
+		}
+	}
+}
+
+func TestPatientData_GetData_validateBeforeTideV2(t *testing.T) {
+	userID := "userid_test_validate_v2"
+	repository := MockPatientDataRepository{}
+	repository.On("GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(infrastructure.NewMockDbAdapterIterator([]string{}), nil)
+	repository.On("GetDataState", mock.Anything, mock.Anything, mock.Anything, []string(nil)).Return(&schema.DbDataState{Count: 1, LastModified: "2023-04-01T12:00:00.000Z"}, nil)
+	tideV2Client := &tidewhisperer.TideWhispererV2MockClient{}
+	tideV2Client.On("GetSettings", mock.Anything, userID, mock.Anything).Return(nil, nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), tideV2Client, &repository, false)
+
+	var validator DataValidator
+	err := p.GetData(testCtx, GetDataArgs{
+		UserID:           userID,
+		StartDate:        "2023-04-01T00:00:00Z",
+		WithPumpSettings: true,
+		Format:           FormatNDJSON,
+		Validate: func(dataValidator DataValidator) bool {
+			validator = dataValidator
+			return false
+		},
+	}, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, validator.ETag)
+	assert.True(t, validator.LastModified.IsZero())
+	// The client already has the data: neither the settings nor the data are fetched
+	tideV2Client.AssertNotCalled(t, "GetSettings", mock.Anything, mock.Anything, mock.Anything)
+	repository.AssertNotCalled(t, "GetDataInDeviceData", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatientData_GetDataRangeValidator(t *testing.T) {
+	repository := MockPatientDataRepository{}
+	state := &schema.DbDataState{Count: 3, LastModified: "2023-04-01T12:00:00.000Z"}
+	schemaVersion := &common.SchemaVersion{Minimum: 1, Maximum: 2}
+	repository.On("GetDataState", mock.Anything, mock.Anything, &common.Params{UserID: "user1", SchemaVersion: schemaVersion}, dataRangeExcludedTypes).Return(state, nil)
+	repository.On("GetDataState", mock.Anything, mock.Anything, &common.Params{UserID: "user1"}, dataRangeExcludedTypes).Return(&schema.DbDataState{Count: 4, LastModified: "2023-04-01T12:00:00.000Z"}, nil)
+	p := NewPatientDataUseCase(log.New(&bytes.Buffer{}, "", 0), nil, &repository, false)
+	p.SetSchemaVersion(*schemaVersion)
+
+	validator, err := p.GetDataRangeValidator(testCtx, "trace", "user1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, newDataValidator(state, false), *validator)
+
+	t.Run("should use all the schema versions when requested", func(t *testing.T) {
+		allValidator, err := p.GetDataRangeValidator(testCtx, "trace", "user1", true)
+		assert.Nil(t, err)
+		assert.NotEqual(t, validator.ETag, allValidator.ETag)
+	})
+}